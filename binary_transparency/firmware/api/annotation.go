@@ -32,7 +32,7 @@ type SignedStatement struct {
 	// Statement should be interpreted as.
 	Type StatementType
 	// The serialised Claim in json form.
-	// This is one of MalwareStatement or BuildStatement.
+	// This is one of FirmwareMetadata, MalwareStatement or RevocationStatement.
 	Statement []byte
 
 	// Signature is the bytestream of the signature over (Type || Statement).
@@ -67,7 +67,7 @@ func (s MalwareStatement) String() string {
 // RevocationStatement is an annotation that marks a build as revoked.
 // This statement simply being present for a build marks it as revoked.
 // There is no way to unrevoke something; this can be done by re-releasing it.
-// TODO(mhutchinson): Wire this up in the personality.
+// Revocations are signed by the vendor which published the firmware.
 type RevocationStatement struct {
 	// FirmwareID is the SignedStatement in the log being annotated.
 	FirmwareID FirmwareID
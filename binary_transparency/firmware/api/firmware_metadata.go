@@ -14,13 +14,19 @@
 
 package api
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
 
 // FirmwareMetadata represents a firmware image and related info.
 type FirmwareMetadata struct {
 	////// What's this firmware for? //////
 
-	// TODO(al): consider a vendor/device/publisher model
+	// VendorID identifies the vendor publishing this firmware, and namespaces
+	// the DeviceID so that one log can hold firmware from several vendors.
+	VendorID string `json:",omitempty"`
 
 	// DeviceID specifies the target device for this firmware.
 	DeviceID string
@@ -46,7 +52,42 @@ type FirmwareMetadata struct {
 	BuildTimestamp string
 }
 
+// QualifiedDeviceID returns the DeviceID namespaced by the VendorID.
+func (m FirmwareMetadata) QualifiedDeviceID() string {
+	return QualifiedDeviceID(m.VendorID, m.DeviceID)
+}
+
 // String returns a human-readable representation of the firmware metadata info.
 func (m FirmwareMetadata) String() string {
-	return fmt.Sprintf("%s/v%d built at %s with image hash 0x%x", m.DeviceID, m.FirmwareRevision, m.BuildTimestamp, m.FirmwareImageSHA512)
+	return fmt.Sprintf("%s/v%d built at %s with image hash 0x%x", m.QualifiedDeviceID(), m.FirmwareRevision, m.BuildTimestamp, m.FirmwareImageSHA512)
+}
+
+// QualifiedDeviceID returns the device ID namespaced by the vendor ID as
+// "vendorID/deviceID", or just the deviceID if there is no vendor.
+// This is only unambiguous if neither ID contains a "/", see ValidateIDs.
+func QualifiedDeviceID(vendorID, deviceID string) string {
+	if len(vendorID) == 0 {
+		return deviceID
+	}
+	return vendorID + "/" + deviceID
+}
+
+// ParseQualifiedDeviceID splits a QualifiedDeviceID into its vendor and device IDs.
+func ParseQualifiedDeviceID(id string) (vendorID, deviceID string) {
+	if i := strings.Index(id, "/"); i >= 0 {
+		return id[:i], id[i+1:]
+	}
+	return "", id
+}
+
+// ValidateIDs checks that the vendor and device IDs can be combined into an
+// unambiguous QualifiedDeviceID.
+func (m FirmwareMetadata) ValidateIDs() error {
+	if len(m.DeviceID) == 0 {
+		return errors.New("DeviceID is required")
+	}
+	if strings.Contains(m.VendorID, "/") || strings.Contains(m.DeviceID, "/") {
+		return fmt.Errorf("VendorID %q and DeviceID %q must not contain '/'", m.VendorID, m.DeviceID)
+	}
+	return nil
 }
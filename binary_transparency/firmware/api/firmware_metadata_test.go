@@ -59,3 +59,37 @@ func TestFirmwareMetadataToString(t *testing.T) {
 		})
 	}
 }
+
+func TestQualifiedDeviceID(t *testing.T) {
+	for _, test := range []struct {
+		vendorID, deviceID string
+		want               string
+	}{
+		{deviceID: "dummy", want: "dummy"},
+		{vendorID: "acme", deviceID: "dummy", want: "acme/dummy"},
+	} {
+		t.Run(test.want, func(t *testing.T) {
+			if got := api.QualifiedDeviceID(test.vendorID, test.deviceID); got != test.want {
+				t.Errorf("QualifiedDeviceID() = %q, want %q", got, test.want)
+			}
+			if v, d := api.ParseQualifiedDeviceID(test.want); v != test.vendorID || d != test.deviceID {
+				t.Errorf("ParseQualifiedDeviceID() = %q, %q, want %q, %q", v, d, test.vendorID, test.deviceID)
+			}
+		})
+	}
+}
+
+func TestDeviceReleaseLogHighestRevision(t *testing.T) {
+	for _, test := range []struct {
+		revs []uint64
+		want uint64
+	}{
+		{revs: nil, want: 0},
+		{revs: []uint64{1, 5, 3}, want: 5},
+	} {
+		l := api.DeviceReleaseLog{DeviceID: "dummy", Revisions: test.revs}
+		if got := l.HighestRevision(); got != test.want {
+			t.Errorf("HighestRevision(%v) = %d, want %d", test.revs, got, test.want)
+		}
+	}
+}
@@ -16,36 +16,52 @@ package api
 
 import (
 	"bytes"
+	"encoding/base64"
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/google/trillian-examples/formats/log"
+	"golang.org/x/mod/sumdb/note"
 )
 
 const (
 	// HTTPAddFirmware is the path of the URL to publish a firmware entry.
 	HTTPAddFirmware = "ft/v0/add-firmware"
+	// HTTPAddFirmwareBatch is the path of the URL to publish many firmware entries at once.
+	HTTPAddFirmwareBatch = "ft/v0/add-firmware-batch"
 	// HTTPAddAnnotationMalware is the path of the URL to publish annotations about malware scans.
 	HTTPAddAnnotationMalware = "ft/v0/add-annotation-malware"
+	// HTTPAddAnnotationRevocation is the path of the URL to publish firmware revocations.
+	HTTPAddAnnotationRevocation = "ft/v0/add-annotation-revocation"
 	// HTTPGetConsistency is the path of the URL to get a consistency proof between log roots.
 	HTTPGetConsistency = "ft/v0/get-consistency"
 	// HTTPGetInclusion is the path of the URL to get inclusion proofs for entries in the log.
 	HTTPGetInclusion = "ft/v0/get-inclusion"
 	// HTTPGetManifestEntryAndProof is the path of the URL to get firmware manifest entries with inclusion proofs.
 	HTTPGetManifestEntryAndProof = "ft/v0/get-firmware-manifest-entry-and-proof"
+	// HTTPGetEntries is the path of the URL to get a range of entries, with inclusion proofs, from the log.
+	HTTPGetEntries = "ft/v0/get-entries"
 	// HTTPGetFirmwareImage is the path of the URL for getting firmware images from the CAS.
 	HTTPGetFirmwareImage = "ft/v0/get-firmware-image"
 	// HTTPGetRoot is the path of the URL to get a recent log root.
 	HTTPGetRoot = "ft/v0/get-root"
 
 	// FTLogCheckpointEcosystemv0 is the v0 identifier for FT log checkpoints.
+	// The otherdata of a v0 checkpoint is a single line holding the timestamp.
 	FTLogCheckpointEcosystemv0 = "Firmware Transparency Log v0"
+	// FTLogCheckpointEcosystemv1 is the v1 identifier for FT log checkpoints.
+	// The otherdata of a v1 checkpoint is made of formats/log extension lines.
+	FTLogCheckpointEcosystemv1 = "Firmware Transparency Log v1"
+	// FTInclusionPromiseEcosystemv0 is the v0 identifier for FT log inclusion promises.
+	FTInclusionPromiseEcosystemv0 = "Firmware Transparency Promise v0"
 )
 
 // LogCheckpoint commits to the state of the log.
 // The serialisation format of this checkpoint is compatible with the format
-// specified at github.com/google/trillian-examples/tree/master/formats/log
+// specified at github.com/google/trillian-examples/tree/master/formats/log.
+// How the timestamp is carried in otherdata depends on the Ecosystem.
 type LogCheckpoint struct {
 	log.Checkpoint
 	// The number of nanoseconds since the Unix epoch.
@@ -55,38 +71,187 @@ type LogCheckpoint struct {
 	Envelope []byte
 }
 
+// checkpointRegistry understands the otherdata extensions used by FT log checkpoints.
+var checkpointRegistry = mustRegistry(log.TimestampExtension)
+
+func mustRegistry(types ...log.ExtensionType) *log.Registry {
+	r, err := log.NewRegistry(types...)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
 // String returns a compact printable representation of a LogCheckpoint.
 func (l LogCheckpoint) String() string {
 	return fmt.Sprintf("{size %d @ %d root: 0x%x}", l.Size, l.TimestampNanos, l.Hash)
 }
 
 // Marshal serialises the checkpoint.
-func (l LogCheckpoint) Marshal() []byte {
+func (l LogCheckpoint) Marshal() ([]byte, error) {
+	var od []byte
+	switch l.Ecosystem {
+	case FTLogCheckpointEcosystemv0:
+		od = []byte(fmt.Sprintf("%d\n", l.TimestampNanos))
+	case FTLogCheckpointEcosystemv1:
+		var err error
+		od, err = log.Extensions{log.Timestamp{Time: time.Unix(0, int64(l.TimestampNanos))}}.Marshal()
+		if err != nil {
+			return nil, fmt.Errorf("invalid checkpoint otherdata: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown checkpoint ecosystem %q", l.Ecosystem)
+	}
 	b := bytes.Buffer{}
 	b.Write(l.Checkpoint.Marshal())
-	b.WriteString(fmt.Sprintf("%d\n", l.TimestampNanos))
-	return b.Bytes()
+	b.Write(od)
+	return b.Bytes(), nil
 }
 
 // Unmarshal knows how to deserialise a LogCheckpoint.
+//
+// A v0 checkpoint must have only the bare decimal timestamp as otherdata.
+// A v1 checkpoint must have a log.Timestamp line, and any unknown otherdata
+// lines are ignored.
 func (l *LogCheckpoint) Unmarshal(data []byte) error {
-	const delim = "\n"
 	rest, err := l.Checkpoint.Unmarshal(data)
 	if err != nil {
 		return err
 	}
-	lines := strings.Split(strings.TrimRight(string(rest), delim), delim)
-	if el := len(lines); el != 1 {
-		return fmt.Errorf("expected 1 line of other data, got %d", el)
+	switch l.Ecosystem {
+	case FTLogCheckpointEcosystemv0:
+		const delim = "\n"
+		lines := strings.Split(strings.TrimRight(string(rest), delim), delim)
+		if el := len(lines); el != 1 {
+			return fmt.Errorf("expected 1 line of other data, got %d", el)
+		}
+		ts, err := strconv.ParseUint(lines[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("failed to parse timestamp: %w", err)
+		}
+		l.TimestampNanos = ts
+	case FTLogCheckpointEcosystemv1:
+		exts, err := checkpointRegistry.Parse(rest)
+		if err != nil {
+			return fmt.Errorf("failed to parse otherdata: %w", err)
+		}
+		ts, ok := exts.Find(log.TimestampExtension.Keyword).(log.Timestamp)
+		if !ok {
+			return fmt.Errorf("expected a %s line in otherdata", log.TimestampExtension.Keyword)
+		}
+		l.TimestampNanos = uint64(ts.Time.UnixNano())
+	default:
+		return fmt.Errorf("unknown checkpoint ecosystem %q", l.Ecosystem)
 	}
-	ts, err := strconv.ParseUint(lines[0], 10, 64)
+	return nil
+}
+
+// ParseCheckpoint verifies the log's signature on a checkpoint envelope, and
+// returns the LogCheckpoint it contains.
+func ParseCheckpoint(envelope []byte, logSigVerifier note.Verifier) (*LogCheckpoint, error) {
+	sc, err := log.ParseSignedCheckpoint(envelope, logSigVerifier)
+	if err != nil {
+		return nil, err
+	}
+	cp := &LogCheckpoint{Envelope: envelope}
+	if err := cp.Unmarshal(sc.Body()); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// InclusionPromise is the log's signed promise, returned when a statement is
+// added, that the statement will be included in the log within MaxMergeDelay
+// of TimestampNanos. A log which breaks this promise can be shown to have done
+// so by presenting the signed promise alongside a later checkpoint which does
+// not include the statement.
+//
+// The serialisation format is a note, signed by the log, with the lines:
+//   - FTInclusionPromiseEcosystemv0
+//   - the base64 encoded Merkle leaf hash of the statement
+//   - the number of nanoseconds since the Unix epoch when the statement was accepted
+//   - the maximum merge delay in nanoseconds
+type InclusionPromise struct {
+	// LeafHash is the Merkle leaf hash of the statement.
+	LeafHash []byte
+	// The number of nanoseconds since the Unix epoch.
+	TimestampNanos uint64
+	// MaxMergeDelay is the longest the log may take to include the statement.
+	MaxMergeDelay time.Duration
+
+	// If set, Envelope contains the envelope from which this promise was parsed.
+	Envelope []byte
+}
+
+// Deadline returns the time by which the statement must be included.
+func (p InclusionPromise) Deadline() time.Time {
+	return time.Unix(0, int64(p.TimestampNanos)).Add(p.MaxMergeDelay)
+}
+
+// Marshal serialises the promise.
+func (p InclusionPromise) Marshal() []byte {
+	return []byte(fmt.Sprintf("%s\n%s\n%d\n%d\n", FTInclusionPromiseEcosystemv0, base64.StdEncoding.EncodeToString(p.LeafHash), p.TimestampNanos, p.MaxMergeDelay.Nanoseconds()))
+}
+
+// Unmarshal knows how to deserialise an InclusionPromise.
+func (p *InclusionPromise) Unmarshal(data []byte) error {
+	const delim = "\n"
+	lines := strings.Split(strings.TrimRight(string(data), delim), delim)
+	if el := len(lines); el != 4 {
+		return fmt.Errorf("expected 4 lines, got %d", el)
+	}
+	if got, want := lines[0], FTInclusionPromiseEcosystemv0; got != want {
+		return fmt.Errorf("invalid promise header %q, want %q", got, want)
+	}
+	h, err := base64.StdEncoding.DecodeString(lines[1])
+	if err != nil {
+		return fmt.Errorf("failed to parse leaf hash: %w", err)
+	}
+	ts, err := strconv.ParseUint(lines[2], 10, 64)
 	if err != nil {
 		return fmt.Errorf("failed to parse timestamp: %w", err)
 	}
-	l.TimestampNanos = ts
+	mmd, err := strconv.ParseInt(lines[3], 10, 64)
+	if err != nil {
+		return fmt.Errorf("failed to parse max merge delay: %w", err)
+	}
+	p.LeafHash = h
+	p.TimestampNanos = ts
+	p.MaxMergeDelay = time.Duration(mmd)
 	return nil
 }
 
+// ParseInclusionPromise verifies the log's signature on a promise envelope,
+// and returns the InclusionPromise it contains.
+func ParseInclusionPromise(envelope []byte, logSigVerifier note.Verifier) (*InclusionPromise, error) {
+	n, err := note.Open(envelope, note.VerifierList(logSigVerifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify promise signature: %w", err)
+	}
+	p := &InclusionPromise{Envelope: envelope}
+	if err := p.Unmarshal([]byte(n.Text)); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// AddFirmwareResult is the outcome of adding a single firmware entry in a batch.
+type AddFirmwareResult struct {
+	// Code is the HTTP status code for this entry, which is http.StatusOK if
+	// the entry was logged.
+	Code int
+	// Error describes why the entry wasn't logged, if it wasn't.
+	Error string `json:",omitempty"`
+	// Promise is the log's signed InclusionPromise for the entry, if it was logged.
+	Promise []byte `json:",omitempty"`
+}
+
+// AddFirmwareBatchResponse is returned from a request to add a batch of
+// firmware entries, with a result for each entry in the order submitted.
+type AddFirmwareBatchResponse struct {
+	Results []AddFirmwareResult
+}
+
 // GetConsistencyRequest is sent to ask for a proof that the tree at ToSize
 // is append-only from the tree at FromSize. The response is a ConsistencyProof.
 type GetConsistencyRequest struct {
@@ -119,3 +284,10 @@ type InclusionProof struct {
 func (l InclusionProof) String() string {
 	return fmt.Sprintf("{index %d, value: 0x%x, proof: %x}", l.LeafIndex, l.Value, l.Proof)
 }
+
+// GetEntriesResponse holds consecutive entries from the log, starting at the
+// requested index, each with an inclusion proof to the requested tree size.
+// The log may return fewer entries than were requested.
+type GetEntriesResponse struct {
+	Entries []InclusionProof
+}
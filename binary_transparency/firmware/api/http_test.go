@@ -15,8 +15,11 @@
 package api_test
 
 import (
+	"bytes"
 	"testing"
+	"time"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/google/trillian-examples/binary_transparency/firmware/api"
 	"github.com/google/trillian-examples/formats/log"
 )
@@ -45,3 +48,106 @@ func TestLogCheckpointString(t *testing.T) {
 		}
 	}
 }
+
+func TestLogCheckpointMarshal(t *testing.T) {
+	for _, test := range []struct {
+		ecosystem string
+		want      string
+		wantErr   bool
+	}{
+		{ecosystem: api.FTLogCheckpointEcosystemv0, want: "Firmware Transparency Log v0\n10\nEjQ=\n1230\n"},
+		{ecosystem: api.FTLogCheckpointEcosystemv1, want: "Firmware Transparency Log v1\n10\nEjQ=\nTimestamp 1230\n"},
+		{ecosystem: "Firmware Transparency Log v2", wantErr: true},
+	} {
+		t.Run(test.ecosystem, func(t *testing.T) {
+			cp := api.LogCheckpoint{
+				Checkpoint: log.Checkpoint{
+					Ecosystem: test.ecosystem,
+					Size:      10,
+					Hash:      []byte{0x12, 0x34},
+				},
+				TimestampNanos: 1230,
+			}
+			got, err := cp.Marshal()
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("Marshal() = %v, want err %t", err, test.wantErr)
+			}
+			if string(got) != test.want {
+				t.Errorf("Marshal() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLogCheckpointUnmarshal(t *testing.T) {
+	for _, test := range []struct {
+		desc    string
+		body    string
+		wantErr bool
+	}{
+		{desc: "v0", body: "Firmware Transparency Log v0\n10\nEjQ=\n1230\n"},
+		{desc: "v0 timestamp extension", body: "Firmware Transparency Log v0\n10\nEjQ=\nTimestamp 1230\n", wantErr: true},
+		{desc: "v0 no timestamp", body: "Firmware Transparency Log v0\n10\nEjQ=\n", wantErr: true},
+		{desc: "v0 bad timestamp", body: "Firmware Transparency Log v0\n10\nEjQ=\nnow\n", wantErr: true},
+		{desc: "v0 other lines", body: "Firmware Transparency Log v0\n10\nEjQ=\n1230\nmystery line\n", wantErr: true},
+		{desc: "v1", body: "Firmware Transparency Log v1\n10\nEjQ=\nTimestamp 1230\n"},
+		{desc: "v1 unknown lines ignored", body: "Firmware Transparency Log v1\n10\nEjQ=\nmystery line\nTimestamp 1230\n"},
+		{desc: "v1 bare timestamp", body: "Firmware Transparency Log v1\n10\nEjQ=\n1230\n", wantErr: true},
+		{desc: "v1 no timestamp", body: "Firmware Transparency Log v1\n10\nEjQ=\n", wantErr: true},
+		{desc: "v1 bad timestamp", body: "Firmware Transparency Log v1\n10\nEjQ=\nTimestamp now\n", wantErr: true},
+		{desc: "v1 repeated timestamp", body: "Firmware Transparency Log v1\n10\nEjQ=\nTimestamp 1230\nTimestamp 1231\n", wantErr: true},
+		{desc: "unknown ecosystem", body: "Firmware Transparency Log v2\n10\nEjQ=\nTimestamp 1230\n", wantErr: true},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			var got api.LogCheckpoint
+			err := got.Unmarshal([]byte(test.body))
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("Unmarshal() = %v, want err %t", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.Size != 10 || !bytes.Equal(got.Hash, []byte{0x12, 0x34}) || got.TimestampNanos != 1230 {
+				t.Errorf("Unmarshal() = %v, want {size 10 @ 1230 root: 0x1234}", got)
+			}
+		})
+	}
+}
+
+func TestInclusionPromiseRoundTrip(t *testing.T) {
+	want := api.InclusionPromise{
+		LeafHash:       []byte{0x12, 0x34, 0x56},
+		TimestampNanos: 1234,
+		MaxMergeDelay:  time.Minute,
+	}
+	var got api.InclusionPromise
+	if err := got.Unmarshal(want.Marshal()); err != nil {
+		t.Fatalf("Unmarshal() = %v", err)
+	}
+	if diff := cmp.Diff(want, got); len(diff) != 0 {
+		t.Errorf("round trip diff: %s", diff)
+	}
+	if got, want := got.Deadline(), time.Unix(0, 1234).Add(time.Minute); !got.Equal(want) {
+		t.Errorf("Deadline() = %v, want %v", got, want)
+	}
+}
+
+func TestInclusionPromiseUnmarshalErrors(t *testing.T) {
+	for _, test := range []struct {
+		desc string
+		body string
+	}{
+		{desc: "wrong header", body: "Firmware Transparency Log v0\nEjRW\n1234\n60000000000\n"},
+		{desc: "missing line", body: "Firmware Transparency Promise v0\nEjRW\n1234\n"},
+		{desc: "bad hash", body: "Firmware Transparency Promise v0\n!!!\n1234\n60000000000\n"},
+		{desc: "bad timestamp", body: "Firmware Transparency Promise v0\nEjRW\nnow\n60000000000\n"},
+		{desc: "bad delay", body: "Firmware Transparency Promise v0\nEjRW\n1234\nsoon\n"},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			var p api.InclusionPromise
+			if err := p.Unmarshal([]byte(test.body)); err == nil {
+				t.Error("Unmarshal() = nil, want error")
+			}
+		})
+	}
+}
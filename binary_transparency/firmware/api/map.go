@@ -14,15 +14,29 @@
 
 package api
 
-import "fmt"
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/sumdb/note"
+)
 
 const (
-	// MapHTTPGetCheckpoint is the path of the URL to get a recent map checkpoint.
-	MapHTTPGetCheckpoint = "ftmap/v0/get-checkpoint"
+	// MapHTTPGetCheckpoint is the path of the URL to get a recent signed map
+	// checkpoint. The v0 path served an unsigned JSON checkpoint, and is gone.
+	MapHTTPGetCheckpoint = "ftmap/v1/get-checkpoint"
 	// MapHTTPGetTile is the path of the URL to get a map tile at a revision.
 	MapHTTPGetTile = "ftmap/v0/tile"
 	// MapHTTPGetAggregation is the path of the URL to get aggregated FW info.
 	MapHTTPGetAggregation = "ftmap/v0/aggregation"
+	// MapHTTPGetDeviceReleaseLog is the path of the URL to get the release log
+	// for a device.
+	MapHTTPGetDeviceReleaseLog = "ftmap/v0/device-release-log"
+
+	// FTMapCheckpointEcosystemv0 is the v0 identifier for FT map checkpoints.
+	FTMapCheckpointEcosystemv0 = "Firmware Transparency Map v0"
 
 	// MapPrefixStrata is the number of prefix strata in the FT map.
 	MapPrefixStrata = 1
@@ -32,29 +46,114 @@ const (
 
 // AggregatedFirmware represents the results of aggregating a single piece of firmware
 // according to the rules described in #Aggregate().
+// Its JSON is hashed into the map, so fields added later are omitted when empty.
 type AggregatedFirmware struct {
 	Index uint64
 	Good  bool
+	// Revoked is true if the firmware has been revoked by its vendor.
+	Revoked bool `json:",omitempty"`
 }
 
-// DeviceReleaseLog represents firmware releases found for a single device ID.
-// Entries are ordered by their sequence in the original log.
+// DeviceReleaseLog represents firmware releases found for a single device ID
+// of a vendor. Entries are ordered by their sequence in the original log.
 type DeviceReleaseLog struct {
+	VendorID  string `json:",omitempty"`
 	DeviceID  string
 	Revisions []uint64
 }
 
+// QualifiedDeviceID returns the DeviceID namespaced by the VendorID.
+func (l DeviceReleaseLog) QualifiedDeviceID() string {
+	return QualifiedDeviceID(l.VendorID, l.DeviceID)
+}
+
+// HighestRevision returns the highest firmware revision logged for the device.
+func (l DeviceReleaseLog) HighestRevision() uint64 {
+	var h uint64
+	for _, r := range l.Revisions {
+		if r > h {
+			h = r
+		}
+	}
+	return h
+}
+
 // MapCheckpoint is a commitment to a map built from the FW Log at a given size.
 // The map checkpoint contains the checkpoint of the log this was built from, with
 // the number of entries consumed from that input log. This allows clients to check
 // they are seeing the same version of the log as the map was built from. This also
 // provides information to allow verifiers of the map to confirm correct construction.
+//
+// The serialisation format is a note, signed by the map, with the lines:
+//   - FTMapCheckpointEcosystemv0
+//   - the map revision
+//   - the number of log entries consumed
+//   - the base64 encoded map root hash
+//   - the base64 encoded log checkpoint
 type MapCheckpoint struct {
-	// LogCheckpoint is the json encoded api.LogCheckpoint.
+	// LogCheckpoint is the log's signed api.LogCheckpoint, as served by the log.
 	LogCheckpoint []byte
 	LogSize       uint64
 	RootHash      []byte
 	Revision      uint64
+
+	// If set, Envelope contains the envelope from which this MapCheckpoint was parsed.
+	Envelope []byte
+}
+
+// Marshal serialises the map checkpoint.
+func (m MapCheckpoint) Marshal() []byte {
+	return []byte(fmt.Sprintf("%s\n%d\n%d\n%s\n%s\n", FTMapCheckpointEcosystemv0, m.Revision, m.LogSize, base64.StdEncoding.EncodeToString(m.RootHash), base64.StdEncoding.EncodeToString(m.LogCheckpoint)))
+}
+
+// Unmarshal knows how to deserialise a MapCheckpoint.
+func (m *MapCheckpoint) Unmarshal(data []byte) error {
+	const delim = "\n"
+	lines := strings.Split(strings.TrimRight(string(data), delim), delim)
+	if el := len(lines); el != 5 {
+		return fmt.Errorf("expected 5 lines, got %d", el)
+	}
+	if got, want := lines[0], FTMapCheckpointEcosystemv0; got != want {
+		return fmt.Errorf("invalid map checkpoint header %q, want %q", got, want)
+	}
+	rev, err := strconv.ParseUint(lines[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("failed to parse revision: %w", err)
+	}
+	size, err := strconv.ParseUint(lines[2], 10, 64)
+	if err != nil {
+		return fmt.Errorf("failed to parse log size: %w", err)
+	}
+	h, err := base64.StdEncoding.DecodeString(lines[3])
+	if err != nil {
+		return fmt.Errorf("failed to parse root hash: %w", err)
+	}
+	lcp, err := base64.StdEncoding.DecodeString(lines[4])
+	if err != nil {
+		return fmt.Errorf("failed to parse log checkpoint: %w", err)
+	}
+	m.Revision = rev
+	m.LogSize = size
+	m.RootHash = h
+	m.LogCheckpoint = lcp
+	return nil
+}
+
+// ParseMapCheckpoint verifies the map's signature on a map checkpoint envelope,
+// and returns the MapCheckpoint it contains.
+//
+// Note that the log checkpoint inside it is not verified, which callers must
+// do using ParseCheckpoint.
+func ParseMapCheckpoint(envelope []byte, mapSigVerifier note.Verifier) (*MapCheckpoint, error) {
+	n, err := note.Open(envelope, note.VerifierList(mapSigVerifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify map checkpoint signature: %w", err)
+	}
+	m := &MapCheckpoint{Envelope: envelope}
+	if err := m.Unmarshal([]byte(n.Text)); err != nil {
+		return nil, err
+	}
+	return m, nil
 }
 
 // MapTile is a subtree of the whole map.
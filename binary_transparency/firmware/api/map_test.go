@@ -0,0 +1,112 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/trillian-examples/binary_transparency/firmware/api"
+	"github.com/google/trillian-examples/binary_transparency/firmware/internal/crypto"
+	"golang.org/x/mod/sumdb/note"
+)
+
+func TestParseMapCheckpoint(t *testing.T) {
+	mapSigner, err := note.NewSigner(crypto.TestMapPriv)
+	if err != nil {
+		t.Fatalf("NewSigner() = %v", err)
+	}
+	logSigner, err := note.NewSigner(crypto.TestFTPersonalityPriv)
+	if err != nil {
+		t.Fatalf("NewSigner() = %v", err)
+	}
+	v, err := note.NewVerifier(crypto.TestMapPub)
+	if err != nil {
+		t.Fatalf("NewVerifier() = %v", err)
+	}
+	mcp := api.MapCheckpoint{
+		LogCheckpoint: []byte("signed log checkpoint\n"),
+		LogSize:       10,
+		RootHash:      []byte{0x12, 0x34},
+		Revision:      3,
+	}
+
+	for _, test := range []struct {
+		desc    string
+		text    string
+		signer  note.Signer
+		wantErr bool
+	}{
+		{
+			desc:   "valid",
+			text:   string(mcp.Marshal()),
+			signer: mapSigner,
+		}, {
+			desc:    "signed by log",
+			text:    string(mcp.Marshal()),
+			signer:  logSigner,
+			wantErr: true,
+		}, {
+			desc:    "wrong header",
+			text:    "Firmware Transparency Log v0\n3\n10\nEjQ=\nc2lnbmVk\n",
+			signer:  mapSigner,
+			wantErr: true,
+		}, {
+			desc:    "missing line",
+			text:    "Firmware Transparency Map v0\n3\n10\nEjQ=\n",
+			signer:  mapSigner,
+			wantErr: true,
+		}, {
+			desc:    "bad revision",
+			text:    "Firmware Transparency Map v0\nthree\n10\nEjQ=\nc2lnbmVk\n",
+			signer:  mapSigner,
+			wantErr: true,
+		}, {
+			desc:    "bad log size",
+			text:    "Firmware Transparency Map v0\n3\nten\nEjQ=\nc2lnbmVk\n",
+			signer:  mapSigner,
+			wantErr: true,
+		}, {
+			desc:    "bad root hash",
+			text:    "Firmware Transparency Map v0\n3\n10\n!!!\nc2lnbmVk\n",
+			signer:  mapSigner,
+			wantErr: true,
+		}, {
+			desc:    "bad log checkpoint",
+			text:    "Firmware Transparency Map v0\n3\n10\nEjQ=\n!!!\n",
+			signer:  mapSigner,
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			env, err := note.Sign(&note.Note{Text: test.text}, test.signer)
+			if err != nil {
+				t.Fatalf("Sign() = %v", err)
+			}
+			got, err := api.ParseMapCheckpoint(env, v)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("ParseMapCheckpoint() = %v, want err %t", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			want := mcp
+			want.Envelope = env
+			if diff := cmp.Diff(want, *got); len(diff) != 0 {
+				t.Errorf("ParseMapCheckpoint() diff: %s", diff)
+			}
+		})
+	}
+}
@@ -28,7 +28,28 @@ type ProofBundle struct {
 	// ManifestStatement is the json representation of an `api.SignedStatement` struct.
 	ManifestStatement []byte
 	// Checkpoint must represent a tree which includes the ManifestStatement.
+	// The log's signature on the checkpoint may be followed by cosignatures,
+	// e.g. from witnesses, so that devices can check a witness policy offline.
 	Checkpoint []byte
 	// InclusionProof is a proof to Checkpoint for ManifestStatement.
 	InclusionProof InclusionProof
+	// MapInclusion, if set, proves the aggregated annotations on the firmware
+	// in the FT map, so that they can be checked offline.
+	MapInclusion *MapInclusion `json:",omitempty"`
+}
+
+// MapInclusion proves that the FT map commits to an aggregation of the
+// annotations on a firmware manifest.
+type MapInclusion struct {
+	// Checkpoint is the map's signed MapCheckpoint which Proof is to.
+	Checkpoint []byte
+	// Aggregation is the json representation of the `api.AggregatedFirmware`
+	// for the manifest, which is the value committed to by the map.
+	Aggregation []byte
+	// Proof is a proof to Checkpoint for Aggregation.
+	Proof MapInclusionProof
+	// LogConsistency is a consistency proof between the ProofBundle checkpoint
+	// and the log checkpoint which the map was built from, from the smaller
+	// to the larger.
+	LogConsistency [][]byte
 }
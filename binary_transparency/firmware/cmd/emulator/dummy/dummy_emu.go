@@ -28,20 +28,34 @@ package main
 
 import (
 	"flag"
+	"strings"
 
 	"github.com/golang/glog"
 	"github.com/google/trillian-examples/binary_transparency/firmware/cmd/emulator/dummy/impl"
+	"github.com/google/trillian-examples/binary_transparency/firmware/internal/verify"
 )
 
 var (
-	dummyDirectory = flag.String("dummy_storage_dir", "/tmp/dummy_device", "Directory path of the dummy device's state storage")
+	dummyDirectory   = flag.String("dummy_storage_dir", "/tmp/dummy_device", "Directory path of the dummy device's state storage")
+	witnessKeys      = flag.String("witness_keys", "", "Comma separated list of note verifier keys for trusted witnesses")
+	witnessThreshold = flag.Int("witness_threshold", 0, "Number of trusted witnesses which must have cosigned the stored proof bundle checkpoint")
 )
 
 func main() {
 	flag.Parse()
 
+	var keys []string
+	if len(*witnessKeys) > 0 {
+		keys = strings.Split(*witnessKeys, ",")
+	}
+	wp, err := verify.NewWitnessPolicy(keys, *witnessThreshold)
+	if err != nil {
+		glog.Exitf("Invalid witness policy: %v", err)
+	}
+
 	if err := impl.Main(impl.EmulatorOpts{
 		DeviceStorage: *dummyDirectory,
+		WitnessPolicy: wp,
 	}); err != nil {
 		glog.Exit(err.Error())
 	}
@@ -19,16 +19,20 @@ import (
 	"fmt"
 
 	"github.com/google/trillian-examples/binary_transparency/firmware/devices/dummy/rom"
+	"github.com/google/trillian-examples/binary_transparency/firmware/internal/verify"
 )
 
 // EmulatorOpts encapsulates the parameters for running the emulator.
 type EmulatorOpts struct {
 	DeviceStorage string
+	// WitnessPolicy is the witness policy which the ROM requires the stored
+	// proof bundle to satisfy.
+	WitnessPolicy verify.WitnessPolicy
 }
 
 // Main is the entry point for the dummy emulator
 func Main(opts EmulatorOpts) error {
-	boot, err := rom.Reset(opts.DeviceStorage)
+	boot, err := rom.Reset(opts.DeviceStorage, opts.WitnessPolicy)
 	if err != nil {
 		return fmt.Errorf("ROM: %w", err)
 	}
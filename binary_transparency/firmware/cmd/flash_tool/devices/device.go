@@ -29,6 +29,9 @@ type ErrNeedsInit = error
 type Device interface {
 	// DeviceCheckpoint returns the log checkpoint note used during the last firmware update.
 	DeviceCheckpoint() ([]byte, error)
+	// DeviceManifest returns the signed firmware manifest statement of the
+	// currently installed firmware, or nil if none has been installed.
+	DeviceManifest() ([]byte, error)
 	// ApplyUpdate applies the provided update to the device.
 	ApplyUpdate(api.UpdatePackage) error
 }
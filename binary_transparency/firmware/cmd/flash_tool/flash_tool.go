@@ -28,11 +28,13 @@ package main
 import (
 	"context"
 	"flag"
+	"strings"
 
 	"github.com/golang/glog"
 	"github.com/google/trillian-examples/binary_transparency/firmware/cmd/flash_tool/impl"
 	"github.com/google/trillian-examples/binary_transparency/firmware/internal/crypto"
-	"golang.org/x/mod/sumdb/note"
+	"github.com/google/trillian-examples/binary_transparency/firmware/internal/verify"
+	"github.com/google/trillian-examples/formats/note"
 )
 
 var (
@@ -43,6 +45,10 @@ var (
 	updateFile    = flag.String("update_file", "", "File path to read the update package from")
 	force         = flag.Bool("force", false, "Ignore errors and force update")
 	deviceStorage = flag.String("device_storage", "", "Storage description string for selected device")
+	claimantKeys  = flag.String("claimant_keys", "", "Path to a JSON registry of claimant public keys, or empty to use the demo keys")
+	witnessKeys   = flag.String("witness_keys", "", "Comma separated list of note verifier keys for trusted witnesses")
+	witnessThresh = flag.Int("witness_threshold", 0, "Number of trusted witnesses which must have cosigned the update's proof bundle checkpoint")
+	requireMap    = flag.Bool("require_map_inclusion", false, "Require the update's proof bundle to prove the firmware's annotations in the map")
 )
 
 func main() {
@@ -52,16 +58,36 @@ func main() {
 	if err != nil {
 		glog.Exitf("Failed to create CP verifier: %q", err)
 	}
+	mv, err := note.NewVerifier(crypto.TestMapPub)
+	if err != nil {
+		glog.Exitf("Failed to create map verifier: %q", err)
+	}
+	claimants, err := crypto.LoadRegistry(*claimantKeys)
+	if err != nil {
+		glog.Exitf("Failed to load claimant keys: %v", err)
+	}
+	var keys []string
+	if len(*witnessKeys) > 0 {
+		keys = strings.Split(*witnessKeys, ",")
+	}
+	wp, err := verify.NewWitnessPolicy(keys, *witnessThresh)
+	if err != nil {
+		glog.Exitf("Invalid witness policy: %v", err)
+	}
 
 	if err := impl.Main(context.Background(), impl.FlashOpts{
-		DeviceID:       *deviceID,
-		LogURL:         *logURL,
-		LogSigVerifier: v,
-		MapURL:         *mapURL,
-		WitnessURL:     *witnessURL,
-		UpdateFile:     *updateFile,
-		Force:          *force,
-		DeviceStorage:  *deviceStorage,
+		DeviceID:            *deviceID,
+		LogURL:              *logURL,
+		LogSigVerifier:      v,
+		Claimants:           claimants,
+		MapURL:              *mapURL,
+		MapSigVerifier:      mv,
+		WitnessURL:          *witnessURL,
+		WitnessPolicy:       wp,
+		RequireMapInclusion: *requireMap,
+		UpdateFile:          *updateFile,
+		Force:               *force,
+		DeviceStorage:       *deviceStorage,
 	}); err != nil {
 		glog.Exit(err.Error())
 	}
@@ -18,7 +18,6 @@
 package impl
 
 import (
-	"bytes"
 	"context"
 	"crypto/sha512"
 	"encoding/json"
@@ -33,9 +32,8 @@ import (
 	"github.com/google/trillian-examples/binary_transparency/firmware/devices/dummy"
 	armory_flash "github.com/google/trillian-examples/binary_transparency/firmware/devices/usbarmory/flash"
 	"github.com/google/trillian-examples/binary_transparency/firmware/internal/client"
+	"github.com/google/trillian-examples/binary_transparency/firmware/internal/crypto"
 	"github.com/google/trillian-examples/binary_transparency/firmware/internal/verify"
-	"github.com/google/trillian/merkle/coniks"
-	"github.com/google/trillian/storage/tree"
 	"golang.org/x/mod/sumdb/note"
 )
 
@@ -44,11 +42,21 @@ type FlashOpts struct {
 	DeviceID       string
 	LogURL         string
 	LogSigVerifier note.Verifier
+	Claimants      *crypto.Registry
 	MapURL         string
+	// MapSigVerifier verifies the map's signature on its checkpoints, and is
+	// required for any map checks.
+	MapSigVerifier note.Verifier
 	WitnessURL     string
-	UpdateFile     string
-	Force          bool
-	DeviceStorage  string
+	// WitnessPolicy is the witness policy which the update's proof bundle
+	// checkpoint must satisfy.
+	WitnessPolicy verify.WitnessPolicy
+	// RequireMapInclusion requires the update's proof bundle to prove the
+	// firmware's annotations in the map, so that they're checked offline.
+	RequireMapInclusion bool
+	UpdateFile          string
+	Force               bool
+	DeviceStorage       string
 }
 
 func Main(ctx context.Context, opts FlashOpts) error {
@@ -56,6 +64,9 @@ func Main(ctx context.Context, opts FlashOpts) error {
 	if err != nil {
 		return fmt.Errorf("log_url is invalid: %w", err)
 	}
+	if opts.Claimants == nil {
+		return errors.New("claimant registry is required")
+	}
 	c := &client.ReadonlyClient{LogURL: logURL}
 
 	up, err := readUpdateFile(opts.UpdateFile)
@@ -68,7 +79,7 @@ func Main(ctx context.Context, opts FlashOpts) error {
 		return fmt.Errorf("failed to get device: %w", err)
 	}
 
-	pb, fwMeta, err := verifyUpdate(c, opts.LogSigVerifier, up, dev)
+	pb, fwMeta, err := verifyUpdate(c, opts.LogSigVerifier, opts.MapSigVerifier, opts.Claimants, opts.WitnessPolicy, up, dev)
 	if err != nil {
 		err := fmt.Errorf("failed to validate update: %w", err)
 		if !opts.Force {
@@ -87,8 +98,18 @@ func Main(ctx context.Context, opts FlashOpts) error {
 		}
 	}
 
+	// Any annotations carried by the bundle were checked with the rest of it,
+	// but they're only required if requested.
+	if opts.RequireMapInclusion && pb.MapInclusion == nil {
+		err := errors.New("update's proof bundle has no map inclusion")
+		if !opts.Force {
+			return err
+		}
+		glog.Warning(err)
+	}
+
 	if len(opts.MapURL) > 0 {
-		err := verifyAnnotations(ctx, c, opts.LogSigVerifier, pb, fwMeta, opts.MapURL)
+		err := verifyAnnotations(ctx, c, opts.LogSigVerifier, opts.MapSigVerifier, pb, fwMeta, opts.MapURL)
 		if err != nil {
 			if !opts.Force {
 				return fmt.Errorf("verifyAnnotations: %w", err)
@@ -172,7 +193,7 @@ func getConsistencyFunc(c *client.ReadonlyClient) func(from, to uint64) ([][]byt
 }
 
 // verifyUpdate checks that an update package is self-consistent and returns a verified proof bundle
-func verifyUpdate(c *client.ReadonlyClient, logSigVerifier note.Verifier, up api.UpdatePackage, dev devices.Device) (api.ProofBundle, api.FirmwareMetadata, error) {
+func verifyUpdate(c *client.ReadonlyClient, logSigVerifier, mapSigVerifier note.Verifier, claimants *crypto.Registry, wp verify.WitnessPolicy, up api.UpdatePackage, dev devices.Device) (api.ProofBundle, api.FirmwareMetadata, error) {
 	var pb api.ProofBundle
 	var fwMeta api.FirmwareMetadata
 
@@ -181,24 +202,47 @@ func verifyUpdate(c *client.ReadonlyClient, logSigVerifier note.Verifier, up api
 	if err != nil {
 		return pb, fwMeta, fmt.Errorf("failed to fetch the device checkpoint: %w", err)
 	}
-	dcNote, err := note.Open(n, note.VerifierList(logSigVerifier))
+	dc, err := api.ParseCheckpoint(n, logSigVerifier)
 	if err != nil {
-		return pb, fwMeta, fmt.Errorf("failed to open the device checkpoint: %w", err)
+		return pb, fwMeta, fmt.Errorf("failed to parse the device checkpoint: %w", err)
 	}
-	dc := api.LogCheckpoint{Envelope: []byte(n)}
-	if err := dc.Unmarshal([]byte(dcNote.Text)); err != nil {
-		return pb, fwMeta, fmt.Errorf("failed to unmarshal the device checkpoint: %w", err)
+
+	installed, err := installedRevision(dev)
+	if err != nil {
+		return pb, fwMeta, fmt.Errorf("failed to determine the installed firmware revision: %w", err)
 	}
 
 	cpFunc := getConsistencyFunc(c)
 	fwHash := sha512.Sum512(up.FirmwareImage)
-	pb, fwMeta, err = verify.BundleForUpdate(up.ProofBundle, fwHash[:], dc, cpFunc, logSigVerifier)
+	pb, fwMeta, err = verify.BundleForUpdate(up.ProofBundle, fwHash[:], *dc, installed, cpFunc, logSigVerifier, mapSigVerifier, claimants, wp)
 	if err != nil {
 		return pb, fwMeta, fmt.Errorf("failed to verify proof bundle: %w", err)
 	}
 	return pb, fwMeta, nil
 }
 
+// installedRevision returns the revision of the firmware currently installed
+// on the device, or zero if there is none. The manifest stored on the device
+// was verified when it was flashed, so is trusted here.
+func installedRevision(dev devices.Device) (uint64, error) {
+	m, err := dev.DeviceManifest()
+	if err != nil {
+		return 0, err
+	}
+	if len(m) == 0 {
+		return 0, nil
+	}
+	var s api.SignedStatement
+	if err := json.Unmarshal(m, &s); err != nil {
+		return 0, fmt.Errorf("failed to unmarshal SignedStatement: %w", err)
+	}
+	var meta api.FirmwareMetadata
+	if err := json.Unmarshal(s.Statement, &meta); err != nil {
+		return 0, fmt.Errorf("failed to unmarshal FirmwareMetadata: %w", err)
+	}
+	return meta.FirmwareRevision, nil
+}
+
 func verifyWitness(c *client.ReadonlyClient, logSigVerifier note.Verifier, pb api.ProofBundle, witnessURL string) error {
 	wURL, err := url.Parse(witnessURL)
 	if err != nil {
@@ -222,8 +266,11 @@ func verifyWitness(c *client.ReadonlyClient, logSigVerifier note.Verifier, pb ap
 	return nil
 }
 
-func verifyAnnotations(ctx context.Context, c *client.ReadonlyClient, logSigVerifier note.Verifier, pb api.ProofBundle, fwMeta api.FirmwareMetadata, mapURL string) error {
-	mc, err := client.NewMapClient(mapURL)
+func verifyAnnotations(ctx context.Context, c *client.ReadonlyClient, logSigVerifier, mapSigVerifier note.Verifier, pb api.ProofBundle, fwMeta api.FirmwareMetadata, mapURL string) error {
+	if mapSigVerifier == nil {
+		return errors.New("a map signature verifier is required to check annotations")
+	}
+	mc, err := client.NewMapClient(mapURL, mapSigVerifier)
 	if err != nil {
 		return fmt.Errorf("failed to create map client: %w", err)
 	}
@@ -236,77 +283,31 @@ func verifyAnnotations(ctx context.Context, c *client.ReadonlyClient, logSigVeri
 	// Without this, the client is at risk of being given a custom map root that
 	// nobody else in the world sees.
 	glog.V(1).Infof("Received map checkpoint: %s", mcp.LogCheckpoint)
-	var lcp api.LogCheckpoint
-	if err := json.Unmarshal(mcp.LogCheckpoint, &lcp); err != nil {
-		return fmt.Errorf("failed to unmarshal log checkpoint: %w", err)
+	lcp, err := api.ParseCheckpoint(mcp.LogCheckpoint, logSigVerifier)
+	if err != nil {
+		return fmt.Errorf("failed to parse log checkpoint: %w", err)
 	}
 	// TODO(mhutchinson): check consistency with the largest checkpoint found thus far
 	// in order to detect a class of fork; it could be that the checkpoint in the update
 	// is consistent with the map and the witness, but the map and the witness aren't
 	// consistent with each other.
-	if err := verify.BundleConsistency(pb, lcp, getConsistencyFunc(c), logSigVerifier); err != nil {
+	if err := verify.BundleConsistency(pb, *lcp, getConsistencyFunc(c), logSigVerifier); err != nil {
 		return fmt.Errorf("failed to verify update with map checkpoint: %w", err)
 	}
 
 	// Get the aggregation and proof, and then check everything about it.
 	// This is a little paranoid as the inclusion proof is generated client-side.
 	// The pretense here is that there is a trust boundary between the code in this class,
-	// and everything else. In a production system, it is likely that the proof generation
-	// would live elsewhere (e.g. in the OTA packaging process), and the shorter proof
-	// bundle would be provided to the device.
+	// and everything else. Update packages can instead carry these proofs in
+	// their proof bundle, in which case they're checked offline by verify.
 	preimage, ip, err := mc.Aggregation(ctx, mcp.Revision, pb.InclusionProof.LeafIndex)
 	if err != nil {
 		return fmt.Errorf("failed to get map value for %q: %w", pb.InclusionProof.LeafIndex, err)
 	}
-	// 1. Check: the proof is for the correct key.
-	kbs := sha512.Sum512_256([]byte(fmt.Sprintf("summary:%d", pb.InclusionProof.LeafIndex)))
-	if !bytes.Equal(ip.Key, kbs[:]) {
-		return fmt.Errorf("received inclusion proof for key %x but wanted %x", ip.Key, kbs[:])
-	}
-	// 2. Check: the proof is for the correct value.
-	leafID := tree.NewNodeID2(string(kbs[:]), 256)
-	hasher := coniks.Default
-	expectedCommitment := hasher.HashLeaf(api.MapTreeID, leafID, preimage)
-	if !bytes.Equal(ip.Value, expectedCommitment) {
-		// This could happen if the JSON roundtripping was not stable. If we see that happen,
-		// then we'll need to pass out the raw bytes received from the server and parse into
-		// the struct at a higher level.
-		// It could also happen because the value returned is not actually committed to by the map.
-		return fmt.Errorf("received inclusion proof for value %x but wanted %x", ip.Value, expectedCommitment)
-	}
-	// 3. Check: the inclusion proof evaluates to the map root that we've obtained.
-	// The calculation starts from the leaf, and uses the siblings from the inclusion proof
-	// to generate the root, which is then compared with the map checkpoint.
-	calc := expectedCommitment
-	for pd := hasher.BitLen(); pd > 0; pd-- {
-		sib := ip.Proof[pd-1]
-		stem := leafID.Prefix(uint(pd))
-		if sib == nil {
-			sib = hasher.HashEmpty(api.MapTreeID, stem.Sibling())
-		}
-		left, right := calc, sib
-		if !isLeftChild(stem) {
-			left, right = right, left
-		}
-		calc = hasher.HashChildren(left, right)
-	}
-	if !bytes.Equal(calc, mcp.RootHash) {
-		return fmt.Errorf("inclusion proof calculated root %x but wanted %x", calc, mcp.RootHash)
-	}
-
-	var agg api.AggregatedFirmware
-	if err := json.Unmarshal(preimage, &agg); err != nil {
-		return fmt.Errorf("failed to decode aggregation: %w", err)
+	agg, err := verify.MapAggregation(mcp, pb.InclusionProof.LeafIndex, preimage, ip)
+	if err != nil {
+		return err
 	}
 	// Now we're certain that the aggregation is contained in the map, we can use the value.
-	if !agg.Good {
-		return errors.New("firmware is marked as bad")
-	}
-	return nil
-}
-
-// isLeftChild returns whether the given node is a left child.
-func isLeftChild(id tree.NodeID2) bool {
-	last, bits := id.LastByte()
-	return last&(1<<(8-bits)) == 0
+	return verify.Aggregation(agg)
 }
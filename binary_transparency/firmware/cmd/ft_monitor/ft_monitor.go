@@ -31,27 +31,51 @@ import (
 	"github.com/golang/glog"
 	"github.com/google/trillian-examples/binary_transparency/firmware/api"
 	"github.com/google/trillian-examples/binary_transparency/firmware/cmd/ft_monitor/impl"
+	"github.com/google/trillian-examples/binary_transparency/firmware/internal/crypto"
+	"github.com/google/trillian-examples/formats/note"
 )
 
 var (
 	ftLog        = flag.String("ftlog", "http://localhost:8000", "Base URL of FT Log server")
 	pollInterval = flag.Duration("poll_interval", 5*time.Second, "Duration to wait between polling for new entries")
 	keyWord      = flag.String("keyword", "trojan", "Example keyword for malware")
+	vendorID     = flag.String("vendor", "", "Only monitor firmware published by this vendor, or all firmware if empty")
 	annotate     = flag.Bool("annotate", false, "If true then this will add annotations to the log in addition to local logging")
 	stateFile    = flag.String("state_file", "", "Filepath to persist monitor state to")
+	claimantKeys = flag.String("claimant_keys", "", "Path to a JSON registry of claimant public keys, or empty to use the demo keys")
+	annotatorKey = flag.String("annotator_key_file", "testdata/keys/annotator_malware.pem", "Path to the PEM private key used to sign annotations, if annotating")
 )
 
 func main() {
 	flag.Parse()
 
+	v, err := note.NewVerifier(crypto.TestFTPersonalityPub)
+	if err != nil {
+		glog.Exitf("Failed to create CP verifier: %q", err)
+	}
+	claimants, err := crypto.LoadRegistry(*claimantKeys)
+	if err != nil {
+		glog.Exitf("Failed to load claimant keys: %v", err)
+	}
+	var annotator *crypto.Claimant
+	if *annotate {
+		if annotator, err = crypto.LoadSigningClaimant(*annotatorKey); err != nil {
+			glog.Exitf("Failed to load annotator key: %v", err)
+		}
+	}
+
 	if err := impl.Main(context.Background(), impl.MonitorOpts{
-		LogURL:       *ftLog,
-		PollInterval: *pollInterval,
-		Keyword:      *keyWord,
+		LogURL:         *ftLog,
+		LogSigVerifier: v,
+		Claimants:      claimants,
+		PollInterval:   *pollInterval,
+		VendorID:       *vendorID,
+		Keyword:        *keyWord,
 		Matched: func(idx uint64, fw api.FirmwareMetadata) {
 			glog.Warningf("Malware detected at log index %d, in firmware: %v", idx, fw)
 		},
 		Annotate:  *annotate,
+		Annotator: annotator,
 		StateFile: *stateFile,
 	}); err != nil {
 		glog.Exitf(err.Error())
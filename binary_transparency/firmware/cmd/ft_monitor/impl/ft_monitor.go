@@ -48,11 +48,18 @@ type MatchFunc func(index uint64, fw api.FirmwareMetadata)
 type MonitorOpts struct {
 	LogURL         string
 	LogSigVerifier note.Verifier
-	PollInterval   time.Duration
-	Keyword        string
-	Matched        MatchFunc
-	Annotate       bool
-	StateFile      string
+	// Claimants is used to verify the signatures on logged statements.
+	Claimants    *crypto.Registry
+	PollInterval time.Duration
+	// VendorID restricts monitoring to firmware published by this vendor,
+	// or to firmware from all vendors if empty.
+	VendorID string
+	Keyword  string
+	Matched  MatchFunc
+	Annotate bool
+	// Annotator signs the malware annotations, and is required if Annotate is set.
+	Annotator *crypto.Claimant
+	StateFile string
 }
 
 func Main(ctx context.Context, opts MonitorOpts) error {
@@ -62,6 +69,12 @@ func Main(ctx context.Context, opts MonitorOpts) error {
 	if len(opts.StateFile) == 0 {
 		return errors.New("state file is required")
 	}
+	if opts.Claimants == nil {
+		return errors.New("claimant registry is required")
+	}
+	if opts.Annotate && opts.Annotator == nil {
+		return errors.New("annotator key is required to annotate")
+	}
 
 	ftURL, err := url.Parse(opts.LogURL)
 	if err != nil {
@@ -85,17 +98,14 @@ func Main(ctx context.Context, opts MonitorOpts) error {
 		// This could fail here unless a force flag is provided, for better security.
 		glog.Warningf("State file %q did not exist; first log checkpoint will be trusted implicitly", opts.StateFile)
 	} else {
-		n, err := note.Open(state, note.VerifierList(opts.LogSigVerifier))
+		cp, err := api.ParseCheckpoint(state, opts.LogSigVerifier)
 		if err != nil {
-			return fmt.Errorf("failed to open state: %w", err)
-		}
-		latestCP.Envelope = state
-		if err := (&latestCP).Unmarshal([]byte(n.Text)); err != nil {
-			return fmt.Errorf("failed to unmarshal state: %w", err)
+			return fmt.Errorf("failed to parse state: %w", err)
 		}
+		latestCP = *cp
 	}
 	head := latestCP.Size
-	follow := client.NewLogFollower(c)
+	follow := client.NewLogFollower(c, opts.Claimants)
 
 	glog.Infof("Monitoring FT log (%q) starting from index %d", opts.LogURL, head)
 	cpc, cperrc := follow.Checkpoints(ctx, opts.PollInterval, latestCP)
@@ -139,6 +149,10 @@ func processEntry(entry client.LogEntry, c client.ReadonlyClient, opts MonitorOp
 	if err := json.Unmarshal(stmt.Statement, &meta); err != nil {
 		return fmt.Errorf("unable to decode FW Metadata from Statement %q", err)
 	}
+	if len(opts.VendorID) > 0 && meta.VendorID != opts.VendorID {
+		glog.V(1).Infof("Skipping firmware (@%d) from vendor %q", entry.Index, meta.VendorID)
+		return nil
+	}
 
 	glog.Infof("Found firmware (@%d): %s", entry.Index, meta)
 
@@ -169,7 +183,7 @@ func processEntry(entry client.LogEntry, c client.ReadonlyClient, opts MonitorOp
 			Good: !malwareDetected,
 		}
 		glog.V(1).Infof("Annotating %s", ms)
-		js, err := createStatementJSON(ms)
+		js, err := createStatementJSON(ms, opts.Annotator)
 		if err != nil {
 			return fmt.Errorf("failed to create annotation: %q", err)
 		}
@@ -183,12 +197,12 @@ func processEntry(entry client.LogEntry, c client.ReadonlyClient, opts MonitorOp
 	return nil
 }
 
-func createStatementJSON(m api.MalwareStatement) ([]byte, error) {
+func createStatementJSON(m api.MalwareStatement, annotator *crypto.Claimant) ([]byte, error) {
 	js, err := json.Marshal(m)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal metadata: %w", err)
 	}
-	sig, err := crypto.AnnotatorMalware.SignMessage(api.MalwareStatementType, js)
+	sig, err := annotator.SignMessage(api.MalwareStatementType, js)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate signature: %w", err)
 	}
@@ -14,7 +14,8 @@
 
 // This package is the entrypoint for the Firmware Transparency personality server.
 // This requires a Trillian instance to be reachable via gRPC and a tree to have
-// been provisioned. See the README in the root of this project for instructions.
+// been provisioned, unless a serverless log is used instead. See the README in
+// the root of this project for instructions.
 package main
 
 import (
@@ -25,7 +26,7 @@ import (
 	"github.com/golang/glog"
 	"github.com/google/trillian-examples/binary_transparency/firmware/cmd/ft_personality/impl"
 	"github.com/google/trillian-examples/binary_transparency/firmware/internal/crypto"
-	"golang.org/x/mod/sumdb/note"
+	"github.com/google/trillian-examples/formats/note"
 )
 
 var (
@@ -33,10 +34,15 @@ var (
 
 	connectTimeout = flag.Duration("connect_timeout", time.Second, "the timeout for connecting to the backend")
 	trillianAddr   = flag.String("trillian", ":8090", "address:port of Trillian Log gRPC service")
+	serverlessDir  = flag.String("serverless_dir", "", "If set, the directory of a serverless log to use instead of Trillian, which is created if it doesn't exist")
 
 	casDBFile = flag.String("cas_db_file", "", "Path to a file to be used as sqlite3 storage for images, e.g. /tmp/ft.db")
+	casDir    = flag.String("cas_dir", "", "If set, the directory to store images in as files instead of in --cas_db_file, which is still required for other state. This is better suited to large images.")
 
-	sthRefresh = flag.Duration("sth_refresh_interval", 5*time.Second, "how often to fetch the latest log root from Trillian")
+	sthRefresh    = flag.Duration("sth_refresh_interval", 5*time.Second, "how often to fetch the latest log root from Trillian, or integrate the serverless log")
+	maxMergeDelay = flag.Duration("max_merge_delay", time.Minute, "the maximum time promised to submitters for added entries to be included in the log, which must be longer than --sth_refresh_interval")
+
+	claimantKeys = flag.String("claimant_keys", "", "Path to a JSON registry of claimant public keys, or empty to use the demo keys")
 )
 
 func main() {
@@ -46,15 +52,23 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	claimants, err := crypto.LoadRegistry(*claimantKeys)
+	if err != nil {
+		glog.Exitf("Failed to load claimant keys: %v", err)
+	}
 
 	ctx := context.Background()
 	if err := impl.Main(ctx, impl.PersonalityOpts{
 		ListenAddr:     *listenAddr,
 		ConnectTimeout: *connectTimeout,
 		TrillianAddr:   *trillianAddr,
+		ServerlessDir:  *serverlessDir,
 		CASFile:        *casDBFile,
+		CASDir:         *casDir,
 		STHRefresh:     *sthRefresh,
+		MaxMergeDelay:  *maxMergeDelay,
 		Signer:         signer,
+		Claimants:      claimants,
 	}); err != nil {
 		glog.Exitf("Error running personality: %q", err)
 	}
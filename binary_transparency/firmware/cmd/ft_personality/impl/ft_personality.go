@@ -13,8 +13,8 @@
 // limitations under the License.
 
 // Package impl is the implementation of the Firmware Transparency personality server.
-// This requires a Trillian instance to be reachable via gRPC and a tree to have
-// been provisioned.
+// This requires either a Trillian instance to be reachable via gRPC and a tree to
+// have been provisioned, or a directory in which to keep a serverless log.
 package impl
 
 import (
@@ -22,14 +22,18 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"time"
 
 	"github.com/golang/glog"
 	"github.com/google/trillian-examples/binary_transparency/firmware/cmd/ft_personality/internal/cas"
 	ih "github.com/google/trillian-examples/binary_transparency/firmware/cmd/ft_personality/internal/http"
+	"github.com/google/trillian-examples/binary_transparency/firmware/cmd/ft_personality/internal/revisions"
+	"github.com/google/trillian-examples/binary_transparency/firmware/cmd/ft_personality/internal/serverless"
 	"github.com/google/trillian-examples/binary_transparency/firmware/cmd/ft_personality/internal/trees"
 	"github.com/google/trillian-examples/binary_transparency/firmware/cmd/ft_personality/internal/trillian"
+	"github.com/google/trillian-examples/binary_transparency/firmware/internal/crypto"
 	"github.com/gorilla/mux"
 	"golang.org/x/mod/sumdb/note"
 
@@ -41,42 +45,102 @@ import (
 type PersonalityOpts struct {
 	ListenAddr     string
 	CASFile        string
+	CASDir         string
 	TrillianAddr   string
 	ConnectTimeout time.Duration
+	ServerlessDir  string
 	STHRefresh     time.Duration
+	MaxMergeDelay  time.Duration
 	Signer         note.Signer
+	Claimants      *crypto.Registry
+
+	// Log, if set, is used as the log instead of Trillian or a serverless log.
+	// This is intended for tests.
+	Log Log
+	// Listener, if set, is used to serve requests instead of listening on
+	// ListenAddr. This is intended for tests.
+	Listener net.Listener
+}
+
+// Log is the personality's view of the log, which is periodically updated to
+// the latest root.
+type Log interface {
+	ih.Trillian
+
+	// UpdateRoot updates the root returned by Root to the latest root of the log.
+	UpdateRoot(ctx context.Context) error
 }
 
 func Main(ctx context.Context, opts PersonalityOpts) error {
 	if len(opts.CASFile) == 0 {
 		return errors.New("CAS file is required")
 	}
+	if opts.Claimants == nil {
+		return errors.New("claimant registry is required")
+	}
+	if opts.MaxMergeDelay <= opts.STHRefresh {
+		return fmt.Errorf("max merge delay (%v) must be longer than the STH refresh interval (%v)", opts.MaxMergeDelay, opts.STHRefresh)
+	}
 
 	glog.Infof("Connecting to local DB at %q", opts.CASFile)
 	db, err := sql.Open("sqlite3", opts.CASFile)
 	if err != nil {
 		return fmt.Errorf("failed to connect to DB: %w", err)
 	}
-	cas, err := cas.NewBinaryStorage(db)
+	var store ih.CAS
+	if len(opts.CASDir) > 0 {
+		glog.Infof("Storing images in %q", opts.CASDir)
+		if store, err = cas.NewFileStorage(opts.CASDir); err != nil {
+			return fmt.Errorf("failed to create file CAS: %w", err)
+		}
+	} else {
+		if store, err = cas.NewBinaryStorage(db); err != nil {
+			return fmt.Errorf("failed to connect CAS to DB: %w", err)
+		}
+	}
+
+	revs, err := revisions.NewStorage(db)
 	if err != nil {
-		return fmt.Errorf("failed to connect CAS to DB: %w", err)
+		return fmt.Errorf("failed to connect revision storage to DB: %w", err)
 	}
 
-	// TODO(mhutchinson): This is putting the tree config in the CAS DB.
-	// This isn't unreasonable, but it does make the naming misleading now.
-	treeStorage := trees.NewTreeStorage(db)
+	lc := opts.Log
+	if lc != nil {
+		glog.Infof("Using provided log")
+	} else if len(opts.ServerlessDir) > 0 {
+		glog.Infof("Opening serverless log in %q", opts.ServerlessDir)
+		sclient, err := serverless.NewClient(opts.ServerlessDir)
+		if err != nil {
+			return fmt.Errorf("failed to open serverless log: %w", err)
+		}
+		lc = sclient
+	} else {
+		// TODO(mhutchinson): This is putting the tree config in the CAS DB.
+		// This isn't unreasonable, but it does make the naming misleading now.
+		treeStorage := trees.NewTreeStorage(db)
 
-	glog.Infof("Connecting to Trillian Log...")
-	tclient, err := trillian.NewClient(ctx, opts.ConnectTimeout, opts.TrillianAddr, treeStorage)
-	if err != nil {
-		return fmt.Errorf("failed to connect to Trillian: %w", err)
+		glog.Infof("Connecting to Trillian Log...")
+		tclient, err := trillian.NewClient(ctx, opts.ConnectTimeout, opts.TrillianAddr, treeStorage)
+		if err != nil {
+			return fmt.Errorf("failed to connect to Trillian: %w", err)
+		}
+		defer tclient.Close()
+		lc = tclient
+	}
+
+	// Revisions may not have been recorded for firmware which was logged
+	// before the revisions storage was created, so take them from the log.
+	if err := lc.UpdateRoot(ctx); err != nil {
+		return fmt.Errorf("failed to get log root: %w", err)
+	}
+	if err := ih.SeedRevisions(ctx, lc, revs); err != nil {
+		return fmt.Errorf("failed to seed revisions from log: %w", err)
 	}
-	defer tclient.Close()
 
 	// Periodically sync the golden STH in the background.
 	go func() {
 		for ctx.Err() == nil {
-			if err := tclient.UpdateRoot(ctx); err != nil {
+			if err := lc.UpdateRoot(ctx); err != nil {
 				glog.Warningf("error updating STH: %v", err)
 			}
 
@@ -88,7 +152,7 @@ func Main(ctx context.Context, opts PersonalityOpts) error {
 	}()
 
 	glog.Infof("Starting FT personality server...")
-	srv := ih.NewServer(tclient, cas, opts.Signer)
+	srv := ih.NewServer(lc, store, revs, opts.Signer, opts.MaxMergeDelay, opts.Claimants)
 	r := mux.NewRouter()
 	srv.RegisterHandlers(r)
 	hServer := &http.Server{
@@ -97,7 +161,11 @@ func Main(ctx context.Context, opts PersonalityOpts) error {
 	}
 	e := make(chan error, 1)
 	go func() {
-		e <- hServer.ListenAndServe()
+		if opts.Listener != nil {
+			e <- hServer.Serve(opts.Listener)
+		} else {
+			e <- hServer.ListenAndServe()
+		}
 		close(e)
 	}()
 	<-ctx.Done()
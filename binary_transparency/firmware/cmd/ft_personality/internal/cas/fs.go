@@ -0,0 +1,100 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cas
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// FileStorage is a CAS which stores binary images as files in a directory on
+// the local filesystem. Images are streamed to and from disk, so they need not
+// fit in memory.
+type FileStorage struct {
+	root string
+}
+
+// NewFileStorage creates a new CAS that stores images under the given
+// directory, which will be created if needed.
+func NewFileStorage(root string) (*FileStorage, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create CAS directory: %w", err)
+	}
+	return &FileStorage{root: root}, nil
+}
+
+// path returns the path of the file for the key. Files are spread across
+// subdirectories named by the first byte of the key to keep directories small.
+func (fs *FileStorage) path(key []byte) string {
+	k := hex.EncodeToString(key)
+	if len(k) < 2 {
+		return filepath.Join(fs.root, k)
+	}
+	return filepath.Join(fs.root, k[:2], k)
+}
+
+// Store reads a binary image and stores it under the given key, which must be
+// the SHA512 hash of the image.
+// The image is written to a temporary file while its hash is calculated, and
+// only moved into place if the hash matches the key. This means that only
+// complete and correct images can be read back.
+func (fs *FileStorage) Store(key []byte, r io.Reader) error {
+	p := fs.path(key)
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for image: %w", err)
+	}
+	f, err := ioutil.TempFile(filepath.Dir(p), ".tmp-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	h := sha512.New()
+	if _, err := io.Copy(f, io.TeeReader(r, h)); err != nil {
+		return fmt.Errorf("failed to write image: %w", err)
+	}
+	if err := checkHash(key, h.Sum(nil)); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close image file: %w", err)
+	}
+	// Any existing file under this key has the same contents, so it's safe to
+	// replace it.
+	if err := os.Rename(f.Name(), p); err != nil {
+		return fmt.Errorf("failed to move image into place: %w", err)
+	}
+	return nil
+}
+
+// Retrieve opens a binary image that was previously stored.
+func (fs *FileStorage) Retrieve(key []byte) (Image, error) {
+	f, err := os.Open(fs.path(key))
+	if os.IsNotExist(err) {
+		return nil, status.Errorf(codes.NotFound, "unknown hash: %x", key)
+	} else if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
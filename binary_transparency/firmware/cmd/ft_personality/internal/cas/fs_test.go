@@ -0,0 +1,92 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cas
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestFileStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ft_cas")
+	if err != nil {
+		t.Fatalf("TempDir() = %v", err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := NewFileStorage(filepath.Join(dir, "cas"))
+	if err != nil {
+		t.Fatalf("NewFileStorage() = %v", err)
+	}
+
+	image := bytes.Repeat([]byte("firmware"), 10000)
+	keyBs := sha512.Sum512(image)
+	key := keyBs[:]
+
+	// Storing the same image twice is fine.
+	for i := 0; i < 2; i++ {
+		if err := store.Store(key, bytes.NewReader(image)); err != nil {
+			t.Fatalf("Store() = %v", err)
+		}
+		got, err := readImage(store, key)
+		if err != nil {
+			t.Fatalf("Retrieve() = %v", err)
+		}
+		if !bytes.Equal(got, image) {
+			t.Errorf("got image of %d bytes which differs from stored image", len(got))
+		}
+	}
+
+	// Images can be read from part way through.
+	img, err := store.Retrieve(key)
+	if err != nil {
+		t.Fatalf("Retrieve() = %v", err)
+	}
+	defer img.Close()
+	if _, err := img.Seek(8, io.SeekStart); err != nil {
+		t.Fatalf("Seek() = %v", err)
+	}
+	buf := make([]byte, 8)
+	if _, err := io.ReadFull(img, buf); err != nil {
+		t.Fatalf("ReadFull() = %v", err)
+	}
+	if got, want := string(buf), "firmware"; got != want {
+		t.Errorf("read %q after seeking, want %q", got, want)
+	}
+
+	// Images which don't match the key are rejected, and leave nothing behind.
+	badBs := sha512.Sum512([]byte("expected"))
+	err = store.Store(badBs[:], bytes.NewReader([]byte("actual")))
+	if got, want := status.Code(err), codes.InvalidArgument; got != want {
+		t.Fatalf("Store(mismatch) = %v, want code %s", err, want)
+	}
+	if _, err := store.Retrieve(badBs[:]); status.Code(err) != codes.NotFound {
+		t.Errorf("Retrieve(mismatch) = %v, want code NotFound", err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "cas", "*", "*"))
+	if err != nil {
+		t.Fatalf("Glob() = %v", err)
+	}
+	if len(files) != 1 {
+		t.Errorf("got files %v, want only the stored image", files)
+	}
+}
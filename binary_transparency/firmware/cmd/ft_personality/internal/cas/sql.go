@@ -12,16 +12,27 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-// Package cas contains a Content Addressable Store.
+// Package cas contains Content Addressable Stores for firmware images, which
+// are keyed by the SHA512 hash of the image.
 package cas
 
 import (
+	"bytes"
+	"crypto/sha512"
 	"database/sql"
+	"io"
+	"io/ioutil"
 
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
+// Image is a stored binary image, which must be closed after reading.
+type Image interface {
+	io.ReadSeeker
+	io.Closer
+}
+
 // BinaryStorage is a CAS intended for storing binary images keyed by their hash string
 // that uses a SQL Database as its backing store.
 type BinaryStorage struct {
@@ -43,17 +54,24 @@ func (bs *BinaryStorage) init() error {
 	return err
 }
 
-// Store stores a binary image under the given key (which should be a hash of its data).
+// Store reads a binary image and stores it under the given key, which must be
+// the SHA512 hash of the image. The whole image is held in memory.
 // If there was an existing value under the key then it will not be updated.
-// TODO(mhutchinson): Consider validating that the image is exactly the same if the key
-// already exists. This should only happen if the hash function isn't strong.
-func (bs *BinaryStorage) Store(key, image []byte) error {
-	_, err := bs.db.Exec("INSERT OR IGNORE INTO images (key, data) VALUES (?, ?)", key, image)
+func (bs *BinaryStorage) Store(key []byte, r io.Reader) error {
+	image, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	h := sha512.Sum512(image)
+	if err := checkHash(key, h[:]); err != nil {
+		return err
+	}
+	_, err = bs.db.Exec("INSERT OR IGNORE INTO images (key, data) VALUES (?, ?)", key, image)
 	return err
 }
 
 // Retrieve gets a binary image that was previously stored.
-func (bs *BinaryStorage) Retrieve(key []byte) ([]byte, error) {
+func (bs *BinaryStorage) Retrieve(key []byte) (Image, error) {
 	var res []byte
 	row := bs.db.QueryRow("SELECT data FROM images WHERE key=?", key)
 	if err := row.Err(); err != nil {
@@ -67,5 +85,21 @@ func (bs *BinaryStorage) Retrieve(key []byte) ([]byte, error) {
 		return nil, err
 
 	}
-	return res, nil
+	return nopCloser{bytes.NewReader(res)}, nil
+}
+
+// nopCloser is an Image for data which is already in memory.
+type nopCloser struct {
+	*bytes.Reader
+}
+
+func (nopCloser) Close() error { return nil }
+
+// checkHash returns an error with code InvalidArgument if the hash of an
+// image doesn't match the key it is being stored under.
+func checkHash(key, hash []byte) error {
+	if !bytes.Equal(key, hash) {
+		return status.Errorf(codes.InvalidArgument, "image does not match key (SHA512 %x != %x)", hash, key)
+	}
+	return nil
 }
@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"crypto/sha512"
 	"database/sql"
+	"io/ioutil"
 	"testing"
 
 	_ "github.com/mattn/go-sqlite3" // Load drivers for sqlite3
@@ -56,10 +57,10 @@ func TestRoundTrip(t *testing.T) {
 			key, value := keyBs[:], test.image
 
 			for i := 0; i < test.extraRuns+1; i++ {
-				if err := store.Store(key, value); err != nil {
+				if err := store.Store(key, bytes.NewReader(value)); err != nil {
 					t.Error("failed to store into CAS", err)
 				}
-				got, err := store.Retrieve(key)
+				got, err := readImage(store, key)
 				if err != nil {
 					t.Error("failed to retrieve from CAS", err)
 				}
@@ -92,3 +93,37 @@ func TestUnknownHash(t *testing.T) {
 		t.Fatalf("got error code %s, want %s", got, want)
 	}
 }
+
+func TestHashMismatch(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Error("failed to open temporary in-memory DB", err)
+	}
+	defer db.Close()
+
+	store, err := NewBinaryStorage(db)
+	if err != nil {
+		t.Error("failed to create CAS", err)
+	}
+
+	keyBs := sha512.Sum512([]byte("expected"))
+	err = store.Store(keyBs[:], bytes.NewReader([]byte("actual")))
+	if got, want := status.Code(err), codes.InvalidArgument; got != want {
+		t.Fatalf("got error %v, want code %s", err, want)
+	}
+	if _, err := store.Retrieve(keyBs[:]); status.Code(err) != codes.NotFound {
+		t.Fatalf("image with wrong hash was stored: %v", err)
+	}
+}
+
+// readImage retrieves and reads the whole image stored under the key.
+func readImage(store interface {
+	Retrieve([]byte) (Image, error)
+}, key []byte) ([]byte, error) {
+	img, err := store.Retrieve(key)
+	if err != nil {
+		return nil, err
+	}
+	defer img.Close()
+	return ioutil.ReadAll(img)
+}
@@ -95,6 +95,21 @@ func (mr *MockTrillianMockRecorder) InclusionProofByHash(arg0, arg1, arg2 interf
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InclusionProofByHash", reflect.TypeOf((*MockTrillian)(nil).InclusionProofByHash), arg0, arg1, arg2)
 }
 
+// LeavesByRange mocks base method.
+func (m *MockTrillian) LeavesByRange(arg0 context.Context, arg1, arg2 uint64) ([][]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LeavesByRange", arg0, arg1, arg2)
+	ret0, _ := ret[0].([][]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LeavesByRange indicates an expected call of LeavesByRange.
+func (mr *MockTrillianMockRecorder) LeavesByRange(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LeavesByRange", reflect.TypeOf((*MockTrillian)(nil).LeavesByRange), arg0, arg1, arg2)
+}
+
 // Root mocks base method.
 func (m *MockTrillian) Root() *types.LogRootV1 {
 	m.ctrl.T.Helper()
@@ -20,18 +20,27 @@ import (
 	"context"
 	"crypto/sha512"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"mime"
 	"mime/multipart"
 	"net/http"
+	"os"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/google/trillian-examples/binary_transparency/firmware/api"
+	"github.com/google/trillian-examples/binary_transparency/firmware/cmd/ft_personality/internal/cas"
+	"github.com/google/trillian-examples/binary_transparency/firmware/cmd/ft_personality/internal/revisions"
 	"github.com/google/trillian-examples/binary_transparency/firmware/internal/crypto"
+	"github.com/google/trillian-examples/binary_transparency/firmware/internal/verify"
 	"github.com/google/trillian-examples/formats/log"
 	"github.com/google/trillian/types"
 	"github.com/gorilla/mux"
@@ -57,125 +66,630 @@ type Trillian interface {
 
 	// InclusionProofByHash fetches an inclusion proof and index for the first leaf found with the specified hash, if any.
 	InclusionProofByHash(ctx context.Context, hash []byte, treeSize uint64) (uint64, [][]byte, error)
+
+	// LeavesByRange gets the values of up to count leaves, starting at the given index.
+	LeavesByRange(ctx context.Context, start, count uint64) ([][]byte, error)
 }
 
 // CAS is the interface to the Content Addressable Store for firmware images.
 type CAS interface {
-	// Store puts the image under the key.
-	Store([]byte, []byte) error
+	// Store reads the image and puts it under the key, which is the SHA512
+	// hash of the image.
+	// Must return status code InvalidArgument, and not store the image, if
+	// the image doesn't match the key.
+	Store([]byte, io.Reader) error
 
-	// Retrieve gets a binary image that was previously stored.
+	// Retrieve opens a binary image that was previously stored.
 	// Must return status code NotFound if no such image exists.
-	Retrieve([]byte) ([]byte, error)
+	Retrieve([]byte) (cas.Image, error)
+}
+
+// Revisions records the highest firmware revision logged for each device.
+type Revisions interface {
+	// Latest returns the highest revision recorded for the vendor qualified
+	// device ID, and whether any revision has been recorded.
+	Latest(deviceID string) (revisions.Record, bool, error)
+
+	// Raise records rec for the vendor qualified device ID if its revision is
+	// higher than the one already recorded, and reports whether it was.
+	Raise(deviceID string, rec revisions.Record) (bool, error)
+
+	// Restore undoes a Raise of rec for the vendor qualified device ID,
+	// putting back prev, or removing the record if prev is nil. Nothing is
+	// changed if a higher revision has been recorded since.
+	Restore(deviceID string, rec revisions.Record, prev *revisions.Record) error
+
+	// SeededSize returns the tree size that revisions have been seeded from
+	// the log up to.
+	SeededSize() (uint64, error)
+
+	// SetSeededSize records the tree size that revisions have been seeded
+	// from the log up to.
+	SetSeededSize(size uint64) error
 }
 
 // Server is the core state & handler implementation of the FT personality.
 type Server struct {
-	c      Trillian
-	cas    CAS
-	signer note.Signer
+	c         Trillian
+	cas       CAS
+	revs      Revisions
+	signer    note.Signer
+	claimants *crypto.Registry
+	// mmd is the maximum merge delay promised for added statements.
+	mmd time.Duration
+
+	// revMu serializes the check and reservation of revisions when adding
+	// firmware. It is not held while firmware is logged.
+	revMu sync.Mutex
 }
 
 // NewServer creates a new server that interfaces with the given Trillian logger.
-func NewServer(c Trillian, cas CAS, signer note.Signer) *Server {
+// Only statements signed by a claimant in the given registry will be accepted,
+// and firmware revisions for each device must be strictly increasing.
+// Added firmware is given a promise, signed by signer, that it will be
+// included in the log within the maximum merge delay.
+func NewServer(c Trillian, cas CAS, revs Revisions, signer note.Signer, maxMergeDelay time.Duration, claimants *crypto.Registry) *Server {
 	return &Server{
-		c:      c,
-		cas:    cas,
-		signer: signer,
+		c:         c,
+		cas:       cas,
+		revs:      revs,
+		signer:    signer,
+		claimants: claimants,
+		mmd:       maxMergeDelay,
+	}
+}
+
+// seedBatchSize is the number of leaves fetched from the log at a time when
+// seeding revisions.
+const seedBatchSize = 256
+
+// SeedRevisions raises the revisions recorded for each device to the highest
+// firmware revision in the log at its current root. This should be called
+// before serving, as the revisions storage may have been created after
+// firmware was already logged. Only leaves added since the revisions were
+// last seeded are read.
+func SeedRevisions(ctx context.Context, c Trillian, revs Revisions) error {
+	size := c.Root().TreeSize
+	from, err := revs.SeededSize()
+	if err != nil {
+		return fmt.Errorf("failed to get seeded tree size: %w", err)
+	}
+	if from > size {
+		return fmt.Errorf("revisions were seeded from tree size %d, but the log has size %d", from, size)
+	}
+	highest := make(map[string]revisions.Record)
+	for i := from; i < size; {
+		count := size - i
+		if count > seedBatchSize {
+			count = seedBatchSize
+		}
+		leaves, err := c.LeavesByRange(ctx, i, count)
+		if err != nil {
+			return fmt.Errorf("failed to get leaves from %d: %w", i, err)
+		}
+		if len(leaves) == 0 || uint64(len(leaves)) > count {
+			return fmt.Errorf("got %d leaves from %d, want between 1 and %d", len(leaves), i, count)
+		}
+		for _, bs := range leaves {
+			var stmt api.SignedStatement
+			if err := json.Unmarshal(bs, &stmt); err != nil {
+				return fmt.Errorf("failed to unmarshal statement at %d: %w", i, err)
+			}
+			if stmt.Type == api.FirmwareMetadataType {
+				var meta api.FirmwareMetadata
+				if err := json.Unmarshal(stmt.Statement, &meta); err != nil {
+					return fmt.Errorf("failed to unmarshal firmware at %d: %w", i, err)
+				}
+				if d := meta.QualifiedDeviceID(); meta.FirmwareRevision >= highest[d].Revision {
+					highest[d] = revisions.Record{Revision: meta.FirmwareRevision, LeafHash: verify.HashLeaf(bs)}
+				}
+			}
+			i++
+		}
+	}
+	for d, rec := range highest {
+		raised, err := revs.Raise(d, rec)
+		if err != nil {
+			return fmt.Errorf("failed to record revision for %q: %w", d, err)
+		}
+		if raised {
+			glog.Infof("Seeded revision %d for %q from the log", rec.Revision, d)
+		}
+	}
+	if err := revs.SetSeededSize(size); err != nil {
+		return fmt.Errorf("failed to record seeded tree size: %w", err)
+	}
+	return nil
+}
+
+// maxBatchSize is the maximum number of firmware entries accepted in a single
+// batch request.
+const maxBatchSize = 256
+
+// maxStatementSize is the maximum size of a firmware statement. Images are
+// streamed to temporary files, but statements are held in memory.
+const maxStatementSize = 1 << 20
+
+// firmwareEntry is a firmware statement which has been checked, and whose
+// image has been staged, so it is ready to be logged. The image is only put
+// in the CAS once the statement is logged, and the entry must be discarded
+// once handled.
+type firmwareEntry struct {
+	statement []byte
+	meta      api.FirmwareMetadata
+	// image is a temporary file holding the image, or nil if none was staged.
+	image *os.File
+}
+
+// discard removes the staged image, if any.
+func (fw firmwareEntry) discard() {
+	if fw.image == nil {
+		return
+	}
+	fw.image.Close()
+	if err := os.Remove(fw.image.Name()); err != nil {
+		glog.Warningf("Failed to remove staged image %q: %v", fw.image.Name(), err)
 	}
 }
 
 // addFirmware handles requests to log new firmware images.
 // It expects a mime/multipart POST consisting of SignedStatement and then firmware bytes.
+// The response is the log's signed api.InclusionPromise for the statement.
 func (s *Server) addFirmware(w http.ResponseWriter, r *http.Request) {
-	statement, image, err := parseAddFirmwareRequest(r)
+	mr, err := multipartReader(r)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("failed to parse request: %q", err.Error()), http.StatusBadRequest)
 		return
 	}
-
-	stmt := api.SignedStatement{}
-	if err := json.NewDecoder(bytes.NewReader(statement)).Decode(&stmt); err != nil {
-		http.Error(w, fmt.Sprintf("failed to decode statement: %q", err.Error()), http.StatusBadRequest)
+	fw, code, err := s.readFirmware(mr)
+	if err == io.EOF {
+		err = errors.New("expected firmware statement and image, got none")
+	}
+	if err != nil {
+		http.Error(w, err.Error(), code)
 		return
 	}
+	defer fw.discard()
+	if _, err := mr.NextPart(); err != io.EOF {
+		http.Error(w, "failed to parse request: expected only firmware statement and image", http.StatusBadRequest)
+		return
+	}
+	glog.V(1).Infof("Got firmware %+v", fw.meta)
 
-	// Verify the signature:
-	if err := crypto.Publisher.VerifySignature(stmt.Type, stmt.Statement, stmt.Signature); err != nil {
-		http.Error(w, fmt.Sprintf("signature verification failed! %v", err), http.StatusBadRequest)
+	// Reject firmware which doesn't advance the revision for the device, to
+	// prevent logged firmware being used to roll devices back.
+	s.revMu.Lock()
+	res, code, err := s.reserveRevision(fw)
+	s.revMu.Unlock()
+	if err != nil {
+		// A statement which has already been added is accepted again, so that
+		// publishers can safely retry.
+		if code != http.StatusConflict {
+			http.Error(w, err.Error(), code)
+			return
+		}
+		promise, dcode, derr := s.duplicatePromise(r.Context(), fw)
+		if derr != nil {
+			http.Error(w, derr.Error(), dcode)
+			return
+		}
+		if promise == nil {
+			http.Error(w, err.Error(), code)
+			return
+		}
+		if code, err := s.storeImage(fw); err != nil {
+			http.Error(w, err.Error(), code)
+			return
+		}
+		glog.V(1).Infof("Firmware %+v was already added", fw.meta)
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write(promise)
 		return
 	}
-	if stmt.Type != api.FirmwareMetadataType {
-		http.Error(w, fmt.Sprintf("Expected statement type %q, but got %q", api.FirmwareMetadataType, stmt.Type), http.StatusBadRequest)
+	promise, code, err := s.logFirmware(r.Context(), fw)
+	if err != nil {
+		s.releaseRevisions(res)
+		http.Error(w, err.Error(), code)
 		return
 	}
-
-	// Parse the firmware metadata:
-	var meta api.FirmwareMetadata
-	if err := json.Unmarshal(stmt.Statement, &meta); err != nil {
-		http.Error(w, fmt.Sprintf("failed to unmarshal metadata: %q", err.Error()), http.StatusBadRequest)
+	// The firmware is logged, so its revision stays reserved even if this
+	// fails. Resubmitting it will store the image.
+	if code, err := s.storeImage(fw); err != nil {
+		http.Error(w, err.Error(), code)
 		return
 	}
 
-	glog.V(1).Infof("Got firmware %+v", meta)
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write(promise)
+}
+
+// addFirmwareBatch handles requests to log many new firmware images at once.
+// It expects a mime/multipart POST consisting of pairs of SignedStatement and
+// then firmware bytes, as for addFirmware.
+//
+// Every entry is checked before any are logged. If any entry is rejected then
+// none are logged, and the response has status BadRequest. Otherwise all of
+// the entries are logged and the response has status OK, though individual
+// entries may still have failed to be logged. In both cases the body is an
+// api.AddFirmwareBatchResponse holding the result for each entry.
+func (s *Server) addFirmwareBatch(w http.ResponseWriter, r *http.Request) {
+	mr, err := multipartReader(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to parse request: %q", err.Error()), http.StatusBadRequest)
+		return
+	}
 
-	// Check the firmware bytes matches the manifest
-	h := sha512.Sum512(image)
-	if !bytes.Equal(h[:], meta.FirmwareImageSHA512) {
-		http.Error(w, fmt.Sprintf("uploaded image does not match SHA512 in metadata (%x != %x)", h[:], meta.FirmwareImageSHA512), http.StatusBadRequest)
+	var fws []firmwareEntry
+	defer func() {
+		for _, fw := range fws {
+			fw.discard()
+		}
+	}()
+	var results []api.AddFirmwareResult
+	rejected := false
+	for {
+		fw, code, err := s.readFirmware(mr)
+		if err == io.EOF {
+			break
+		}
+		if len(fws) == maxBatchSize {
+			fw.discard()
+			http.Error(w, fmt.Sprintf("failed to parse request: too many entries, at most %d are allowed", maxBatchSize), http.StatusBadRequest)
+			return
+		}
+		var res api.AddFirmwareResult
+		if err != nil {
+			if code != http.StatusBadRequest || errors.Is(err, errMalformed) {
+				// The rest of the request can't be trusted or read, so fail it all.
+				http.Error(w, err.Error(), code)
+				return
+			}
+			res = api.AddFirmwareResult{Code: code, Error: err.Error()}
+			rejected = true
+		}
+		fws = append(fws, fw)
+		results = append(results, res)
+	}
+	if len(fws) == 0 {
+		http.Error(w, "failed to parse request: expected pairs of firmware statement and image, got none", http.StatusBadRequest)
 		return
 	}
 
-	if err := s.cas.Store((h[:]), image); err != nil {
-		http.Error(w, fmt.Sprintf("failed to store image in CAS %v", err), http.StatusInternalServerError)
+	// Revisions must also increase between entries for the same device within
+	// the batch, which reserving them in order ensures.
+	reserved := make([]*reservation, len(fws))
+	s.revMu.Lock()
+	for i, fw := range fws {
+		if results[i].Code != 0 {
+			continue
+		}
+		res, code, err := s.reserveRevision(fw)
+		if err != nil {
+			results[i] = api.AddFirmwareResult{Code: code, Error: err.Error()}
+			continue
+		}
+		reserved[i] = &res
 	}
-	if err := s.c.AddSignedStatement(r.Context(), statement); err != nil {
-		http.Error(w, fmt.Sprintf("failed to log firmware to Trillian %v", err), http.StatusInternalServerError)
+	s.revMu.Unlock()
+	// Entries which have already been added are given a new promise. An entry
+	// repeated within the batch is still rejected, as the earlier one has
+	// only been reserved and may yet fail to be logged.
+	for i, fw := range fws {
+		if results[i].Code != http.StatusConflict {
+			if results[i].Code != 0 {
+				rejected = true
+			}
+			continue
+		}
+		if repeatsReserved(fws[:i], reserved[:i], fw) {
+			rejected = true
+			continue
+		}
+		promise, dcode, derr := s.duplicatePromise(r.Context(), fw)
+		if derr == nil && promise != nil {
+			dcode, derr = s.storeImage(fw)
+		}
+		switch {
+		case derr != nil:
+			results[i] = api.AddFirmwareResult{Code: dcode, Error: derr.Error()}
+		case promise != nil:
+			results[i] = api.AddFirmwareResult{Code: http.StatusOK, Promise: promise}
+			continue
+		}
+		rejected = true
+	}
+
+	code := http.StatusOK
+	if rejected {
+		code = http.StatusBadRequest
+		var held []reservation
+		for i := range results {
+			if reserved[i] != nil {
+				held = append(held, *reserved[i])
+			}
+			if results[i].Code == 0 || len(results[i].Promise) > 0 {
+				results[i] = api.AddFirmwareResult{Code: http.StatusFailedDependency, Error: "not logged as other entries in the batch were rejected"}
+			}
+		}
+		s.releaseRevisions(held...)
+	} else {
+		var failed []reservation
+		for i, fw := range fws {
+			if len(results[i].Promise) > 0 {
+				// Already added.
+				continue
+			}
+			promise, code, err := s.logFirmware(r.Context(), fw)
+			if err != nil {
+				results[i] = api.AddFirmwareResult{Code: code, Error: err.Error()}
+				failed = append(failed, *reserved[i])
+				continue
+			}
+			if code, err := s.storeImage(fw); err != nil {
+				results[i] = api.AddFirmwareResult{Code: code, Error: err.Error()}
+				continue
+			}
+			results[i] = api.AddFirmwareResult{Code: http.StatusOK, Promise: promise}
+		}
+		s.releaseRevisions(failed...)
+		glog.V(1).Infof("Logged batch of %d firmware entries", len(fws))
 	}
 
+	js, err := json.Marshal(api.AddFirmwareBatchResponse{Results: results})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(js)
 }
 
-// parseAddFirmwareRequest returns the bytes for the SignedStatement, and the firmware image respectively.
-func parseAddFirmwareRequest(r *http.Request) ([]byte, []byte, error) {
-	h := r.Header["Content-Type"]
-	if len(h) == 0 {
-		return nil, nil, fmt.Errorf("no content-type header")
+// errMalformed is wrapped by errors from readFirmware if the request body
+// couldn't be parsed, rather than an entry in it being unacceptable.
+var errMalformed = errors.New("failed to parse request")
+
+// readFirmware reads the next SignedStatement and firmware image from the
+// multipart request. If the statement is acceptable then the image is
+// streamed to a temporary file, and checked against the hash in the statement.
+// If there are no more parts then io.EOF is returned.
+// If the firmware is not acceptable, the HTTP status code to return is given
+// along with the error. The image part is always consumed, so that following
+// entries can be read unless the error wraps errMalformed.
+func (s *Server) readFirmware(mr *multipart.Reader) (firmwareEntry, int, error) {
+	p, err := mr.NextPart()
+	if err == io.EOF {
+		return firmwareEntry{}, http.StatusBadRequest, err
+	}
+	if err != nil {
+		return firmwareEntry{}, http.StatusBadRequest, fmt.Errorf("%w: failed to find firmware statement in request body: %v", errMalformed, err)
+	}
+	statement, err := ioutil.ReadAll(io.LimitReader(p, maxStatementSize+1))
+	if err != nil {
+		return firmwareEntry{}, http.StatusBadRequest, fmt.Errorf("%w: failed to read body of firmware statement: %v", errMalformed, err)
+	}
+	image, err := mr.NextPart()
+	if err != nil {
+		return firmwareEntry{}, http.StatusBadRequest, fmt.Errorf("%w: failed to find firmware image in request body: %v", errMalformed, err)
+	}
+	if len(statement) > maxStatementSize {
+		return firmwareEntry{}, http.StatusBadRequest, fmt.Errorf("firmware statement is larger than %d bytes", maxStatementSize)
 	}
 
-	mediaType, mediaParams, err := mime.ParseMediaType(h[0])
+	fw, code, err := s.checkFirmware(statement)
 	if err != nil {
-		return nil, nil, err
+		return firmwareEntry{}, code, err
 	}
-	if !strings.HasPrefix(mediaType, "multipart/") {
-		return nil, nil, fmt.Errorf("expecting mime multipart body")
+
+	f, err := ioutil.TempFile("", "ft-image-")
+	if err != nil {
+		return firmwareEntry{}, http.StatusInternalServerError, fmt.Errorf("failed to stage image: %v", err)
 	}
-	boundary := mediaParams["boundary"]
-	if len(boundary) == 0 {
-		return nil, nil, fmt.Errorf("invalid mime multipart header - no boundary specified")
+	fw.image = f
+	h := sha512.New()
+	if _, err := io.Copy(f, io.TeeReader(image, h)); err != nil {
+		fw.discard()
+		return firmwareEntry{}, http.StatusInternalServerError, fmt.Errorf("failed to stage image: %v", err)
 	}
-	mr := multipart.NewReader(r.Body, boundary)
+	if got, want := h.Sum(nil), fw.meta.FirmwareImageSHA512; !bytes.Equal(got, want) {
+		fw.discard()
+		return firmwareEntry{}, http.StatusBadRequest, fmt.Errorf("uploaded image does not match SHA512 in metadata: got %x, want %x", got, want)
+	}
+	return fw, http.StatusOK, nil
+}
 
-	// Get firmware statement (JSON)
-	p, err := mr.NextPart()
+// storeImage puts the staged image for the firmware into the CAS. This must
+// only be done once the firmware has been logged, so that the CAS only holds
+// images for logged firmware. Storing an image again is harmless, so a
+// resubmission can complete a previous failure.
+// If this fails, the HTTP status code to return is given along with the error.
+func (s *Server) storeImage(fw firmwareEntry) (int, error) {
+	if _, err := fw.image.Seek(0, io.SeekStart); err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("failed to read staged image: %v", err)
+	}
+	if err := s.cas.Store(fw.meta.FirmwareImageSHA512, fw.image); err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("failed to store image in CAS %v", err)
+	}
+	return http.StatusOK, nil
+}
+
+// checkFirmware parses the SignedStatement for a firmware image, and checks
+// that it's signed by a trusted claimant.
+// If the firmware is not acceptable, the HTTP status code to return is given
+// along with the error.
+func (s *Server) checkFirmware(statement []byte) (firmwareEntry, int, error) {
+	stmt := api.SignedStatement{}
+	if err := json.NewDecoder(bytes.NewReader(statement)).Decode(&stmt); err != nil {
+		return firmwareEntry{}, http.StatusBadRequest, fmt.Errorf("failed to decode statement: %q", err.Error())
+	}
+
+	if stmt.Type != api.FirmwareMetadataType {
+		return firmwareEntry{}, http.StatusBadRequest, fmt.Errorf("Expected statement type %q, but got %q", api.FirmwareMetadataType, stmt.Type)
+	}
+
+	// Parse the firmware metadata:
+	var meta api.FirmwareMetadata
+	if err := json.Unmarshal(stmt.Statement, &meta); err != nil {
+		return firmwareEntry{}, http.StatusBadRequest, fmt.Errorf("failed to unmarshal metadata: %q", err.Error())
+	}
+	if err := meta.ValidateIDs(); err != nil {
+		return firmwareEntry{}, http.StatusBadRequest, fmt.Errorf("invalid metadata: %v", err)
+	}
+	if len(meta.FirmwareImageSHA512) != sha512.Size {
+		return firmwareEntry{}, http.StatusBadRequest, fmt.Errorf("invalid metadata: FirmwareImageSHA512 has %d bytes, want %d", len(meta.FirmwareImageSHA512), sha512.Size)
+	}
+
+	// Verify the signature was made by a claimant trusted for the vendor's device:
+	if err := s.claimants.VerifySignature(stmt.Type, meta.VendorID, meta.DeviceID, stmt.Statement, stmt.Signature); err != nil {
+		return firmwareEntry{}, http.StatusBadRequest, fmt.Errorf("signature verification failed! %v", err)
+	}
+	return firmwareEntry{
+		statement: statement,
+		meta:      meta,
+	}, http.StatusOK, nil
+}
+
+// repeatsReserved returns whether the firmware statement is the same as one of
+// the entries with a reservation.
+func repeatsReserved(fws []firmwareEntry, reserved []*reservation, fw firmwareEntry) bool {
+	for i, f := range fws {
+		if reserved[i] != nil && bytes.Equal(f.statement, fw.statement) {
+			return true
+		}
+	}
+	return false
+}
+
+// reservation is a firmware revision which has been recorded for a device
+// before the firmware is logged. It must be released if the firmware can't
+// be logged.
+type reservation struct {
+	deviceID string
+	rec      revisions.Record
+	// prev is the record which was replaced, or nil if there was none.
+	prev *revisions.Record
+}
+
+// reserveRevision checks that the firmware revision is greater than any
+// already recorded for the device, and records it. Recording it before the
+// firmware is logged means it's enforced even if the server restarts before
+// the firmware is integrated. If the revision is not acceptable, the HTTP
+// status code to return is given along with the error.
+// s.revMu must be held.
+func (s *Server) reserveRevision(fw firmwareEntry) (reservation, int, error) {
+	meta := fw.meta
+	deviceID := meta.QualifiedDeviceID()
+	latest, ok, err := s.revs.Latest(deviceID)
+	if err != nil {
+		return reservation{}, http.StatusInternalServerError, fmt.Errorf("failed to look up revision for %q: %v", deviceID, err)
+	}
+	if ok && meta.FirmwareRevision <= latest.Revision {
+		return reservation{}, http.StatusConflict, fmt.Errorf("firmware revision %d for %q is not greater than logged revision %d", meta.FirmwareRevision, deviceID, latest.Revision)
+	}
+	res := reservation{deviceID: deviceID, rec: revisions.Record{Revision: meta.FirmwareRevision, LeafHash: verify.HashLeaf(fw.statement)}}
+	if ok {
+		res.prev = &latest
+	}
+	raised, err := s.revs.Raise(deviceID, res.rec)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to find firmware statement in request body: %v", err)
+		return reservation{}, http.StatusInternalServerError, fmt.Errorf("failed to record revision for %q: %v", deviceID, err)
+	}
+	if !raised {
+		return reservation{}, http.StatusConflict, fmt.Errorf("firmware revision %d for %q is not greater than logged revision", meta.FirmwareRevision, deviceID)
+	}
+	return res, http.StatusOK, nil
+}
+
+// releaseRevisions undoes the reservations for firmware which wasn't logged.
+// The reservations must be in the order they were made.
+func (s *Server) releaseRevisions(rs ...reservation) {
+	s.revMu.Lock()
+	defer s.revMu.Unlock()
+	for i := len(rs) - 1; i >= 0; i-- {
+		r := rs[i]
+		if err := s.revs.Restore(r.deviceID, r.rec, r.prev); err != nil {
+			// The revision stays reserved, which still prevents rollbacks.
+			glog.Errorf("Failed to release revision %d for %q: %v", r.rec.Revision, r.deviceID, err)
+		}
+	}
+}
+
+// logFirmware adds the firmware statement to the log, returning the signed
+// inclusion promise for it. Its revision must already be reserved.
+func (s *Server) logFirmware(ctx context.Context, fw firmwareEntry) ([]byte, int, error) {
+	if err := s.c.AddSignedStatement(ctx, fw.statement); err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to log firmware to Trillian %v", err)
 	}
-	rawJSON, err := ioutil.ReadAll(p)
+	return s.issuePromise(fw.statement)
+}
+
+// duplicatePromise returns a new inclusion promise for the firmware statement
+// if it has already been added to the log, or nil if it hasn't. The statement
+// has been added if it's the one recorded for the latest revision of the
+// device, or if it's already in the log.
+// If this fails, the HTTP status code to return is given along with the error.
+func (s *Server) duplicatePromise(ctx context.Context, fw firmwareEntry) ([]byte, int, error) {
+	lh := verify.HashLeaf(fw.statement)
+	latest, ok, err := s.revs.Latest(fw.meta.QualifiedDeviceID())
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to read body of firmware statement: %v", err)
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to look up revision for %q: %v", fw.meta.QualifiedDeviceID(), err)
 	}
+	if ok && latest.Revision == fw.meta.FirmwareRevision && bytes.Equal(latest.LeafHash, lh) {
+		return s.issuePromise(fw.statement)
+	}
+	size := s.c.Root().TreeSize
+	if size == 0 {
+		return nil, http.StatusOK, nil
+	}
+	if _, _, err := s.c.InclusionProofByHash(ctx, lh, size); err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, http.StatusOK, nil
+		}
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to look up statement in log: %v", err)
+	}
+	return s.issuePromise(fw.statement)
+}
 
-	// Get firmware binary image
-	p, err = mr.NextPart()
+// issuePromise signs an inclusion promise for the statement.
+// If this fails, the HTTP status code to return is given along with the error.
+func (s *Server) issuePromise(statement []byte) ([]byte, int, error) {
+	promise, err := s.promise(statement)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to find firmware image in request body: %v", err)
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to sign inclusion promise: %v", err)
 	}
-	image, err := ioutil.ReadAll(p)
+	return promise, http.StatusOK, nil
+}
+
+// promise returns a signed api.InclusionPromise that the statement will be
+// included in the log within the maximum merge delay from now.
+func (s *Server) promise(statement []byte) ([]byte, error) {
+	p := api.InclusionPromise{
+		LeafHash:       verify.HashLeaf(statement),
+		TimestampNanos: uint64(time.Now().UnixNano()),
+		MaxMergeDelay:  s.mmd,
+	}
+	return note.Sign(&note.Note{Text: string(p.Marshal())}, s.signer)
+}
+
+// multipartReader returns a reader for the parts of a mime/multipart request.
+func multipartReader(r *http.Request) (*multipart.Reader, error) {
+	h := r.Header["Content-Type"]
+	if len(h) == 0 {
+		return nil, fmt.Errorf("no content-type header")
+	}
+
+	mediaType, mediaParams, err := mime.ParseMediaType(h[0])
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to read body of firmware image: %v", err)
+		return nil, err
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		return nil, fmt.Errorf("expecting mime multipart body")
+	}
+	boundary := mediaParams["boundary"]
+	if len(boundary) == 0 {
+		return nil, fmt.Errorf("invalid mime multipart header - no boundary specified")
 	}
-	return rawJSON, image, nil
+	return multipart.NewReader(r.Body, boundary), nil
 }
 
 // getConsistency returns consistency proofs between published tree sizes.
@@ -311,19 +825,89 @@ func (s *Server) getManifestEntryAndProof(w http.ResponseWriter, r *http.Request
 	w.Write(js)
 }
 
+// maxEntriesPerRequest is the maximum number of entries returned by getEntries.
+const maxEntriesPerRequest = 256
+
+// getEntries returns consecutive entries from the log, starting at the
+// requested index, each with an inclusion proof to the requested tree size.
+// Fewer entries than were requested may be returned.
+func (s *Server) getEntries(w http.ResponseWriter, r *http.Request) {
+	start, err := parseIntParam(r, "start")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	end, err := parseIntParam(r, "end")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	treeSize, err := parseIntParam(r, "treesize")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Validation on the range and tree size being requested.
+	if start >= end {
+		http.Error(w, fmt.Sprintf("start %d >= end %d", start, end), http.StatusBadRequest)
+		return
+	}
+	if end > treeSize {
+		http.Error(w, fmt.Sprintf("end %d > treesize %d", end, treeSize), http.StatusBadRequest)
+		return
+	}
+	goldenSize := s.c.Root().TreeSize
+	if treeSize > goldenSize {
+		http.Error(w, fmt.Sprintf("requested tree size %d > current tree size %d", treeSize, goldenSize), http.StatusBadRequest)
+		return
+	}
+	if end-start > maxEntriesPerRequest {
+		end = start + maxEntriesPerRequest
+	}
+
+	resp := api.GetEntriesResponse{
+		Entries: make([]api.InclusionProof, 0, end-start),
+	}
+	for i := start; i < end; i++ {
+		data, proof, err := s.c.FirmwareManifestAtIndex(r.Context(), i, treeSize)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to get leaf %d & inclusion proof: %v", i, err), http.StatusInternalServerError)
+			return
+		}
+		resp.Entries = append(resp.Entries, api.InclusionProof{
+			Value:     data,
+			LeafIndex: i,
+			Proof:     proof,
+		})
+	}
+
+	js, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(js)
+}
+
 // getRoot returns a recent tree root.
 func (s *Server) getRoot(w http.ResponseWriter, r *http.Request) {
 	sth := s.c.Root()
 	checkpoint := api.LogCheckpoint{
 		Checkpoint: log.Checkpoint{
-			Ecosystem: api.FTLogCheckpointEcosystemv0,
+			Ecosystem: api.FTLogCheckpointEcosystemv1,
 			Size:      sth.TreeSize,
 			Hash:      sth.RootHash,
 		},
 		TimestampNanos: sth.TimestampNanos,
 	}
+	cpRaw, err := checkpoint.Marshal()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	n := &note.Note{
-		Text: string(checkpoint.Marshal()),
+		Text: string(cpRaw),
 	}
 	b, err := note.Sign(n, s.signer)
 	if err != nil {
@@ -335,6 +919,7 @@ func (s *Server) getRoot(w http.ResponseWriter, r *http.Request) {
 }
 
 // getFirmwareImage returns a firmware image stored in the CAS.
+// Range requests are supported, so that large images can be fetched in parts.
 func (s *Server) getFirmwareImage(w http.ResponseWriter, r *http.Request) {
 	hash, err := parseBase64Param(r, "hash")
 	if err != nil {
@@ -347,10 +932,13 @@ func (s *Server) getFirmwareImage(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), httpStatusForErr(err))
 		return
 	}
+	defer image.Close()
 
+	// Images never change, so the hash makes an ideal ETag. This allows
+	// clients to resume interrupted downloads using range requests.
 	w.Header().Set("Content-Type", "application/binary")
-	w.Header().Set("Content-Length", strconv.Itoa(len(image)))
-	w.Write(image)
+	w.Header().Set("ETag", fmt.Sprintf("%q", hex.EncodeToString(hash)))
+	http.ServeContent(w, r, "", time.Time{}, image)
 }
 
 // addAnnotationMalware handles requests to annotate a logged firmware with a malware annotation.
@@ -368,10 +956,6 @@ func (s *Server) addAnnotationMalware(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := crypto.AnnotatorMalware.VerifySignature(ss.Type, ss.Statement, ss.Signature); err != nil {
-		http.Error(w, fmt.Sprintf("signature verification failed! %v", err), http.StatusBadRequest)
-		return
-	}
 	if ss.Type != api.MalwareStatementType {
 		http.Error(w, fmt.Sprintf("expected statement type %q, but got %q", api.MalwareStatementType, ss.Type), http.StatusBadRequest)
 		return
@@ -384,31 +968,63 @@ func (s *Server) addAnnotationMalware(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Now check that the annotation points at something which is actually in this log.
-	fwbs, _, err := s.c.FirmwareManifestAtIndex(r.Context(), malwareStmt.FirmwareID.LogIndex, malwareStmt.FirmwareID.LogIndex+1)
+	meta, code, err := s.firmwareForID(r.Context(), malwareStmt.FirmwareID)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("failed to validate firmware: %q", err.Error()), http.StatusInternalServerError)
+		http.Error(w, err.Error(), code)
 		return
 	}
-	var fwss api.SignedStatement
-	if err := json.Unmarshal(fwbs, &fwss); err != nil {
-		http.Error(w, fmt.Sprintf("failed to unmarshal statement: %q", err.Error()), http.StatusInternalServerError)
+	if err := s.claimants.VerifySignature(ss.Type, meta.VendorID, meta.DeviceID, ss.Statement, ss.Signature); err != nil {
+		http.Error(w, fmt.Sprintf("signature verification failed! %v", err), http.StatusBadRequest)
 		return
 	}
-	if fwss.Type != api.FirmwareMetadataType {
-		http.Error(w, fmt.Sprintf("statement at index %d is not firmware", malwareStmt.FirmwareID.LogIndex), http.StatusBadRequest)
+
+	glog.V(1).Infof("Got MalwareStatement %+v", malwareStmt)
+
+	if err := s.c.AddSignedStatement(r.Context(), rawStmt); err != nil {
+		http.Error(w, fmt.Sprintf("failed to log firmware to Trillian %v", err), http.StatusInternalServerError)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+}
+
+// addAnnotationRevocation handles requests to revoke a logged firmware.
+func (s *Server) addAnnotationRevocation(w http.ResponseWriter, r *http.Request) {
+	ss := api.SignedStatement{}
+
+	// Store the original bytes as statement to avoid a round-trip (de)serialization.
+	rawStmt, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	var meta api.FirmwareMetadata
-	if err := json.Unmarshal(fwss.Statement, &meta); err != nil {
-		http.Error(w, fmt.Sprintf("failed to unmarshal firmware: %q", err.Error()), http.StatusInternalServerError)
+	if err := json.NewDecoder(bytes.NewReader(rawStmt)).Decode(&ss); err != nil {
+		http.Error(w, fmt.Sprintf("failed to decode statement: %q", err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	if ss.Type != api.RevocationStatementType {
+		http.Error(w, fmt.Sprintf("expected statement type %q, but got %q", api.RevocationStatementType, ss.Type), http.StatusBadRequest)
 		return
 	}
-	if !bytes.Equal(meta.FirmwareImageSHA512, malwareStmt.FirmwareID.FirmwareImageSHA512) {
-		http.Error(w, fmt.Sprintf("wrong firmware hash at index %d; got %x but expected %x", malwareStmt.FirmwareID.LogIndex, malwareStmt.FirmwareID.FirmwareImageSHA512, meta.FirmwareImageSHA512), http.StatusInternalServerError)
+	var revocationStmt api.RevocationStatement
+	if err := json.Unmarshal(ss.Statement, &revocationStmt); err != nil {
+		http.Error(w, fmt.Sprintf("failed to unmarshal RevocationStatement: %q", err.Error()), http.StatusBadRequest)
 		return
 	}
 
-	glog.V(1).Infof("Got MalwareStatement %+v", malwareStmt)
+	// Now check that the revocation points at something which is actually in this log,
+	// and that it was signed by a claimant trusted to revoke firmware for that device.
+	meta, code, err := s.firmwareForID(r.Context(), revocationStmt.FirmwareID)
+	if err != nil {
+		http.Error(w, err.Error(), code)
+		return
+	}
+	if err := s.claimants.VerifySignature(ss.Type, meta.VendorID, meta.DeviceID, ss.Statement, ss.Signature); err != nil {
+		http.Error(w, fmt.Sprintf("signature verification failed! %v", err), http.StatusBadRequest)
+		return
+	}
+
+	glog.V(1).Infof("Got RevocationStatement %+v", revocationStmt)
 
 	if err := s.c.AddSignedStatement(r.Context(), rawStmt); err != nil {
 		http.Error(w, fmt.Sprintf("failed to log firmware to Trillian %v", err), http.StatusInternalServerError)
@@ -417,6 +1033,31 @@ func (s *Server) addAnnotationMalware(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 }
 
+// firmwareForID returns the metadata of the firmware entry in the log which id
+// refers to. If there is no such entry, the HTTP status code to respond with is
+// returned along with the error.
+func (s *Server) firmwareForID(ctx context.Context, id api.FirmwareID) (api.FirmwareMetadata, int, error) {
+	var meta api.FirmwareMetadata
+	fwbs, _, err := s.c.FirmwareManifestAtIndex(ctx, id.LogIndex, id.LogIndex+1)
+	if err != nil {
+		return meta, http.StatusInternalServerError, fmt.Errorf("failed to validate firmware: %q", err.Error())
+	}
+	var fwss api.SignedStatement
+	if err := json.Unmarshal(fwbs, &fwss); err != nil {
+		return meta, http.StatusInternalServerError, fmt.Errorf("failed to unmarshal statement: %q", err.Error())
+	}
+	if fwss.Type != api.FirmwareMetadataType {
+		return meta, http.StatusBadRequest, fmt.Errorf("statement at index %d is not firmware", id.LogIndex)
+	}
+	if err := json.Unmarshal(fwss.Statement, &meta); err != nil {
+		return meta, http.StatusInternalServerError, fmt.Errorf("failed to unmarshal firmware: %q", err.Error())
+	}
+	if !bytes.Equal(meta.FirmwareImageSHA512, id.FirmwareImageSHA512) {
+		return meta, http.StatusInternalServerError, fmt.Errorf("wrong firmware hash at index %d; got %x but expected %x", id.LogIndex, id.FirmwareImageSHA512, meta.FirmwareImageSHA512)
+	}
+	return meta, http.StatusOK, nil
+}
+
 // httpStatusForErr maps status codes to HTTP errors.
 func httpStatusForErr(e error) int {
 	switch status.Code(e) {
@@ -433,10 +1074,13 @@ func httpStatusForErr(e error) int {
 // RegisterHandlers registers HTTP handlers for firmware transparency endpoints.
 func (s *Server) RegisterHandlers(r *mux.Router) {
 	r.HandleFunc(fmt.Sprintf("/%s", api.HTTPAddFirmware), s.addFirmware).Methods("POST")
+	r.HandleFunc(fmt.Sprintf("/%s", api.HTTPAddFirmwareBatch), s.addFirmwareBatch).Methods("POST")
 	r.HandleFunc(fmt.Sprintf("/%s", api.HTTPAddAnnotationMalware), s.addAnnotationMalware).Methods("POST")
+	r.HandleFunc(fmt.Sprintf("/%s", api.HTTPAddAnnotationRevocation), s.addAnnotationRevocation).Methods("POST")
 	r.HandleFunc(fmt.Sprintf("/%s/from/{from:[0-9]+}/to/{to:[0-9]+}", api.HTTPGetConsistency), s.getConsistency).Methods("GET")
 	r.HandleFunc(fmt.Sprintf("/%s/for-leaf-hash/{hash}/in-tree-of/{treesize:[0-9]+}", api.HTTPGetInclusion), s.getInclusionByHash).Methods("GET")
 	r.HandleFunc(fmt.Sprintf("/%s/at/{index:[0-9]+}/in-tree-of/{treesize:[0-9]+}", api.HTTPGetManifestEntryAndProof), s.getManifestEntryAndProof).Methods("GET")
+	r.HandleFunc(fmt.Sprintf("/%s", api.HTTPGetEntries), s.getEntries).Methods("GET").Queries("start", "{start:[0-9]+}", "end", "{end:[0-9]+}", "treesize", "{treesize:[0-9]+}")
 	r.HandleFunc(fmt.Sprintf("/%s/with-hash/{hash}", api.HTTPGetFirmwareImage), s.getFirmwareImage).Methods("GET")
 	r.HandleFunc(fmt.Sprintf("/%s", api.HTTPGetRoot), s.getRoot).Methods("GET")
 }
@@ -15,22 +15,33 @@
 package http
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha512"
+	"database/sql"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	gomock "github.com/golang/mock/gomock"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/trillian-examples/binary_transparency/firmware/api"
+	"github.com/google/trillian-examples/binary_transparency/firmware/cmd/ft_personality/internal/cas"
+	"github.com/google/trillian-examples/binary_transparency/firmware/cmd/ft_personality/internal/revisions"
 	"github.com/google/trillian-examples/binary_transparency/firmware/internal/crypto"
+	"github.com/google/trillian-examples/binary_transparency/firmware/internal/verify"
 	"github.com/google/trillian/types"
 	"github.com/gorilla/mux"
+	_ "github.com/mattn/go-sqlite3" // Load drivers for sqlite3
 	"golang.org/x/mod/sumdb/note"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -48,17 +59,17 @@ func TestRoot(t *testing.T) {
 		{
 			desc:     "valid 1",
 			root:     types.LogRootV1{TreeSize: 1, TimestampNanos: 123, RootHash: []byte{0x12, 0x34}},
-			wantBody: "Firmware Transparency Log v0\n1\nEjQ=\n123\n",
+			wantBody: "Firmware Transparency Log v1\n1\nEjQ=\nTimestamp 123\n",
 		}, {
 			desc:     "valid 2",
 			root:     types.LogRootV1{TreeSize: 10, TimestampNanos: 1230, RootHash: []byte{0x34, 0x12}},
-			wantBody: "Firmware Transparency Log v0\n10\nNBI=\n1230\n",
+			wantBody: "Firmware Transparency Log v1\n10\nNBI=\nTimestamp 1230\n",
 		},
 	} {
 		t.Run(test.desc, func(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			mt := NewMockTrillian(ctrl)
-			server := NewServer(mt, FakeCAS{}, testSigner)
+			server := NewServer(mt, FakeCAS{}, FakeRevisions{}, testSigner, time.Minute, crypto.DemoRegistry())
 
 			mt.EXPECT().Root().Return(&test.root)
 
@@ -99,7 +110,7 @@ func b64Decode(t *testing.T, b64 string) []byte {
 func TestAddFirmware(t *testing.T) {
 	testSigner, _ := note.NewSigner(crypto.TestFTPersonalityPriv)
 	st := b64Decode(t, "eyJEZXZpY2VJRCI6IlRhbGtpZVRvYXN0ZXIiLCJGaXJtd2FyZVJldmlzaW9uIjoxLCJGaXJtd2FyZUltYWdlU0hBNTEyIjoiMTRxN0JVSnphR1g1UndSU0ZnbkNNTnJBT2k4Mm5RUTZ3aExXa3p1UlFRNEdPWjQzK2NYTWlFTnFNWE56TU1ISTdNc3NMNTgzVFdMM0ZrTXFNdFVQckE9PSIsIkV4cGVjdGVkRmlybXdhcmVNZWFzdXJlbWVudCI6IiIsIkJ1aWxkVGltZXN0YW1wIjoiMjAyMC0xMS0xN1QxMzozMDoxNFoifQ==")
-	sign, err := crypto.Publisher.SignMessage(api.FirmwareMetadataType, st)
+	sign, err := mustLoadClaimant(t, "vendor").SignMessage(api.FirmwareMetadataType, st)
 	if err != nil {
 		t.Fatalf("signing failed, bailing out!: %v", err)
 	}
@@ -178,7 +189,7 @@ func TestAddFirmware(t *testing.T) {
 		t.Run(test.desc, func(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			mt := NewMockTrillian(ctrl)
-			server := NewServer(mt, FakeCAS{}, testSigner)
+			server := NewServer(mt, FakeCAS{}, FakeRevisions{}, testSigner, time.Minute, crypto.DemoRegistry())
 
 			if test.wantTrillianCall {
 				mt.EXPECT().AddSignedStatement(gomock.Any(), gomock.Eq([]byte(test.wantManifest))).
@@ -204,6 +215,770 @@ func TestAddFirmware(t *testing.T) {
 	}
 }
 
+func TestAddFirmwareVendor(t *testing.T) {
+	testSigner, _ := note.NewSigner(crypto.TestFTPersonalityPriv)
+	vendor := mustLoadClaimant(t, "vendor")
+	acmeOnly := &crypto.Registry{}
+	acmeOnly.Add("acme", vendor, []api.StatementType{api.FirmwareMetadataType}, "acme", nil)
+	image := "hi"
+	h := sha512.Sum512([]byte(image))
+	fw := func(vendorID, deviceID string) []byte {
+		return mustSignStatement(t, vendor, api.FirmwareMetadataType, api.FirmwareMetadata{
+			VendorID:            vendorID,
+			DeviceID:            deviceID,
+			FirmwareRevision:    1,
+			FirmwareImageSHA512: h[:],
+		})
+	}
+
+	for _, test := range []struct {
+		desc             string
+		stmt             []byte
+		wantTrillianCall bool
+		wantStatus       int
+	}{
+		{
+			desc:             "vendor's own device",
+			stmt:             fw("acme", "toaster"),
+			wantTrillianCall: true,
+			wantStatus:       http.StatusOK,
+		}, {
+			desc:       "other vendor's device",
+			stmt:       fw("other", "toaster"),
+			wantStatus: http.StatusBadRequest,
+		}, {
+			desc:       "no vendor",
+			stmt:       fw("", "toaster"),
+			wantStatus: http.StatusBadRequest,
+		}, {
+			desc:       "ambiguous device",
+			stmt:       fw("acme", "other/toaster"),
+			wantStatus: http.StatusBadRequest,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mt := NewMockTrillian(ctrl)
+			server := NewServer(mt, FakeCAS{}, FakeRevisions{}, testSigner, time.Minute, acmeOnly)
+
+			if test.wantTrillianCall {
+				mt.EXPECT().AddSignedStatement(gomock.Any(), gomock.Eq(test.stmt)).Return(nil)
+			}
+
+			r := mux.NewRouter()
+			server.RegisterHandlers(r)
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			url := fmt.Sprintf("%s/%s", ts.URL, api.HTTPAddFirmware)
+			resp, err := ts.Client().Post(url, "multipart/form-data; boundary=mimeisfunlolol", strings.NewReader(addFirmwareBody(test.stmt, image)))
+			if err != nil {
+				t.Fatalf("error response: %v", err)
+			}
+			if got, want := resp.StatusCode, test.wantStatus; got != want {
+				body, _ := ioutil.ReadAll(resp.Body)
+				t.Errorf("status code got != want (%d, %d): %q", got, want, body)
+			}
+		})
+	}
+}
+
+func TestAddFirmwareRevisions(t *testing.T) {
+	testSigner, _ := note.NewSigner(crypto.TestFTPersonalityPriv)
+	vendor := mustLoadClaimant(t, "vendor")
+	image := "hi"
+	h := sha512.Sum512([]byte(image))
+	fw := func(vendorID string, revision uint64) []byte {
+		return mustSignStatement(t, vendor, api.FirmwareMetadataType, api.FirmwareMetadata{
+			VendorID:            vendorID,
+			DeviceID:            "dummy",
+			FirmwareRevision:    revision,
+			FirmwareImageSHA512: h[:],
+		})
+	}
+
+	for _, test := range []struct {
+		desc             string
+		stmt             []byte
+		trillianErr      error
+		wantTrillianCall bool
+		inLog            bool
+		wantStatus       int
+		wantRevisions    FakeRevisions
+	}{
+		{
+			desc:             "first revision for device",
+			stmt:             fw("other", 1),
+			wantTrillianCall: true,
+			wantStatus:       http.StatusOK,
+			wantRevisions:    FakeRevisions{"dummy": 5, "other/dummy": 1},
+		}, {
+			desc:             "newer revision",
+			stmt:             fw("", 6),
+			wantTrillianCall: true,
+			wantStatus:       http.StatusOK,
+			wantRevisions:    FakeRevisions{"dummy": 6},
+		}, {
+			desc:          "same revision",
+			stmt:          fw("", 5),
+			wantStatus:    http.StatusConflict,
+			wantRevisions: FakeRevisions{"dummy": 5},
+		}, {
+			desc:          "older revision",
+			stmt:          fw("", 4),
+			wantStatus:    http.StatusConflict,
+			wantRevisions: FakeRevisions{"dummy": 5},
+		}, {
+			desc:          "same statement already logged",
+			stmt:          fw("", 5),
+			inLog:         true,
+			wantStatus:    http.StatusOK,
+			wantRevisions: FakeRevisions{"dummy": 5},
+		}, {
+			desc:             "newer revision but trillian failure",
+			stmt:             fw("", 6),
+			trillianErr:      errors.New("boom"),
+			wantTrillianCall: true,
+			wantStatus:       http.StatusInternalServerError,
+			wantRevisions:    FakeRevisions{"dummy": 5},
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mt := NewMockTrillian(ctrl)
+			revs := FakeRevisions{"dummy": 5}
+			store := FakeCAS{}
+			server := NewServer(mt, store, revs, testSigner, time.Minute, crypto.DemoRegistry())
+
+			if test.wantTrillianCall {
+				mt.EXPECT().AddSignedStatement(gomock.Any(), gomock.Eq(test.stmt)).Return(test.trillianErr)
+			}
+			mt.EXPECT().Root().Return(&types.LogRootV1{TreeSize: 10}).AnyTimes()
+			mt.EXPECT().InclusionProofByHash(gomock.Any(), gomock.Any(), uint64(10)).DoAndReturn(inLog(test.inLog, test.stmt)).AnyTimes()
+
+			r := mux.NewRouter()
+			server.RegisterHandlers(r)
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			url := fmt.Sprintf("%s/%s", ts.URL, api.HTTPAddFirmware)
+			resp, err := ts.Client().Post(url, "multipart/form-data; boundary=mimeisfunlolol", strings.NewReader(addFirmwareBody(test.stmt, image)))
+			if err != nil {
+				t.Fatalf("error response: %v", err)
+			}
+			body, _ := ioutil.ReadAll(resp.Body)
+			if got, want := resp.StatusCode, test.wantStatus; got != want {
+				t.Errorf("status code got != want (%d, %d): %q", got, want, body)
+			}
+			if resp.StatusCode == http.StatusOK {
+				checkPromise(t, body, test.stmt)
+			}
+			// The image is only stored if the firmware is logged.
+			if got, want := len(store) == 1, resp.StatusCode == http.StatusOK; got != want {
+				t.Errorf("got %d images in CAS, want image stored %t", len(store), want)
+			}
+			if diff := cmp.Diff(test.wantRevisions, revs); len(diff) != 0 {
+				t.Errorf("revisions diff: %s", diff)
+			}
+		})
+	}
+}
+
+func TestAddFirmwareRevisionNotReserved(t *testing.T) {
+	testSigner, _ := note.NewSigner(crypto.TestFTPersonalityPriv)
+	vendor := mustLoadClaimant(t, "vendor")
+	image := "hi"
+	h := sha512.Sum512([]byte(image))
+	fw6 := mustSignStatement(t, vendor, api.FirmwareMetadataType, api.FirmwareMetadata{
+		DeviceID:            "dummy",
+		FirmwareRevision:    6,
+		FirmwareImageSHA512: h[:],
+	})
+
+	ctrl := gomock.NewController(t)
+	mt := NewMockTrillian(ctrl)
+	revs := &failingRevisions{FakeRevisions: FakeRevisions{"dummy": 5}, fail: true}
+	server := NewServer(mt, FakeCAS{}, revs, testSigner, time.Minute, crypto.DemoRegistry())
+	mt.EXPECT().Root().Return(&types.LogRootV1{}).AnyTimes()
+	r := mux.NewRouter()
+	server.RegisterHandlers(r)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	for _, step := range []struct {
+		desc       string
+		fail       bool
+		wantLogged bool
+		wantStatus int
+	}{
+		{
+			desc:       "not reserved",
+			fail:       true,
+			wantStatus: http.StatusInternalServerError,
+		}, {
+			desc:       "reserved on retry",
+			wantLogged: true,
+			wantStatus: http.StatusOK,
+		},
+	} {
+		revs.fail = step.fail
+		if step.wantLogged {
+			mt.EXPECT().AddSignedStatement(gomock.Any(), gomock.Eq(fw6)).DoAndReturn(func(context.Context, []byte) error {
+				// The revision must be recorded before the firmware is logged.
+				if got := revs.FakeRevisions["dummy"]; got != 6 {
+					t.Errorf("%s: revision %d recorded while logging, want 6", step.desc, got)
+				}
+				return nil
+			})
+		}
+		url := fmt.Sprintf("%s/%s", ts.URL, api.HTTPAddFirmware)
+		resp, err := ts.Client().Post(url, "multipart/form-data; boundary=mimeisfunlolol", strings.NewReader(addFirmwareBody(fw6, image)))
+		if err != nil {
+			t.Fatalf("%s: error response: %v", step.desc, err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		if got, want := resp.StatusCode, step.wantStatus; got != want {
+			t.Errorf("%s: status code got != want (%d, %d): %q", step.desc, got, want, body)
+		}
+	}
+	if diff := cmp.Diff(FakeRevisions{"dummy": 6}, revs.FakeRevisions); len(diff) != 0 {
+		t.Errorf("revisions diff: %s", diff)
+	}
+}
+
+func TestAddFirmwareResubmitted(t *testing.T) {
+	testSigner, _ := note.NewSigner(crypto.TestFTPersonalityPriv)
+	vendor := mustLoadClaimant(t, "vendor")
+	fw := func(image string) []byte {
+		h := sha512.Sum512([]byte(image))
+		return mustSignStatement(t, vendor, api.FirmwareMetadataType, api.FirmwareMetadata{
+			DeviceID:            "dummy",
+			FirmwareRevision:    1,
+			FirmwareImageSHA512: h[:],
+		})
+	}
+	stmt, other := fw("hi"), fw("other")
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open temporary in-memory DB: %v", err)
+	}
+	defer db.Close()
+	revs, err := revisions.NewStorage(db)
+	if err != nil {
+		t.Fatalf("failed to create revisions storage: %v", err)
+	}
+
+	ctrl := gomock.NewController(t)
+	mt := NewMockTrillian(ctrl)
+	// The log hasn't integrated the statement, so resubmissions can only be
+	// recognized from the revisions storage.
+	mt.EXPECT().Root().Return(&types.LogRootV1{}).AnyTimes()
+	mt.EXPECT().AddSignedStatement(gomock.Any(), gomock.Eq(stmt)).Return(nil).Times(1)
+	newServer := func() *httptest.Server {
+		server := NewServer(mt, FakeCAS{}, revs, testSigner, time.Minute, crypto.DemoRegistry())
+		r := mux.NewRouter()
+		server.RegisterHandlers(r)
+		return httptest.NewServer(r)
+	}
+	ts := newServer()
+
+	for _, step := range []struct {
+		desc       string
+		restart    bool
+		stmt       []byte
+		image      string
+		wantStatus int
+	}{
+		{
+			desc:       "submitted",
+			stmt:       stmt,
+			image:      "hi",
+			wantStatus: http.StatusOK,
+		}, {
+			desc:       "resubmitted",
+			stmt:       stmt,
+			image:      "hi",
+			wantStatus: http.StatusOK,
+		}, {
+			desc:       "resubmitted after restart",
+			restart:    true,
+			stmt:       stmt,
+			image:      "hi",
+			wantStatus: http.StatusOK,
+		}, {
+			desc:       "other statement for revision",
+			stmt:       other,
+			image:      "other",
+			wantStatus: http.StatusConflict,
+		},
+	} {
+		if step.restart {
+			ts.Close()
+			ts = newServer()
+		}
+		url := fmt.Sprintf("%s/%s", ts.URL, api.HTTPAddFirmware)
+		resp, err := ts.Client().Post(url, "multipart/form-data; boundary=mimeisfunlolol", strings.NewReader(addFirmwareBody(step.stmt, step.image)))
+		if err != nil {
+			t.Fatalf("%s: error response: %v", step.desc, err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		if got, want := resp.StatusCode, step.wantStatus; got != want {
+			t.Fatalf("%s: status code got != want (%d, %d): %q", step.desc, got, want, body)
+		}
+		if resp.StatusCode == http.StatusOK {
+			checkPromise(t, body, step.stmt)
+		}
+	}
+	ts.Close()
+}
+
+func TestSeedRevisions(t *testing.T) {
+	vendor := mustLoadClaimant(t, "vendor")
+	fw := func(vendorID, deviceID string, revision uint64) []byte {
+		return mustSignStatement(t, vendor, api.FirmwareMetadataType, api.FirmwareMetadata{
+			VendorID:         vendorID,
+			DeviceID:         deviceID,
+			FirmwareRevision: revision,
+		})
+	}
+	leaves := [][]byte{
+		fw("", "dummy", 3),
+		fw("", "dummy", 7),
+		fw("acme", "dummy", 2),
+		mustSignStatement(t, vendor, api.RevocationStatementType, api.RevocationStatement{}),
+		fw("", "armory", 1),
+		fw("", "dummy", 4),
+	}
+
+	for _, test := range []struct {
+		desc     string
+		revs     FakeRevisions
+		seeded   uint64
+		want     FakeRevisions
+		wantSize uint64
+		leafErr  error
+		wantErr  bool
+	}{
+		{
+			desc:     "empty revisions",
+			revs:     FakeRevisions{},
+			want:     FakeRevisions{"dummy": 7, "acme/dummy": 2, "armory": 1},
+			wantSize: 6,
+		}, {
+			desc:     "revisions ahead of log",
+			revs:     FakeRevisions{"dummy": 9, "armory": 0},
+			want:     FakeRevisions{"dummy": 9, "acme/dummy": 2, "armory": 1},
+			wantSize: 6,
+		}, {
+			desc:     "only new leaves",
+			revs:     FakeRevisions{},
+			seeded:   3,
+			want:     FakeRevisions{"dummy": 4, "armory": 1},
+			wantSize: 6,
+		}, {
+			desc:     "already seeded",
+			revs:     FakeRevisions{"dummy": 7},
+			seeded:   6,
+			want:     FakeRevisions{"dummy": 7},
+			wantSize: 6,
+		}, {
+			desc:     "seeded beyond log",
+			revs:     FakeRevisions{},
+			seeded:   7,
+			want:     FakeRevisions{},
+			wantSize: 7,
+			wantErr:  true,
+		}, {
+			desc:    "log failure",
+			revs:    FakeRevisions{},
+			want:    FakeRevisions{},
+			leafErr: errors.New("boom"),
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mt := NewMockTrillian(ctrl)
+			mt.EXPECT().Root().Return(&types.LogRootV1{TreeSize: uint64(len(leaves))})
+			// Return fewer leaves than asked for, as a log may.
+			mt.EXPECT().LeavesByRange(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, start, count uint64) ([][]byte, error) {
+				if test.leafErr != nil {
+					return nil, test.leafErr
+				}
+				if start < test.seeded {
+					t.Errorf("LeavesByRange(%d, %d) reads leaves already seeded up to %d", start, count, test.seeded)
+				}
+				end := start + 2
+				if end > uint64(len(leaves)) {
+					end = uint64(len(leaves))
+				}
+				return leaves[start:end], nil
+			}).AnyTimes()
+
+			revs := &seededRevisions{FakeRevisions: test.revs, size: test.seeded}
+			err := SeedRevisions(context.Background(), mt, revs)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("SeedRevisions() = %v, want err %t", err, test.wantErr)
+			}
+			if diff := cmp.Diff(test.want, test.revs); len(diff) != 0 {
+				t.Errorf("revisions diff: %s", diff)
+			}
+			if got, want := revs.size, test.wantSize; got != want {
+				t.Errorf("got seeded size %d, want %d", got, want)
+			}
+		})
+	}
+}
+
+// addFirmwareBody returns the multipart body for an add-firmware request.
+func addFirmwareBody(stmt []byte, image string) string {
+	return strings.Join([]string{"--mimeisfunlolol",
+		"Content-Type: application/json",
+		"",
+		string(stmt),
+		"--mimeisfunlolol",
+		"Content-Type: application/octet-stream",
+		"",
+		image,
+		"--mimeisfunlolol--",
+		"",
+	}, "\n")
+}
+
+// checkPromise checks that the body is a valid inclusion promise for the statement.
+func checkPromise(t *testing.T, body, stmt []byte) {
+	t.Helper()
+	v, err := note.NewVerifier(crypto.TestFTPersonalityPub)
+	if err != nil {
+		t.Fatalf("failed to create verifier: %v", err)
+	}
+	p, err := api.ParseInclusionPromise(body, v)
+	if err != nil {
+		t.Fatalf("failed to parse promise %q: %v", body, err)
+	}
+	if got, want := p.LeafHash, verify.HashLeaf(stmt); !bytes.Equal(got, want) {
+		t.Errorf("promise has leaf hash %x, want %x", got, want)
+	}
+	if got, want := p.MaxMergeDelay, time.Minute; got != want {
+		t.Errorf("promise has max merge delay %v, want %v", got, want)
+	}
+	if d := time.Until(p.Deadline()); d <= 0 || d > time.Minute {
+		t.Errorf("promise deadline is %v away, want within the next minute", d)
+	}
+}
+
+// fwEntry is a firmware statement and image to be submitted in a batch.
+type fwEntry struct {
+	stmt  []byte
+	image string
+}
+
+// addFirmwareBatchBody returns the multipart body for an add-firmware-batch request.
+func addFirmwareBatchBody(entries ...fwEntry) string {
+	var lines []string
+	for _, e := range entries {
+		lines = append(lines, "--mimeisfunlolol",
+			"Content-Type: application/json",
+			"",
+			string(e.stmt),
+			"--mimeisfunlolol",
+			"Content-Type: application/octet-stream",
+			"",
+			e.image)
+	}
+	return strings.Join(append(lines, "--mimeisfunlolol--", ""), "\n")
+}
+
+func TestAddFirmwareBatch(t *testing.T) {
+	testSigner, _ := note.NewSigner(crypto.TestFTPersonalityPriv)
+	vendor := mustLoadClaimant(t, "vendor")
+	fw := func(deviceID string, revision uint64, image string) fwEntry {
+		h := sha512.Sum512([]byte(image))
+		return fwEntry{
+			stmt: mustSignStatement(t, vendor, api.FirmwareMetadataType, api.FirmwareMetadata{
+				DeviceID:            deviceID,
+				FirmwareRevision:    revision,
+				FirmwareImageSHA512: h[:],
+			}),
+			image: image,
+		}
+	}
+	a1, a2, b1 := fw("a", 1, "a1"), fw("a", 2, "a2"), fw("b", 1, "b1")
+	old5 := fw("old", 5, "old5")
+	// An entry whose image doesn't match the hash in its statement.
+	badImage := fwEntry{stmt: b1.stmt, image: "nope"}
+
+	for _, test := range []struct {
+		desc          string
+		body          string
+		trillianErr   error
+		inLog         *fwEntry
+		wantLogged    []fwEntry
+		wantStored    int
+		wantStatus    int
+		wantResults   []int
+		wantRevisions FakeRevisions
+	}{
+		{
+			desc:          "all valid",
+			body:          addFirmwareBatchBody(a1, a2, b1),
+			wantLogged:    []fwEntry{a1, a2, b1},
+			wantStatus:    http.StatusOK,
+			wantResults:   []int{http.StatusOK, http.StatusOK, http.StatusOK},
+			wantStored:    3,
+			wantRevisions: FakeRevisions{"a": 2, "b": 1, "old": 5},
+		}, {
+			desc:          "image mismatch",
+			body:          addFirmwareBatchBody(a1, badImage),
+			wantStatus:    http.StatusBadRequest,
+			wantResults:   []int{http.StatusFailedDependency, http.StatusBadRequest},
+			wantStored:    0,
+			wantRevisions: FakeRevisions{"old": 5},
+		}, {
+			desc:          "revisions out of order",
+			body:          addFirmwareBatchBody(a2, b1, a1),
+			wantStatus:    http.StatusBadRequest,
+			wantResults:   []int{http.StatusFailedDependency, http.StatusFailedDependency, http.StatusConflict},
+			wantStored:    0,
+			wantRevisions: FakeRevisions{"old": 5},
+		}, {
+			desc:          "entry repeated",
+			body:          addFirmwareBatchBody(a1, a1),
+			wantStatus:    http.StatusBadRequest,
+			wantResults:   []int{http.StatusFailedDependency, http.StatusConflict},
+			wantStored:    0,
+			wantRevisions: FakeRevisions{"old": 5},
+		}, {
+			desc:          "revision already logged",
+			body:          addFirmwareBatchBody(a1, fw("old", 5, "old5")),
+			wantStatus:    http.StatusBadRequest,
+			wantResults:   []int{http.StatusFailedDependency, http.StatusConflict},
+			wantStored:    0,
+			wantRevisions: FakeRevisions{"old": 5},
+		}, {
+			desc:          "entry already logged",
+			body:          addFirmwareBatchBody(old5, a1),
+			inLog:         &old5,
+			wantLogged:    []fwEntry{old5, a1},
+			wantStatus:    http.StatusOK,
+			wantResults:   []int{http.StatusOK, http.StatusOK},
+			wantStored:    2,
+			wantRevisions: FakeRevisions{"a": 1, "old": 5},
+		}, {
+			desc:          "trillian failure",
+			body:          addFirmwareBatchBody(a1),
+			trillianErr:   errors.New("boom"),
+			wantLogged:    []fwEntry{a1},
+			wantStatus:    http.StatusOK,
+			wantResults:   []int{http.StatusInternalServerError},
+			wantStored:    0,
+			wantRevisions: FakeRevisions{"old": 5},
+		}, {
+			desc:          "missing image",
+			body:          strings.Replace(addFirmwareBody(a1.stmt, a1.image), "--mimeisfunlolol\nContent-Type: application/octet-stream\n\na1\n", "", 1),
+			wantStatus:    http.StatusBadRequest,
+			wantRevisions: FakeRevisions{"old": 5},
+		}, {
+			desc:          "empty",
+			body:          "--mimeisfunlolol--\n",
+			wantStatus:    http.StatusBadRequest,
+			wantRevisions: FakeRevisions{"old": 5},
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mt := NewMockTrillian(ctrl)
+			revs := FakeRevisions{"old": 5}
+			store := FakeCAS{}
+			server := NewServer(mt, store, revs, testSigner, time.Minute, crypto.DemoRegistry())
+
+			for _, e := range test.wantLogged {
+				if test.inLog != nil && bytes.Equal(e.stmt, test.inLog.stmt) {
+					continue
+				}
+				mt.EXPECT().AddSignedStatement(gomock.Any(), gomock.Eq(e.stmt)).Return(test.trillianErr)
+			}
+			mt.EXPECT().Root().Return(&types.LogRootV1{TreeSize: 10}).AnyTimes()
+			var logged []byte
+			if test.inLog != nil {
+				logged = test.inLog.stmt
+			}
+			mt.EXPECT().InclusionProofByHash(gomock.Any(), gomock.Any(), uint64(10)).DoAndReturn(inLog(logged != nil, logged)).AnyTimes()
+
+			r := mux.NewRouter()
+			server.RegisterHandlers(r)
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			url := fmt.Sprintf("%s/%s", ts.URL, api.HTTPAddFirmwareBatch)
+			resp, err := ts.Client().Post(url, "multipart/form-data; boundary=mimeisfunlolol", strings.NewReader(test.body))
+			if err != nil {
+				t.Fatalf("error response: %v", err)
+			}
+			body, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("failed to read response: %v", err)
+			}
+			if got, want := resp.StatusCode, test.wantStatus; got != want {
+				t.Errorf("status code got != want (%d, %d): %q", got, want, body)
+			}
+			if test.wantResults != nil {
+				var br api.AddFirmwareBatchResponse
+				if err := json.Unmarshal(body, &br); err != nil {
+					t.Fatalf("failed to unmarshal response %q: %v", body, err)
+				}
+				var got []int
+				for i, r := range br.Results {
+					got = append(got, r.Code)
+					if r.Code == http.StatusOK {
+						checkPromise(t, r.Promise, test.wantLogged[i].stmt)
+					}
+				}
+				if diff := cmp.Diff(test.wantResults, got); len(diff) != 0 {
+					t.Errorf("result codes diff: %s", diff)
+				}
+			}
+			// Only images for logged firmware are stored.
+			if got, want := len(store), test.wantStored; got != want {
+				t.Errorf("got %d images in CAS, want %d", got, want)
+			}
+			if diff := cmp.Diff(test.wantRevisions, revs); len(diff) != 0 {
+				t.Errorf("revisions diff: %s", diff)
+			}
+		})
+	}
+}
+
+func TestAddAnnotationRevocation(t *testing.T) {
+	testSigner, _ := note.NewSigner(crypto.TestFTPersonalityPriv)
+	vendor := mustLoadClaimant(t, "vendor")
+	annotator := mustLoadClaimant(t, "annotator_malware")
+	dummyOnly := &crypto.Registry{}
+	dummyOnly.Add("vendor", vendor, []api.StatementType{api.RevocationStatementType}, "", []string{"dummy"})
+	image := sha512.Sum512([]byte("hi"))
+	fwStmt := mustSignStatement(t, vendor, api.FirmwareMetadataType, api.FirmwareMetadata{
+		DeviceID:            "TalkieToaster",
+		FirmwareRevision:    1,
+		FirmwareImageSHA512: image[:],
+	})
+	revocation := func(idx uint64, hash []byte) api.RevocationStatement {
+		return api.RevocationStatement{FirmwareID: api.FirmwareID{LogIndex: idx, FirmwareImageSHA512: hash}}
+	}
+
+	for _, test := range []struct {
+		desc             string
+		body             []byte
+		claimants        *crypto.Registry
+		wantFWLookup     bool
+		wantTrillianCall bool
+		trillianErr      error
+		wantStatus       int
+	}{
+		{
+			desc:       "malformed request",
+			body:       []byte("garbage"),
+			wantStatus: http.StatusBadRequest,
+		}, {
+			desc:             "valid request",
+			body:             mustSignStatement(t, vendor, api.RevocationStatementType, revocation(3, image[:])),
+			wantFWLookup:     true,
+			wantTrillianCall: true,
+			wantStatus:       http.StatusOK,
+		}, {
+			desc:         "not signed by publisher",
+			body:         mustSignStatement(t, annotator, api.RevocationStatementType, revocation(3, image[:])),
+			wantFWLookup: true,
+			wantStatus:   http.StatusBadRequest,
+		}, {
+			desc:         "publisher not trusted for device",
+			body:         mustSignStatement(t, vendor, api.RevocationStatementType, revocation(3, image[:])),
+			claimants:    dummyOnly,
+			wantFWLookup: true,
+			wantStatus:   http.StatusBadRequest,
+		}, {
+			desc:       "wrong statement type",
+			body:       mustSignStatement(t, vendor, api.MalwareStatementType, revocation(3, image[:])),
+			wantStatus: http.StatusBadRequest,
+		}, {
+			desc:         "wrong firmware hash",
+			body:         mustSignStatement(t, vendor, api.RevocationStatementType, revocation(3, []byte("wrong"))),
+			wantFWLookup: true,
+			wantStatus:   http.StatusInternalServerError,
+		}, {
+			desc:             "valid request but trillian failure",
+			body:             mustSignStatement(t, vendor, api.RevocationStatementType, revocation(3, image[:])),
+			wantFWLookup:     true,
+			wantTrillianCall: true,
+			trillianErr:      errors.New("boom"),
+			wantStatus:       http.StatusInternalServerError,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mt := NewMockTrillian(ctrl)
+			claimants := test.claimants
+			if claimants == nil {
+				claimants = crypto.DemoRegistry()
+			}
+			server := NewServer(mt, FakeCAS{}, FakeRevisions{}, testSigner, time.Minute, claimants)
+
+			if test.wantFWLookup {
+				mt.EXPECT().FirmwareManifestAtIndex(gomock.Any(), gomock.Eq(uint64(3)), gomock.Eq(uint64(4))).
+					Return(fwStmt, nil, nil)
+			}
+			if test.wantTrillianCall {
+				mt.EXPECT().AddSignedStatement(gomock.Any(), gomock.Eq(test.body)).
+					Return(test.trillianErr)
+			}
+
+			r := mux.NewRouter()
+			server.RegisterHandlers(r)
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			client := ts.Client()
+			url := fmt.Sprintf("%s/%s", ts.URL, api.HTTPAddAnnotationRevocation)
+			resp, err := client.Post(url, "application/json", bytes.NewReader(test.body))
+			if err != nil {
+				t.Errorf("error response: %v", err)
+			}
+			if got, want := resp.StatusCode, test.wantStatus; got != want {
+				body, _ := ioutil.ReadAll(resp.Body)
+				t.Errorf("status code got != want (%d, %d): %q", got, want, body)
+			}
+		})
+	}
+}
+
+// mustLoadClaimant returns the named test claimant, which is able to sign.
+func mustLoadClaimant(t *testing.T, name string) *crypto.Claimant {
+	t.Helper()
+	c, err := crypto.LoadSigningClaimant(filepath.Join("../../../../testdata/keys", name+".pem"))
+	if err != nil {
+		t.Fatalf("failed to load claimant %q: %v", name, err)
+	}
+	return c
+}
+
+// mustSignStatement returns the JSON SignedStatement of v, signed by c.
+func mustSignStatement(t *testing.T, c *crypto.Claimant, st api.StatementType, v interface{}) []byte {
+	t.Helper()
+	js, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshaling failed, bailing out!: %v", err)
+	}
+	sig, err := c.SignMessage(st, js)
+	if err != nil {
+		t.Fatalf("signing failed, bailing out!: %v", err)
+	}
+	ss, err := json.Marshal(api.SignedStatement{Type: st, Statement: js, Signature: sig})
+	if err != nil {
+		t.Fatalf("marshaling failed, bailing out!: %v", err)
+	}
+	return ss
+}
+
 func TestGetConsistency(t *testing.T) {
 	testSigner, _ := note.NewSigner(crypto.TestFTPersonalityPriv)
 	root := types.LogRootV1{TreeSize: 24, TimestampNanos: 123, RootHash: []byte{0x12, 0x34}}
@@ -248,7 +1023,7 @@ func TestGetConsistency(t *testing.T) {
 		t.Run(test.desc, func(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			mt := NewMockTrillian(ctrl)
-			server := NewServer(mt, FakeCAS{}, testSigner)
+			server := NewServer(mt, FakeCAS{}, FakeRevisions{}, testSigner, time.Minute, crypto.DemoRegistry())
 			mt.EXPECT().Root().AnyTimes().
 				Return(&root)
 
@@ -336,7 +1111,7 @@ func TestGetManifestEntries(t *testing.T) {
 		t.Run(test.desc, func(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			mt := NewMockTrillian(ctrl)
-			server := NewServer(mt, FakeCAS{}, testSigner)
+			server := NewServer(mt, FakeCAS{}, FakeRevisions{}, testSigner, time.Minute, crypto.DemoRegistry())
 
 			mt.EXPECT().Root().AnyTimes().
 				Return(&root)
@@ -373,6 +1148,107 @@ func TestGetManifestEntries(t *testing.T) {
 	}
 }
 
+func TestGetEntries(t *testing.T) {
+	testSigner, _ := note.NewSigner(crypto.TestFTPersonalityPriv)
+	root := types.LogRootV1{TreeSize: 1000, TimestampNanos: 123, RootHash: []byte{0x12, 0x34}}
+	for _, test := range []struct {
+		desc        string
+		query       string
+		wantIndices []uint64
+		trillianErr error
+		wantStatus  int
+	}{
+		{
+			desc:        "valid request",
+			query:       "start=3&end=6&treesize=10",
+			wantIndices: []uint64{3, 4, 5},
+			wantStatus:  http.StatusOK,
+		}, {
+			desc:        "range capped",
+			query:       "start=500&end=1000&treesize=1000",
+			wantIndices: indices(500, 500+maxEntriesPerRequest),
+			wantStatus:  http.StatusOK,
+		}, {
+			desc:       "empty range",
+			query:      "start=3&end=3&treesize=10",
+			wantStatus: http.StatusBadRequest,
+		}, {
+			desc:       "end beyond tree size",
+			query:      "start=3&end=11&treesize=10",
+			wantStatus: http.StatusBadRequest,
+		}, {
+			desc:       "tree size bigger than golden tree size",
+			query:      "start=3&end=6&treesize=1001",
+			wantStatus: http.StatusBadRequest,
+		}, {
+			desc:       "missing tree size",
+			query:      "start=3&end=6",
+			wantStatus: http.StatusNotFound,
+		}, {
+			desc:        "trillian failure",
+			query:       "start=3&end=6&treesize=10",
+			wantIndices: []uint64{3},
+			trillianErr: errors.New("boom"),
+			wantStatus:  http.StatusInternalServerError,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mt := NewMockTrillian(ctrl)
+			server := NewServer(mt, FakeCAS{}, FakeRevisions{}, testSigner, time.Minute, crypto.DemoRegistry())
+
+			mt.EXPECT().Root().AnyTimes().Return(&root)
+			for _, i := range test.wantIndices {
+				mt.EXPECT().FirmwareManifestAtIndex(gomock.Any(), gomock.Eq(i), gomock.Any()).
+					Return([]byte(fmt.Sprintf("leaf %d", i)), [][]byte{[]byte("proof")}, test.trillianErr)
+			}
+
+			r := mux.NewRouter()
+			server.RegisterHandlers(r)
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			resp, err := ts.Client().Get(fmt.Sprintf("%s/%s?%s", ts.URL, api.HTTPGetEntries, test.query))
+			if err != nil {
+				t.Fatalf("error response: %v", err)
+			}
+			body, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("failed to read body: %v", err)
+			}
+			if got, want := resp.StatusCode, test.wantStatus; got != want {
+				t.Fatalf("status code got != want (%d, %d): %q", got, want, body)
+			}
+			if resp.StatusCode != http.StatusOK {
+				return
+			}
+			var er api.GetEntriesResponse
+			if err := json.Unmarshal(body, &er); err != nil {
+				t.Fatalf("failed to unmarshal response: %v", err)
+			}
+			var got []uint64
+			for _, e := range er.Entries {
+				got = append(got, e.LeafIndex)
+				if want := fmt.Sprintf("leaf %d", e.LeafIndex); string(e.Value) != want {
+					t.Errorf("got value %q for index %d, want %q", e.Value, e.LeafIndex, want)
+				}
+			}
+			if diff := cmp.Diff(test.wantIndices, got); len(diff) != 0 {
+				t.Errorf("indices diff: %s", diff)
+			}
+		})
+	}
+}
+
+// indices returns the indices in the range [start, end).
+func indices(start, end uint64) []uint64 {
+	var r []uint64
+	for i := start; i < end; i++ {
+		r = append(r, i)
+	}
+	return r
+}
+
 func TestGetInclusionProofByHash(t *testing.T) {
 	testSigner, _ := note.NewSigner(crypto.TestFTPersonalityPriv)
 	root := types.LogRootV1{TreeSize: 24, TimestampNanos: 123, RootHash: []byte{0x12, 0x34}}
@@ -414,7 +1290,7 @@ func TestGetInclusionProofByHash(t *testing.T) {
 		t.Run(test.desc, func(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			mt := NewMockTrillian(ctrl)
-			server := NewServer(mt, FakeCAS{}, testSigner)
+			server := NewServer(mt, FakeCAS{}, FakeRevisions{}, testSigner, time.Minute, crypto.DemoRegistry())
 
 			mt.EXPECT().Root().AnyTimes().
 				Return(&root)
@@ -460,16 +1336,183 @@ func TestGetInclusionProofByHash(t *testing.T) {
 	}
 }
 
+func TestGetFirmwareImage(t *testing.T) {
+	testSigner, _ := note.NewSigner(crypto.TestFTPersonalityPriv)
+	image := []byte("0123456789")
+	h := sha512.Sum512(image)
+	unknown := sha512.Sum512([]byte("unknown"))
+	for _, test := range []struct {
+		desc       string
+		hash       []byte
+		rangeHdr   string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			desc:       "whole image",
+			hash:       h[:],
+			wantStatus: http.StatusOK,
+			wantBody:   "0123456789",
+		}, {
+			desc:       "range",
+			hash:       h[:],
+			rangeHdr:   "bytes=2-4",
+			wantStatus: http.StatusPartialContent,
+			wantBody:   "234",
+		}, {
+			desc:       "suffix range",
+			hash:       h[:],
+			rangeHdr:   "bytes=-3",
+			wantStatus: http.StatusPartialContent,
+			wantBody:   "789",
+		}, {
+			desc:       "unsatisfiable range",
+			hash:       h[:],
+			rangeHdr:   "bytes=20-30",
+			wantStatus: http.StatusRequestedRangeNotSatisfiable,
+		}, {
+			desc:       "unknown image",
+			hash:       unknown[:],
+			wantStatus: http.StatusNotFound,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			store := FakeCAS{string(h[:]): image}
+			server := NewServer(nil, store, FakeRevisions{}, testSigner, time.Minute, crypto.DemoRegistry())
+			r := mux.NewRouter()
+			server.RegisterHandlers(r)
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			url := fmt.Sprintf("%s/%s/with-hash/%s", ts.URL, api.HTTPGetFirmwareImage, base64.URLEncoding.EncodeToString(test.hash))
+			req, err := http.NewRequest(http.MethodGet, url, nil)
+			if err != nil {
+				t.Fatalf("NewRequest() = %v", err)
+			}
+			if len(test.rangeHdr) > 0 {
+				req.Header.Set("Range", test.rangeHdr)
+			}
+			resp, err := ts.Client().Do(req)
+			if err != nil {
+				t.Fatalf("error response: %v", err)
+			}
+			defer resp.Body.Close()
+			body, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("failed to read body: %v", err)
+			}
+			if got, want := resp.StatusCode, test.wantStatus; got != want {
+				t.Fatalf("status code got != want (%d, %d): %q", got, want, body)
+			}
+			if test.wantStatus/100 == 2 {
+				if got, want := string(body), test.wantBody; got != want {
+					t.Errorf("got body %q, want %q", got, want)
+				}
+				if got := resp.Header.Get("Accept-Ranges"); got != "bytes" {
+					t.Errorf("got Accept-Ranges %q, want bytes", got)
+				}
+			}
+		})
+	}
+}
+
+// inLog returns a fake InclusionProofByHash which finds only the given
+// statement, and only if logged is set.
+func inLog(logged bool, stmt []byte) func(context.Context, []byte, uint64) (uint64, [][]byte, error) {
+	return func(_ context.Context, hash []byte, _ uint64) (uint64, [][]byte, error) {
+		if logged && bytes.Equal(hash, verify.HashLeaf(stmt)) {
+			return 3, [][]byte{}, nil
+		}
+		return 0, nil, status.Error(codes.NotFound, "nope")
+	}
+}
+
+type FakeRevisions map[string]uint64
+
+func (f FakeRevisions) Latest(deviceID string) (revisions.Record, bool, error) {
+	rev, ok := f[deviceID]
+	return revisions.Record{Revision: rev}, ok, nil
+}
+
+func (f FakeRevisions) Raise(deviceID string, rec revisions.Record) (bool, error) {
+	if rev, ok := f[deviceID]; ok && rec.Revision <= rev {
+		return false, nil
+	}
+	f[deviceID] = rec.Revision
+	return true, nil
+}
+
+func (f FakeRevisions) Restore(deviceID string, rec revisions.Record, prev *revisions.Record) error {
+	if rev, ok := f[deviceID]; !ok || rev != rec.Revision {
+		return nil
+	}
+	if prev == nil {
+		delete(f, deviceID)
+		return nil
+	}
+	f[deviceID] = prev.Revision
+	return nil
+}
+
+func (f FakeRevisions) SeededSize() (uint64, error) {
+	return 0, nil
+}
+
+func (f FakeRevisions) SetSeededSize(uint64) error {
+	return nil
+}
+
+// failingRevisions fails to record revisions while fail is set.
+type failingRevisions struct {
+	FakeRevisions
+	fail bool
+}
+
+func (f *failingRevisions) Raise(deviceID string, rec revisions.Record) (bool, error) {
+	if f.fail {
+		return false, errors.New("boom")
+	}
+	return f.FakeRevisions.Raise(deviceID, rec)
+}
+
+// seededRevisions records the tree size revisions have been seeded up to.
+type seededRevisions struct {
+	FakeRevisions
+	size uint64
+}
+
+func (f *seededRevisions) SeededSize() (uint64, error) {
+	return f.size, nil
+}
+
+func (f *seededRevisions) SetSeededSize(size uint64) error {
+	f.size = size
+	return nil
+}
+
 type FakeCAS map[string][]byte
 
-func (f FakeCAS) Store(key, image []byte) error {
+func (f FakeCAS) Store(key []byte, r io.Reader) error {
+	image, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if h := sha512.Sum512(image); !bytes.Equal(h[:], key) {
+		return status.Error(codes.InvalidArgument, "hash mismatch")
+	}
 	f[string(key)] = image
 	return nil
 }
 
-func (f FakeCAS) Retrieve(key []byte) ([]byte, error) {
+func (f FakeCAS) Retrieve(key []byte) (cas.Image, error) {
 	if image, ok := f[string(key)]; ok {
-		return image, nil
+		return fakeImage{bytes.NewReader(image)}, nil
 	}
-	return nil, errors.New("nope")
+	return nil, status.Error(codes.NotFound, "nope")
 }
+
+type fakeImage struct {
+	*bytes.Reader
+}
+
+func (fakeImage) Close() error { return nil }
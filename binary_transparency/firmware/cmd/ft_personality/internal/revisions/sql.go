@@ -0,0 +1,122 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package revisions tracks the highest firmware revision logged for each device.
+package revisions
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Record is the revision recorded for a device.
+type Record struct {
+	Revision uint64
+	// LeafHash is the leaf hash of the firmware statement for the revision,
+	// which allows it to be recognized if resubmitted. It may be nil for
+	// revisions recorded before leaf hashes were stored.
+	LeafHash []byte
+}
+
+// Storage records the highest firmware revision logged for each device, using
+// a SQL Database as its backing store. Revisions are recorded before the
+// firmware is logged, so that they're enforced as soon as it could be.
+//
+// Only firmware logged since the storage was created is recorded, so this
+// should be seeded from the log before use if the log is not empty. The tree
+// size it has been seeded up to is also stored.
+type Storage struct {
+	db *sql.DB
+}
+
+// NewStorage creates a new Storage that uses the given DB as a backend.
+// The DB will be initialized if needed.
+func NewStorage(db *sql.DB) (*Storage, error) {
+	s := &Storage{
+		db: db,
+	}
+	return s, s.init()
+}
+
+// init creates the database tables if needed.
+func (s *Storage) init() error {
+	if _, err := s.db.Exec("CREATE TABLE IF NOT EXISTS revisions (device TEXT PRIMARY KEY, revision INTEGER, leafhash BLOB)"); err != nil {
+		return err
+	}
+	// Databases created before leaf hashes were stored need the column adding.
+	if _, err := s.db.Exec("SELECT leafhash FROM revisions LIMIT 0"); err != nil {
+		if _, err := s.db.Exec("ALTER TABLE revisions ADD COLUMN leafhash BLOB"); err != nil {
+			return fmt.Errorf("failed to add leafhash column: %v", err)
+		}
+	}
+	_, err := s.db.Exec("CREATE TABLE IF NOT EXISTS seeded (id INTEGER PRIMARY KEY, size INTEGER)")
+	return err
+}
+
+// Latest returns the highest revision recorded for the device, and whether
+// any revision has been recorded at all.
+func (s *Storage) Latest(deviceID string) (Record, bool, error) {
+	var rev int64
+	var lh []byte
+	if err := s.db.QueryRow("SELECT revision, leafhash FROM revisions WHERE device=?", deviceID).Scan(&rev, &lh); err != nil {
+		if err == sql.ErrNoRows {
+			return Record{}, false, nil
+		}
+		return Record{}, false, err
+	}
+	return Record{Revision: uint64(rev), LeafHash: lh}, true, nil
+}
+
+// Raise records rec for the device if its revision is higher than the one
+// already recorded, and reports whether it was recorded.
+func (s *Storage) Raise(deviceID string, rec Record) (bool, error) {
+	r, err := s.db.Exec("INSERT INTO revisions (device, revision, leafhash) VALUES (?, ?, ?) ON CONFLICT(device) DO UPDATE SET revision=excluded.revision, leafhash=excluded.leafhash WHERE excluded.revision > revisions.revision", deviceID, int64(rec.Revision), rec.LeafHash)
+	if err != nil {
+		return false, err
+	}
+	n, err := r.RowsAffected()
+	return n > 0, err
+}
+
+// Restore undoes a Raise of rec for the device, putting back prev, or
+// removing the record if prev is nil. Nothing is changed if a higher revision
+// has been recorded since.
+func (s *Storage) Restore(deviceID string, rec Record, prev *Record) error {
+	if prev == nil {
+		_, err := s.db.Exec("DELETE FROM revisions WHERE device=? AND revision=?", deviceID, int64(rec.Revision))
+		return err
+	}
+	_, err := s.db.Exec("UPDATE revisions SET revision=?, leafhash=? WHERE device=? AND revision=?", int64(prev.Revision), prev.LeafHash, deviceID, int64(rec.Revision))
+	return err
+}
+
+// SeededSize returns the tree size that revisions have been seeded from the
+// log up to, or zero if they never have been.
+func (s *Storage) SeededSize() (uint64, error) {
+	var size int64
+	if err := s.db.QueryRow("SELECT size FROM seeded WHERE id=0").Scan(&size); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return uint64(size), nil
+}
+
+// SetSeededSize records the tree size that revisions have been seeded from
+// the log up to.
+func (s *Storage) SetSeededSize(size uint64) error {
+	_, err := s.db.Exec("INSERT OR REPLACE INTO seeded (id, size) VALUES (0, ?)", int64(size))
+	return err
+}
@@ -0,0 +1,165 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package revisions
+
+import (
+	"bytes"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3" // Load drivers for sqlite3
+)
+
+func mustCreateStorage(t *testing.T) *Storage {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal("failed to open temporary in-memory DB", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	s, err := NewStorage(db)
+	if err != nil {
+		t.Fatal("failed to create storage", err)
+	}
+	return s
+}
+
+func TestRaise(t *testing.T) {
+	s := mustCreateStorage(t)
+
+	if _, ok, err := s.Latest("dummy"); err != nil || ok {
+		t.Errorf("Latest() for unknown device = _, %t, %v, want false, nil", ok, err)
+	}
+	for _, step := range []struct {
+		rev        uint64
+		wantRaised bool
+		wantLatest uint64
+	}{
+		{rev: 1, wantRaised: true, wantLatest: 1},
+		{rev: 5, wantRaised: true, wantLatest: 5},
+		{rev: 5, wantLatest: 5},
+		{rev: 3, wantLatest: 5},
+	} {
+		raised, err := s.Raise("dummy", Record{Revision: step.rev})
+		if err != nil || raised != step.wantRaised {
+			t.Errorf("Raise(%d) = %t, %v, want %t, nil", step.rev, raised, err, step.wantRaised)
+		}
+		got, ok, err := s.Latest("dummy")
+		if err != nil || !ok || got.Revision != step.wantLatest {
+			t.Errorf("Latest() = %v, %t, %v, want %d, true, nil", got, ok, err, step.wantLatest)
+		}
+	}
+	if _, ok, err := s.Latest("acme/dummy"); err != nil || ok {
+		t.Errorf("Latest() for other vendor's device = _, %t, %v, want false, nil", ok, err)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	s := mustCreateStorage(t)
+
+	// Restoring a first revision removes the record.
+	if _, err := s.Raise("dummy", Record{Revision: 1}); err != nil {
+		t.Fatalf("Raise() = %v", err)
+	}
+	if err := s.Restore("dummy", Record{Revision: 1}, nil); err != nil {
+		t.Fatalf("Restore() = %v", err)
+	}
+	if _, ok, err := s.Latest("dummy"); err != nil || ok {
+		t.Errorf("Latest() after Restore() = _, %t, %v, want false, nil", ok, err)
+	}
+
+	// Restoring puts back the previous revision, unless raised since.
+	for _, rev := range []uint64{5, 6, 7} {
+		if _, err := s.Raise("dummy", Record{Revision: rev}); err != nil {
+			t.Fatalf("Raise(%d) = %v", rev, err)
+		}
+	}
+	if err := s.Restore("dummy", Record{Revision: 6}, &Record{Revision: 5}); err != nil {
+		t.Fatalf("Restore(6) = %v", err)
+	}
+	if got, _, err := s.Latest("dummy"); err != nil || got.Revision != 7 {
+		t.Errorf("Latest() after Restore(6) = %v, %v, want 7", got, err)
+	}
+	if err := s.Restore("dummy", Record{Revision: 7}, &Record{Revision: 6}); err != nil {
+		t.Fatalf("Restore(7) = %v", err)
+	}
+	if got, _, err := s.Latest("dummy"); err != nil || got.Revision != 6 {
+		t.Errorf("Latest() after Restore(7) = %v, %v, want 6", got, err)
+	}
+}
+
+func TestLeafHash(t *testing.T) {
+	s := mustCreateStorage(t)
+
+	lh5, lh6 := []byte("five"), []byte("six")
+	if _, err := s.Raise("dummy", Record{Revision: 5, LeafHash: lh5}); err != nil {
+		t.Fatalf("Raise(5) = %v", err)
+	}
+	if _, err := s.Raise("dummy", Record{Revision: 6, LeafHash: lh6}); err != nil {
+		t.Fatalf("Raise(6) = %v", err)
+	}
+	if got, _, err := s.Latest("dummy"); err != nil || !bytes.Equal(got.LeafHash, lh6) {
+		t.Errorf("Latest() = %v, %v, want leaf hash %q", got, err, lh6)
+	}
+	if err := s.Restore("dummy", Record{Revision: 6, LeafHash: lh6}, &Record{Revision: 5, LeafHash: lh5}); err != nil {
+		t.Fatalf("Restore(6) = %v", err)
+	}
+	if got, _, err := s.Latest("dummy"); err != nil || !bytes.Equal(got.LeafHash, lh5) {
+		t.Errorf("Latest() after Restore(6) = %v, %v, want leaf hash %q", got, err, lh5)
+	}
+}
+
+func TestLegacyRevisions(t *testing.T) {
+	location := filepath.Join(t.TempDir(), "revisions.db")
+
+	// Create a database as it was before leaf hashes were stored.
+	db, err := sql.Open("sqlite3", location)
+	if err != nil {
+		t.Fatalf("sql.Open() = %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("CREATE TABLE revisions (device TEXT PRIMARY KEY, revision INTEGER)"); err != nil {
+		t.Fatalf("failed to create legacy table: %v", err)
+	}
+	if _, err := db.Exec("INSERT INTO revisions (device, revision) VALUES ('dummy', 5)"); err != nil {
+		t.Fatalf("failed to write legacy revision: %v", err)
+	}
+
+	s, err := NewStorage(db)
+	if err != nil {
+		t.Fatalf("NewStorage() = %v", err)
+	}
+	if got, ok, err := s.Latest("dummy"); err != nil || !ok || got.Revision != 5 || got.LeafHash != nil {
+		t.Errorf("Latest() = %v, %t, %v, want revision 5 with no leaf hash", got, ok, err)
+	}
+}
+
+func TestSeededSize(t *testing.T) {
+	s := mustCreateStorage(t)
+
+	if got, err := s.SeededSize(); err != nil || got != 0 {
+		t.Errorf("SeededSize() = %d, %v, want 0, nil", got, err)
+	}
+	for _, size := range []uint64{10, 20} {
+		if err := s.SetSeededSize(size); err != nil {
+			t.Fatalf("SetSeededSize(%d) = %v", size, err)
+		}
+		if got, err := s.SeededSize(); err != nil || got != size {
+			t.Errorf("SeededSize() = %d, %v, want %d, nil", got, err, size)
+		}
+	}
+}
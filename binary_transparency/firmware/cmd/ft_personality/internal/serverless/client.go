@@ -0,0 +1,288 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package serverless represents the log for the needs of this personality,
+// using serverless log storage on the local filesystem instead of Trillian.
+package serverless
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	fmtlog "github.com/google/trillian-examples/formats/log"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/google/trillian-examples/serverless/layout"
+	"github.com/google/trillian-examples/serverless/log"
+	"github.com/google/trillian-examples/serverless/storage"
+	"github.com/google/trillian-examples/serverless/storage/fs"
+	"github.com/google/trillian/merkle/compact"
+	"github.com/google/trillian/merkle/hashers"
+	"github.com/google/trillian/merkle/rfc6962/hasher"
+	tt "github.com/google/trillian/types"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Client represents the personality's view of a serverless log stored on the
+// local filesystem.
+//
+// Added entries are only sequenced; they are integrated into the tree, and
+// become visible in Root, when UpdateRoot is called.
+type Client struct {
+	rootDir string
+	h       hashers.LogHasher
+
+	// stLock guards st, which is not thread-safe.
+	stLock sync.Mutex
+	st     *fs.Storage
+
+	golden     tt.LogRootV1
+	goldenLock sync.Mutex
+}
+
+// NewClient returns a new client that will read/write to the serverless log
+// stored in rootDir. If rootDir does not exist then a new, empty, log will be
+// created there.
+func NewClient(rootDir string) (*Client, error) {
+	c := &Client{
+		rootDir: rootDir,
+		h:       hasher.DefaultHasher,
+	}
+
+	cpRaw, err := fs.ReadCheckpoint(rootDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, c.create()
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read log checkpoint: %w", err)
+	}
+	var cp fmtlog.Checkpoint
+	otherData, err := cp.Unmarshal(cpRaw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal checkpoint: %w", err)
+	}
+	si, err := api.ParseShardInfo(otherData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint otherdata: %w", err)
+	}
+	if si.Closed {
+		return nil, fmt.Errorf("log in %q is closed", rootDir)
+	}
+	if c.st, err = fs.Load(rootDir, &cp); err != nil {
+		return nil, fmt.Errorf("failed to load log storage: %w", err)
+	}
+
+	// The checkpoint was written by this personality the last time it ran, so
+	// the time it was written is the best available timestamp for the root.
+	var ts time.Time
+	if fi, err := os.Stat(filepath.Join(rootDir, layout.CheckpointPath)); err == nil {
+		ts = fi.ModTime()
+	}
+	c.setGolden(cp, ts)
+	glog.Infof("Loaded serverless log in %q at size %d", rootDir, cp.Size)
+	return c, nil
+}
+
+// create initialises a new, empty, log in c.rootDir.
+func (c *Client) create() error {
+	st, err := fs.Create(c.rootDir, c.h.EmptyRoot())
+	if err != nil {
+		return fmt.Errorf("failed to create log storage: %w", err)
+	}
+	cp := fmtlog.Checkpoint{
+		Ecosystem: api.CheckpointHeaderV0,
+		Size:      0,
+		Hash:      c.h.EmptyRoot(),
+	}
+	if err := st.WriteCheckpoint(cp.Marshal()); err != nil {
+		return fmt.Errorf("failed to write initial checkpoint: %w", err)
+	}
+	c.st = st
+	c.setGolden(cp, time.Now())
+	glog.Infof("Created new serverless log in %q", c.rootDir)
+	return nil
+}
+
+// AddSignedStatement adds the statement to the log if it isn't already present.
+func (c *Client) AddSignedStatement(ctx context.Context, data []byte) error {
+	c.stLock.Lock()
+	defer c.stLock.Unlock()
+
+	if _, err := log.Sequence(c.st, c.h, data); err != nil && !errors.Is(err, storage.ErrDupeLeaf) {
+		return err
+	}
+	return nil
+}
+
+// Root returns the most recent root seen by this client.
+// Use UpdateRoot() to update this client's view of the latest root.
+func (c *Client) Root() *tt.LogRootV1 {
+	c.goldenLock.Lock()
+	defer c.goldenLock.Unlock()
+
+	// Copy the internal trusted root in order to prevent clients from modifying it.
+	ret := c.golden
+	return &ret
+}
+
+// UpdateRoot integrates any sequenced entries into the log, and writes out a
+// new checkpoint if the log has grown.
+// After returning, the most recent root will be obtainable via c.Root().
+func (c *Client) UpdateRoot(ctx context.Context) error {
+	c.stLock.Lock()
+	defer c.stLock.Unlock()
+
+	newCp, err := log.Integrate(c.st, c.h)
+	if err != nil {
+		return fmt.Errorf("failed to integrate: %w", err)
+	}
+	if newCp == nil {
+		return nil
+	}
+	newCp.Ecosystem = api.CheckpointHeaderV0
+	if err := c.st.WriteCheckpoint(newCp.Marshal()); err != nil {
+		return fmt.Errorf("failed to store new log checkpoint: %w", err)
+	}
+	// The storage only learns of the new checkpoint when it's loaded.
+	st, err := fs.Load(c.rootDir, newCp)
+	if err != nil {
+		return fmt.Errorf("failed to reload log storage: %w", err)
+	}
+	c.st = st
+	c.setGolden(*newCp, time.Now())
+	return nil
+}
+
+// ConsistencyProof gets the consistency proof between two given tree sizes.
+func (c *Client) ConsistencyProof(ctx context.Context, from, to uint64) ([][]byte, error) {
+	pb, err := c.proofBuilder(to)
+	if err != nil {
+		return nil, err
+	}
+	return pb.ConsistencyProof(from, to)
+}
+
+// FirmwareManifestAtIndex gets the value at the given index and an inclusion proof
+// to the given tree size.
+func (c *Client) FirmwareManifestAtIndex(ctx context.Context, index, treeSize uint64) ([]byte, [][]byte, error) {
+	if index >= treeSize {
+		return nil, nil, fmt.Errorf("index %d >= tree size %d", index, treeSize)
+	}
+	dir, f := layout.SeqPath(c.rootDir, index)
+	data, err := ioutil.ReadFile(filepath.Join(dir, f))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read leaf %d: %w", index, err)
+	}
+	pb, err := c.proofBuilder(treeSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	proof, err := pb.InclusionProof(index)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, proof, nil
+}
+
+// InclusionProofByHash gets an inclusion proof in the specified tree size for the
+// leaf with the specified hash.
+func (c *Client) InclusionProofByHash(ctx context.Context, hash []byte, treeSize uint64) (uint64, [][]byte, error) {
+	index, err := client.LookupIndex(c.fetch, hash)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil, status.Errorf(codes.NotFound, "no leaves found for hash 0x%x", hash)
+	} else if err != nil {
+		return 0, nil, err
+	}
+	if index >= treeSize {
+		return 0, nil, status.Errorf(codes.NotFound, "no leaves found for hash 0x%x in tree size %d", hash, treeSize)
+	}
+	pb, err := c.proofBuilder(treeSize)
+	if err != nil {
+		return 0, nil, err
+	}
+	proof, err := pb.InclusionProof(index)
+	if err != nil {
+		return 0, nil, err
+	}
+	return index, proof, nil
+}
+
+// LeavesByRange gets the values of up to count leaves, starting at the given
+// index. Only leaves which have been integrated are returned.
+func (c *Client) LeavesByRange(ctx context.Context, start, count uint64) ([][]byte, error) {
+	size := c.Root().TreeSize
+	if start >= size {
+		return nil, fmt.Errorf("start %d >= tree size %d", start, size)
+	}
+	if start+count > size {
+		count = size - start
+	}
+	leaves := make([][]byte, 0, count)
+	for i := start; i < start+count; i++ {
+		dir, f := layout.SeqPath(c.rootDir, i)
+		data, err := ioutil.ReadFile(filepath.Join(dir, f))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read leaf %d: %w", i, err)
+		}
+		leaves = append(leaves, data)
+	}
+	return leaves, nil
+}
+
+// proofBuilder returns a ProofBuilder for the log at the given size, which
+// need not be the size of the latest checkpoint but must be a size the log
+// was integrated to. This holds for every size served by this personality.
+func (c *Client) proofBuilder(size uint64) (*client.ProofBuilder, error) {
+	c.stLock.Lock()
+	nc := client.NewNodeCache(func(level, index, logSize uint64) (*api.Tile, error) {
+		return log.GetTile(c.st, level, index, logSize)
+	})
+	hashes, err := client.FetchRangeNodes(size, &nc)
+	c.stLock.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch compact range nodes: %w", err)
+	}
+	r, err := (&compact.RangeFactory{Hash: c.h.HashChildren}).NewRange(0, size, hashes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create range covering log: %w", err)
+	}
+	root, err := r.GetRootHash(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate root at size %d: %w", size, err)
+	}
+	return client.NewProofBuilder(fmtlog.Checkpoint{Size: size, Hash: root}, c.h.HashChildren, c.fetch)
+}
+
+// fetch reads the file at the given path relative to the root of the log.
+func (c *Client) fetch(p string) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(c.rootDir, p))
+}
+
+func (c *Client) setGolden(cp fmtlog.Checkpoint, ts time.Time) {
+	c.goldenLock.Lock()
+	defer c.goldenLock.Unlock()
+
+	c.golden = tt.LogRootV1{
+		TreeSize:       cp.Size,
+		RootHash:       cp.Hash,
+		TimestampNanos: uint64(ts.UnixNano()),
+	}
+}
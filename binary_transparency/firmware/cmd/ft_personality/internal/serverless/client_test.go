@@ -0,0 +1,164 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package serverless
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/trillian-examples/binary_transparency/firmware/internal/verify"
+	"github.com/google/trillian/merkle/rfc6962/hasher"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "ft_serverless")
+	if err != nil {
+		t.Fatalf("TempDir() = %v", err)
+	}
+	defer os.RemoveAll(dir)
+	root := filepath.Join(dir, "log")
+
+	c, err := NewClient(root)
+	if err != nil {
+		t.Fatalf("NewClient() = %v", err)
+	}
+	if got := c.Root().TreeSize; got != 0 {
+		t.Fatalf("new log has size %d, want 0", got)
+	}
+
+	var leaves [][]byte
+	var sizes []uint64
+	// Roots at every size the log was integrated to, to check proofs against.
+	roots := make(map[uint64][]byte)
+	for _, batch := range []int{3, 1, 5} {
+		for i := 0; i < batch; i++ {
+			l := []byte(fmt.Sprintf("statement %d", len(leaves)))
+			leaves = append(leaves, l)
+			if err := c.AddSignedStatement(ctx, l); err != nil {
+				t.Fatalf("AddSignedStatement() = %v", err)
+			}
+		}
+		// Duplicates are silently ignored.
+		if err := c.AddSignedStatement(ctx, leaves[0]); err != nil {
+			t.Fatalf("AddSignedStatement(dupe) = %v", err)
+		}
+		if got, want := c.Root().TreeSize, uint64(len(leaves)-batch); got != want {
+			t.Errorf("before UpdateRoot size = %d, want %d", got, want)
+		}
+		if err := c.UpdateRoot(ctx); err != nil {
+			t.Fatalf("UpdateRoot() = %v", err)
+		}
+		if got, want := c.Root().TreeSize, uint64(len(leaves)); got != want {
+			t.Errorf("after UpdateRoot size = %d, want %d", got, want)
+		}
+		sizes = append(sizes, c.Root().TreeSize)
+		roots[c.Root().TreeSize] = c.Root().RootHash
+	}
+
+	// Reopening the log gives the same root.
+	want := c.Root()
+	c, err = NewClient(root)
+	if err != nil {
+		t.Fatalf("NewClient(existing) = %v", err)
+	}
+	if got := c.Root(); got.TreeSize != want.TreeSize || !bytes.Equal(got.RootHash, want.RootHash) {
+		t.Fatalf("reopened log root = %d %x, want %d %x", got.TreeSize, got.RootHash, want.TreeSize, want.RootHash)
+	}
+
+	lv := verify.NewLogVerifier()
+	for _, size := range sizes {
+		for i := uint64(0); i < size; i++ {
+			data, proof, err := c.FirmwareManifestAtIndex(ctx, i, size)
+			if err != nil {
+				t.Fatalf("FirmwareManifestAtIndex(%d, %d) = %v", i, size, err)
+			}
+			if !bytes.Equal(data, leaves[i]) {
+				t.Errorf("FirmwareManifestAtIndex(%d, %d) = %q, want %q", i, size, data, leaves[i])
+			}
+			lh := hasher.DefaultHasher.HashLeaf(leaves[i])
+			if err := lv.VerifyInclusionProof(int64(i), int64(size), proof, roots[size], lh); err != nil {
+				t.Errorf("inclusion proof for %d in %d from FirmwareManifestAtIndex: %v", i, size, err)
+			}
+
+			index, proof, err := c.InclusionProofByHash(ctx, lh, size)
+			if err != nil {
+				t.Fatalf("InclusionProofByHash(%d, %d) = %v", i, size, err)
+			}
+			if index != i {
+				t.Errorf("InclusionProofByHash() index = %d, want %d", index, i)
+			}
+			if err := lv.VerifyInclusionProof(int64(i), int64(size), proof, roots[size], lh); err != nil {
+				t.Errorf("inclusion proof for %d in %d from InclusionProofByHash: %v", i, size, err)
+			}
+		}
+	}
+
+	for _, from := range sizes {
+		for _, to := range sizes {
+			if from > to {
+				continue
+			}
+			proof, err := c.ConsistencyProof(ctx, from, to)
+			if err != nil {
+				t.Fatalf("ConsistencyProof(%d, %d) = %v", from, to, err)
+			}
+			if err := lv.VerifyConsistencyProof(int64(from), int64(to), roots[from], roots[to], proof); err != nil {
+				t.Errorf("ConsistencyProof(%d, %d) failed to verify: %v", from, to, err)
+			}
+		}
+	}
+}
+
+func TestInclusionProofByHashNotFound(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "ft_serverless")
+	if err != nil {
+		t.Fatalf("TempDir() = %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := NewClient(filepath.Join(dir, "log"))
+	if err != nil {
+		t.Fatalf("NewClient() = %v", err)
+	}
+	if err := c.AddSignedStatement(ctx, []byte("logged")); err != nil {
+		t.Fatalf("AddSignedStatement() = %v", err)
+	}
+	if err := c.UpdateRoot(ctx); err != nil {
+		t.Fatalf("UpdateRoot() = %v", err)
+	}
+	// Sequenced, but not yet integrated.
+	if err := c.AddSignedStatement(ctx, []byte("pending")); err != nil {
+		t.Fatalf("AddSignedStatement() = %v", err)
+	}
+
+	for _, leaf := range []string{"unknown", "pending"} {
+		t.Run(leaf, func(t *testing.T) {
+			lh := hasher.DefaultHasher.HashLeaf([]byte(leaf))
+			_, _, err := c.InclusionProofByHash(ctx, lh, c.Root().TreeSize)
+			if got, want := status.Code(err), codes.NotFound; got != want {
+				t.Errorf("InclusionProofByHash() = %v, want code %v", err, want)
+			}
+		})
+	}
+}
@@ -28,6 +28,8 @@ import (
 	"github.com/google/trillian/client"
 	tt "github.com/google/trillian/types"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // Client represents the personality's view of the Trillian Log.
@@ -192,11 +194,28 @@ func (c *Client) InclusionProofByHash(ctx context.Context, hash []byte, treeSize
 		return 0, nil, err
 	}
 	if len(ip.Proof) == 0 {
-		return 0, nil, fmt.Errorf("no leaves found for hash 0x%x", hash)
+		return 0, nil, status.Errorf(codes.NotFound, "no leaves found for hash 0x%x", hash)
 	}
 	return uint64(ip.Proof[0].LeafIndex), ip.Proof[0].Hashes, nil
 }
 
+// LeavesByRange gets the values of up to count leaves, starting at the given index.
+func (c *Client) LeavesByRange(ctx context.Context, start, count uint64) ([][]byte, error) {
+	resp, err := c.client.GetLeavesByRange(ctx, &trillian.GetLeavesByRangeRequest{
+		LogId:      c.logID,
+		StartIndex: int64(start),
+		Count:      int64(count),
+	})
+	if err != nil {
+		return nil, err
+	}
+	leaves := make([][]byte, 0, len(resp.Leaves))
+	for _, l := range resp.Leaves {
+		leaves = append(leaves, l.LeafValue)
+	}
+	return leaves, nil
+}
+
 // Close finishes the underlying connections and tidies up after the Client is finished.
 func (c *Client) Close() {
 	c.done()
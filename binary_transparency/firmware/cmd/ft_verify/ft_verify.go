@@ -0,0 +1,109 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// ft_verify is a tool to verify firmware update packages, or proof bundles and
+// firmware images, without contacting the log.
+//
+// All of the checks which a device performs on an update are run, and a report
+// describing the firmware manifest, log checkpoint, inclusion proof, and
+// measurement of the image is written to stdout.
+//
+// Usage:
+//
+//	go run ./cmd/ft_verify/ --logtostderr --update_file=/path/to/update.json
+//
+// or:
+//
+//	go run ./cmd/ft_verify/ --logtostderr --bundle_file=/path/to/bundle.json --image_file=/path/to/firmware.bin
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/binary_transparency/firmware/cmd/ft_verify/impl"
+	"github.com/google/trillian-examples/binary_transparency/firmware/internal/crypto"
+	"github.com/google/trillian-examples/binary_transparency/firmware/internal/verify"
+	"github.com/google/trillian-examples/formats/note"
+)
+
+var (
+	updateFile    = flag.String("update_file", "", "File path to read the update package from")
+	bundleFile    = flag.String("bundle_file", "", "File path to read the proof bundle from, if --update_file is not set")
+	imageFile     = flag.String("image_file", "", "File path to read the firmware image from, if --update_file is not set")
+	deviceID      = flag.String("device", "", "One of [dummy, armory], or empty to use the device from the firmware manifest")
+	logKey        = flag.String("log_key", "", "File path to read the log's note verifier key from, or empty to use the test key")
+	mapKey        = flag.String("map_key", "", "File path to read the map's note verifier key from, or empty to use the test key")
+	claimantKeys  = flag.String("claimant_keys", "", "Path to a JSON registry of claimant public keys, or empty to use the demo keys")
+	witnessKeys   = flag.String("witness_keys", "", "Comma separated list of note verifier keys for trusted witnesses")
+	witnessThresh = flag.Int("witness_threshold", 0, "Number of trusted witnesses which must have cosigned the proof bundle checkpoint")
+)
+
+func main() {
+	flag.Parse()
+
+	vkey := crypto.TestFTPersonalityPub
+	if len(*logKey) > 0 {
+		k, err := ioutil.ReadFile(*logKey)
+		if err != nil {
+			glog.Exitf("Failed to read log key: %v", err)
+		}
+		vkey = strings.TrimSpace(string(k))
+	}
+	v, err := note.NewVerifier(vkey)
+	if err != nil {
+		glog.Exitf("Failed to create CP verifier: %q", err)
+	}
+	mkey := crypto.TestMapPub
+	if len(*mapKey) > 0 {
+		k, err := ioutil.ReadFile(*mapKey)
+		if err != nil {
+			glog.Exitf("Failed to read map key: %v", err)
+		}
+		mkey = strings.TrimSpace(string(k))
+	}
+	mv, err := note.NewVerifier(mkey)
+	if err != nil {
+		glog.Exitf("Failed to create map verifier: %q", err)
+	}
+	claimants, err := crypto.LoadRegistry(*claimantKeys)
+	if err != nil {
+		glog.Exitf("Failed to load claimant keys: %v", err)
+	}
+	var keys []string
+	if len(*witnessKeys) > 0 {
+		keys = strings.Split(*witnessKeys, ",")
+	}
+	wp, err := verify.NewWitnessPolicy(keys, *witnessThresh)
+	if err != nil {
+		glog.Exitf("Invalid witness policy: %v", err)
+	}
+
+	if err := impl.Main(impl.VerifyOpts{
+		UpdateFile:     *updateFile,
+		BundleFile:     *bundleFile,
+		ImageFile:      *imageFile,
+		DeviceID:       *deviceID,
+		LogSigVerifier: v,
+		MapSigVerifier: mv,
+		Claimants:      claimants,
+		WitnessPolicy:  wp,
+		Output:         os.Stdout,
+	}); err != nil {
+		glog.Exit(err.Error())
+	}
+}
@@ -0,0 +1,249 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package impl is the implementation of a tool to verify firmware update
+// packages and proof bundles offline.
+package impl
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/google/trillian-examples/binary_transparency/firmware/api"
+	dummy_common "github.com/google/trillian-examples/binary_transparency/firmware/devices/dummy/common"
+	"github.com/google/trillian-examples/binary_transparency/firmware/devices/usbarmory"
+	"github.com/google/trillian-examples/binary_transparency/firmware/internal/crypto"
+	"github.com/google/trillian-examples/binary_transparency/firmware/internal/verify"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// VerifyOpts encapsulates parameters for the verify Main below.
+type VerifyOpts struct {
+	// UpdateFile is the path of an api.UpdatePackage to verify.
+	UpdateFile string
+	// BundleFile and ImageFile are the paths of an api.ProofBundle and the
+	// firmware image it is for, which are verified if UpdateFile is not set.
+	BundleFile string
+	ImageFile  string
+	// DeviceID selects how the expected measurement of the image is
+	// calculated, and defaults to the device in the firmware manifest.
+	DeviceID       string
+	LogSigVerifier note.Verifier
+	// MapSigVerifier verifies the map checkpoint in the bundle's map
+	// inclusion, if there is one.
+	MapSigVerifier note.Verifier
+	Claimants      *crypto.Registry
+	// WitnessPolicy is the witness policy which the bundle checkpoint must satisfy.
+	WitnessPolicy verify.WitnessPolicy
+	// Output is where the report is written.
+	Output io.Writer
+}
+
+// Check is the outcome of a single verification check.
+type Check struct {
+	Name  string
+	OK    bool
+	Error string `json:",omitempty"`
+}
+
+// Report describes a proof bundle and firmware image, and the outcome of
+// each of the checks performed on them.
+type Report struct {
+	// Manifest is the firmware metadata from the bundle, if it could be parsed.
+	Manifest *api.FirmwareMetadata `json:",omitempty"`
+	// Checkpoint is the log checkpoint from the bundle, if its signature was valid.
+	Checkpoint *api.LogCheckpoint `json:",omitempty"`
+	// LeafIndex is the index of the manifest in the log, according to the bundle.
+	LeafIndex uint64
+	// ImageSHA512 is the hash of the firmware image.
+	ImageSHA512 []byte
+	// Measurement is the expected measurement of the firmware image, if the
+	// device is known.
+	Measurement []byte `json:",omitempty"`
+	// Aggregation is the firmware's aggregated annotations from the map, if
+	// the bundle proves them.
+	Aggregation *api.AggregatedFirmware `json:",omitempty"`
+	Checks      []Check
+	// OK is true only if all of the checks passed.
+	OK bool
+}
+
+func (r *Report) check(name string, err error) bool {
+	c := Check{Name: name, OK: err == nil}
+	if err != nil {
+		c.Error = err.Error()
+	}
+	r.Checks = append(r.Checks, c)
+	return c.OK
+}
+
+// Main is the entrypoint for the implementation of the verifier.
+// The report is written to opts.Output, and an error returned if any check failed.
+func Main(opts VerifyOpts) error {
+	if opts.LogSigVerifier == nil || opts.Claimants == nil {
+		return errors.New("log signature verifier and claimant registry are required")
+	}
+	bundleRaw, image, err := readInputs(opts)
+	if err != nil {
+		return err
+	}
+
+	r := Verify(bundleRaw, image, opts.DeviceID, opts.LogSigVerifier, opts.MapSigVerifier, opts.Claimants, opts.WitnessPolicy)
+	enc := json.NewEncoder(opts.Output)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(r); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	if !r.OK {
+		return errors.New("verification failed")
+	}
+	return nil
+}
+
+// readInputs returns the raw proof bundle and the firmware image to verify.
+func readInputs(opts VerifyOpts) ([]byte, []byte, error) {
+	if len(opts.UpdateFile) > 0 {
+		if len(opts.BundleFile) > 0 || len(opts.ImageFile) > 0 {
+			return nil, nil, errors.New("either an update file, or a bundle file and image file, must be provided, but not both")
+		}
+		raw, err := ioutil.ReadFile(opts.UpdateFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read update package file: %w", err)
+		}
+		var up api.UpdatePackage
+		if err := json.Unmarshal(raw, &up); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse update package file: %w", err)
+		}
+		return up.ProofBundle, up.FirmwareImage, nil
+	}
+
+	if len(opts.BundleFile) == 0 || len(opts.ImageFile) == 0 {
+		return nil, nil, errors.New("either an update file, or a bundle file and image file, must be provided")
+	}
+	bundleRaw, err := ioutil.ReadFile(opts.BundleFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read bundle file: %w", err)
+	}
+	image, err := ioutil.ReadFile(opts.ImageFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read image file: %w", err)
+	}
+	return bundleRaw, image, nil
+}
+
+// Verify checks that the proof bundle is self-consistent and matches the
+// firmware image, without contacting the log. As many checks as possible are
+// performed, so that the report describes all of the problems found.
+func Verify(bundleRaw, image []byte, deviceID string, logSigVerifier, mapSigVerifier note.Verifier, claimants *crypto.Registry, wp verify.WitnessPolicy) Report {
+	h := sha512.Sum512(image)
+	r := Report{ImageSHA512: h[:]}
+
+	var pb api.ProofBundle
+	if !r.check("bundle", json.Unmarshal(bundleRaw, &pb)) {
+		return r
+	}
+	r.LeafIndex = pb.InclusionProof.LeafIndex
+
+	cp, err := api.ParseCheckpoint(pb.Checkpoint, logSigVerifier)
+	if r.check("checkpoint signature", err) {
+		r.Checkpoint = cp
+		r.Checkpoint.Envelope = nil
+		r.check("witness cosignatures", wp.Verify(pb.Checkpoint, logSigVerifier))
+	}
+
+	var stmt api.SignedStatement
+	if r.check("manifest statement", parseStatement(pb.ManifestStatement, &stmt)) {
+		r.check("manifest signature", claimants.VerifyStatement(stmt, nil))
+		var meta api.FirmwareMetadata
+		if r.check("manifest", json.Unmarshal(stmt.Statement, &meta)) {
+			r.Manifest = &meta
+		}
+	}
+
+	if cp != nil {
+		lv := verify.NewLogVerifier()
+		r.check("inclusion proof", lv.VerifyInclusionProof(int64(pb.InclusionProof.LeafIndex), int64(cp.Size), pb.InclusionProof.Proof, cp.Hash, verify.HashLeaf(pb.ManifestStatement)))
+	}
+
+	if r.Manifest != nil {
+		r.check("image hash", equal("firmware image hash", r.ImageSHA512, r.Manifest.FirmwareImageSHA512))
+
+		if len(deviceID) == 0 {
+			deviceID = r.Manifest.DeviceID
+		}
+		m, err := measure(deviceID, image)
+		if r.check("measurement", err) {
+			r.Measurement = m
+			r.check("measurement match", equal("firmware measurement", m, r.Manifest.ExpectedFirmwareMeasurement))
+		}
+	}
+
+	if pb.MapInclusion != nil {
+		agg, err := verify.MapInclusion(pb, logSigVerifier, mapSigVerifier)
+		if r.check("map inclusion", err) {
+			r.Aggregation = &agg
+			r.check("annotations", verify.Aggregation(agg))
+		}
+	}
+
+	// Finally, check the bundle exactly as devices do. A device which has never
+	// been updated has no checkpoint or revision to check the bundle against.
+	noConsistency := func(from, to uint64) ([][]byte, error) { return nil, nil }
+	_, _, err = verify.BundleForUpdate(bundleRaw, r.ImageSHA512, api.LogCheckpoint{}, 0, noConsistency, logSigVerifier, mapSigVerifier, claimants, wp)
+	r.check("update verification", err)
+	if r.Measurement != nil {
+		r.check("boot verification", verify.BundleForBoot(bundleRaw, r.Measurement, logSigVerifier, mapSigVerifier, claimants, wp))
+	}
+
+	r.OK = true
+	for _, c := range r.Checks {
+		r.OK = r.OK && c.OK
+	}
+	return r
+}
+
+// parseStatement parses a firmware manifest SignedStatement.
+func parseStatement(raw []byte, stmt *api.SignedStatement) error {
+	if err := json.Unmarshal(raw, stmt); err != nil {
+		return err
+	}
+	if stmt.Type != api.FirmwareMetadataType {
+		return fmt.Errorf("expected statement type %q, but got %q", api.FirmwareMetadataType, stmt.Type)
+	}
+	return nil
+}
+
+// measure returns the expected measurement of the firmware image for the device.
+func measure(deviceID string, image []byte) ([]byte, error) {
+	switch deviceID {
+	case "armory":
+		return usbarmory.ExpectedMeasurement(image)
+	case "dummy":
+		return dummy_common.ExpectedMeasurement(image)
+	default:
+		return nil, fmt.Errorf("unknown device %q, must be one of: 'dummy', 'armory'", deviceID)
+	}
+}
+
+func equal(what string, got, want []byte) error {
+	if !bytes.Equal(got, want) {
+		return fmt.Errorf("%s does not match metadata (0x%x != 0x%x)", what, got, want)
+	}
+	return nil
+}
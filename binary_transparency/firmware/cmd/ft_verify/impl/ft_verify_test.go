@@ -0,0 +1,228 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package impl
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/trillian-examples/binary_transparency/firmware/api"
+	dummy_common "github.com/google/trillian-examples/binary_transparency/firmware/devices/dummy/common"
+	"github.com/google/trillian-examples/binary_transparency/firmware/internal/crypto"
+	"github.com/google/trillian-examples/binary_transparency/firmware/internal/verify"
+	"github.com/google/trillian-examples/formats/log"
+	"github.com/google/trillian-examples/formats/note"
+	sumdb_note "golang.org/x/mod/sumdb/note"
+)
+
+const (
+	vendorKey = "../../../testdata/keys/vendor.pem"
+	firmware  = "../../../testdata/firmware/dummy_device/example.wasm"
+)
+
+// bundle returns a proof bundle for the image in a log containing only its
+// manifest, so that the checkpoint root is the leaf hash and the proof is empty.
+func bundle(t *testing.T, image []byte) []byte {
+	t.Helper()
+	vendor, err := crypto.LoadSigningClaimant(vendorKey)
+	if err != nil {
+		t.Fatalf("LoadSigningClaimant() = %v", err)
+	}
+	m, err := dummy_common.ExpectedMeasurement(image)
+	if err != nil {
+		t.Fatalf("ExpectedMeasurement() = %v", err)
+	}
+	h := sha512.Sum512(image)
+	meta, err := json.Marshal(api.FirmwareMetadata{
+		DeviceID:                    "dummy",
+		FirmwareRevision:            1,
+		FirmwareImageSHA512:         h[:],
+		ExpectedFirmwareMeasurement: m,
+		BuildTimestamp:              "2021-06-01T12:00:00Z",
+	})
+	if err != nil {
+		t.Fatalf("Marshal() = %v", err)
+	}
+	sig, err := vendor.SignMessage(api.FirmwareMetadataType, meta)
+	if err != nil {
+		t.Fatalf("SignMessage() = %v", err)
+	}
+	stmt, err := json.Marshal(api.SignedStatement{Type: api.FirmwareMetadataType, Statement: meta, Signature: sig})
+	if err != nil {
+		t.Fatalf("Marshal() = %v", err)
+	}
+
+	cp := api.LogCheckpoint{
+		Checkpoint: log.Checkpoint{
+			Ecosystem: api.FTLogCheckpointEcosystemv0,
+			Size:      1,
+			Hash:      verify.HashLeaf(stmt),
+		},
+		TimestampNanos: uint64(time.Now().UnixNano()),
+	}
+	signer, err := note.NewSigner(crypto.TestFTPersonalityPriv)
+	if err != nil {
+		t.Fatalf("NewSigner() = %v", err)
+	}
+	cpBody, err := cp.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal() = %v", err)
+	}
+	cpRaw, err := sumdb_note.Sign(&sumdb_note.Note{Text: string(cpBody)}, signer)
+	if err != nil {
+		t.Fatalf("Sign() = %v", err)
+	}
+
+	pb, err := json.Marshal(api.ProofBundle{
+		ManifestStatement: stmt,
+		Checkpoint:        cpRaw,
+		InclusionProof:    api.InclusionProof{LeafIndex: 0, Proof: [][]byte{}},
+	})
+	if err != nil {
+		t.Fatalf("Marshal() = %v", err)
+	}
+	return pb
+}
+
+func TestVerify(t *testing.T) {
+	image, err := ioutil.ReadFile(firmware)
+	if err != nil {
+		t.Fatalf("ReadFile() = %v", err)
+	}
+	v, err := note.NewVerifier(crypto.TestFTPersonalityPub)
+	if err != nil {
+		t.Fatalf("NewVerifier() = %v", err)
+	}
+	witness, err := note.NewVerifier(crypto.TestWitnessPub)
+	if err != nil {
+		t.Fatalf("NewVerifier() = %v", err)
+	}
+	pb := bundle(t, image)
+	var tamperedBundle api.ProofBundle
+	if err := json.Unmarshal(pb, &tamperedBundle); err != nil {
+		t.Fatalf("Unmarshal() = %v", err)
+	}
+	tamperedBundle.InclusionProof.LeafIndex = 1
+	tampered, err := json.Marshal(tamperedBundle)
+	if err != nil {
+		t.Fatalf("Marshal() = %v", err)
+	}
+
+	for _, test := range []struct {
+		desc       string
+		bundle     []byte
+		image      []byte
+		device     string
+		wp         verify.WitnessPolicy
+		wantOK     bool
+		wantFailed []string
+	}{
+		{
+			desc:   "valid",
+			bundle: pb,
+			image:  image,
+			wantOK: true,
+		}, {
+			desc:       "wrong image",
+			bundle:     pb,
+			image:      append([]byte("evil"), image...),
+			wantFailed: []string{"image hash", "measurement match", "update verification", "boot verification"},
+		}, {
+			desc:       "bad inclusion proof",
+			bundle:     tampered,
+			image:      image,
+			wantFailed: []string{"inclusion proof", "update verification", "boot verification"},
+		}, {
+			desc:       "unknown device",
+			bundle:     pb,
+			image:      image,
+			device:     "toaster",
+			wantFailed: []string{"measurement"},
+		}, {
+			desc:       "not witnessed",
+			bundle:     pb,
+			image:      image,
+			wp:         verify.WitnessPolicy{Witnesses: []sumdb_note.Verifier{witness}, Threshold: 1},
+			wantFailed: []string{"witness cosignatures", "update verification", "boot verification"},
+		}, {
+			desc:       "garbage bundle",
+			bundle:     []byte("not a bundle"),
+			image:      image,
+			wantFailed: []string{"bundle"},
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			r := Verify(test.bundle, test.image, test.device, v, nil, crypto.DemoRegistry(), test.wp)
+			if r.OK != test.wantOK {
+				t.Errorf("OK = %t, want %t: %+v", r.OK, test.wantOK, r.Checks)
+			}
+			var failed []string
+			for _, c := range r.Checks {
+				if !c.OK {
+					failed = append(failed, c.Name)
+				}
+			}
+			if got, want := len(failed), len(test.wantFailed); got != want {
+				t.Fatalf("failed checks = %q, want %q", failed, test.wantFailed)
+			}
+			for i := range failed {
+				if failed[i] != test.wantFailed[i] {
+					t.Errorf("failed checks = %q, want %q", failed, test.wantFailed)
+				}
+			}
+		})
+	}
+}
+
+func TestMainReport(t *testing.T) {
+	image, err := ioutil.ReadFile(firmware)
+	if err != nil {
+		t.Fatalf("ReadFile() = %v", err)
+	}
+	up, err := json.Marshal(api.UpdatePackage{FirmwareImage: image, ProofBundle: bundle(t, image)})
+	if err != nil {
+		t.Fatalf("Marshal() = %v", err)
+	}
+	updateFile := filepath.Join(t.TempDir(), "update.ota")
+	if err := ioutil.WriteFile(updateFile, up, 0644); err != nil {
+		t.Fatalf("WriteFile() = %v", err)
+	}
+	v, err := note.NewVerifier(crypto.TestFTPersonalityPub)
+	if err != nil {
+		t.Fatalf("NewVerifier() = %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := Main(VerifyOpts{
+		UpdateFile:     updateFile,
+		LogSigVerifier: v,
+		Claimants:      crypto.DemoRegistry(),
+		Output:         &out,
+	}); err != nil {
+		t.Fatalf("Main() = %v", err)
+	}
+	var r Report
+	if err := json.Unmarshal(out.Bytes(), &r); err != nil {
+		t.Fatalf("failed to parse report: %v", err)
+	}
+	if !r.OK || r.Manifest == nil || r.Manifest.DeviceID != "dummy" || r.Checkpoint == nil || r.Checkpoint.Size != 1 {
+		t.Errorf("unexpected report: %s", out.Bytes())
+	}
+}
@@ -18,12 +18,14 @@ package main
 import (
 	"context"
 	"flag"
+	"io/ioutil"
+	"strings"
 	"time"
 
 	"github.com/golang/glog"
 	"github.com/google/trillian-examples/binary_transparency/firmware/cmd/ft_witness/impl"
 	"github.com/google/trillian-examples/binary_transparency/firmware/internal/crypto"
-	"golang.org/x/mod/sumdb/note"
+	"github.com/google/trillian-examples/formats/note"
 )
 
 var (
@@ -31,12 +33,25 @@ var (
 	wsFile       = flag.String("ws_db_file", "", "Path to a file to be used as simple file storage for checkpoint, e.g. /tmp/witness.db")
 	ftLogURL     = flag.String("ftlog", "http://localhost:8000", "Base URL of FT Log server")
 	pollInterval = flag.Duration("poll_interval", 5*time.Second, "Duration to wait between polling FT Log for new entries")
+	witnessKey   = flag.String("witness_key", "", "Path to a file containing the note signer key used to cosign checkpoints, or empty to use the test key")
 )
 
 func main() {
 	flag.Parse()
 
 	testVerifier, _ := note.NewVerifier(crypto.TestFTPersonalityPub)
+	skey := crypto.TestWitnessPriv
+	if len(*witnessKey) > 0 {
+		k, err := ioutil.ReadFile(*witnessKey)
+		if err != nil {
+			glog.Exitf("Failed to read witness key: %v", err)
+		}
+		skey = strings.TrimSpace(string(k))
+	}
+	signer, err := note.NewSigner(skey)
+	if err != nil {
+		glog.Exitf("Failed to create witness signer: %v", err)
+	}
 
 	ctx := context.Background()
 	if err := impl.Main(ctx, impl.WitnessOpts{
@@ -44,6 +59,7 @@ func main() {
 		WSFile:           *wsFile,
 		FtLogURL:         *ftLogURL,
 		FtLogSigVerifier: testVerifier,
+		Signer:           signer,
 		PollInterval:     *pollInterval,
 	}); err != nil {
 		glog.Exit(err.Error())
@@ -20,6 +20,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"time"
 
@@ -38,7 +39,13 @@ type WitnessOpts struct {
 	WSFile           string
 	FtLogURL         string
 	FtLogSigVerifier note.Verifier
-	PollInterval     time.Duration
+	// Signer, if set, is used to cosign the checkpoints served by the witness.
+	Signer       note.Signer
+	PollInterval time.Duration
+
+	// Listener, if set, is used to serve requests instead of listening on
+	// ListenAddr. This is intended for tests.
+	Listener net.Listener
 }
 
 // Main kickstarts the witness
@@ -53,7 +60,7 @@ func Main(ctx context.Context, opts WitnessOpts) error {
 	}
 
 	glog.Infof("Starting FT witness server...")
-	witness, err := ih.NewWitness(ws, opts.FtLogURL, opts.FtLogSigVerifier, opts.PollInterval)
+	witness, err := ih.NewWitness(ws, opts.FtLogURL, opts.FtLogSigVerifier, opts.Signer, opts.PollInterval)
 	if err != nil {
 		return fmt.Errorf("failed to create new witness: %w", err)
 	}
@@ -68,7 +75,11 @@ func Main(ctx context.Context, opts WitnessOpts) error {
 	}
 	e := make(chan error, 1)
 	go func() {
-		e <- hServer.ListenAndServe()
+		if opts.Listener != nil {
+			e <- hServer.Serve(opts.Listener)
+		} else {
+			e <- hServer.ListenAndServe()
+		}
 		close(e)
 	}()
 	<-ctx.Done()
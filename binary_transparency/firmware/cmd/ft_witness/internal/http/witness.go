@@ -26,6 +26,7 @@ import (
 	"github.com/golang/glog"
 	"github.com/google/trillian-examples/binary_transparency/firmware/api"
 	"github.com/google/trillian-examples/binary_transparency/firmware/internal/client"
+	"github.com/google/trillian-examples/formats/log"
 	"github.com/gorilla/mux"
 	"golang.org/x/mod/sumdb/note"
 )
@@ -45,41 +46,66 @@ type Witness struct {
 	gcp            api.LogCheckpoint
 	logURL         string
 	logSigVerifier note.Verifier
+	signer         note.Signer
 	pollInterval   time.Duration
 	witnessLock    sync.Mutex
 }
 
 // NewWitness creates a new Witness.
-func NewWitness(ws WitnessStore, logURL string, logSigVerifier note.Verifier, pollInterval time.Duration) (*Witness, error) {
+// If signer is not nil, then the witness cosigns the checkpoints it serves.
+func NewWitness(ws WitnessStore, logURL string, logSigVerifier note.Verifier, signer note.Signer, pollInterval time.Duration) (*Witness, error) {
 	gcpRaw, err := ws.RetrieveCP()
 	if err != nil {
 		return nil, fmt.Errorf("new witness failed due to storage retrieval: %w", err)
 	}
-	gcp := api.LogCheckpoint{
-		Envelope: gcpRaw,
+	s := &Witness{
+		ws:             ws,
+		gcp:            api.LogCheckpoint{Envelope: gcpRaw},
+		logURL:         logURL,
+		logSigVerifier: logSigVerifier,
+		signer:         signer,
+		pollInterval:   pollInterval,
 	}
 	if len(gcpRaw) > 0 {
-		n, err := note.Open(gcpRaw, note.VerifierList(logSigVerifier))
+		// The stored checkpoint may predate the witness having a signer.
+		env, err := s.cosign(gcpRaw)
 		if err != nil {
-			return nil, fmt.Errorf("failed to open stored checkpoint: %w", err)
+			return nil, fmt.Errorf("failed to cosign stored checkpoint: %w", err)
 		}
-		if err := gcp.Unmarshal([]byte(n.Text)); err != nil {
+		cp, err := api.ParseCheckpoint(env, logSigVerifier)
+		if err != nil {
 			return nil, fmt.Errorf("failed to parse stored checkpoint: %w", err)
 		}
+		s.gcp = *cp
 	}
+	return s, nil
+}
 
-	return &Witness{
-		ws:             ws,
-		gcp:            gcp,
-		logURL:         logURL,
-		logSigVerifier: logSigVerifier,
-		pollInterval:   pollInterval,
-	}, nil
+// cosign returns the checkpoint envelope with the witness's cosignature added,
+// unless the witness has no signer or has already cosigned it.
+func (s *Witness) cosign(envelope []byte) ([]byte, error) {
+	if s.signer == nil {
+		return envelope, nil
+	}
+	sc, err := log.ParseSignedCheckpoint(envelope, s.logSigVerifier)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range sc.Cosignatures {
+		if c.Name == s.signer.Name() && c.Hash == s.signer.KeyHash() {
+			return envelope, nil
+		}
+	}
+	if err := sc.Cosign(s.signer); err != nil {
+		return nil, err
+	}
+	return sc.Marshal(), nil
 }
 
 // getCheckpoint returns a checkpoint which is registered with witness
 func (s *Witness) getCheckpoint(w http.ResponseWriter, r *http.Request) {
 	s.witnessLock.Lock()
+	defer s.witnessLock.Unlock()
 	w.Header().Set("Content-Type", "text/plain")
 	w.Write(s.gcp.Envelope)
 }
@@ -100,7 +126,7 @@ func (s *Witness) Poll(ctx context.Context) error {
 		LogURL:         ftURL,
 		LogSigVerifier: s.logSigVerifier,
 	}
-	follow := client.NewLogFollower(c)
+	follow := client.NewLogFollower(c, nil)
 
 	glog.Infof("Polling FT log %q...", ftURL)
 	cpc, cperrc := follow.Checkpoints(ctx, s.pollInterval, s.gcp)
@@ -115,6 +141,13 @@ func (s *Witness) Poll(ctx context.Context) error {
 		case cp = <-cpc:
 		}
 
+		env, err := s.cosign(cp.Envelope)
+		if err != nil {
+			glog.Warningf("Failed to cosign new logcheckpoint: %q", err)
+			continue
+		}
+		cp.Envelope = env
+
 		s.witnessLock.Lock()
 		if err = s.ws.StoreCP(cp.Envelope); err != nil {
 			glog.Warningf("Failed to save new logcheckpoint into store: %q", err)
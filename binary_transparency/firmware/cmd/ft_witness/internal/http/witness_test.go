@@ -33,6 +33,8 @@ const (
 func TestGetWitnessCheckpoint(t *testing.T) {
 	testSigner, _ := note.NewSigner(crypto.TestFTPersonalityPriv)
 	testVerifier, _ := note.NewVerifier(crypto.TestFTPersonalityPub)
+	witnessSigner, _ := note.NewSigner(crypto.TestWitnessPriv)
+	witnessVerifier, _ := note.NewVerifier(crypto.TestWitnessPub)
 	for _, test := range []struct {
 		desc     string
 		wantBody string
@@ -50,7 +52,7 @@ func TestGetWitnessCheckpoint(t *testing.T) {
 			if err != nil {
 				t.Fatalf("Failed to sign checkpoint: %v", err)
 			}
-			witness, err := NewWitness(FakeStore{ns, true}, dummyURL, testVerifier, dummyPollInterval)
+			witness, err := NewWitness(FakeStore{ns, true}, dummyURL, testVerifier, witnessSigner, dummyPollInterval)
 			if err != nil {
 				t.Fatalf("error creating witness: %v", err)
 			}
@@ -69,10 +71,13 @@ func TestGetWitnessCheckpoint(t *testing.T) {
 			if err != nil {
 				t.Errorf("failed to read body: %v", err)
 			}
-			got, err := note.Open(body, note.VerifierList(testVerifier))
+			got, err := note.Open(body, note.VerifierList(testVerifier, witnessVerifier))
 			if err != nil {
 				t.Fatalf("Failed to open returned body: %v :\n%s", err, body)
 			}
+			if len(got.Sigs) != 2 {
+				t.Errorf("got %d verified signatures, want log signature and cosignature:\n%s", len(got.Sigs), body)
+			}
 			if got.Text != test.wantBody {
 				t.Errorf("got '%s' want '%s'", got.Text, test.wantBody)
 			}
@@ -92,7 +97,7 @@ func TestFailedWitnessCreation(t *testing.T) {
 		},
 	} {
 		t.Run(test.desc, func(t *testing.T) {
-			_, err := NewWitness(FakeStore{[]byte{}, false}, dummyURL, testVerifier, dummyPollInterval)
+			_, err := NewWitness(FakeStore{[]byte{}, false}, dummyURL, testVerifier, nil, dummyPollInterval)
 			if err == nil {
 				t.Errorf("error witness creation happened smoothly: %v", err)
 			}
@@ -0,0 +1,191 @@
+// Copyright 2020 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package impl is the implementation of the tool which builds the FT map.
+package impl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/apache/beam/sdks/go/pkg/beam"
+	"github.com/apache/beam/sdks/go/pkg/beam/io/databaseio"
+	"github.com/apache/beam/sdks/go/pkg/beam/runners/direct"
+	"github.com/google/trillian/experimental/batchmap"
+
+	"github.com/google/trillian-examples/binary_transparency/firmware/api"
+	"github.com/google/trillian-examples/binary_transparency/firmware/internal/ftmap"
+
+	_ "github.com/mattn/go-sqlite3" // Load drivers for sqlite3
+)
+
+func init() {
+	beam.RegisterType(reflect.TypeOf((*tileToDBRowFn)(nil)).Elem())
+	beam.RegisterType(reflect.TypeOf((*logToDBRowFn)(nil)).Elem())
+	beam.RegisterType(reflect.TypeOf((*aggToDBRowFn)(nil)).Elem())
+}
+
+// MapOpts encapsulates options for building a revision of the FT map.
+type MapOpts struct {
+	// Input is the log to build the map from.
+	Input ftmap.InputLog
+	// MapDB is the connection path for the output database where the map
+	// tiles will be written.
+	MapDB string
+	// Count is the total number of entries starting from the beginning of the
+	// log to use, or -1 to use all.
+	Count int64
+	// WriteBatchSize is the number of tiles to write per batch.
+	WriteBatchSize int
+	// Run executes the pipeline, e.g. beamx.Run. If unset, the pipeline is
+	// executed in process using the direct runner.
+	Run func(ctx context.Context, p *beam.Pipeline) error
+}
+
+// Main builds a new revision of the map from the log, and writes it out to
+// the map DB.
+func Main(ctx context.Context, opts MapOpts) error {
+	if opts.Input == nil {
+		return errors.New("input log is required")
+	}
+	if len(opts.MapDB) == 0 {
+		return errors.New("map DB is required")
+	}
+	mapDB, err := ftmap.NewMapDB(opts.MapDB)
+	if err != nil {
+		return fmt.Errorf("failed to open map DB at %q: %v", opts.MapDB, err)
+	}
+	rev, err := mapDB.NextWriteRevision()
+	if err != nil {
+		return fmt.Errorf("failed to query for next write revision: %v", err)
+	}
+
+	// The tree & strata config is part of the API for clients. If we make this configurable then
+	// there needs to be some dynamic way to get this to clients (e.g. in a MapCheckpoint).
+	pb := ftmap.NewMapBuilder(opts.Input, api.MapTreeID, api.MapPrefixStrata)
+
+	p, s := beam.NewPipelineWithRoot()
+	result, err := pb.Create(s, opts.Count)
+	if err != nil {
+		return fmt.Errorf("failed to build Create pipeline: %v", err)
+	}
+
+	tileRows := beam.ParDo(s.Scope("convertTiles"), &tileToDBRowFn{Revision: rev}, result.MapTiles)
+	databaseio.WriteWithBatchSize(s.Scope("sinkTiles"), opts.WriteBatchSize, "sqlite3", opts.MapDB, "tiles", []string{}, tileRows)
+	aggRows := beam.ParDo(s.Scope("convertAgg"), &aggToDBRowFn{Revision: rev}, result.AggregatedFirmware)
+	databaseio.WriteWithBatchSize(s.Scope("sinkAgg"), opts.WriteBatchSize, "sqlite3", opts.MapDB, "aggregations", []string{}, aggRows)
+	logRows := beam.ParDo(s, &logToDBRowFn{rev}, result.DeviceLogs)
+	databaseio.WriteWithBatchSize(s.Scope("sinkLogs"), opts.WriteBatchSize, "sqlite3", opts.MapDB, "logs", []string{}, logRows)
+
+	// All of the above constructs the pipeline but doesn't run it. Now we run it.
+	run := opts.Run
+	if run == nil {
+		run = func(ctx context.Context, p *beam.Pipeline) error {
+			_, err := direct.Execute(ctx, p)
+			return err
+		}
+	}
+	if err := run(ctx, p); err != nil {
+		return fmt.Errorf("failed to execute job: %v", err)
+	}
+
+	// Now write the revision metadata to finalize this map construction.
+	if err := mapDB.WriteRevision(rev, result.Metadata.Checkpoint, result.Metadata.Entries); err != nil {
+		return fmt.Errorf("failed to finalize map revison %d: %v", rev, err)
+	}
+	return nil
+}
+
+// LogDBRow adapts DeviceReleaseLog to the schema format of the Map database to allow for databaseio writing.
+type LogDBRow struct {
+	Revision int
+	// DeviceID is the vendor qualified device ID, see api.QualifiedDeviceID.
+	DeviceID string
+	Leaves   []byte
+}
+
+type logToDBRowFn struct {
+	Revision int
+}
+
+func (fn *logToDBRowFn) ProcessElement(ctx context.Context, l *api.DeviceReleaseLog) (LogDBRow, error) {
+	bs, err := json.Marshal(l.Revisions)
+	if err != nil {
+		return LogDBRow{}, err
+	}
+	return LogDBRow{
+		Revision: fn.Revision,
+		DeviceID: l.QualifiedDeviceID(),
+		Leaves:   bs,
+	}, nil
+}
+
+// MapTile is the schema format of the Map database to allow for databaseio writing.
+type MapTile struct {
+	Revision int
+	Path     []byte
+	Tile     []byte
+}
+
+type tileToDBRowFn struct {
+	Revision int
+}
+
+func (fn *tileToDBRowFn) ProcessElement(ctx context.Context, t *batchmap.Tile) (MapTile, error) {
+	bs, err := json.Marshal(t)
+	if err != nil {
+		return MapTile{}, err
+	}
+	return MapTile{
+		Revision: fn.Revision,
+		Path:     t.Path,
+		Tile:     bs,
+	}, nil
+}
+
+// AggregatedFirmwareDBRow adapts AggregatedFirmware to the schema format of the Map database to allow for databaseio writing.
+type AggregatedFirmwareDBRow struct {
+	// The keys are the index of the FW Log Metadata that was aggregated, and map Revision number.
+	FWLogIndex uint64
+	Revision   int
+
+	// The value is the summary of the aggregated information. Thus far, bools for whether it's considered good,
+	// and whether it has been revoked.
+	// Clients will have the other information about the FW so no need to duplicate it here.
+	Good    int
+	Revoked int
+}
+
+type aggToDBRowFn struct {
+	Revision int
+}
+
+func (fn *aggToDBRowFn) ProcessElement(ctx context.Context, t *api.AggregatedFirmware) AggregatedFirmwareDBRow {
+	goodInt, revokedInt := 0, 0
+	if t.Good {
+		goodInt = 1
+	}
+	if t.Revoked {
+		revokedInt = 1
+	}
+	return AggregatedFirmwareDBRow{
+		FWLogIndex: t.Index,
+		Revision:   fn.Revision,
+		Good:       goodInt,
+		Revoked:    revokedInt,
+	}
+}
@@ -20,23 +20,42 @@ package main
 import (
 	"context"
 	"flag"
+	"io/ioutil"
+	"strings"
 
 	"github.com/golang/glog"
 	"github.com/google/trillian-examples/binary_transparency/firmware/cmd/ftmapserver/impl"
+	"github.com/google/trillian-examples/binary_transparency/firmware/internal/crypto"
+	"github.com/google/trillian-examples/formats/note"
 )
 
 var (
 	listenAddr = flag.String("listen", ":8001", "address:port to listen for requests on")
 	mapDBAddr  = flag.String("map_db", "", "Connection path for map database")
+	mapKey     = flag.String("map_key", "", "Path to a file containing the note signer key used to sign map checkpoints, or empty to use the test key")
 )
 
 func main() {
 	flag.Parse()
 
+	skey := crypto.TestMapPriv
+	if len(*mapKey) > 0 {
+		k, err := ioutil.ReadFile(*mapKey)
+		if err != nil {
+			glog.Exitf("Failed to read map key: %v", err)
+		}
+		skey = strings.TrimSpace(string(k))
+	}
+	signer, err := note.NewSigner(skey)
+	if err != nil {
+		glog.Exitf("Failed to create map signer: %v", err)
+	}
+
 	ctx := context.Background()
 	if err := impl.Main(ctx, impl.MapServerOpts{
 		ListenAddr: *listenAddr,
 		MapDBAddr:  *mapDBAddr,
+		Signer:     signer,
 	}); err != nil {
 		glog.Exit(err.Error())
 	}
@@ -17,53 +17,67 @@ package impl
 
 import (
 	"context"
+	"database/sql"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"strconv"
 
 	"github.com/golang/glog"
 	"github.com/google/trillian-examples/binary_transparency/firmware/api"
 	"github.com/google/trillian-examples/binary_transparency/firmware/internal/ftmap"
-	"github.com/google/trillian-examples/formats/log"
 	"github.com/google/trillian/experimental/batchmap"
-	"github.com/google/trillian/types"
-
 	"github.com/gorilla/mux"
+	"golang.org/x/mod/sumdb/note"
 
 	_ "github.com/mattn/go-sqlite3" // Load drivers for sqlite3
 )
 
 type MapReader interface {
 	// LatestRevision gets the metadata for the last completed write.
-	LatestRevision() (rev int, logroot types.LogRootV1, count int64, err error)
+	// The log checkpoint is the log's signed checkpoint which the revision
+	// was built from.
+	LatestRevision() (rev int, logCheckpoint []byte, count int64, err error)
 
 	// Tile gets the tile at the given path in the given revision of the map.
 	Tile(revision int, path []byte) (*batchmap.Tile, error)
 
 	// Aggregation gets the aggregation for the firmware at the given log index.
 	Aggregation(revision int, fwLogIndex uint64) (api.AggregatedFirmware, error)
+
+	// DeviceReleaseLog gets the release log for the given vendor qualified device ID.
+	DeviceReleaseLog(revision int, deviceID string) (api.DeviceReleaseLog, error)
 }
 
 // MapServerOpts encapsulates options for running an FT map server.
 type MapServerOpts struct {
 	ListenAddr string
 	MapDBAddr  string
+	// Signer is used to sign the map checkpoints served by the map.
+	Signer note.Signer
+
+	// Listener, if set, is used to serve requests instead of listening on
+	// ListenAddr. This is intended for tests.
+	Listener net.Listener
 }
 
 func Main(ctx context.Context, opts MapServerOpts) error {
 	if len(opts.MapDBAddr) == 0 {
 		return errors.New("map DB is required")
 	}
+	if opts.Signer == nil {
+		return errors.New("map signer is required")
+	}
 	mapDB, err := ftmap.NewMapDB(opts.MapDBAddr)
 	if err != nil {
 		return fmt.Errorf("failed to open map DB at %q: %v", opts.MapDBAddr, err)
 	}
 
 	glog.Infof("Starting FT map server...")
-	srv := Server{db: mapDB}
+	srv := Server{db: mapDB, signer: opts.Signer}
 	r := mux.NewRouter()
 	srv.RegisterHandlers(r)
 	hServer := &http.Server{
@@ -72,7 +86,11 @@ func Main(ctx context.Context, opts MapServerOpts) error {
 	}
 	e := make(chan error, 1)
 	go func() {
-		e <- hServer.ListenAndServe()
+		if opts.Listener != nil {
+			e <- hServer.Serve(opts.Listener)
+		} else {
+			e <- hServer.ListenAndServe()
+		}
 		close(e)
 	}()
 	<-ctx.Done()
@@ -83,44 +101,37 @@ func Main(ctx context.Context, opts MapServerOpts) error {
 
 // Server is the core state & handler implementation of the FT personality.
 type Server struct {
-	db MapReader
+	db     MapReader
+	signer note.Signer
 }
 
-// getCheckpoint returns a recent MapCheckpoint.
+// getCheckpoint returns a recent MapCheckpoint, signed by the map.
 func (s *Server) getCheckpoint(w http.ResponseWriter, r *http.Request) {
-	rev, logRootV1, count, err := s.db.LatestRevision()
+	rev, lcp, count, err := s.db.LatestRevision()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	glog.V(1).Infof("Latest revision: %d %+v", rev, logRootV1)
+	glog.V(1).Infof("Latest revision: %d %s", rev, lcp)
 	tile, err := s.db.Tile(rev, []byte{})
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	lcp := api.LogCheckpoint{
-		Checkpoint: log.Checkpoint{
-			Ecosystem: api.FTLogCheckpointEcosystemv0,
-			Size:      logRootV1.TreeSize,
-			Hash:      logRootV1.RootHash,
-		},
-		TimestampNanos: logRootV1.TimestampNanos,
-	}
 	checkpoint := api.MapCheckpoint{
-		LogCheckpoint: lcp.Marshal(),
+		LogCheckpoint: lcp,
 		LogSize:       uint64(count),
 		Revision:      uint64(rev),
 		RootHash:      tile.RootHash,
 	}
-	js, err := json.Marshal(checkpoint)
+	b, err := note.Sign(&note.Note{Text: string(checkpoint.Marshal())}, s.signer)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
-
+		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(js)
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write(b)
 }
 
 // getTile returns the tile at the given revision & path.
@@ -187,6 +198,34 @@ func (s *Server) getAggregation(w http.ResponseWriter, r *http.Request) {
 	w.Write(js)
 }
 
+// getDeviceReleaseLog returns the release log for the device, from which the
+// highest logged firmware revision for the device can be found.
+func (s *Server) getDeviceReleaseLog(w http.ResponseWriter, r *http.Request) {
+	rev, err := parseUintParam(r, "revision")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	deviceID := mux.Vars(r)["deviceID"]
+
+	l, err := s.db.DeviceReleaseLog(int(rev), deviceID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, fmt.Sprintf("no release log for %q", deviceID), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	js, err := json.Marshal(l)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(js)
+}
+
 // RegisterHandlers registers HTTP handlers for the endpoints.
 func (s *Server) RegisterHandlers(r *mux.Router) {
 	r.HandleFunc(fmt.Sprintf("/%s", api.MapHTTPGetCheckpoint), s.getCheckpoint).Methods("GET")
@@ -194,6 +233,8 @@ func (s *Server) RegisterHandlers(r *mux.Router) {
 	r.HandleFunc(fmt.Sprintf("/%s/in-revision/{revision:[0-9]+}/at-path/", api.MapHTTPGetTile), s.getTile).Methods("GET")
 	r.HandleFunc(fmt.Sprintf("/%s/in-revision/{revision:[0-9]+}/at-path/{path}", api.MapHTTPGetTile), s.getTile).Methods("GET")
 	r.HandleFunc(fmt.Sprintf("/%s/in-revision/{revision:[0-9]+}/for-firmware-at-index/{fwIndex:[0-9]+}", api.MapHTTPGetAggregation), s.getAggregation).Methods("GET")
+	// The device ID is qualified by the vendor, if any, so may contain a "/".
+	r.HandleFunc(fmt.Sprintf("/%s/in-revision/{revision:[0-9]+}/for-device/{deviceID:.+}", api.MapHTTPGetDeviceReleaseLog), s.getDeviceReleaseLog).Methods("GET")
 }
 
 func parseBase64Param(r *http.Request, name string) ([]byte, error) {
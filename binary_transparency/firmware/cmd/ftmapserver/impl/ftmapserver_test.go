@@ -15,6 +15,7 @@
 package impl
 
 import (
+	"database/sql"
 	"encoding/base64"
 	"fmt"
 	"io/ioutil"
@@ -24,45 +25,46 @@ import (
 
 	gomock "github.com/golang/mock/gomock"
 	"github.com/google/trillian-examples/binary_transparency/firmware/api"
+	"github.com/google/trillian-examples/binary_transparency/firmware/internal/crypto"
 	"github.com/google/trillian/experimental/batchmap"
-	"github.com/google/trillian/types"
 	"github.com/gorilla/mux"
+	"golang.org/x/mod/sumdb/note"
 )
 
 func TestRoot(t *testing.T) {
+	signer, err := note.NewSigner(crypto.TestMapPriv)
+	if err != nil {
+		t.Fatalf("NewSigner() = %v", err)
+	}
+	verifier, err := note.NewVerifier(crypto.TestMapPub)
+	if err != nil {
+		t.Fatalf("NewVerifier() = %v", err)
+	}
 	for _, test := range []struct {
 		desc     string
 		rev      int
-		logroot  types.LogRootV1
+		lcp      []byte
 		count    int64
 		rootHash []byte
 		wantBody string
 	}{
 		{
-			desc: "valid 1",
-			rev:  42,
-			logroot: types.LogRootV1{
-				TreeSize:       42,
-				RootHash:       []byte{0x12, 0x34},
-				Revision:       2,
-				TimestampNanos: 12345,
-			},
+			desc:     "valid 1",
+			rev:      42,
+			lcp:      []byte("Firmware Transparency Log v0\n42\nEjQ=\nTimestamp 12345\n\n— ft_personality sig\n"),
 			count:    111,
 			rootHash: []byte{0x34, 0x12},
-			// LogCheckpoint below is base64 of:
-			// Firmware Transparency Log v0
-			// 42
-			// EjQ=
-			// 12345
-			wantBody: `{"LogCheckpoint":"RmlybXdhcmUgVHJhbnNwYXJlbmN5IExvZyB2MAo0MgpFalE9CjEyMzQ1Cg==","LogSize":111,"RootHash":"NBI=","Revision":42}`,
+			// The log checkpoint is passed through unchanged, and is base64
+			// encoded on the last line.
+			wantBody: "Firmware Transparency Map v0\n42\n111\nNBI=\nRmlybXdhcmUgVHJhbnNwYXJlbmN5IExvZyB2MAo0MgpFalE9ClRpbWVzdGFtcCAxMjM0NQoK4oCUIGZ0X3BlcnNvbmFsaXR5IHNpZwo=\n",
 		},
 	} {
 		t.Run(test.desc, func(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			mmr := NewMockMapReader(ctrl)
-			server := Server{db: mmr}
+			server := Server{db: mmr, signer: signer}
 
-			mmr.EXPECT().LatestRevision().Return(test.rev, test.logroot, test.count, nil /* err */)
+			mmr.EXPECT().LatestRevision().Return(test.rev, test.lcp, test.count, nil /* err */)
 			mmr.EXPECT().Tile(test.rev, []byte{}).Return(&batchmap.Tile{RootHash: test.rootHash}, nil /* err */)
 
 			ts := httptest.NewServer(http.HandlerFunc(server.getCheckpoint))
@@ -80,8 +82,12 @@ func TestRoot(t *testing.T) {
 			if err != nil {
 				t.Errorf("failed to read body: %v", err)
 			}
-			if string(body) != test.wantBody {
-				t.Errorf("got '%s' want '%s'", string(body), test.wantBody)
+			got, err := note.Open(body, note.VerifierList(verifier))
+			if err != nil {
+				t.Fatalf("failed to open map checkpoint: %v", err)
+			}
+			if got.Text != test.wantBody {
+				t.Errorf("got '%s' want '%s'", got.Text, test.wantBody)
 			}
 		})
 	}
@@ -199,3 +205,69 @@ func TestAggregation(t *testing.T) {
 		})
 	}
 }
+
+func TestDeviceReleaseLog(t *testing.T) {
+	for _, test := range []struct {
+		desc       string
+		rev        int
+		deviceID   string
+		log        api.DeviceReleaseLog
+		err        error
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			desc:       "no vendor",
+			rev:        42,
+			deviceID:   "dummy",
+			log:        api.DeviceReleaseLog{DeviceID: "dummy", Revisions: []uint64{1, 3, 2}},
+			wantStatus: http.StatusOK,
+			wantBody:   `{"DeviceID":"dummy","Revisions":[1,3,2]}`,
+		}, {
+			desc:       "vendor",
+			rev:        42,
+			deviceID:   "acme/dummy",
+			log:        api.DeviceReleaseLog{VendorID: "acme", DeviceID: "dummy", Revisions: []uint64{7}},
+			wantStatus: http.StatusOK,
+			wantBody:   `{"VendorID":"acme","DeviceID":"dummy","Revisions":[7]}`,
+		}, {
+			desc:       "unknown device",
+			rev:        42,
+			deviceID:   "toaster",
+			err:        sql.ErrNoRows,
+			wantStatus: http.StatusNotFound,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mmr := NewMockMapReader(ctrl)
+			server := Server{db: mmr}
+
+			mmr.EXPECT().DeviceReleaseLog(test.rev, test.deviceID).Return(test.log, test.err)
+
+			r := mux.NewRouter()
+			server.RegisterHandlers(r)
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+			url := fmt.Sprintf("%s/%s/in-revision/%d/for-device/%s", ts.URL, api.MapHTTPGetDeviceReleaseLog, test.rev, test.deviceID)
+
+			resp, err := ts.Client().Get(url)
+			if err != nil {
+				t.Fatalf("error response: %v", err)
+			}
+			if resp.StatusCode != test.wantStatus {
+				t.Errorf("status code got %v want %v (%s)", resp.StatusCode, test.wantStatus, url)
+			}
+			if test.wantStatus != http.StatusOK {
+				return
+			}
+			body, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Errorf("failed to read body: %v", err)
+			}
+			if string(body) != test.wantBody {
+				t.Errorf("got '%s' want '%s'", string(body), test.wantBody)
+			}
+		})
+	}
+}
@@ -39,6 +39,8 @@ type ModifyBundleOpts struct {
 	Input      string
 	Output     string
 	Sign       bool
+	// Signer holds the stolen vendor key used to re-sign the manifest if Sign is set.
+	Signer *crypto.Claimant
 }
 
 // Main is the modify bundle entrypoint.
@@ -46,6 +48,9 @@ func Main(opts ModifyBundleOpts) error {
 	if len(opts.BinaryPath) == 0 {
 		return errors.New("must specify BinaryPath")
 	}
+	if opts.Sign && opts.Signer == nil {
+		return errors.New("must specify Signer in order to sign")
+	}
 
 	bundleRaw, err := ioutil.ReadFile(opts.Input)
 	if err != nil {
@@ -97,7 +102,7 @@ func Main(opts ModifyBundleOpts) error {
 
 	if opts.Sign {
 		// Use stolen key to re-sign the dodgy metadata
-		sig, err := crypto.Publisher.SignMessage(api.FirmwareMetadataType, rawMeta)
+		sig, err := opts.Signer.SignMessage(api.FirmwareMetadataType, rawMeta)
 		if err != nil {
 			return fmt.Errorf("failed to sign FirmwareMetadata: %w", err)
 		}
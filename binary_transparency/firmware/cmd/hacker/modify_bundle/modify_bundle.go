@@ -32,6 +32,7 @@ import (
 
 	"github.com/golang/glog"
 	"github.com/google/trillian-examples/binary_transparency/firmware/cmd/hacker/modify_bundle/impl"
+	"github.com/google/trillian-examples/binary_transparency/firmware/internal/crypto"
 )
 
 var (
@@ -40,17 +41,27 @@ var (
 	input      = flag.String("input", "", "File path read input ProofBundle from.")
 	output     = flag.String("output", "", "File path to write output ProofBundle to.")
 	sign       = flag.Bool("sign", true, "Whether to use stolen key to sign manifest.")
+	keyFile    = flag.String("key_file", "testdata/keys/vendor.pem", "Path to the stolen vendor PEM private key used to sign the manifest.")
 )
 
 func main() {
 	flag.Parse()
 
+	var signer *crypto.Claimant
+	if *sign {
+		var err error
+		if signer, err = crypto.LoadSigningClaimant(*keyFile); err != nil {
+			glog.Exitf("Failed to load stolen key: %v", err)
+		}
+	}
+
 	if err := impl.Main(impl.ModifyBundleOpts{
 		BinaryPath: *binaryPath,
 		DeviceID:   *deviceID,
 		Input:      *input,
 		Output:     *output,
 		Sign:       *sign,
+		Signer:     signer,
 	}); err != nil {
 		glog.Exit(err.Error())
 	}
@@ -22,8 +22,10 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/golang/glog"
@@ -32,6 +34,7 @@ import (
 	"github.com/google/trillian-examples/binary_transparency/firmware/devices/usbarmory"
 	"github.com/google/trillian-examples/binary_transparency/firmware/internal/client"
 	"github.com/google/trillian-examples/binary_transparency/firmware/internal/crypto"
+	"github.com/google/trillian-examples/binary_transparency/firmware/internal/verify"
 	"golang.org/x/mod/sumdb/note"
 )
 
@@ -39,11 +42,46 @@ import (
 type PublishOpts struct {
 	LogURL         string
 	LogSigVerifier note.Verifier
+	VendorID       string
 	DeviceID       string
 	Revision       uint64
 	BinaryPath     string
 	Timestamp      string
 	OutputPath     string
+	// Signer holds the vendor key used to sign the statement.
+	Signer *crypto.Claimant
+	// ReleaseDir, if set, is a directory containing a ReleaseFile describing
+	// firmware for many devices, which are published in a single batch.
+	// DeviceID, BinaryPath and OutputPath are ignored in this mode.
+	ReleaseDir string
+	// WitnessURL, if set, is the base URL of a witness whose cosigned
+	// checkpoint is embedded in the update packages in place of the log's.
+	WitnessURL string
+	// MapURL, if set, is the base URL of the FT map. The publisher waits for
+	// the map to include the firmware, and embeds the proof of its annotations
+	// in the update packages so that they can be checked offline.
+	MapURL string
+	// MapSigVerifier verifies the map's signature on its checkpoints, and is
+	// required if MapURL is set.
+	MapSigVerifier note.Verifier
+}
+
+// ReleaseFile is the name of the file in a release directory which describes
+// the firmware in the release.
+const ReleaseFile = "release.json"
+
+// Release describes the firmware for many devices which are to be released
+// together. It is read as JSON from the ReleaseFile in a release directory.
+type Release struct {
+	Entries []ReleaseEntry
+}
+
+// ReleaseEntry describes the firmware in a release for a single device.
+type ReleaseEntry struct {
+	// DeviceID is the target device for the firmware.
+	DeviceID string
+	// BinaryPath is the path of the firmware binary, relative to the release directory.
+	BinaryPath string
 }
 
 // Main is the entrypoint for the implementation of the publisher.
@@ -52,6 +90,39 @@ func Main(ctx context.Context, opts PublishOpts) error {
 	if err != nil {
 		return fmt.Errorf("LogURL is invalid: %w", err)
 	}
+	if opts.Signer == nil {
+		return errors.New("a vendor signer is required")
+	}
+
+	c := &client.SubmitClient{
+		ReadonlyClient: &client.ReadonlyClient{
+			LogURL:         logURL,
+			LogSigVerifier: opts.LogSigVerifier,
+		},
+	}
+	var wc *client.WitnessClient
+	if len(opts.WitnessURL) > 0 {
+		wURL, err := url.Parse(opts.WitnessURL)
+		if err != nil {
+			return fmt.Errorf("WitnessURL is invalid: %w", err)
+		}
+		wc = &client.WitnessClient{
+			URL:            wURL,
+			LogSigVerifier: opts.LogSigVerifier,
+		}
+	}
+	var mc *client.MapClient
+	if len(opts.MapURL) > 0 {
+		if opts.MapSigVerifier == nil {
+			return errors.New("a map signature verifier is required with MapURL")
+		}
+		if mc, err = client.NewMapClient(opts.MapURL, opts.MapSigVerifier); err != nil {
+			return fmt.Errorf("MapURL is invalid: %w", err)
+		}
+	}
+	if len(opts.ReleaseDir) > 0 {
+		return publishRelease(ctx, c, wc, mc, opts)
+	}
 
 	metadata, fw, err := createManifest(opts)
 	if err != nil {
@@ -60,71 +131,225 @@ func Main(ctx context.Context, opts PublishOpts) error {
 
 	glog.Infof("Measurement: %x", metadata.ExpectedFirmwareMeasurement)
 
-	js, err := createStatementJSON(metadata)
+	js, err := createStatementJSON(metadata, opts.Signer)
 	if err != nil {
 		return fmt.Errorf("failed to marshal statement: %w", err)
 	}
 
-	c := &client.SubmitClient{
-		ReadonlyClient: &client.ReadonlyClient{
-			LogURL:         logURL,
-			LogSigVerifier: opts.LogSigVerifier,
-		},
+	glog.Info("Submitting entry...")
+	promise, err := c.PublishFirmware(js, fw)
+	if err != nil {
+		return fmt.Errorf("couldn't submit statement: %w", err)
 	}
 
-	initialCP, err := c.GetCheckpoint()
+	glog.Infof("Successfully submitted entry, waiting for inclusion by %v...", promise.Deadline())
+	if err := awaitAndPackage(ctx, c, wc, mc, opts.MapSigVerifier, *promise, js, fw, opts.OutputPath); err != nil {
+		return fmt.Errorf("bailing: %w", err)
+	}
+	return nil
+}
+
+// publishRelease publishes all of the firmware described in the release
+// directory in a single batch, and writes an update package for each device
+// into the release directory.
+func publishRelease(ctx context.Context, c *client.SubmitClient, wc *client.WitnessClient, mc *client.MapClient, opts PublishOpts) error {
+	rf := filepath.Join(opts.ReleaseDir, ReleaseFile)
+	raw, err := ioutil.ReadFile(rf)
 	if err != nil {
-		return fmt.Errorf("failed to get a pre-submission checkpoint from log: %w", err)
+		return fmt.Errorf("failed to read release file: %w", err)
+	}
+	var release Release
+	if err := json.Unmarshal(raw, &release); err != nil {
+		return fmt.Errorf("failed to unmarshal release file %q: %w", rf, err)
+	}
+	if len(release.Entries) == 0 {
+		return fmt.Errorf("release file %q has no entries", rf)
 	}
 
-	glog.Info("Submitting entry...")
-	if err := c.PublishFirmware(js, fw); err != nil {
-		return fmt.Errorf("couldn't submit statement: %w", err)
+	subs := make([]client.FirmwareSubmission, 0, len(release.Entries))
+	seen := make(map[string]bool)
+	for _, e := range release.Entries {
+		// Each device gets an update package named for it, so may only appear once.
+		if seen[e.DeviceID] {
+			return fmt.Errorf("device %q appears more than once in release", e.DeviceID)
+		}
+		seen[e.DeviceID] = true
+
+		eOpts := opts
+		eOpts.DeviceID = e.DeviceID
+		eOpts.BinaryPath = filepath.Join(opts.ReleaseDir, e.BinaryPath)
+		metadata, fw, err := createManifest(eOpts)
+		if err != nil {
+			return fmt.Errorf("failed to create manifest for %q: %w", e.DeviceID, err)
+		}
+		glog.Infof("Measurement for %q: %x", e.DeviceID, metadata.ExpectedFirmwareMeasurement)
+		js, err := createStatementJSON(metadata, opts.Signer)
+		if err != nil {
+			return fmt.Errorf("failed to marshal statement for %q: %w", e.DeviceID, err)
+		}
+		subs = append(subs, client.FirmwareSubmission{Manifest: js, Image: fw})
 	}
 
-	glog.Info("Successfully submitted entry, waiting for inclusion...")
-	cp, consistency, ip, err := client.AwaitInclusion(ctx, c.ReadonlyClient, *initialCP, js)
+	glog.Infof("Submitting %d entries...", len(subs))
+	results, err := c.PublishFirmwareBatch(subs)
+	for i, r := range results {
+		if r.Code != http.StatusOK {
+			glog.Errorf("Entry for %q was not logged (%d): %s", release.Entries[i].DeviceID, r.Code, r.Error)
+		}
+	}
 	if err != nil {
+		return fmt.Errorf("couldn't submit release: %w", err)
+	}
+	promises := make([]api.InclusionPromise, len(results))
+	for i, r := range results {
+		if r.Code != http.StatusOK {
+			return fmt.Errorf("couldn't submit statement for %q: %s", release.Entries[i].DeviceID, r.Error)
+		}
+		p, err := c.ParseInclusionPromise(r.Promise, subs[i].Manifest)
+		if err != nil {
+			return fmt.Errorf("bad promise for %q: %w", release.Entries[i].DeviceID, err)
+		}
+		promises[i] = *p
+	}
+
+	glog.Info("Successfully submitted release, waiting for inclusion...")
+	for i, e := range release.Entries {
+		out := filepath.Join(opts.ReleaseDir, e.DeviceID+".ota")
+		if err := awaitAndPackage(ctx, c, wc, mc, opts.MapSigVerifier, promises[i], subs[i].Manifest, subs[i].Image, out); err != nil {
+			return fmt.Errorf("bailing on %q: %w", e.DeviceID, err)
+		}
+	}
+	return nil
+}
+
+// awaitAndPackage waits for the log to keep its promise to include the
+// statement, and then writes an update package containing the firmware and its
+// proofs to outputPath, if set. If wc is not nil, then the package proves
+// inclusion under the witness's cosigned checkpoint. If mc is not nil, then
+// the package also proves the firmware's annotations in the map.
+func awaitAndPackage(ctx context.Context, c *client.SubmitClient, wc *client.WitnessClient, mc *client.MapClient, mapSigVerifier note.Verifier, promise api.InclusionPromise, js, fw []byte, outputPath string) error {
+	cp, ip, err := c.WaitForInclusion(ctx, promise)
+	if errors.Is(err, client.ErrMergeDelayMissed) {
+		// The statement is logged, so the update package is still valid, but
+		// the log has misbehaved and the promise is the evidence of this.
+		glog.Errorf("Log broke its promise: %v", err)
+		glog.Warningf("Broken promise: %s", promise.Envelope)
+	} else if err != nil {
 		glog.Errorf("Failed while waiting for inclusion: %v", err)
 		glog.Warningf("Failed checkpoint: %s", cp)
-		glog.Warningf("Failed consistency proof: %x", consistency)
 		glog.Warningf("Failed inclusion proof: %x", ip)
-		return fmt.Errorf("bailing: %w", err)
+		return err
 	}
 
 	glog.Infof("Successfully logged %s", js)
 
-	if len(opts.OutputPath) > 0 {
-		glog.Infof("Creating update package file %q...", opts.OutputPath)
-		pb, err := json.Marshal(
-			api.ProofBundle{
-				ManifestStatement: js,
-				Checkpoint:        cp.Envelope,
-				InclusionProof:    ip,
-			})
+	if wc != nil {
+		glog.Infof("Waiting for the witness to reach size %d...", cp.Size)
+		if cp, ip, err = awaitWitness(ctx, c.ReadonlyClient, wc, js, cp.Size); err != nil {
+			return fmt.Errorf("failed to get witnessed checkpoint: %w", err)
+		}
+		glog.Infof("Using witnessed checkpoint %s", cp)
+	}
+
+	if len(outputPath) > 0 {
+		pb := api.ProofBundle{
+			ManifestStatement: js,
+			Checkpoint:        cp.Envelope,
+			InclusionProof:    ip,
+		}
+		if mc != nil {
+			glog.Infof("Waiting for the map to include firmware at index %d...", ip.LeafIndex)
+			if pb.MapInclusion, err = awaitMap(ctx, c.ReadonlyClient, mc, mapSigVerifier, pb); err != nil {
+				return fmt.Errorf("failed to get map inclusion: %w", err)
+			}
+		}
+
+		glog.Infof("Creating update package file %q...", outputPath)
+		pbRaw, err := json.Marshal(pb)
 		if err != nil {
 			return fmt.Errorf("failed to marshal ProofBundle: %w", err)
 		}
 
 		bundle := api.UpdatePackage{
 			FirmwareImage: fw,
-			ProofBundle:   pb,
+			ProofBundle:   pbRaw,
 		}
 
-		f, err := os.OpenFile(opts.OutputPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.ModePerm)
+		f, err := os.OpenFile(outputPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.ModePerm)
 		if err != nil {
-			return fmt.Errorf("failed to create output package file %q: %w", opts.OutputPath, err)
+			return fmt.Errorf("failed to create output package file %q: %w", outputPath, err)
 		}
 		defer f.Close()
 
 		if err := json.NewEncoder(f).Encode(bundle); err != nil {
 			return fmt.Errorf("failed to encode output package JSON: %w", err)
 		}
-		glog.Infof("Successfully created update package file %q", opts.OutputPath)
+		glog.Infof("Successfully created update package file %q", outputPath)
 	}
 	return nil
 }
 
+// awaitWitness waits for the witness to serve a checkpoint of at least the
+// given size, and returns it along with a verified inclusion proof for the
+// statement under it.
+func awaitWitness(ctx context.Context, c *client.ReadonlyClient, wc *client.WitnessClient, js []byte, size uint64) (api.LogCheckpoint, api.InclusionProof, error) {
+	lv := verify.NewLogVerifier()
+	for {
+		wcp, err := wc.GetWitnessCheckpoint()
+		if err != nil {
+			glog.Warningf("Received error while fetching witness checkpoint: %q", err)
+		} else if wcp.Size >= size {
+			ip, err := c.GetInclusion(js, *wcp)
+			if err != nil {
+				return api.LogCheckpoint{}, api.InclusionProof{}, fmt.Errorf("failed to get inclusion proof for witnessed checkpoint: %w", err)
+			}
+			if err := lv.VerifyInclusionProof(int64(ip.LeafIndex), int64(wcp.Size), ip.Proof, wcp.Hash, verify.HashLeaf(js)); err != nil {
+				return api.LogCheckpoint{}, api.InclusionProof{}, fmt.Errorf("invalid inclusion proof for witnessed checkpoint: %w", err)
+			}
+			return *wcp, ip, nil
+		}
+
+		select {
+		case <-time.After(1 * time.Second):
+		case <-ctx.Done():
+			return api.LogCheckpoint{}, api.InclusionProof{}, ctx.Err()
+		}
+	}
+}
+
+// awaitMap waits for the map to be built from a log which includes the
+// firmware in the bundle, and returns the proof of its annotations.
+func awaitMap(ctx context.Context, c *client.ReadonlyClient, mc *client.MapClient, mapSigVerifier note.Verifier, pb api.ProofBundle) (*api.MapInclusion, error) {
+	for {
+		mcp, err := mc.MapCheckpoint()
+		if err != nil {
+			glog.Warningf("Received error while fetching map checkpoint: %q", err)
+		} else if mcp.LogSize > pb.InclusionProof.LeafIndex {
+			mi, err := mc.MapInclusion(ctx, *c, mcp, pb)
+			if err != nil {
+				return nil, err
+			}
+			pb.MapInclusion = mi
+			agg, err := verify.MapInclusion(pb, c.LogSigVerifier, mapSigVerifier)
+			if err != nil {
+				return nil, fmt.Errorf("invalid map inclusion: %w", err)
+			}
+			if err := verify.Aggregation(agg); err != nil {
+				// The package is still created, as the annotations are evidence
+				// of why flash tools which check them will refuse it.
+				glog.Warningf("Annotations on this update will cause it to be refused: %v", err)
+			}
+			return mi, nil
+		}
+
+		select {
+		case <-time.After(1 * time.Second):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
 func createManifest(opts PublishOpts) (api.FirmwareMetadata, []byte, error) {
 	var measure func([]byte) ([]byte, error)
 	switch opts.DeviceID {
@@ -153,6 +378,7 @@ func createManifest(opts PublishOpts) (api.FirmwareMetadata, []byte, error) {
 		buildTime = time.Now().Format(time.RFC3339)
 	}
 	metadata := api.FirmwareMetadata{
+		VendorID:                    opts.VendorID,
 		DeviceID:                    opts.DeviceID,
 		FirmwareRevision:            opts.Revision,
 		FirmwareImageSHA512:         h[:],
@@ -163,12 +389,12 @@ func createManifest(opts PublishOpts) (api.FirmwareMetadata, []byte, error) {
 	return metadata, fw, nil
 }
 
-func createStatementJSON(m api.FirmwareMetadata) ([]byte, error) {
+func createStatementJSON(m api.FirmwareMetadata, signer *crypto.Claimant) ([]byte, error) {
 	js, err := json.Marshal(m)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal metadata: %w", err)
 	}
-	sig, err := crypto.Publisher.SignMessage(api.FirmwareMetadataType, js)
+	sig, err := signer.SignMessage(api.FirmwareMetadataType, js)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate signature: %w", err)
 	}
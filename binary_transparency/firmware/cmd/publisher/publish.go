@@ -22,17 +22,24 @@ import (
 
 	"github.com/golang/glog"
 	"github.com/google/trillian-examples/binary_transparency/firmware/cmd/publisher/impl"
+	"github.com/google/trillian-examples/binary_transparency/firmware/internal/crypto"
+	"github.com/google/trillian-examples/formats/note"
 )
 
 var (
 	logURL = flag.String("log_url", "http://localhost:8000", "Base URL of the log HTTP API")
 
+	vendorID   = flag.String("vendor", "", "the vendor publishing the firmware, or empty for no vendor")
 	deviceID   = flag.String("device", "", "the target device for the firmware")
 	revision   = flag.Uint64("revision", 1, "the version of the firmware")
 	binaryPath = flag.String("binary_path", "", "file path to the firmware binary")
 	timestamp  = flag.String("timestamp", "", "timestamp formatted as RFC3339, or empty to use current time")
 	timeout    = flag.Duration("timeout", 5*time.Minute, "Duration to wait for inclusion of submitted metadata")
 	outputPath = flag.String("output_path", "/tmp/update.ota", "File path to write the update package file to. This file is intended to be consumed by the flash_tool only.")
+	keyFile    = flag.String("key_file", "testdata/keys/vendor.pem", "Path to the vendor PEM private key used to sign the firmware metadata")
+	releaseDir = flag.String("release_dir", "", "If set, a directory containing a release.json describing firmware for many devices, which are all published in one batch. Update packages are written to the same directory, and --device, --binary_path and --output_path are ignored.")
+	witnessURL = flag.String("witness_url", "", "Base URL of a witness whose cosigned checkpoint is embedded in the update package, or empty to use the log's checkpoint")
+	mapURL     = flag.String("map_url", "", "Base URL of the FT map, which the publisher waits for to include the firmware in order to embed proof of its annotations in the update package, or empty to skip this")
 )
 
 func main() {
@@ -40,13 +47,33 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
 	defer cancel()
 
+	v, err := note.NewVerifier(crypto.TestFTPersonalityPub)
+	if err != nil {
+		glog.Exitf("Failed to create CP verifier: %q", err)
+	}
+	mv, err := note.NewVerifier(crypto.TestMapPub)
+	if err != nil {
+		glog.Exitf("Failed to create map verifier: %q", err)
+	}
+	signer, err := crypto.LoadSigningClaimant(*keyFile)
+	if err != nil {
+		glog.Exitf("Failed to load vendor key: %v", err)
+	}
+
 	if err := impl.Main(ctx, impl.PublishOpts{
-		LogURL:     *logURL,
-		DeviceID:   *deviceID,
-		Revision:   *revision,
-		BinaryPath: *binaryPath,
-		Timestamp:  *timestamp,
-		OutputPath: *outputPath,
+		LogURL:         *logURL,
+		LogSigVerifier: v,
+		VendorID:       *vendorID,
+		DeviceID:       *deviceID,
+		Revision:       *revision,
+		BinaryPath:     *binaryPath,
+		Timestamp:      *timestamp,
+		OutputPath:     *outputPath,
+		Signer:         signer,
+		ReleaseDir:     *releaseDir,
+		WitnessURL:     *witnessURL,
+		MapURL:         *mapURL,
+		MapSigVerifier: mv,
 	}); err != nil {
 		glog.Exitf(err.Error())
 	}
@@ -0,0 +1,113 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package impl is the implementation of a tool to put firmware revocations into the log.
+package impl
+
+import (
+	"context"
+	"crypto/sha512"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/binary_transparency/firmware/api"
+	"github.com/google/trillian-examples/binary_transparency/firmware/internal/client"
+	"github.com/google/trillian-examples/binary_transparency/firmware/internal/crypto"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// RevokeOpts encapsulates parameters for the revoke Main below.
+type RevokeOpts struct {
+	LogURL         string
+	LogSigVerifier note.Verifier
+	LogIndex       uint64
+	BinaryPath     string
+	// Signer holds the vendor key used to sign the statement.
+	Signer *crypto.Claimant
+}
+
+// Main is the entrypoint for the implementation of the revoker.
+func Main(ctx context.Context, opts RevokeOpts) error {
+	logURL, err := url.Parse(opts.LogURL)
+	if err != nil {
+		return fmt.Errorf("LogURL is invalid: %w", err)
+	}
+	if opts.Signer == nil {
+		return errors.New("a vendor signer is required")
+	}
+
+	fw, err := ioutil.ReadFile(opts.BinaryPath)
+	if err != nil {
+		return fmt.Errorf("failed to read %q: %w", opts.BinaryPath, err)
+	}
+	h := sha512.Sum512(fw)
+
+	js, err := createStatementJSON(api.RevocationStatement{
+		FirmwareID: api.FirmwareID{
+			LogIndex:            opts.LogIndex,
+			FirmwareImageSHA512: h[:],
+		},
+	}, opts.Signer)
+	if err != nil {
+		return fmt.Errorf("failed to marshal statement: %w", err)
+	}
+
+	c := &client.SubmitClient{
+		ReadonlyClient: &client.ReadonlyClient{
+			LogURL:         logURL,
+			LogSigVerifier: opts.LogSigVerifier,
+		},
+	}
+
+	initialCP, err := c.GetCheckpoint()
+	if err != nil {
+		return fmt.Errorf("failed to get a pre-submission checkpoint from log: %w", err)
+	}
+
+	glog.Info("Submitting revocation...")
+	if err := c.PublishAnnotationRevocation(js); err != nil {
+		return fmt.Errorf("couldn't submit statement: %w", err)
+	}
+
+	glog.Info("Successfully submitted revocation, waiting for inclusion...")
+	if _, _, _, err := client.AwaitInclusion(ctx, c.ReadonlyClient, *initialCP, js); err != nil {
+		return fmt.Errorf("failed while waiting for inclusion: %w", err)
+	}
+
+	glog.Infof("Successfully logged %s", js)
+	return nil
+}
+
+func createStatementJSON(r api.RevocationStatement, signer *crypto.Claimant) ([]byte, error) {
+	js, err := json.Marshal(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal revocation: %w", err)
+	}
+	sig, err := signer.SignMessage(api.RevocationStatementType, js)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signature: %w", err)
+	}
+
+	statement := api.SignedStatement{
+		Type:      api.RevocationStatementType,
+		Statement: js,
+		Signature: sig,
+	}
+
+	return json.Marshal(statement)
+}
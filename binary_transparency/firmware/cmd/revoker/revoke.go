@@ -0,0 +1,65 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// revoke is a demo tool for vendors to revoke firmware which has previously
+// been published to the log.
+//
+// Usage:
+//   go run ./cmd/revoker --logtostderr --log_index=0 --binary_path=./testdata/firmware/dummy_device/example.wasm
+package main
+
+import (
+	"context"
+	"flag"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/binary_transparency/firmware/cmd/revoker/impl"
+	"github.com/google/trillian-examples/binary_transparency/firmware/internal/crypto"
+	"github.com/google/trillian-examples/formats/note"
+)
+
+var (
+	logURL = flag.String("log_url", "http://localhost:8000", "Base URL of the log HTTP API")
+
+	logIndex   = flag.Uint64("log_index", 0, "the index in the log of the firmware metadata to revoke")
+	binaryPath = flag.String("binary_path", "", "file path to the firmware binary being revoked")
+	timeout    = flag.Duration("timeout", 5*time.Minute, "Duration to wait for inclusion of submitted revocation")
+	keyFile    = flag.String("key_file", "testdata/keys/vendor.pem", "Path to the vendor PEM private key used to sign the revocation")
+)
+
+func main() {
+	flag.Parse()
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	v, err := note.NewVerifier(crypto.TestFTPersonalityPub)
+	if err != nil {
+		glog.Exitf("Failed to create CP verifier: %q", err)
+	}
+	signer, err := crypto.LoadSigningClaimant(*keyFile)
+	if err != nil {
+		glog.Exitf("Failed to load vendor key: %v", err)
+	}
+
+	if err := impl.Main(ctx, impl.RevokeOpts{
+		LogURL:         *logURL,
+		LogSigVerifier: v,
+		LogIndex:       *logIndex,
+		BinaryPath:     *binaryPath,
+		Signer:         signer,
+	}); err != nil {
+		glog.Exitf(err.Error())
+	}
+}
@@ -23,8 +23,7 @@ import (
 	"github.com/google/trillian-examples/binary_transparency/firmware/devices/dummy/common"
 	"github.com/google/trillian-examples/binary_transparency/firmware/internal/crypto"
 	"github.com/google/trillian-examples/binary_transparency/firmware/internal/verify"
-
-	"golang.org/x/mod/sumdb/note"
+	"github.com/google/trillian-examples/formats/note"
 )
 
 const (
@@ -45,8 +44,11 @@ type Chain func() error
 // Other, real-world, devices with secure elements may be able to optimise this
 // process by checking once and leveraging properties of the hardware.
 //
+// The stored proof bundle must satisfy the witness policy wp, which is how a
+// device which never goes online can be protected from split views.
+//
 // Returns the first link in the boot chain as a func.
-func Reset(storagePath string) (Chain, error) {
+func Reset(storagePath string, wp verify.WitnessPolicy) (Chain, error) {
 	glog.Info("----RESET----")
 	glog.Info("Powering up bananas, configuring Romulans, feeding the watchdogs")
 
@@ -75,7 +77,11 @@ func Reset(storagePath string) (Chain, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to create sig verifier: %w", err)
 	}
-	if err := verify.BundleForBoot(bundleRaw, fwMeasurement[:], note.VerifierList(v)); err != nil {
+	mv, err := note.NewVerifier(crypto.TestMapPub)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create map sig verifier: %w", err)
+	}
+	if err := verify.BundleForBoot(bundleRaw, fwMeasurement[:], v, mv, crypto.DemoRegistry(), wp); err != nil {
 		return nil, fmt.Errorf("failed to verify bundle: %w", err)
 	}
 
@@ -11,7 +11,7 @@ import (
 	"github.com/f-secure-foundry/tamago/soc/imx6/dcp"
 	"github.com/google/trillian-examples/binary_transparency/firmware/internal/crypto"
 	"github.com/google/trillian-examples/binary_transparency/firmware/internal/verify"
-	"golang.org/x/mod/sumdb/note"
+	"github.com/google/trillian-examples/formats/note"
 )
 
 const (
@@ -44,8 +44,17 @@ func verifyIntegrity(proof, firmware *Partition) error {
 	}
 	fmt.Printf("firmware partition hash: 0x%x\n", h)
 	logSigVerifier, err := note.NewVerifier(crypto.TestFTPersonalityPub)
+	if err != nil {
+		return fmt.Errorf("failed to create log sig verifier: %w", err)
+	}
+	mapSigVerifier, err := note.NewVerifier(crypto.TestMapPub)
+	if err != nil {
+		return fmt.Errorf("failed to create map sig verifier: %w", err)
+	}
 
-	if err := verify.BundleForBoot(rawBundle, h, note.VerifierList(logSigVerifier)); err != nil {
+	// The bootloader has no way to configure trusted witnesses yet, so no
+	// witness cosignatures are required.
+	if err := verify.BundleForBoot(rawBundle, h, logSigVerifier, mapSigVerifier, crypto.DemoRegistry(), verify.WitnessPolicy{}); err != nil {
 		return fmt.Errorf("failed to verify bundle: %w", err)
 	}
 	return nil
@@ -17,10 +17,13 @@ package integration_test
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"testing"
@@ -32,9 +35,15 @@ import (
 	i_monitor "github.com/google/trillian-examples/binary_transparency/firmware/cmd/ft_monitor/impl"
 	i_personality "github.com/google/trillian-examples/binary_transparency/firmware/cmd/ft_personality/impl"
 	i_witness "github.com/google/trillian-examples/binary_transparency/firmware/cmd/ft_witness/impl"
+	i_map "github.com/google/trillian-examples/binary_transparency/firmware/cmd/ftmap/impl"
+	i_mapserver "github.com/google/trillian-examples/binary_transparency/firmware/cmd/ftmapserver/impl"
 	i_modify "github.com/google/trillian-examples/binary_transparency/firmware/cmd/hacker/modify_bundle/impl"
 	i_publish "github.com/google/trillian-examples/binary_transparency/firmware/cmd/publisher/impl"
+	"github.com/google/trillian-examples/binary_transparency/firmware/internal/client"
 	"github.com/google/trillian-examples/binary_transparency/firmware/internal/crypto"
+	"github.com/google/trillian-examples/binary_transparency/firmware/internal/fakelog"
+	"github.com/google/trillian-examples/binary_transparency/firmware/internal/ftmap"
+	"github.com/google/trillian-examples/binary_transparency/firmware/internal/verify"
 	"golang.org/x/mod/sumdb/note"
 )
 
@@ -46,10 +55,12 @@ const (
 
 	GoodFirmware   = "../testdata/firmware/dummy_device/example.wasm"
 	HackedFirmware = "../testdata/firmware/dummy_device/hacked.wasm"
+	ClaimantKeys   = "../testdata/keys/claimants.json"
+	VendorKey      = "../testdata/keys/vendor.pem"
 )
 
 var (
-	trillianAddr = flag.String("trillian", "", "Host:port of Trillian Log RPC server")
+	trillianAddr = flag.String("trillian", "", "Host:port of Trillian Log RPC server, or empty to use an in-memory log")
 )
 
 func mustGetLogSigVerifier(t *testing.T) note.Verifier {
@@ -61,9 +72,42 @@ func mustGetLogSigVerifier(t *testing.T) note.Verifier {
 	return v
 }
 
+func mustGetMapSigVerifier(t *testing.T) note.Verifier {
+	t.Helper()
+	v, err := note.NewVerifier(crypto.TestMapPub)
+	if err != nil {
+		t.Fatalf("Failed to create map verifier: %q", err)
+	}
+	return v
+}
+
+func mustLoadRegistry(t *testing.T) *crypto.Registry {
+	t.Helper()
+	r, err := crypto.LoadRegistry(ClaimantKeys)
+	if err != nil {
+		t.Fatalf("Failed to load claimant registry: %q", err)
+	}
+	return r
+}
+
+func mustLoadVendor(t *testing.T) *crypto.Claimant {
+	t.Helper()
+	c, err := crypto.LoadSigningClaimant(VendorKey)
+	if err != nil {
+		t.Fatalf("Failed to load vendor key: %q", err)
+	}
+	return c
+}
+
 func TestFTIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+	// Without Trillian, the test runs hermetically against an in-memory log.
+	// This also allows the map to be built, as it reads the log directly.
+	var fake *fakelog.Log
 	if len(*trillianAddr) == 0 {
-		t.Skip("--trillian flag unset, skipping test")
+		fake = fakelog.New()
 	}
 
 	tmpDir := t.TempDir()
@@ -74,22 +118,21 @@ func TestFTIntegration(t *testing.T) {
 	ctx, cancel := testContext(t)
 	defer cancel()
 
-	// TODO(al): make this dynamic
-	pListen := "localhost:43563"
-	pAddr := fmt.Sprintf("http://%s", pListen)
+	pListener, pAddr := mustListen(t)
 
-	pErrChan := make(chan error)
+	pErrChan := make(chan error, 1)
 	logSigVerifier := mustGetLogSigVerifier(t)
+	mapSigVerifier := mustGetMapSigVerifier(t)
+	claimants := mustLoadRegistry(t)
+	vendor := mustLoadVendor(t)
 
 	go func() {
-		if err := runPersonality(ctx, t, pListen); err != nil {
+		if err := runPersonality(ctx, t, pListener, fake); err != nil {
 			pErrChan <- err
 		}
 		close(pErrChan)
 	}()
-
-	// TODO(al): make this wait until the personality is listening
-	<-time.After(5 * time.Second)
+	waitForServer(ctx, t, fmt.Sprintf("%s/%s", pAddr, api.HTTPGetRoot), pErrChan)
 
 	for _, step := range []struct {
 		desc       string
@@ -107,6 +150,7 @@ func TestFTIntegration(t *testing.T) {
 					Timestamp:      PublishTimestamp1,
 					Revision:       1,
 					OutputPath:     updatePath,
+					Signer:         vendor,
 				})
 			},
 		}, {
@@ -115,6 +159,7 @@ func TestFTIntegration(t *testing.T) {
 				return i_flash.Main(ctx, i_flash.FlashOpts{
 					LogURL:         pAddr,
 					LogSigVerifier: logSigVerifier,
+					Claimants:      claimants,
 					WitnessURL:     "",
 					DeviceID:       "dummy",
 					UpdateFile:     updatePath,
@@ -140,6 +185,7 @@ func TestFTIntegration(t *testing.T) {
 					Timestamp:      PublishTimestamp2,
 					Revision:       2,
 					OutputPath:     updatePath,
+					Signer:         vendor,
 				})
 			},
 		}, {
@@ -148,6 +194,7 @@ func TestFTIntegration(t *testing.T) {
 				return i_flash.Main(ctx, i_flash.FlashOpts{
 					LogURL:         pAddr,
 					LogSigVerifier: logSigVerifier,
+					Claimants:      claimants,
 					WitnessURL:     "",
 					DeviceID:       "dummy",
 					UpdateFile:     updatePath,
@@ -209,6 +256,7 @@ func TestFTIntegration(t *testing.T) {
 					Input:      filepath.Join(devStoragePath, "bundle.json"),
 					Output:     filepath.Join(devStoragePath, "bundle.json"),
 					Sign:       true,
+					Signer:     vendor,
 				}); err != nil {
 					t.Fatalf("Failed to modify bundle: %q", err)
 				}
@@ -244,18 +292,19 @@ func TestFTIntegration(t *testing.T) {
 					DeviceID:       "dummy",
 					BinaryPath:     HackedFirmware,
 					Timestamp:      PublishMalwareTimestamp,
-					Revision:       1,
+					Revision:       3,
 					OutputPath:     updatePath,
+					Signer:         vendor,
 				}); err != nil {
 					t.Fatalf("Failed to log malware: %q", err)
 				}
 
-				<-time.After(5 * time.Second)
 				// Now flash the bundle normally, it will install because it's been logged
 				// and so is now discoverable.
 				if err := i_flash.Main(ctx, i_flash.FlashOpts{
 					LogURL:         pAddr,
 					LogSigVerifier: logSigVerifier,
+					Claimants:      claimants,
 					WitnessURL:     "",
 					DeviceID:       "dummy",
 					UpdateFile:     updatePath,
@@ -287,37 +336,43 @@ func TestFTIntegration(t *testing.T) {
 			desc: "Firmware update with witness verification",
 			step: func() error {
 				// Start up the witness:
-				wHost := "localhost:43565"
-				wAddr := fmt.Sprintf("http://%s", wHost)
+				wListener, wAddr := mustListen(t)
 				wCtx, wCancel := context.WithCancel(context.Background())
 				defer wCancel()
+				wErrChan := make(chan error, 1)
 				go func() {
-					if err := runWitness(wCtx, t, pAddr, wHost, logSigVerifier); err != nil {
-						t.Errorf("Witness error: %q", err)
+					if err := runWitness(wCtx, t, pAddr, wListener, logSigVerifier); err != nil {
+						wErrChan <- err
 					}
+					close(wErrChan)
 				}()
-
-				// Wait for few seconds before starting the test
-				<-time.After(2 * time.Second)
+				waitForServer(ctx, t, wAddr, wErrChan)
 				if err := i_publish.Main(ctx, i_publish.PublishOpts{
 					LogURL:         pAddr,
 					LogSigVerifier: logSigVerifier,
 					DeviceID:       "dummy",
 					BinaryPath:     GoodFirmware,
 					Timestamp:      PublishTimestamp3,
-					Revision:       3,
+					Revision:       4,
 					OutputPath:     updatePath,
+					Signer:         vendor,
+					WitnessURL:     wAddr,
 				}); err != nil {
 					t.Fatalf("Failed to publish new bundle: %q", err)
 				}
 
-				// Wait witness to view the device checkpoint
-				<-time.After(5 * time.Second)
-
+				// The update package carries the witness's cosignature, so
+				// the device can require it.
+				wp, err := verify.NewWitnessPolicy([]string{crypto.TestWitnessPub}, 1)
+				if err != nil {
+					t.Fatalf("Failed to create witness policy: %q", err)
+				}
 				if err := i_flash.Main(ctx, i_flash.FlashOpts{
 					LogURL:         pAddr,
 					LogSigVerifier: logSigVerifier,
+					Claimants:      claimants,
 					WitnessURL:     wAddr,
+					WitnessPolicy:  wp,
 					DeviceID:       "dummy",
 					UpdateFile:     updatePath,
 					DeviceStorage:  devStoragePath,
@@ -325,6 +380,98 @@ func TestFTIntegration(t *testing.T) {
 					t.Fatalf("witness verification failed: %q", err)
 				}
 
+				return nil
+			},
+		}, {
+			desc: "Build map and fetch device release log",
+			step: func() error {
+				if fake == nil {
+					t.Log("Map can only be built from the in-memory log, skipping")
+					return nil
+				}
+				logURL, err := url.Parse(pAddr)
+				if err != nil {
+					return fmt.Errorf("failed to parse log URL: %w", err)
+				}
+				lc := client.ReadonlyClient{LogURL: logURL, LogSigVerifier: logSigVerifier}
+				mapDB := filepath.Join(tmpDir, "ftmap.db")
+				if err := i_map.Main(ctx, i_map.MapOpts{
+					Input:          ftmap.NewInputLog(lc.GetCheckpoint, fake),
+					MapDB:          mapDB,
+					Count:          -1,
+					WriteBatchSize: 250,
+				}); err != nil {
+					t.Fatalf("Failed to build map: %q", err)
+				}
+
+				// Start up the map server:
+				mListener, mAddr := mustListen(t)
+				mCtx, mCancel := context.WithCancel(context.Background())
+				defer mCancel()
+				mErrChan := make(chan error, 1)
+				go func() {
+					if err := runMapServer(mCtx, t, mListener, mapDB); err != nil {
+						mErrChan <- err
+					}
+					close(mErrChan)
+				}()
+				waitForServer(ctx, t, mAddr, mErrChan)
+
+				mc, err := client.NewMapClient(mAddr, mapSigVerifier)
+				if err != nil {
+					t.Fatalf("Failed to create map client: %q", err)
+				}
+				cp, err := mc.MapCheckpoint()
+				if err != nil {
+					return fmt.Errorf("failed to get map checkpoint: %w", err)
+				}
+				drl, err := mc.DeviceReleaseLog(cp.Revision, "", "dummy")
+				if err != nil {
+					return fmt.Errorf("failed to get device release log: %w", err)
+				}
+				if got, want := drl.HighestRevision(), uint64(4); got != want {
+					return fmt.Errorf("got highest revision %d in map, want %d", got, want)
+				}
+
+				// Add the firmware's annotations to the last update package,
+				// so that they can be required when flashing.
+				raw, err := ioutil.ReadFile(updatePath)
+				if err != nil {
+					return fmt.Errorf("failed to read update package: %w", err)
+				}
+				var up api.UpdatePackage
+				if err := json.Unmarshal(raw, &up); err != nil {
+					return fmt.Errorf("failed to unmarshal update package: %w", err)
+				}
+				var pb api.ProofBundle
+				if err := json.Unmarshal(up.ProofBundle, &pb); err != nil {
+					return fmt.Errorf("failed to unmarshal proof bundle: %w", err)
+				}
+				if pb.MapInclusion, err = mc.MapInclusion(ctx, lc, cp, pb); err != nil {
+					return fmt.Errorf("failed to get map inclusion: %w", err)
+				}
+				if up.ProofBundle, err = json.Marshal(pb); err != nil {
+					return fmt.Errorf("failed to marshal proof bundle: %w", err)
+				}
+				annotatedPath := filepath.Join(tmpDir, "annotated.ota")
+				if raw, err = json.Marshal(up); err != nil {
+					return fmt.Errorf("failed to marshal update package: %w", err)
+				}
+				if err := ioutil.WriteFile(annotatedPath, raw, 0644); err != nil {
+					return fmt.Errorf("failed to write update package: %w", err)
+				}
+				if err := i_flash.Main(ctx, i_flash.FlashOpts{
+					LogURL:              pAddr,
+					LogSigVerifier:      logSigVerifier,
+					MapSigVerifier:      mapSigVerifier,
+					Claimants:           claimants,
+					RequireMapInclusion: true,
+					DeviceID:            "dummy",
+					UpdateFile:          annotatedPath,
+					DeviceStorage:       devStoragePath,
+				}); err != nil {
+					return fmt.Errorf("failed to flash update with map inclusion: %w", err)
+				}
 				return nil
 			},
 		},
@@ -354,6 +501,36 @@ func testContext(t *testing.T) (context.Context, func()) {
 	return ctx, c
 }
 
+// mustListen returns a listener on a free local port, and the URL to reach it.
+func mustListen(t *testing.T) (net.Listener, string) {
+	t.Helper()
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %q", err)
+	}
+	return l, fmt.Sprintf("http://%s", l.Addr())
+}
+
+// waitForServer polls the URL until the server responds, failing the test if
+// the server returns an error on errc first, or the context is done.
+func waitForServer(ctx context.Context, t *testing.T, url string, errc <-chan error) {
+	t.Helper()
+	for {
+		resp, err := http.Get(url)
+		if err == nil {
+			resp.Body.Close()
+			return
+		}
+		select {
+		case err := <-errc:
+			t.Fatalf("Server at %s failed to start: %q", url, err)
+		case <-ctx.Done():
+			t.Fatalf("Server at %s didn't start: %q", url, ctx.Err())
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
 func setupDeviceStorage(t *testing.T, devStoragePath string) {
 	t.Helper()
 	if err := os.MkdirAll(devStoragePath, 0755); err != nil {
@@ -361,7 +538,7 @@ func setupDeviceStorage(t *testing.T, devStoragePath string) {
 	}
 }
 
-func runPersonality(ctx context.Context, t *testing.T, serverAddr string) error {
+func runPersonality(ctx context.Context, t *testing.T, l net.Listener, fake *fakelog.Log) error {
 	t.Helper()
 	r := t.TempDir()
 
@@ -370,29 +547,59 @@ func runPersonality(ctx context.Context, t *testing.T, serverAddr string) error
 		return fmt.Errorf("failed to create CP signer: %w", err)
 	}
 
-	if err := i_personality.Main(ctx, i_personality.PersonalityOpts{
-		ListenAddr:     serverAddr,
+	opts := i_personality.PersonalityOpts{
+		Listener:       l,
 		CASFile:        filepath.Join(r, "ft-cas.db"),
+		CASDir:         filepath.Join(r, "cas"),
 		TrillianAddr:   *trillianAddr,
 		ConnectTimeout: 10 * time.Second,
 		STHRefresh:     time.Second,
+		MaxMergeDelay:  time.Minute,
 		Signer:         signer,
-	}); err != http.ErrServerClosed {
+		Claimants:      mustLoadRegistry(t),
+	}
+	if fake != nil {
+		opts.Log = fake
+	}
+	if err := i_personality.Main(ctx, opts); err != http.ErrServerClosed {
 		return err
 	}
 	return nil
 }
 
-func runWitness(ctx context.Context, t *testing.T, persAddr, serverAddr string, logSigVerifier note.Verifier) error {
+func runWitness(ctx context.Context, t *testing.T, persAddr string, l net.Listener, logSigVerifier note.Verifier) error {
 	t.Helper()
 	r := t.TempDir()
 
-	err := i_witness.Main(ctx, i_witness.WitnessOpts{
-		ListenAddr:       serverAddr,
+	signer, err := note.NewSigner(crypto.TestWitnessPriv)
+	if err != nil {
+		return fmt.Errorf("failed to create witness signer: %w", err)
+	}
+	err = i_witness.Main(ctx, i_witness.WitnessOpts{
+		Listener:         l,
 		WSFile:           filepath.Join(r, "ft-witness.db"),
 		FtLogURL:         persAddr,
 		FtLogSigVerifier: logSigVerifier,
-		PollInterval:     5 * time.Second,
+		Signer:           signer,
+		PollInterval:     time.Second,
+	})
+	if err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func runMapServer(ctx context.Context, t *testing.T, l net.Listener, mapDB string) error {
+	t.Helper()
+
+	signer, err := note.NewSigner(crypto.TestMapPriv)
+	if err != nil {
+		return fmt.Errorf("failed to create map signer: %w", err)
+	}
+	err = i_mapserver.Main(ctx, i_mapserver.MapServerOpts{
+		Listener:  l,
+		MapDBAddr: mapDB,
+		Signer:    signer,
 	})
 	if err != http.ErrServerClosed {
 		return err
@@ -408,6 +615,7 @@ func runMonitor(ctx context.Context, t *testing.T, serverAddr string, pattern st
 	err := i_monitor.Main(ctx, i_monitor.MonitorOpts{
 		LogURL:         serverAddr,
 		LogSigVerifier: logSigVerifier,
+		Claimants:      mustLoadRegistry(t),
 		PollInterval:   1 * time.Second,
 		Keyword:        "H4x0r3d",
 		Matched:        matched,
@@ -49,51 +49,143 @@ type SubmitClient struct {
 }
 
 // PublishFirmware sends a firmware manifest and corresponding image to the log server.
-func (c SubmitClient) PublishFirmware(manifest, image []byte) error {
+// It returns the log's verified promise to include the manifest, which can be
+// passed to WaitForInclusion.
+func (c SubmitClient) PublishFirmware(manifest, image []byte) (*api.InclusionPromise, error) {
 	u, err := c.LogURL.Parse(api.HTTPAddFirmware)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	glog.V(1).Infof("Submitting to %v", u.String())
-	var b bytes.Buffer
-	w := multipart.NewWriter(&b)
+	r, err := postFirmware(u, FirmwareSubmission{Manifest: manifest, Image: image})
+	if err != nil {
+		return nil, fmt.Errorf("failed to publish to log endpoint (%s): %w", u, err)
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, errFromResponse("failed to submit to log", r)
+	}
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read body: %w", err)
+	}
+	return c.ParseInclusionPromise(b, manifest)
+}
 
-	// Write the manifest JSON part
-	mh := make(textproto.MIMEHeader)
-	mh.Set("Content-Type", "application/json")
-	partWriter, err := w.CreatePart(mh)
+// ParseInclusionPromise verifies the log's signature on the promise envelope,
+// and that it's a promise to include the given statement.
+func (c ReadonlyClient) ParseInclusionPromise(envelope, statement []byte) (*api.InclusionPromise, error) {
+	p, err := api.ParseInclusionPromise(envelope, c.LogSigVerifier)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("invalid inclusion promise: %w", err)
 	}
-	if _, err := io.Copy(partWriter, bytes.NewReader(manifest)); err != nil {
-		return err
+	if got, want := p.LeafHash, verify.HashLeaf(statement); !bytes.Equal(got, want) {
+		return nil, fmt.Errorf("inclusion promise is for leaf hash 0x%x, want 0x%x", got, want)
 	}
+	return p, nil
+}
+
+// FirmwareSubmission is a firmware manifest and corresponding image to be
+// published in a batch.
+type FirmwareSubmission struct {
+	Manifest []byte
+	Image    []byte
+}
 
-	// Write the binary FW image part
-	mh = make(textproto.MIMEHeader)
-	mh.Set("Content-Type", "application/octet-stream")
-	partWriter, err = w.CreatePart(mh)
+// PublishFirmwareBatch sends many firmware manifests and corresponding images
+// to the log server in a single request.
+//
+// The log server checks all of the entries before logging any of them, so
+// either none are logged, or all are submitted for logging. The result for
+// each entry is returned in the same order as the entries. If any entry was
+// rejected then an error is returned along with the results, which say which
+// entries were at fault.
+func (c SubmitClient) PublishFirmwareBatch(entries []FirmwareSubmission) ([]api.AddFirmwareResult, error) {
+	u, err := c.LogURL.Parse(api.HTTPAddFirmwareBatch)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	glog.V(1).Infof("Submitting %d entries to %v", len(entries), u.String())
+	r, err := postFirmware(u, entries...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to publish to log endpoint (%s): %w", u, err)
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK && r.StatusCode != http.StatusBadRequest {
+		return nil, errFromResponse("failed to submit batch to log", r)
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	var br api.AddFirmwareBatchResponse
+	if err := json.Unmarshal(body, &br); err != nil {
+		if r.StatusCode == http.StatusBadRequest {
+			// The request as a whole was rejected, rather than any one entry.
+			return nil, status.New(codeFromHTTPResponse(r.StatusCode), fmt.Sprintf("failed to submit batch to log: %s", body)).Err()
+		}
+		return nil, fmt.Errorf("failed to unmarshal batch response %q: %w", body, err)
+	}
+	if got, want := len(br.Results), len(entries); got != want {
+		return nil, fmt.Errorf("got %d results for batch of %d entries", got, want)
+	}
+	if r.StatusCode != http.StatusOK {
+		return br.Results, status.New(codeFromHTTPResponse(r.StatusCode), "failed to submit batch to log: entries were rejected").Err()
 	}
-	if _, err := io.Copy(partWriter, bytes.NewReader(image)); err != nil {
+	return br.Results, nil
+}
+
+// postFirmware POSTs the firmware entries to the URL as a mime/multipart
+// request, with a manifest JSON part followed by an image part for each entry.
+func postFirmware(u *url.URL, entries ...FirmwareSubmission) (*http.Response, error) {
+	var b bytes.Buffer
+	w := multipart.NewWriter(&b)
+
+	writePart := func(contentType string, data []byte) error {
+		mh := make(textproto.MIMEHeader)
+		mh.Set("Content-Type", contentType)
+		partWriter, err := w.CreatePart(mh)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(partWriter, bytes.NewReader(data))
 		return err
 	}
+	for _, e := range entries {
+		// Write the manifest JSON part
+		if err := writePart("application/json", e.Manifest); err != nil {
+			return nil, err
+		}
+		// Write the binary FW image part
+		if err := writePart("application/octet-stream", e.Image); err != nil {
+			return nil, err
+		}
+	}
 
 	// Finish off the multipart request
 	if err := w.Close(); err != nil {
-		return err
+		return nil, err
 	}
 
 	// Turn this into an HTTP POST request
 	req, err := http.NewRequest("POST", u.String(), &b)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	req.Header.Set("Content-Type", w.FormDataContentType())
 
 	// And finally, submit the request to the log
-	r, err := http.DefaultClient.Do(req)
+	return http.DefaultClient.Do(req)
+}
+
+// PublishAnnotationMalware publishes the serialized annotation to the log.
+func (c SubmitClient) PublishAnnotationMalware(stmt []byte) error {
+	u, err := c.LogURL.Parse(api.HTTPAddAnnotationMalware)
+	if err != nil {
+		return err
+	}
+	glog.V(1).Infof("Submitting to %v", u.String())
+	r, err := http.Post(u.String(), "application/json", bytes.NewBuffer(stmt))
 	if err != nil {
 		return fmt.Errorf("failed to publish to log endpoint (%s): %w", u, err)
 	}
@@ -103,9 +195,9 @@ func (c SubmitClient) PublishFirmware(manifest, image []byte) error {
 	return nil
 }
 
-// PublishAnnotationMalware publishes the serialized annotation to the log.
-func (c SubmitClient) PublishAnnotationMalware(stmt []byte) error {
-	u, err := c.LogURL.Parse(api.HTTPAddAnnotationMalware)
+// PublishAnnotationRevocation publishes the serialized revocation to the log.
+func (c SubmitClient) PublishAnnotationRevocation(stmt []byte) error {
+	u, err := c.LogURL.Parse(api.HTTPAddAnnotationRevocation)
 	if err != nil {
 		return err
 	}
@@ -140,21 +232,16 @@ func (c ReadonlyClient) GetCheckpoint() (*api.LogCheckpoint, error) {
 		return nil, fmt.Errorf("failed to read body: %w", err)
 	}
 
-	n, err := note.Open(b, note.VerifierList(c.LogSigVerifier))
-	if err != nil {
-		return nil, err
-	}
-
-	cp := api.LogCheckpoint{Envelope: b}
-	if err := cp.Unmarshal([]byte(n.Text)); err != nil {
-		return nil, err
-	}
-	return &cp, nil
+	return api.ParseCheckpoint(b, c.LogSigVerifier)
 }
 
 // GetInclusion returns an inclusion proof for the statement under the given checkpoint.
 func (c ReadonlyClient) GetInclusion(statement []byte, cp api.LogCheckpoint) (api.InclusionProof, error) {
-	hash := verify.HashLeaf(statement)
+	return c.getInclusionByHash(verify.HashLeaf(statement), cp)
+}
+
+// getInclusionByHash returns an inclusion proof for the leaf hash under the given checkpoint.
+func (c ReadonlyClient) getInclusionByHash(hash []byte, cp api.LogCheckpoint) (api.InclusionProof, error) {
 	u, err := c.LogURL.Parse(fmt.Sprintf("%s/for-leaf-hash/%s/in-tree-of/%d", api.HTTPGetInclusion, base64.URLEncoding.EncodeToString(hash), cp.Size))
 	if err != nil {
 		return api.InclusionProof{}, err
@@ -199,6 +286,39 @@ func (c ReadonlyClient) GetManifestEntryAndProof(request api.GetFirmwareManifest
 	return &mr, nil
 }
 
+// GetEntries returns consecutive entries from the log in the range [start, end),
+// each with an inclusion proof to the given checkpoint. The proofs are not
+// verified. The log may return fewer entries than were requested, but at least
+// one entry will be returned if there is no error.
+func (c ReadonlyClient) GetEntries(start, end uint64, cp api.LogCheckpoint) ([]api.InclusionProof, error) {
+	u, err := c.LogURL.Parse(fmt.Sprintf("%s?start=%d&end=%d&treesize=%d", api.HTTPGetEntries, start, end, cp.Size))
+	if err != nil {
+		return nil, err
+	}
+	r, err := http.Get(u.String())
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != 200 {
+		return nil, errFromResponse("failed to fetch entries", r)
+	}
+
+	var er api.GetEntriesResponse
+	if err := json.NewDecoder(r.Body).Decode(&er); err != nil {
+		return nil, err
+	}
+	if l := uint64(len(er.Entries)); l == 0 || l > end-start {
+		return nil, fmt.Errorf("got %d entries for range [%d, %d)", l, start, end)
+	}
+	for i, e := range er.Entries {
+		if want := start + uint64(i); e.LeafIndex != want {
+			return nil, fmt.Errorf("got entry with index %d, want %d", e.LeafIndex, want)
+		}
+	}
+	return er.Entries, nil
+}
+
 // GetConsistencyProof returns the Consistency Proof from the server, for the two given snapshots
 func (c ReadonlyClient) GetConsistencyProof(request api.GetConsistencyRequest) (*api.ConsistencyProof, error) {
 	url := fmt.Sprintf("%s/from/%d/to/%d", api.HTTPGetConsistency, request.From, request.To)
@@ -16,7 +16,11 @@ package client_test
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"mime"
 	"mime/multipart"
@@ -25,15 +29,27 @@ import (
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/trillian-examples/binary_transparency/firmware/api"
 	"github.com/google/trillian-examples/binary_transparency/firmware/internal/client"
 	"github.com/google/trillian-examples/binary_transparency/firmware/internal/crypto"
+	"github.com/google/trillian-examples/binary_transparency/firmware/internal/verify"
 	"github.com/google/trillian-examples/formats/log"
+	"github.com/google/trillian/merkle/rfc6962/hasher"
 	"golang.org/x/mod/sumdb/note"
 )
 
+func mustMarshalJSON(t *testing.T, v interface{}) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("json.Marshal() = %v", err)
+	}
+	return string(b)
+}
+
 func mustSignCPNote(t *testing.T, b string) []byte {
 	t.Helper()
 	s, err := note.NewSigner(crypto.TestFTPersonalityPriv)
@@ -56,20 +72,43 @@ func mustGetLogSigVerifier(t *testing.T) note.Verifier {
 	return v
 }
 
+// mustSignPromise returns a promise signed by the log to include the statement.
+func mustSignPromise(t *testing.T, statement []byte, ts time.Time, mmd time.Duration) []byte {
+	t.Helper()
+	p := api.InclusionPromise{
+		LeafHash:       verify.HashLeaf(statement),
+		TimestampNanos: uint64(ts.UnixNano()),
+		MaxMergeDelay:  mmd,
+	}
+	return mustSignCPNote(t, string(p.Marshal()))
+}
+
 func TestPublish(t *testing.T) {
 	for _, test := range []struct {
 		desc     string
 		manifest []byte
 		image    []byte
+		promise  []byte
 		wantErr  bool
 	}{
 		{
 			desc:     "valid",
 			manifest: []byte("Boo!"),
+			promise:  mustSignPromise(t, []byte("Boo!"), time.Now(), time.Minute),
 		}, {
 			desc:     "log server fails",
 			manifest: []byte("Boo!"),
 			wantErr:  true,
+		}, {
+			desc:     "promise for other statement",
+			manifest: []byte("Boo!"),
+			promise:  mustSignPromise(t, []byte("Hiss!"), time.Now(), time.Minute),
+			wantErr:  true,
+		}, {
+			desc:     "unsigned promise",
+			manifest: []byte("Boo!"),
+			promise:  []byte("Firmware Transparency Promise v0\n"),
+			wantErr:  true,
 		},
 	} {
 		t.Run(test.desc, func(t *testing.T) {
@@ -93,6 +132,7 @@ func TestPublish(t *testing.T) {
 				if diff := cmp.Diff(meta, test.manifest); len(diff) != 0 {
 					t.Errorf("POSTed body with unexpected diff: %v", diff)
 				}
+				w.Write(test.promise)
 			}))
 			defer ts.Close()
 
@@ -100,8 +140,8 @@ func TestPublish(t *testing.T) {
 			if err != nil {
 				t.Fatalf("Failed to parse test server URL: %v", err)
 			}
-			c := client.SubmitClient{ReadonlyClient: &client.ReadonlyClient{LogURL: tsURL}}
-			err = c.PublishFirmware(test.manifest, test.image)
+			c := client.SubmitClient{ReadonlyClient: &client.ReadonlyClient{LogURL: tsURL, LogSigVerifier: mustGetLogSigVerifier(t)}}
+			_, err = c.PublishFirmware(test.manifest, test.image)
 			switch {
 			case err != nil && !test.wantErr:
 				t.Fatalf("Got unexpected error %q", err)
@@ -158,6 +198,97 @@ func parseAddFirmwareRequest(r *http.Request) ([]byte, []byte, error) {
 	return rawJSON, image, nil
 }
 
+func TestPublishBatch(t *testing.T) {
+	entries := []client.FirmwareSubmission{
+		{Manifest: []byte("one"), Image: []byte("1")},
+		{Manifest: []byte("two"), Image: []byte("2")},
+	}
+	for _, test := range []struct {
+		desc        string
+		status      int
+		body        string
+		wantResults []api.AddFirmwareResult
+		wantErr     bool
+	}{
+		{
+			desc:        "valid",
+			status:      http.StatusOK,
+			body:        `{"Results":[{"Code":200},{"Code":200}]}`,
+			wantResults: []api.AddFirmwareResult{{Code: 200}, {Code: 200}},
+		}, {
+			desc:        "entry rejected",
+			status:      http.StatusBadRequest,
+			body:        `{"Results":[{"Code":424,"Error":"not logged"},{"Code":409,"Error":"old"}]}`,
+			wantResults: []api.AddFirmwareResult{{Code: 424, Error: "not logged"}, {Code: 409, Error: "old"}},
+			wantErr:     true,
+		}, {
+			desc:    "request rejected",
+			status:  http.StatusBadRequest,
+			body:    "bad request",
+			wantErr: true,
+		}, {
+			desc:    "wrong number of results",
+			status:  http.StatusOK,
+			body:    `{"Results":[{"Code":200}]}`,
+			wantErr: true,
+		}, {
+			desc:    "log server fails",
+			status:  http.StatusInternalServerError,
+			body:    "BOOM",
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if got, want := r.URL.Path[1:], api.HTTPAddFirmwareBatch; got != want {
+					t.Fatalf("Got unexpected HTTP request on %q", r.URL.Path)
+				}
+				_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+				if err != nil {
+					t.Fatalf("Failed to parse content type: %v", err)
+				}
+				mr := multipart.NewReader(r.Body, params["boundary"])
+				var got []client.FirmwareSubmission
+				for {
+					m, err := mr.NextPart()
+					if err == io.EOF {
+						break
+					}
+					if err != nil {
+						t.Fatalf("Failed to read multipart body: %v", err)
+					}
+					manifest, _ := ioutil.ReadAll(m)
+					i, err := mr.NextPart()
+					if err != nil {
+						t.Fatalf("Failed to read image part: %v", err)
+					}
+					image, _ := ioutil.ReadAll(i)
+					got = append(got, client.FirmwareSubmission{Manifest: manifest, Image: image})
+				}
+				if diff := cmp.Diff(entries, got); len(diff) != 0 {
+					t.Errorf("POSTed entries with unexpected diff: %v", diff)
+				}
+				w.WriteHeader(test.status)
+				w.Write([]byte(test.body))
+			}))
+			defer ts.Close()
+
+			tsURL, err := url.Parse((ts.URL))
+			if err != nil {
+				t.Fatalf("Failed to parse test server URL: %v", err)
+			}
+			c := client.SubmitClient{ReadonlyClient: &client.ReadonlyClient{LogURL: tsURL}}
+			results, err := c.PublishFirmwareBatch(entries)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("PublishFirmwareBatch() = %v, want err %t", err, test.wantErr)
+			}
+			if diff := cmp.Diff(test.wantResults, results); len(diff) != 0 {
+				t.Errorf("results diff: %s", diff)
+			}
+		})
+	}
+}
+
 func TestGetCheckpoint(t *testing.T) {
 	for _, test := range []struct {
 		desc    string
@@ -289,6 +420,221 @@ func TestGetInclusion(t *testing.T) {
 	}
 }
 
+func TestWaitForInclusion(t *testing.T) {
+	statement := []byte("Boo!")
+	lh := verify.HashLeaf(statement)
+	start := time.Now()
+	promise, err := api.ParseInclusionPromise(mustSignPromise(t, statement, start, time.Minute), mustGetLogSigVerifier(t))
+	if err != nil {
+		t.Fatalf("ParseInclusionPromise() = %v", err)
+	}
+	// checkpoint returns a signed checkpoint of the given size, issued at the
+	// given time after the promise. A log containing only the statement has
+	// its leaf hash as the root hash.
+	checkpoint := func(size uint64, after time.Duration, hash []byte) string {
+		cp := api.LogCheckpoint{
+			Checkpoint: log.Checkpoint{
+				Ecosystem: api.FTLogCheckpointEcosystemv0,
+				Size:      size,
+				Hash:      hash,
+			},
+			TimestampNanos: uint64(start.Add(after).UnixNano()),
+		}
+		body, err := cp.Marshal()
+		if err != nil {
+			t.Fatalf("Marshal() = %v", err)
+		}
+		return string(mustSignCPNote(t, string(body)))
+	}
+	// A log with another leaf before the statement.
+	otherLH := verify.HashLeaf([]byte("Hoo!"))
+	root2 := hasher.DefaultHasher.HashChildren(otherLH, lh)
+	inclusion2 := mustMarshalJSON(t, api.InclusionProof{LeafIndex: 1, Proof: [][]byte{otherLH}})
+	for _, test := range []struct {
+		desc        string
+		checkpoints []string
+		// absent is the largest tree size which doesn't include the statement.
+		absent      uint64
+		inclusion   string
+		consistency string
+		wantSize    uint64
+		wantErr     bool
+		wantMissed  bool
+	}{
+		{
+			desc:        "included",
+			checkpoints: []string{checkpoint(1, time.Second, lh)},
+			wantSize:    1,
+		}, {
+			desc:        "included late but not seen missing",
+			checkpoints: []string{checkpoint(1, time.Hour, lh)},
+			wantSize:    1,
+		}, {
+			desc:        "missing after deadline",
+			checkpoints: []string{checkpoint(0, 2*time.Minute, []byte{}), checkpoint(1, 3*time.Minute, lh)},
+			wantSize:    1,
+			wantErr:     true,
+			wantMissed:  true,
+		}, {
+			desc:        "invalid proof",
+			checkpoints: []string{checkpoint(1, time.Second, []byte("not the root"))},
+			wantSize:    1,
+			wantErr:     true,
+		}, {
+			desc:        "included after consistent checkpoint",
+			checkpoints: []string{checkpoint(1, time.Second, otherLH), checkpoint(2, 2*time.Second, root2)},
+			absent:      1,
+			inclusion:   inclusion2,
+			consistency: mustMarshalJSON(t, api.ConsistencyProof{Proof: [][]byte{lh}}),
+			wantSize:    2,
+		}, {
+			desc:        "missing after deadline then included consistently",
+			checkpoints: []string{checkpoint(1, 2*time.Minute, otherLH), checkpoint(2, 3*time.Minute, root2)},
+			absent:      1,
+			inclusion:   inclusion2,
+			consistency: mustMarshalJSON(t, api.ConsistencyProof{Proof: [][]byte{lh}}),
+			wantSize:    2,
+			wantErr:     true,
+			wantMissed:  true,
+		}, {
+			desc:        "invalid consistency proof",
+			checkpoints: []string{checkpoint(1, time.Second, otherLH), checkpoint(2, 2*time.Second, root2)},
+			absent:      1,
+			inclusion:   inclusion2,
+			consistency: mustMarshalJSON(t, api.ConsistencyProof{Proof: [][]byte{[]byte("not the leaf")}}),
+			wantSize:    2,
+			wantErr:     true,
+		}, {
+			desc:        "fork at the same size",
+			checkpoints: []string{checkpoint(1, time.Second, otherLH), checkpoint(1, 2*time.Second, []byte("forked root"))},
+			absent:      1,
+			wantSize:    1,
+			wantErr:     true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			cps := test.checkpoints
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.URL.Path[1:] == api.HTTPGetRoot:
+					fmt.Fprint(w, cps[0])
+					if len(cps) > 1 {
+						cps = cps[1:]
+					}
+				case strings.HasPrefix(r.URL.Path[1:], api.HTTPGetInclusion):
+					var size uint64
+					if _, err := fmt.Sscanf(r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:], "%d", &size); err != nil {
+						t.Errorf("Got unexpected inclusion request on %q", r.URL.Path)
+					}
+					if size <= test.absent {
+						http.Error(w, "not found", http.StatusNotFound)
+						return
+					}
+					if len(test.inclusion) > 0 {
+						fmt.Fprint(w, test.inclusion)
+						return
+					}
+					fmt.Fprint(w, `{"LeafIndex": 0, "Proof": []}`)
+				case strings.HasPrefix(r.URL.Path[1:], api.HTTPGetConsistency):
+					fmt.Fprint(w, test.consistency)
+				default:
+					t.Fatalf("Got unexpected HTTP request on %q", r.URL.Path)
+				}
+			}))
+			defer ts.Close()
+
+			tsURL, err := url.Parse((ts.URL))
+			if err != nil {
+				t.Fatalf("Failed to parse test server URL: %v", err)
+			}
+			c := client.ReadonlyClient{LogURL: tsURL, LogSigVerifier: mustGetLogSigVerifier(t)}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			cp, _, err := c.WaitForInclusion(ctx, *promise)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("WaitForInclusion() = %v, want err %t", err, test.wantErr)
+			}
+			if got, want := errors.Is(err, client.ErrMergeDelayMissed), test.wantMissed; got != want {
+				t.Errorf("WaitForInclusion() = %v, want ErrMergeDelayMissed %t", err, want)
+			}
+			if got, want := cp.Size, test.wantSize; got != want {
+				t.Errorf("got checkpoint size %d, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestGetEntries(t *testing.T) {
+	cp := api.LogCheckpoint{
+		Checkpoint: log.Checkpoint{
+			Size: 30,
+		},
+	}
+	for _, test := range []struct {
+		desc    string
+		body    string
+		want    []api.InclusionProof
+		wantErr bool
+	}{
+		{
+			desc: "all requested",
+			body: `{"Entries": [{"Value": "qg==", "LeafIndex": 10, "Proof": ["uw=="]}, {"Value": "zA==", "LeafIndex": 11, "Proof": ["3Q=="]}]}`,
+			want: []api.InclusionProof{
+				{Value: []byte{0xAA}, LeafIndex: 10, Proof: [][]byte{{0xBB}}},
+				{Value: []byte{0xCC}, LeafIndex: 11, Proof: [][]byte{{0xDD}}},
+			},
+		}, {
+			desc: "fewer than requested",
+			body: `{"Entries": [{"Value": "qg==", "LeafIndex": 10, "Proof": ["uw=="]}]}`,
+			want: []api.InclusionProof{
+				{Value: []byte{0xAA}, LeafIndex: 10, Proof: [][]byte{{0xBB}}},
+			},
+		}, {
+			desc:    "none",
+			body:    `{"Entries": []}`,
+			wantErr: true,
+		}, {
+			desc:    "more than requested",
+			body:    `{"Entries": [{"LeafIndex": 10}, {"LeafIndex": 11}, {"LeafIndex": 12}]}`,
+			wantErr: true,
+		}, {
+			desc:    "wrong index",
+			body:    `{"Entries": [{"LeafIndex": 10}, {"LeafIndex": 12}]}`,
+			wantErr: true,
+		}, {
+			desc:    "garbage",
+			body:    `garbage`,
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if got, want := r.URL.Path[1:], api.HTTPGetEntries; got != want {
+					t.Fatalf("Got unexpected HTTP request on %q", r.URL.Path)
+				}
+				if got, want := r.URL.RawQuery, "start=10&end=12&treesize=30"; got != want {
+					t.Errorf("Got query %q, want %q", got, want)
+				}
+				fmt.Fprintln(w, test.body)
+			}))
+			defer ts.Close()
+
+			tsURL, err := url.Parse((ts.URL))
+			if err != nil {
+				t.Fatalf("Failed to parse test server URL: %v", err)
+			}
+			c := client.ReadonlyClient{LogURL: tsURL}
+			got, err := c.GetEntries(10, 12, cp)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("GetEntries() = %v, want err %t", err, test.wantErr)
+			}
+			if d := cmp.Diff(test.want, got); len(d) != 0 {
+				t.Errorf("Got entries with diff: %s", d)
+			}
+		})
+	}
+}
+
 func TestGetManifestAndProof(t *testing.T) {
 	for _, test := range []struct {
 		desc    string
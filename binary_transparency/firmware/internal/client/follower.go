@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -25,6 +26,7 @@ import (
 	"github.com/google/trillian-examples/binary_transparency/firmware/api"
 	"github.com/google/trillian-examples/binary_transparency/firmware/internal/crypto"
 	"github.com/google/trillian-examples/binary_transparency/firmware/internal/verify"
+	"github.com/google/trillian-examples/formats/log"
 	"github.com/google/trillian/merkle/logverifier"
 )
 
@@ -33,12 +35,32 @@ import (
 // if needed.
 type ErrConsistency struct {
 	Golden, Latest api.LogCheckpoint
+	// Proof is the consistency proof which failed to verify.
+	Proof [][]byte
 }
 
 func (e ErrConsistency) Error() string {
 	return fmt.Sprintf("failed to verify consistency proof from %s to %s", e.Golden, e.Latest)
 }
 
+// Evidence returns the inconsistent checkpoints and proof in the portable
+// evidence format, which should be checked with Verify before publishing.
+// This is not possible when the golden checkpoint size is a power of two, as
+// the proof then doesn't commit to the larger tree's view of the smaller one.
+func (e ErrConsistency) Evidence() (*log.Evidence, error) {
+	if len(e.Golden.Envelope) == 0 || len(e.Latest.Envelope) == 0 {
+		return nil, errors.New("checkpoint envelopes are unavailable")
+	}
+	if s := e.Golden.Size; s&(s-1) == 0 {
+		return nil, fmt.Errorf("cannot build evidence from a proof from size %d", s)
+	}
+	return &log.Evidence{
+		Checkpoints:   [2][]byte{e.Golden.Envelope, e.Latest.Envelope},
+		HashAlgorithm: log.HashRFC6962SHA256,
+		Proof:         e.Proof,
+	}, nil
+}
+
 // ErrInclusion is returned if a proof of inclusion does not validate.
 // This allows a motivated client to provide evidence if needed.
 type ErrInclusion struct {
@@ -59,15 +81,19 @@ type LogEntry struct {
 
 // LogFollower follows a log for new data becoming available.
 type LogFollower struct {
-	c  ReadonlyClient
-	lv logverifier.LogVerifier
+	c         ReadonlyClient
+	lv        logverifier.LogVerifier
+	claimants *crypto.Registry
 }
 
 // NewLogFollower creates a LogFollower that uses the given client.
-func NewLogFollower(c ReadonlyClient) LogFollower {
+// The claimants registry is used to verify the signatures on statements output
+// by Entries, and may be nil if only Checkpoints will be used.
+func NewLogFollower(c ReadonlyClient, claimants *crypto.Registry) LogFollower {
 	return LogFollower{
-		c:  c,
-		lv: verify.NewLogVerifier(),
+		c:         c,
+		lv:        verify.NewLogVerifier(),
+		claimants: claimants,
 	}
 }
 
@@ -122,6 +148,7 @@ func (f *LogFollower) Checkpoints(ctx context.Context, pollInterval time.Duratio
 					errc <- ErrConsistency{
 						Golden: golden,
 						Latest: *cp,
+						Proof:  consistency.Proof,
 					}
 					return
 				}
@@ -135,7 +162,8 @@ func (f *LogFollower) Checkpoints(ctx context.Context, pollInterval time.Duratio
 }
 
 // Entries follows the log to output all of the leaves starting from the head index provided.
-// This is intended to be set up to consume the output of #Checkpoints(), and will output new
+// Entries are fetched from the log in batches, and each is verified to be included under the
+// checkpoint before being output. This is intended to be set up to consume the output of #Checkpoints(), and will output new
 // entries each time a Checkpoint becomes available which is larger than the current head.
 // The input channel should be closed in order to clean up the resources used by this method.
 func (f *LogFollower) Entries(ctx context.Context, cpc <-chan api.LogCheckpoint, head uint64) (<-chan LogEntry, <-chan error) {
@@ -144,47 +172,108 @@ func (f *LogFollower) Entries(ctx context.Context, cpc <-chan api.LogCheckpoint,
 
 	go func() {
 		defer close(outc)
+		// Annotations are verified against the vendor and device of the firmware
+		// they refer to, so keep the firmware seen so far to avoid refetching it.
+		firmware := make(map[uint64]api.FirmwareMetadata)
 		for cp := range cpc {
-			for ; head < cp.Size; head++ {
-				proof, err := f.c.GetManifestEntryAndProof(api.GetFirmwareManifestRequest{Index: head, TreeSize: cp.Size})
+			for head < cp.Size {
+				entries, err := f.c.GetEntries(head, cp.Size, cp)
 				if err != nil {
-					glog.Warningf("Failed to fetch the Manifest: %q", err)
-					continue
-				}
-				lh := verify.HashLeaf(proof.Value)
-				if err := f.lv.VerifyInclusionProof(int64(proof.LeafIndex), int64(cp.Size), proof.Proof, cp.Hash, lh); err != nil {
-					errc <- ErrInclusion{
-						Checkpoint: cp,
-						Proof:      *proof,
+					glog.Warningf("Failed to fetch entries from %d: %q", head, err)
+					// Give the log the benefit of the doubt, and retry shortly.
+					select {
+					case <-time.After(time.Second):
+						continue
+					case <-ctx.Done():
+						errc <- ctx.Err()
+						return
 					}
-					return
 				}
-				glog.V(1).Infof("Inclusion proof for leafhash 0x%x verified", lh)
+				for _, proof := range entries {
+					lh := verify.HashLeaf(proof.Value)
+					if err := f.lv.VerifyInclusionProof(int64(proof.LeafIndex), int64(cp.Size), proof.Proof, cp.Hash, lh); err != nil {
+						errc <- ErrInclusion{
+							Checkpoint: cp,
+							Proof:      proof,
+						}
+						return
+					}
+					glog.V(1).Infof("Inclusion proof for leafhash 0x%x verified", lh)
 
-				statement := proof.Value
-				stmt := api.SignedStatement{}
-				if err := json.NewDecoder(bytes.NewReader(statement)).Decode(&stmt); err != nil {
-					errc <- fmt.Errorf("failed to decode SignedStatement: %q", err)
-					return
-				}
+					statement := proof.Value
+					stmt := api.SignedStatement{}
+					if err := json.NewDecoder(bytes.NewReader(statement)).Decode(&stmt); err != nil {
+						errc <- fmt.Errorf("failed to decode SignedStatement: %q", err)
+						return
+					}
 
-				claimant, err := crypto.ClaimantForType(stmt.Type)
-				if err != nil {
-					errc <- err
-					return
-				}
-				// Verify the signature:
-				if err := claimant.VerifySignature(stmt.Type, stmt.Statement, stmt.Signature); err != nil {
-					errc <- fmt.Errorf("failed to verify signature: %q", err)
-					return
-				}
-				outc <- LogEntry{
-					Root:  cp,
-					Index: head,
-					Value: stmt,
+					// Verify the signature:
+					resolve := func(id api.FirmwareID) (api.FirmwareMetadata, error) {
+						if id.LogIndex >= head {
+							return api.FirmwareMetadata{}, fmt.Errorf("annotation at index %d refers to later index %d", head, id.LogIndex)
+						}
+						if m, ok := firmware[id.LogIndex]; ok {
+							return m, nil
+						}
+						m, err := f.firmwareAt(id.LogIndex, cp)
+						if err != nil {
+							return api.FirmwareMetadata{}, err
+						}
+						firmware[id.LogIndex] = m
+						return m, nil
+					}
+					if err := f.claimants.VerifyStatement(stmt, resolve); err != nil {
+						errc <- fmt.Errorf("failed to verify signature: %q", err)
+						return
+					}
+					if stmt.Type == api.FirmwareMetadataType {
+						var m api.FirmwareMetadata
+						if err := json.Unmarshal(stmt.Statement, &m); err != nil {
+							errc <- fmt.Errorf("failed to unmarshal FirmwareMetadata: %q", err)
+							return
+						}
+						firmware[head] = m
+					}
+					outc <- LogEntry{
+						Root:  cp,
+						Index: head,
+						Value: stmt,
+					}
+					head++
 				}
 			}
 		}
 	}()
 	return outc, errc
 }
+
+// firmwareAt fetches the firmware statement at index in the log committed to by
+// cp, checking that it is included and was signed by a trusted claimant.
+func (f *LogFollower) firmwareAt(index uint64, cp api.LogCheckpoint) (api.FirmwareMetadata, error) {
+	var m api.FirmwareMetadata
+	entries, err := f.c.GetEntries(index, index+1, cp)
+	if err != nil {
+		return m, fmt.Errorf("failed to fetch entry %d: %w", index, err)
+	}
+	if len(entries) != 1 {
+		return m, fmt.Errorf("got %d entries at index %d, want 1", len(entries), index)
+	}
+	proof := entries[0]
+	if err := f.lv.VerifyInclusionProof(int64(index), int64(cp.Size), proof.Proof, cp.Hash, verify.HashLeaf(proof.Value)); err != nil {
+		return m, ErrInclusion{Checkpoint: cp, Proof: proof}
+	}
+	var stmt api.SignedStatement
+	if err := json.Unmarshal(proof.Value, &stmt); err != nil {
+		return m, fmt.Errorf("failed to decode SignedStatement: %w", err)
+	}
+	if stmt.Type != api.FirmwareMetadataType {
+		return m, fmt.Errorf("statement at index %d is not firmware", index)
+	}
+	if err := f.claimants.VerifyStatement(stmt, nil); err != nil {
+		return m, fmt.Errorf("failed to verify signature on firmware at index %d: %w", index, err)
+	}
+	if err := json.Unmarshal(stmt.Statement, &m); err != nil {
+		return m, fmt.Errorf("failed to unmarshal FirmwareMetadata: %w", err)
+	}
+	return m, nil
+}
@@ -30,6 +30,8 @@ func codeFromHTTPResponse(r int) codes.Code {
 		return codes.Internal
 	case http.StatusBadRequest:
 		return codes.InvalidArgument
+	case http.StatusNotFound:
+		return codes.NotFound
 	case http.StatusGatewayTimeout:
 		return codes.DeadlineExceeded
 	case http.StatusConflict:
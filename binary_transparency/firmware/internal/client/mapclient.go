@@ -19,6 +19,7 @@ import (
 	"crypto/sha512"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -30,48 +31,46 @@ import (
 	"github.com/google/trillian/merkle/hashers"
 	"github.com/google/trillian/merkle/smt"
 	"github.com/google/trillian/storage/tree"
+	"golang.org/x/mod/sumdb/note"
 	"golang.org/x/sync/errgroup"
 )
 
 type MapClient struct {
-	mapURL *url.URL
+	mapURL         *url.URL
+	mapSigVerifier note.Verifier
 }
 
-func NewMapClient(mapURL string) (*MapClient, error) {
+// NewMapClient returns a client for the map at mapURL, whose checkpoints must
+// be signed by the key for mapSigVerifier.
+func NewMapClient(mapURL string, mapSigVerifier note.Verifier) (*MapClient, error) {
 	u, err := url.Parse(mapURL)
 	if err != nil {
 		return nil, err
 	}
 	return &MapClient{
-		mapURL: u,
+		mapURL:         u,
+		mapSigVerifier: mapSigVerifier,
 	}, nil
 }
 
-// MapCheckpoint returns the Checkpoint for the latest map revision.
+// MapCheckpoint returns the Checkpoint for the latest map revision, having
+// verified the map's signature on it. The log checkpoint inside it is not
+// verified.
 // This map root needs to be taken on trust that it isn't forked etc.
 // To remove this trust, the map roots should be stored in a log, and
 // this would further return:
 // * A Log Checkpoint for the MapCheckpointLog
 // * An inclusion proof for this checkpoint within it
 func (c *MapClient) MapCheckpoint() (api.MapCheckpoint, error) {
-	mcp := api.MapCheckpoint{}
-	u, err := c.mapURL.Parse(api.MapHTTPGetCheckpoint)
+	bs, err := c.fetch(api.MapHTTPGetCheckpoint)
 	if err != nil {
-		return mcp, err
+		return api.MapCheckpoint{}, err
 	}
-	r, err := http.Get(u.String())
+	mcp, err := api.ParseMapCheckpoint(bs, c.mapSigVerifier)
 	if err != nil {
-		return mcp, err
-	}
-	if r.StatusCode != http.StatusOK {
-		return mcp, errFromResponse("failed to fetch checkpoint", r)
+		return api.MapCheckpoint{}, err
 	}
-
-	if err := json.NewDecoder(r.Body).Decode(&mcp); err != nil {
-		return mcp, err
-	}
-	// TODO(mhutchinson): Check signature
-	return mcp, nil
+	return *mcp, nil
 }
 
 // Aggregation returns the value committed to by the map under the given key,
@@ -132,6 +131,66 @@ func (c *MapClient) Aggregation(ctx context.Context, rev uint64, fwIndex uint64)
 	return agg, *ipt.proof, nil
 }
 
+// DeviceReleaseLog returns the release log for the vendor's device at the given
+// map revision, from which the highest logged revision can be found.
+// Unlike Aggregation, no inclusion proof is returned so this must be trusted.
+func (c *MapClient) DeviceReleaseLog(rev uint64, vendorID, deviceID string) (api.DeviceReleaseLog, error) {
+	var l api.DeviceReleaseLog
+	bs, err := c.fetch(fmt.Sprintf("%s/in-revision/%d/for-device/%s", api.MapHTTPGetDeviceReleaseLog, rev, api.QualifiedDeviceID(vendorID, deviceID)))
+	if err != nil {
+		return l, err
+	}
+	if err := json.Unmarshal(bs, &l); err != nil {
+		return l, fmt.Errorf("failed to decode release log: %w", err)
+	}
+	return l, nil
+}
+
+// MapInclusion returns the proofs which show that the map at checkpoint mcp,
+// as returned by MapCheckpoint, commits to the aggregated annotations on the
+// firmware in the proof bundle, so that they can be added to the bundle and
+// checked offline. The consistency proof between the bundle checkpoint and the
+// map's log checkpoint is fetched from the log using lc.
+func (c *MapClient) MapInclusion(ctx context.Context, lc ReadonlyClient, mcp api.MapCheckpoint, pb api.ProofBundle) (*api.MapInclusion, error) {
+	fwIndex := pb.InclusionProof.LeafIndex
+	if mcp.LogSize <= fwIndex {
+		return nil, fmt.Errorf("map built from %d log entries does not include firmware at index %d", mcp.LogSize, fwIndex)
+	}
+	if len(mcp.Envelope) == 0 {
+		return nil, errors.New("map checkpoint has no signed envelope")
+	}
+	lcp, err := api.ParseCheckpoint(mcp.LogCheckpoint, lc.LogSigVerifier)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse map log checkpoint: %w", err)
+	}
+	bcp, err := api.ParseCheckpoint(pb.Checkpoint, lc.LogSigVerifier)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse bundle checkpoint: %w", err)
+	}
+	from, to := bcp.Size, lcp.Size
+	if from > to {
+		from, to = to, from
+	}
+	var consistency [][]byte
+	if from < to {
+		cp, err := lc.GetConsistencyProof(api.GetConsistencyRequest{From: from, To: to})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get consistency proof from %d to %d: %w", from, to, err)
+		}
+		consistency = cp.Proof
+	}
+	preimage, ip, err := c.Aggregation(ctx, mcp.Revision, fwIndex)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get map value for %d: %w", fwIndex, err)
+	}
+	return &api.MapInclusion{
+		Checkpoint:     mcp.Envelope,
+		Aggregation:    preimage,
+		Proof:          ip,
+		LogConsistency: consistency,
+	}, nil
+}
+
 // fetch gets the body from the given path.
 func (c *MapClient) fetch(path string) ([]byte, error) {
 	u, err := c.mapURL.Parse(path)
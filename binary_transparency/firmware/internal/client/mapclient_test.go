@@ -26,9 +26,26 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/trillian-examples/binary_transparency/firmware/api"
 	"github.com/google/trillian-examples/binary_transparency/firmware/internal/client"
+	"github.com/google/trillian-examples/binary_transparency/firmware/internal/crypto"
+	"golang.org/x/mod/sumdb/note"
 )
 
 func TestMapCheckpoint(t *testing.T) {
+	mapSigner, err := note.NewSigner(crypto.TestMapPriv)
+	if err != nil {
+		t.Fatalf("failed to create signer: %q", err)
+	}
+	witnessSigner, err := note.NewSigner(crypto.TestWitnessPriv)
+	if err != nil {
+		t.Fatalf("failed to create signer: %q", err)
+	}
+	sign := func(text string, s note.Signer) string {
+		n, err := note.Sign(&note.Note{Text: text}, s)
+		if err != nil {
+			t.Fatalf("failed to sign note: %q", err)
+		}
+		return string(n)
+	}
 	for _, test := range []struct {
 		desc    string
 		body    string
@@ -37,12 +54,20 @@ func TestMapCheckpoint(t *testing.T) {
 	}{
 		{
 			desc: "valid 1",
-			body: `{ "Revision": 42, "LogSize": 1, "LogCheckpoint": "QyE=", "RootHash": "EjQ="}`,
+			body: sign("Firmware Transparency Map v0\n42\n1\nEjQ=\nQyE=\n", mapSigner),
 			want: api.MapCheckpoint{Revision: 42, LogSize: 1, LogCheckpoint: []byte{0x43, 0x21}, RootHash: []byte{0x12, 0x34}},
 		}, {
 			desc: "valid 2",
-			body: `{ "Revision": 42, "LogSize": 10, "LogCheckpoint": "/u1C", "RootHash": "NBI="}`,
+			body: sign("Firmware Transparency Map v0\n42\n10\nNBI=\n/u1C\n", mapSigner),
 			want: api.MapCheckpoint{Revision: 42, LogSize: 10, LogCheckpoint: []byte{0xfe, 0xed, 0x42}, RootHash: []byte{0x34, 0x12}},
+		}, {
+			desc:    "not signed by map",
+			body:    sign("Firmware Transparency Map v0\n42\n1\nEjQ=\nQyE=\n", witnessSigner),
+			wantErr: true,
+		}, {
+			desc:    "signed garbage",
+			body:    sign("garbage\n", mapSigner),
+			wantErr: true,
 		}, {
 			desc:    "garbage",
 			body:    `garbage`,
@@ -54,11 +79,11 @@ func TestMapCheckpoint(t *testing.T) {
 				if !strings.HasSuffix(r.URL.Path, api.MapHTTPGetCheckpoint) {
 					t.Fatalf("Got unexpected HTTP request on %q", r.URL.Path)
 				}
-				fmt.Fprintln(w, test.body)
+				fmt.Fprint(w, test.body)
 			}))
 			defer ts.Close()
 
-			c, err := client.NewMapClient(ts.URL)
+			c, err := client.NewMapClient(ts.URL, mustGetMapSigVerifier(t))
 			if err != nil {
 				t.Fatalf("Failed to create client: %q", err)
 			}
@@ -71,6 +96,7 @@ func TestMapCheckpoint(t *testing.T) {
 			case err != nil && test.wantErr:
 				// expected error
 			default:
+				test.want.Envelope = []byte(test.body)
 				if d := cmp.Diff(cp, test.want); len(d) != 0 {
 					t.Fatalf("Got checkpoint with diff: %s", d)
 				}
@@ -129,7 +155,7 @@ func TestAggregation(t *testing.T) {
 			}))
 			defer ts.Close()
 
-			c, err := client.NewMapClient(ts.URL)
+			c, err := client.NewMapClient(ts.URL, mustGetMapSigVerifier(t))
 			if err != nil {
 				t.Fatalf("Failed to create client: %q", err)
 			}
@@ -153,3 +179,12 @@ func TestAggregation(t *testing.T) {
 		})
 	}
 }
+
+func mustGetMapSigVerifier(t *testing.T) note.Verifier {
+	t.Helper()
+	v, err := note.NewVerifier(crypto.TestMapPub)
+	if err != nil {
+		t.Fatalf("failed to create verifier: %q", err)
+	}
+	return v
+}
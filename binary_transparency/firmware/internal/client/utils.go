@@ -15,15 +15,23 @@
 package client
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/golang/glog"
 	"github.com/google/trillian-examples/binary_transparency/firmware/api"
 	"github.com/google/trillian-examples/binary_transparency/firmware/internal/verify"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// ErrMergeDelayMissed is returned by WaitForInclusion if the log did not
+// include a statement by the deadline it promised.
+var ErrMergeDelayMissed = errors.New("log missed its promised maximum merge delay")
+
 // AwaitInclusion waits for the specified statement s to be included into the log and then
 // returns the checkpoint under which it was found to be present, along with valid consistency and inclusion proofs.
 func AwaitInclusion(ctx context.Context, c *ReadonlyClient, cp api.LogCheckpoint, s []byte) (api.LogCheckpoint, api.ConsistencyProof, api.InclusionProof, error) {
@@ -79,3 +87,89 @@ func AwaitInclusion(ctx context.Context, c *ReadonlyClient, cp api.LogCheckpoint
 	}
 	// unreachable
 }
+
+// WaitForInclusion waits for the statement promised by p to be included into the log and then
+// returns the checkpoint under which it was found to be present, along with a valid inclusion proof.
+//
+// Each checkpoint is checked to be consistent with the one before it, so the
+// returned checkpoint is consistent with every checkpoint seen while waiting.
+//
+// If a checkpoint was seen which was issued after the promised deadline but
+// did not include the statement, then the log has broken its promise. In this
+// case the checkpoint and proof are still returned once the statement is
+// included, but with an error wrapping ErrMergeDelayMissed.
+func (c ReadonlyClient) WaitForInclusion(ctx context.Context, p api.InclusionPromise) (api.LogCheckpoint, api.InclusionProof, error) {
+	lv := verify.NewLogVerifier()
+	deadline := p.Deadline()
+	// missed is the first checkpoint seen after the deadline which was known
+	// not to include the statement.
+	var missed *api.LogCheckpoint
+	// absentSize is the largest tree size known not to include the statement.
+	var absentSize uint64
+	// prev is the latest checkpoint seen, which later ones must be consistent with.
+	var prev *api.LogCheckpoint
+	for {
+		cp, err := c.GetCheckpoint()
+		if err != nil {
+			return api.LogCheckpoint{}, api.InclusionProof{}, err
+		}
+
+		switch {
+		case prev == nil:
+		case cp.Size < prev.Size:
+			// An older checkpoint tells us nothing new.
+			cp = prev
+		case cp.Size == prev.Size:
+			if !bytes.Equal(cp.Hash, prev.Hash) {
+				return *cp, api.InclusionProof{}, fmt.Errorf("checkpoint %s is inconsistent with earlier checkpoint %s", cp, prev)
+			}
+		case prev.Size > 0:
+			cproof, err := c.GetConsistencyProof(api.GetConsistencyRequest{From: prev.Size, To: cp.Size})
+			if err != nil {
+				glog.Warningf("Received error while fetching consistency proof: %q", err)
+				cp = prev
+				break
+			}
+			if err := lv.VerifyConsistencyProof(int64(prev.Size), int64(cp.Size), prev.Hash, cp.Hash, cproof.Proof); err != nil {
+				// Whoa Nelly, this is bad - bail!
+				glog.Warning("Invalid consistency proof received!")
+				return *cp, api.InclusionProof{}, fmt.Errorf("invalid consistency proof received: %w", err)
+			}
+			glog.V(1).Infof("Consistency proof between %d and %d verified", prev.Size, cp.Size)
+		}
+		prev = cp
+
+		if cp.Size > absentSize {
+			ip, err := c.getInclusionByHash(p.LeafHash, *cp)
+			switch {
+			case status.Code(err) == codes.NotFound:
+				absentSize = cp.Size
+			case err != nil:
+				glog.Warningf("Received error while fetching inclusion proof: %q", err)
+			default:
+				if err := lv.VerifyInclusionProof(int64(ip.LeafIndex), int64(cp.Size), ip.Proof, cp.Hash, p.LeafHash); err != nil {
+					// Whoa Nelly, this is bad - bail!
+					glog.Warning("Invalid inclusion proof received!")
+					return *cp, ip, fmt.Errorf("invalid inclusion proof received: %w", err)
+				}
+				glog.Infof("Inclusion proof for leafhash 0x%x verified", p.LeafHash)
+				if missed != nil {
+					return *cp, ip, fmt.Errorf("checkpoint %s issued after deadline %v did not include leafhash 0x%x: %w", missed, deadline, p.LeafHash, ErrMergeDelayMissed)
+				}
+				return *cp, ip, nil
+			}
+		}
+		if missed == nil && cp.Size <= absentSize && time.Unix(0, int64(cp.TimestampNanos)).After(deadline) {
+			glog.Warningf("Checkpoint %s issued after deadline %v does not include leafhash 0x%x", cp, deadline, p.LeafHash)
+			missed = cp
+		}
+
+		select {
+		case <-time.After(1 * time.Second):
+			//
+		case <-ctx.Done():
+			return api.LogCheckpoint{}, api.InclusionProof{}, ctx.Err()
+		}
+	}
+	// unreachable
+}
@@ -0,0 +1,238 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypto
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/google/trillian-examples/binary_transparency/firmware/api"
+)
+
+// statementTypeNames maps the names used for statement types in registry
+// files to the StatementType.
+var statementTypeNames = map[string]api.StatementType{
+	"firmware":   api.FirmwareMetadataType,
+	"malware":    api.MalwareStatementType,
+	"revocation": api.RevocationStatementType,
+}
+
+// RegistryEntry is the serialised form of a single claimant in a registry file.
+type RegistryEntry struct {
+	// Name identifies the claimant, e.g. the vendor name.
+	Name string
+	// PublicKeyFile is the path to the claimant's PEM encoded RSA public key.
+	// Relative paths are resolved against the directory of the registry file.
+	PublicKeyFile string
+	// StatementTypes lists the statements this claimant may make, which are
+	// any of "firmware", "malware" or "revocation".
+	StatementTypes []string
+	// VendorID is the vendor this claimant acts for, which is typically the
+	// vendor's own publishing key. If this is set then the claimant may only
+	// make statements about firmware with this VendorID, otherwise the claimant
+	// may make statements about firmware from any vendor.
+	VendorID string
+	// DeviceIDs lists the devices this claimant may make statements about.
+	// If this is empty then the claimant may make statements about any device.
+	DeviceIDs []string
+}
+
+// RegistryFile is the serialised form of a Registry.
+type RegistryFile struct {
+	Claimants []RegistryEntry
+}
+
+// Registry holds the public keys of the claimants trusted to make each type
+// of statement, optionally restricted to statements about particular devices.
+type Registry struct {
+	claimants []registeredClaimant
+}
+
+type registeredClaimant struct {
+	name     string
+	c        *Claimant
+	types    map[api.StatementType]bool
+	vendorID string
+	devices  map[string]bool
+}
+
+// DemoRegistry returns a Registry containing the TEST/DEMO claimant keys,
+// which trusts the vendor to publish and revoke firmware for any device, and
+// the malware annotator to make malware statements.
+func DemoRegistry() *Registry {
+	vendor, err := NewClaimant([]byte(TestVendorRSAPub))
+	if err != nil {
+		panic(fmt.Errorf("invalid demo vendor key: %v", err))
+	}
+	annotator, err := NewClaimant([]byte(TestAnnotationPub))
+	if err != nil {
+		panic(fmt.Errorf("invalid demo annotator key: %v", err))
+	}
+	r := &Registry{}
+	r.Add("vendor", vendor, []api.StatementType{api.FirmwareMetadataType, api.RevocationStatementType}, "", nil)
+	r.Add("annotator_malware", annotator, []api.StatementType{api.MalwareStatementType}, "", nil)
+	return r
+}
+
+// LoadRegistry reads a JSON encoded RegistryFile from path, loading the public
+// keys it refers to. If path is empty, then the DemoRegistry is returned.
+func LoadRegistry(path string) (*Registry, error) {
+	if len(path) == 0 {
+		return DemoRegistry(), nil
+	}
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read claimant registry: %w", err)
+	}
+	var rf RegistryFile
+	if err := json.Unmarshal(bs, &rf); err != nil {
+		return nil, fmt.Errorf("failed to parse claimant registry %q: %w", path, err)
+	}
+
+	r := &Registry{}
+	for _, e := range rf.Claimants {
+		if len(e.StatementTypes) == 0 {
+			return nil, fmt.Errorf("claimant %q has no statement types", e.Name)
+		}
+		types := make([]api.StatementType, 0, len(e.StatementTypes))
+		for _, n := range e.StatementTypes {
+			t, ok := statementTypeNames[n]
+			if !ok {
+				return nil, fmt.Errorf("claimant %q has unknown statement type %q", e.Name, n)
+			}
+			types = append(types, t)
+		}
+		keyPath := e.PublicKeyFile
+		if !filepath.IsAbs(keyPath) {
+			keyPath = filepath.Join(filepath.Dir(path), keyPath)
+		}
+		pubPEM, err := ioutil.ReadFile(keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read public key for claimant %q: %w", e.Name, err)
+		}
+		c, err := NewClaimant(pubPEM)
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key for claimant %q: %w", e.Name, err)
+		}
+		r.Add(e.Name, c, types, e.VendorID, e.DeviceIDs)
+	}
+	return r, nil
+}
+
+// Add registers a claimant as trusted to make statements of the given types
+// about firmware for the given vendor's devices. An empty vendorID matches
+// any vendor, and an empty deviceIDs matches any of the vendor's devices.
+func (r *Registry) Add(name string, c *Claimant, types []api.StatementType, vendorID string, deviceIDs []string) {
+	rc := registeredClaimant{
+		name:     name,
+		c:        c,
+		types:    make(map[api.StatementType]bool),
+		vendorID: vendorID,
+	}
+	for _, t := range types {
+		rc.types[t] = true
+	}
+	if len(deviceIDs) > 0 {
+		rc.devices = make(map[string]bool)
+		for _, d := range deviceIDs {
+			rc.devices[d] = true
+		}
+	}
+	r.claimants = append(r.claimants, rc)
+}
+
+// FirmwareResolver returns the metadata of the logged firmware which id refers
+// to. It is used to find the vendor and device that an annotation is about.
+type FirmwareResolver func(id api.FirmwareID) (api.FirmwareMetadata, error)
+
+// VerifySignature checks that the signature over a statement of the given
+// type was made by a claimant trusted to make such statements about the
+// vendor's device.
+func (r *Registry) VerifySignature(stype api.StatementType, vendorID, deviceID string, stmt, signature []byte) error {
+	found := false
+	for _, rc := range r.claimants {
+		if !rc.types[stype] {
+			continue
+		}
+		if len(rc.vendorID) > 0 && rc.vendorID != vendorID {
+			continue
+		}
+		if rc.devices != nil && !rc.devices[deviceID] {
+			continue
+		}
+		found = true
+		if err := rc.c.VerifySignature(stype, stmt, signature); err == nil {
+			return nil
+		}
+	}
+	if !found {
+		return fmt.Errorf("no claimant for statement type %q about device %q", stype, api.QualifiedDeviceID(vendorID, deviceID))
+	}
+	return errors.New("signature not made by any trusted claimant")
+}
+
+// VerifyStatement checks the signature on a SignedStatement. The vendor and
+// device that firmware metadata statements are about is taken from the
+// statement itself. Annotations are about the firmware they refer to, which is
+// looked up using resolve; this may be nil if only firmware metadata is expected.
+func (r *Registry) VerifyStatement(s api.SignedStatement, resolve FirmwareResolver) error {
+	var m api.FirmwareMetadata
+	switch s.Type {
+	case api.FirmwareMetadataType:
+		if err := json.Unmarshal(s.Statement, &m); err != nil {
+			return fmt.Errorf("failed to unmarshal FirmwareMetadata: %w", err)
+		}
+	case api.MalwareStatementType, api.RevocationStatementType:
+		id, err := annotatedFirmware(s)
+		if err != nil {
+			return err
+		}
+		if resolve == nil {
+			return fmt.Errorf("cannot resolve %s for statement type %q", id, s.Type)
+		}
+		if m, err = resolve(id); err != nil {
+			return fmt.Errorf("failed to resolve %s: %w", id, err)
+		}
+		if !bytes.Equal(m.FirmwareImageSHA512, id.FirmwareImageSHA512) {
+			return fmt.Errorf("firmware at index %d has hash %x, but annotation is about %x", id.LogIndex, m.FirmwareImageSHA512, id.FirmwareImageSHA512)
+		}
+	default:
+		return fmt.Errorf("unknown statement type %q", s.Type)
+	}
+	return r.VerifySignature(s.Type, m.VendorID, m.DeviceID, s.Statement, s.Signature)
+}
+
+// annotatedFirmware returns the FirmwareID that an annotation statement refers to.
+func annotatedFirmware(s api.SignedStatement) (api.FirmwareID, error) {
+	switch s.Type {
+	case api.MalwareStatementType:
+		var ms api.MalwareStatement
+		if err := json.Unmarshal(s.Statement, &ms); err != nil {
+			return api.FirmwareID{}, fmt.Errorf("failed to unmarshal MalwareStatement: %w", err)
+		}
+		return ms.FirmwareID, nil
+	case api.RevocationStatementType:
+		var rs api.RevocationStatement
+		if err := json.Unmarshal(s.Statement, &rs); err != nil {
+			return api.FirmwareID{}, fmt.Errorf("failed to unmarshal RevocationStatement: %w", err)
+		}
+		return rs.FirmwareID, nil
+	}
+	return api.FirmwareID{}, fmt.Errorf("statement type %q is not an annotation", s.Type)
+}
@@ -0,0 +1,290 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypto
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/trillian-examples/binary_transparency/firmware/api"
+)
+
+func TestRegistryVerifySignature(t *testing.T) {
+	vendor := mustLoadSigningClaimant(t, "../../testdata/keys/vendor.pem")
+	annotator := mustLoadSigningClaimant(t, "../../testdata/keys/annotator_malware.pem")
+	fileReg, err := LoadRegistry("../../testdata/keys/claimants.json")
+	if err != nil {
+		t.Fatalf("LoadRegistry() = %v", err)
+	}
+	acmeReg := &Registry{}
+	acmeReg.Add("acme", vendor, []api.StatementType{api.FirmwareMetadataType}, "acme", []string{"toaster"})
+	acmeReg.Add("annotator_malware", annotator, []api.StatementType{api.MalwareStatementType}, "", nil)
+	msg := []byte("statement")
+
+	for _, test := range []struct {
+		desc     string
+		r        *Registry
+		signer   *Claimant
+		stype    api.StatementType
+		vendorID string
+		deviceID string
+		wantErr  bool
+	}{
+		{
+			desc:     "firmware from vendor",
+			r:        fileReg,
+			signer:   vendor,
+			stype:    api.FirmwareMetadataType,
+			deviceID: "dummy",
+		}, {
+			desc:     "revocation from vendor",
+			r:        fileReg,
+			signer:   vendor,
+			stype:    api.RevocationStatementType,
+			deviceID: "armory",
+		}, {
+			desc:     "firmware from vendor for unknown device",
+			r:        fileReg,
+			signer:   vendor,
+			stype:    api.FirmwareMetadataType,
+			deviceID: "toaster",
+			wantErr:  true,
+		}, {
+			desc:   "malware from annotator for any device",
+			r:      fileReg,
+			signer: annotator,
+			stype:  api.MalwareStatementType,
+		}, {
+			desc:     "firmware from annotator",
+			r:        fileReg,
+			signer:   annotator,
+			stype:    api.FirmwareMetadataType,
+			deviceID: "dummy",
+			wantErr:  true,
+		}, {
+			desc:    "malware from vendor",
+			r:       fileReg,
+			signer:  vendor,
+			stype:   api.MalwareStatementType,
+			wantErr: true,
+		}, {
+			desc:     "demo registry firmware from vendor",
+			r:        DemoRegistry(),
+			signer:   vendor,
+			stype:    api.FirmwareMetadataType,
+			deviceID: "toaster",
+		}, {
+			desc:   "demo registry malware from annotator",
+			r:      DemoRegistry(),
+			signer: annotator,
+			stype:  api.MalwareStatementType,
+		}, {
+			desc:     "firmware from vendor for own device",
+			r:        acmeReg,
+			signer:   vendor,
+			stype:    api.FirmwareMetadataType,
+			vendorID: "acme",
+			deviceID: "toaster",
+		}, {
+			desc:     "firmware from vendor for other vendor's device",
+			r:        acmeReg,
+			signer:   vendor,
+			stype:    api.FirmwareMetadataType,
+			vendorID: "other",
+			deviceID: "toaster",
+			wantErr:  true,
+		}, {
+			desc:     "firmware from vendor with no vendor",
+			r:        acmeReg,
+			signer:   vendor,
+			stype:    api.FirmwareMetadataType,
+			deviceID: "toaster",
+			wantErr:  true,
+		}, {
+			desc:     "malware from unscoped annotator for vendor's device",
+			r:        acmeReg,
+			signer:   annotator,
+			stype:    api.MalwareStatementType,
+			vendorID: "acme",
+			deviceID: "toaster",
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			sig, err := test.signer.SignMessage(test.stype, msg)
+			if err != nil {
+				t.Fatalf("SignMessage() = %v", err)
+			}
+			if err := test.r.VerifySignature(test.stype, test.vendorID, test.deviceID, msg, sig); (err != nil) != test.wantErr {
+				t.Errorf("VerifySignature() = %v, want err %t", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestRegistryVerifyStatement(t *testing.T) {
+	vendor := mustLoadSigningClaimant(t, "../../testdata/keys/vendor.pem")
+	annotator := mustLoadSigningClaimant(t, "../../testdata/keys/annotator_malware.pem")
+	r := &Registry{}
+	r.Add("acme", vendor, []api.StatementType{api.FirmwareMetadataType, api.RevocationStatementType}, "acme", []string{"dummy", "armory"})
+	r.Add("annotator_toaster", annotator, []api.StatementType{api.MalwareStatementType}, "", []string{"toaster"})
+
+	fwHash := []byte("fwhash")
+	logged := map[uint64]api.FirmwareMetadata{
+		1: {VendorID: "acme", DeviceID: "dummy", FirmwareImageSHA512: fwHash},
+		2: {VendorID: "acme", DeviceID: "toaster", FirmwareImageSHA512: fwHash},
+		3: {VendorID: "other", DeviceID: "dummy", FirmwareImageSHA512: fwHash},
+	}
+	resolve := func(id api.FirmwareID) (api.FirmwareMetadata, error) {
+		m, ok := logged[id.LogIndex]
+		if !ok {
+			return m, errors.New("not found")
+		}
+		return m, nil
+	}
+
+	for _, test := range []struct {
+		desc    string
+		signer  *Claimant
+		stype   api.StatementType
+		stmt    interface{}
+		resolve FirmwareResolver
+		wantErr bool
+	}{
+		{
+			desc:   "firmware for dummy",
+			signer: vendor,
+			stype:  api.FirmwareMetadataType,
+			stmt:   api.FirmwareMetadata{VendorID: "acme", DeviceID: "dummy"},
+		}, {
+			desc:   "firmware for armory",
+			signer: vendor,
+			stype:  api.FirmwareMetadataType,
+			stmt:   api.FirmwareMetadata{VendorID: "acme", DeviceID: "armory"},
+		}, {
+			desc:    "firmware for unknown device",
+			signer:  vendor,
+			stype:   api.FirmwareMetadataType,
+			stmt:    api.FirmwareMetadata{VendorID: "acme", DeviceID: "toaster"},
+			wantErr: true,
+		}, {
+			desc:    "revocation from vendor scoped claimant",
+			signer:  vendor,
+			stype:   api.RevocationStatementType,
+			stmt:    api.RevocationStatement{FirmwareID: api.FirmwareID{LogIndex: 1, FirmwareImageSHA512: fwHash}},
+			resolve: resolve,
+		}, {
+			desc:    "revocation of other vendor's firmware",
+			signer:  vendor,
+			stype:   api.RevocationStatementType,
+			stmt:    api.RevocationStatement{FirmwareID: api.FirmwareID{LogIndex: 3, FirmwareImageSHA512: fwHash}},
+			resolve: resolve,
+			wantErr: true,
+		}, {
+			desc:    "revocation without resolver",
+			signer:  vendor,
+			stype:   api.RevocationStatementType,
+			stmt:    api.RevocationStatement{FirmwareID: api.FirmwareID{LogIndex: 1, FirmwareImageSHA512: fwHash}},
+			wantErr: true,
+		}, {
+			desc:    "revocation of unknown firmware",
+			signer:  vendor,
+			stype:   api.RevocationStatementType,
+			stmt:    api.RevocationStatement{FirmwareID: api.FirmwareID{LogIndex: 9, FirmwareImageSHA512: fwHash}},
+			resolve: resolve,
+			wantErr: true,
+		}, {
+			desc:    "revocation with wrong firmware hash",
+			signer:  vendor,
+			stype:   api.RevocationStatementType,
+			stmt:    api.RevocationStatement{FirmwareID: api.FirmwareID{LogIndex: 1, FirmwareImageSHA512: []byte("other")}},
+			resolve: resolve,
+			wantErr: true,
+		}, {
+			desc:    "malware from device scoped claimant",
+			signer:  annotator,
+			stype:   api.MalwareStatementType,
+			stmt:    api.MalwareStatement{FirmwareID: api.FirmwareID{LogIndex: 2, FirmwareImageSHA512: fwHash}},
+			resolve: resolve,
+		}, {
+			desc:    "malware about other device",
+			signer:  annotator,
+			stype:   api.MalwareStatementType,
+			stmt:    api.MalwareStatement{FirmwareID: api.FirmwareID{LogIndex: 1, FirmwareImageSHA512: fwHash}},
+			resolve: resolve,
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			js, err := json.Marshal(test.stmt)
+			if err != nil {
+				t.Fatalf("Marshal() = %v", err)
+			}
+			sig, err := test.signer.SignMessage(test.stype, js)
+			if err != nil {
+				t.Fatalf("SignMessage() = %v", err)
+			}
+			s := api.SignedStatement{Type: test.stype, Statement: js, Signature: sig}
+			if err := r.VerifyStatement(s, test.resolve); (err != nil) != test.wantErr {
+				t.Errorf("VerifyStatement() = %v, want err %t", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadRegistryErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registry")
+	if err != nil {
+		t.Fatalf("TempDir() = %v", err)
+	}
+	defer os.RemoveAll(dir)
+	pub, err := filepath.Abs("../../testdata/keys/vendor.pub.pem")
+	if err != nil {
+		t.Fatalf("Abs() = %v", err)
+	}
+
+	for _, test := range []struct {
+		desc string
+		rf   RegistryFile
+	}{
+		{
+			desc: "no statement types",
+			rf:   RegistryFile{Claimants: []RegistryEntry{{Name: "v", PublicKeyFile: pub}}},
+		}, {
+			desc: "unknown statement type",
+			rf:   RegistryFile{Claimants: []RegistryEntry{{Name: "v", PublicKeyFile: pub, StatementTypes: []string{"toast"}}}},
+		}, {
+			desc: "missing key file",
+			rf:   RegistryFile{Claimants: []RegistryEntry{{Name: "v", PublicKeyFile: "missing.pem", StatementTypes: []string{"firmware"}}}},
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			js, err := json.Marshal(test.rf)
+			if err != nil {
+				t.Fatalf("Marshal() = %v", err)
+			}
+			path := filepath.Join(dir, "claimants.json")
+			if err := ioutil.WriteFile(path, js, 0644); err != nil {
+				t.Fatalf("WriteFile() = %v", err)
+			}
+			if _, err := LoadRegistry(path); err == nil {
+				t.Error("LoadRegistry() = nil, want error")
+			}
+		})
+	}
+}
@@ -15,85 +15,91 @@
 package crypto
 
 import (
+	"bytes"
 	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha512"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"io/ioutil"
-	"strings"
 
 	"github.com/google/trillian-examples/binary_transparency/firmware/api"
 )
 
-var (
-	// Publisher makes statements containing the firmware metadata.
-	Publisher = Claimant{
-		priv: TestVendorRSAPriv,
-		pub:  TestVendorRSAPub,
-	}
+// Claimant is someone that makes statements, and can sign and verify them.
+// Claimants created from only a public key can verify statements, but not sign them.
+type Claimant struct {
+	priv *rsa.PrivateKey
+	pub  *rsa.PublicKey
+}
 
-	// AnnotatorMalware makes annotation statements about malware in firmware.
-	AnnotatorMalware = Claimant{
-		priv: TestAnnotationPriv,
-		pub:  TestAnnotationPub,
+// NewClaimant returns a Claimant which verifies statements using the given
+// PEM encoded RSA public key.
+func NewClaimant(pubPEM []byte) (*Claimant, error) {
+	pub, err := parsePublicKey(pubPEM)
+	if err != nil {
+		return nil, err
 	}
-)
+	return &Claimant{pub: pub}, nil
+}
 
-// Claimant is someone that makes statements, and can sign and verify them.
-type Claimant struct {
-	// Note that outside of a demo the private key should never be used like this!
-	priv, pub string
+// NewSigningClaimant returns a Claimant which signs statements using the given
+// PEM encoded RSA private key.
+func NewSigningClaimant(privPEM []byte) (*Claimant, error) {
+	priv, err := parsePrivateKey(privPEM)
+	if err != nil {
+		return nil, err
+	}
+	return &Claimant{priv: priv, pub: &priv.PublicKey}, nil
 }
 
-func (c *Claimant) getPrivateKey() (*rsa.PrivateKey, error) {
-	mKey := strings.NewReader(c.priv)
-	priv, err := ioutil.ReadAll(mKey)
+// LoadSigningClaimant reads a PEM encoded RSA private key from the given file,
+// and returns a Claimant which signs statements using it.
+func LoadSigningClaimant(path string) (*Claimant, error) {
+	privPEM, err := ioutil.ReadFile(path)
 	if err != nil {
-		return nil, fmt.Errorf("read failed! %s", err)
+		return nil, fmt.Errorf("failed to read private key: %w", err)
 	}
+	return NewSigningClaimant(privPEM)
+}
 
+func parsePrivateKey(priv []byte) (*rsa.PrivateKey, error) {
 	privPem, rest := pem.Decode(priv)
-	if len(rest) != 0 {
-		return nil, fmt.Errorf("extraneous data: %v", rest)
-	}
 	if privPem == nil {
 		return nil, fmt.Errorf("pem decoded to nil")
 	}
+	if len(bytes.TrimSpace(rest)) != 0 {
+		return nil, fmt.Errorf("extraneous data: %v", rest)
+	}
 	if privPem.Type != "RSA PRIVATE KEY" {
 		return nil, fmt.Errorf("RSA private key is of the wrong type %s", privPem.Type)
 	}
 
-	var privateKey *rsa.PrivateKey
-	if privateKey, err = x509.ParsePKCS1PrivateKey(privPem.Bytes); err != nil {
+	privateKey, err := x509.ParsePKCS1PrivateKey(privPem.Bytes)
+	if err != nil {
 		return nil, fmt.Errorf("unable to parse RSA private key %v", err)
 	}
 
 	return privateKey, nil
 }
 
-func (c *Claimant) getPublicKey() (*rsa.PublicKey, error) {
-	mKey := strings.NewReader(c.pub)
-	pub, err := ioutil.ReadAll(mKey)
-	if err != nil {
-		return nil, fmt.Errorf("public key read failed! %s", err)
-	}
-
+func parsePublicKey(pub []byte) (*rsa.PublicKey, error) {
 	pubPem, rest := pem.Decode(pub)
-	if len(rest) != 0 {
-		return nil, fmt.Errorf("extraneous data: %v", rest)
-	}
 	if pubPem == nil {
 		return nil, fmt.Errorf("pem decoded to nil")
 	}
+	if len(bytes.TrimSpace(rest)) != 0 {
+		return nil, fmt.Errorf("extraneous data: %v", rest)
+	}
 	if pubPem.Type != "RSA PUBLIC KEY" {
 		return nil, fmt.Errorf("RSA public key is of the wrong type %s", pubPem.Type)
 	}
 
-	var pubKey *rsa.PublicKey
-	if pubKey, err = x509.ParsePKCS1PublicKey(pubPem.Bytes); err != nil {
+	pubKey, err := x509.ParsePKCS1PublicKey(pubPem.Bytes)
+	if err != nil {
 		return nil, fmt.Errorf("unable to parse RSA public key %v", err)
 	}
 
@@ -110,13 +116,11 @@ func (c *Claimant) SignMessage(stype api.StatementType, msg []byte) ([]byte, err
 	// The hash is what we actually sign
 	h := sha512.Sum512(bs)
 
-	// Get the required key for signing
-	key, err := c.getPrivateKey()
-	if err != nil {
-		return nil, fmt.Errorf("private key fetch failed %v", err)
+	if c.priv == nil {
+		return nil, errors.New("claimant has no private key")
 	}
 	// use PSS over PKCS#1 v1.5 for enhanced security
-	signature, err := rsa.SignPSS(rand.Reader, key, crypto.SHA512, h[:], nil)
+	signature, err := rsa.SignPSS(rand.Reader, c.priv, crypto.SHA512, h[:], nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to sign statement %v", err)
 	}
@@ -125,11 +129,6 @@ func (c *Claimant) SignMessage(stype api.StatementType, msg []byte) ([]byte, err
 
 // VerifySignature is used to verify the incoming message
 func (c *Claimant) VerifySignature(stype api.StatementType, stmt []byte, signature []byte) error {
-	// Get the required key for signing
-	key, err := c.getPublicKey()
-	if err != nil {
-		return fmt.Errorf("public key fetch failed %v", err)
-	}
 	bs := make([]byte, len(stmt)+1)
 	bs[0] = byte(stype)
 	copy(bs[1:], stmt)
@@ -138,22 +137,10 @@ func (c *Claimant) VerifySignature(stype api.StatementType, stmt []byte, signatu
 	// The hash is what we actually verify
 	h := sha512.Sum512(bs)
 
-	if err = rsa.VerifyPSS(key, crypto.SHA512, h[:], signature, nil); err != nil {
+	if err := rsa.VerifyPSS(c.pub, crypto.SHA512, h[:], signature, nil); err != nil {
 		return fmt.Errorf("failed to verify signature %v", err)
 	}
 	// If we don't get any error from the `VerifyPSS` method, implies our
 	// signature is valid
 	return nil
 }
-
-// ClaimantForType returns the relevant Claimant for the given Statement type.
-func ClaimantForType(t api.StatementType) (*Claimant, error) {
-	switch t {
-	case api.FirmwareMetadataType:
-		return &Publisher, nil
-	case api.MalwareStatementType:
-		return &AnnotatorMalware, nil
-	default:
-		return nil, fmt.Errorf("Unknown Claimant type %v", t)
-	}
-}
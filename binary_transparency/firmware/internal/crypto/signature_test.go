@@ -19,36 +19,47 @@ import (
 	"github.com/google/trillian-examples/binary_transparency/firmware/api"
 )
 
+func mustLoadSigningClaimant(t *testing.T, path string) *Claimant {
+	t.Helper()
+	c, err := LoadSigningClaimant(path)
+	if err != nil {
+		t.Fatalf("LoadSigningClaimant(%q) = %v", path, err)
+	}
+	return c
+}
+
 func TestSignatureRoundTrip(t *testing.T) {
+	vendor := mustLoadSigningClaimant(t, "../../testdata/keys/vendor.pem")
+	annotator := mustLoadSigningClaimant(t, "../../testdata/keys/annotator_malware.pem")
 	for _, test := range []struct {
 		desc      string
 		signbody  string
 		verifbody string
-		claimant  Claimant
+		claimant  *Claimant
 		wantErr   bool
 	}{
 		{
 			desc:      "Successful Signature Verification",
 			signbody:  "My Test Message",
 			verifbody: "My Test Message",
-			claimant:  Publisher,
+			claimant:  vendor,
 		}, {
 			desc:      "Unsuccessful Signature Verification",
 			signbody:  "My Test Message",
 			verifbody: "My Test1 Message",
-			claimant:  Publisher,
+			claimant:  vendor,
 			wantErr:   true,
 		},
 		{
 			desc:      "Successful Signature Verification malware",
 			signbody:  "My Test Message",
 			verifbody: "My Test Message",
-			claimant:  AnnotatorMalware,
+			claimant:  annotator,
 		}, {
 			desc:      "Unsuccessful Signature Verification malware",
 			signbody:  "My Test Message",
 			verifbody: "My Test1 Message",
-			claimant:  AnnotatorMalware,
+			claimant:  annotator,
 			wantErr:   true,
 		},
 	} {
@@ -75,3 +86,13 @@ func TestSignatureRoundTrip(t *testing.T) {
 		})
 	}
 }
+
+func TestSignWithoutPrivateKey(t *testing.T) {
+	c, err := NewClaimant([]byte(TestVendorRSAPub))
+	if err != nil {
+		t.Fatalf("NewClaimant() = %v", err)
+	}
+	if _, err := c.SignMessage(api.FirmwareMetadataType, []byte("msg")); err == nil {
+		t.Error("SignMessage() with no private key = nil, want error")
+	}
+}
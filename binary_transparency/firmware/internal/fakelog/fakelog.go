@@ -0,0 +1,239 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fakelog provides an in-memory log which can stand in for Trillian
+// in tests. Unlike a mock, it keeps a real Merkle tree and serves real proofs,
+// so the FT tools can be run against it end to end without Trillian or MySQL.
+package fakelog
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/apache/beam/sdks/go/pkg/beam"
+	"github.com/google/trillian-examples/binary_transparency/firmware/internal/ftmap"
+	"github.com/google/trillian/merkle/hashers"
+	"github.com/google/trillian/merkle/rfc6962/hasher"
+	tt "github.com/google/trillian/types"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Log is an in-memory, RFC 6962, verifiable log.
+//
+// Like Trillian, added entries are queued and only become part of the tree,
+// and visible in Root, once they have been integrated by calling UpdateRoot.
+// Log is safe for concurrent use.
+type Log struct {
+	h hashers.LogHasher
+
+	mu sync.Mutex
+	// leaves and hashes hold the data and leaf hashes of integrated entries.
+	leaves [][]byte
+	hashes [][]byte
+	// queued holds entries which are waiting to be integrated.
+	queued [][]byte
+	// index maps from leaf hash to index, for integrated entries.
+	index map[string]uint64
+	// seen holds the leaf hashes of all entries, integrated or queued.
+	seen map[string]bool
+	root tt.LogRootV1
+}
+
+// New returns a new, empty, Log.
+func New() *Log {
+	h := hasher.DefaultHasher
+	return &Log{
+		h:     h,
+		index: make(map[string]uint64),
+		seen:  make(map[string]bool),
+		root: tt.LogRootV1{
+			RootHash:       h.EmptyRoot(),
+			TimestampNanos: uint64(time.Now().UnixNano()),
+		},
+	}
+}
+
+// AddSignedStatement adds the statement to the log if it isn't already present.
+func (l *Log) AddSignedStatement(ctx context.Context, data []byte) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	lh := string(l.h.HashLeaf(data))
+	if l.seen[lh] {
+		return nil
+	}
+	l.seen[lh] = true
+	l.queued = append(l.queued, data)
+	return nil
+}
+
+// Root returns the root of the log as of the last call to UpdateRoot.
+func (l *Log) Root() *tt.LogRootV1 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Copy the root in order to prevent clients from modifying it.
+	ret := l.root
+	return &ret
+}
+
+// UpdateRoot integrates any queued entries into the tree, and updates the
+// root if the tree has grown.
+func (l *Log) UpdateRoot(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.queued) == 0 {
+		return nil
+	}
+	for _, data := range l.queued {
+		lh := l.h.HashLeaf(data)
+		l.index[string(lh)] = uint64(len(l.leaves))
+		l.leaves = append(l.leaves, data)
+		l.hashes = append(l.hashes, lh)
+	}
+	l.queued = nil
+	l.root = tt.LogRootV1{
+		TreeSize:       uint64(len(l.leaves)),
+		RootHash:       l.mth(l.hashes),
+		TimestampNanos: uint64(time.Now().UnixNano()),
+		Revision:       l.root.Revision + 1,
+	}
+	return nil
+}
+
+// ConsistencyProof gets the consistency proof between two given tree sizes.
+func (l *Log) ConsistencyProof(ctx context.Context, from, to uint64) ([][]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if from > to || to > uint64(len(l.hashes)) {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid consistency proof request from %d to %d with tree size %d", from, to, len(l.hashes))
+	}
+	if from == 0 || from == to {
+		return [][]byte{}, nil
+	}
+	return l.subproof(from, l.hashes[:to], true), nil
+}
+
+// FirmwareManifestAtIndex gets the value at the given index and an inclusion proof
+// to the given tree size.
+func (l *Log) FirmwareManifestAtIndex(ctx context.Context, index, treeSize uint64) ([]byte, [][]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if index >= treeSize || treeSize > uint64(len(l.hashes)) {
+		return nil, nil, status.Errorf(codes.InvalidArgument, "invalid index %d for tree size %d with log size %d", index, treeSize, len(l.hashes))
+	}
+	return l.leaves[index], l.path(index, l.hashes[:treeSize]), nil
+}
+
+// InclusionProofByHash gets an inclusion proof in the specified tree size for the
+// leaf with the specified hash.
+func (l *Log) InclusionProofByHash(ctx context.Context, hash []byte, treeSize uint64) (uint64, [][]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if treeSize > uint64(len(l.hashes)) {
+		return 0, nil, status.Errorf(codes.InvalidArgument, "tree size %d > log size %d", treeSize, len(l.hashes))
+	}
+	index, ok := l.index[string(hash)]
+	if !ok || index >= treeSize {
+		return 0, nil, status.Errorf(codes.NotFound, "no leaves found for hash 0x%x in tree size %d", hash, treeSize)
+	}
+	return index, l.path(index, l.hashes[:treeSize]), nil
+}
+
+// LeavesByRange gets the values of up to count leaves, starting at the given index.
+func (l *Log) LeavesByRange(ctx context.Context, start, count uint64) ([][]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	size := uint64(len(l.leaves))
+	if start >= size {
+		return nil, status.Errorf(codes.InvalidArgument, "start %d >= log size %d", start, size)
+	}
+	if start+count > size {
+		count = size - start
+	}
+	return append([][]byte(nil), l.leaves[start:start+count]...), nil
+}
+
+// Entries returns a PCollection of ftmap.InputLogLeaf, containing entries in
+// range [start, end). This allows the log to be used, with ftmap.NewInputLog,
+// as the input for building the FT map.
+func (l *Log) Entries(s beam.Scope, start, end int64) beam.PCollection {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entries := make([]ftmap.InputLogLeaf, 0, end-start)
+	for i := start; i < end; i++ {
+		entries = append(entries, ftmap.InputLogLeaf{Seq: i, Data: l.leaves[i]})
+	}
+	return beam.CreateList(s, entries)
+}
+
+// mth returns the Merkle Tree Hash of the leaf hashes, as defined in
+// RFC 6962 section 2.1.
+func (l *Log) mth(hs [][]byte) []byte {
+	switch len(hs) {
+	case 0:
+		return l.h.EmptyRoot()
+	case 1:
+		return hs[0]
+	}
+	k := split(uint64(len(hs)))
+	return l.h.HashChildren(l.mth(hs[:k]), l.mth(hs[k:]))
+}
+
+// path returns the audit path for the leaf at index m, as defined in
+// RFC 6962 section 2.1.1.
+func (l *Log) path(m uint64, hs [][]byte) [][]byte {
+	if len(hs) <= 1 {
+		return [][]byte{}
+	}
+	k := split(uint64(len(hs)))
+	if m < k {
+		return append(l.path(m, hs[:k]), l.mth(hs[k:]))
+	}
+	return append(l.path(m-k, hs[k:]), l.mth(hs[:k]))
+}
+
+// subproof returns the consistency proof between the first m leaf hashes and
+// all of them, as defined in RFC 6962 section 2.1.2.
+func (l *Log) subproof(m uint64, hs [][]byte, b bool) [][]byte {
+	n := uint64(len(hs))
+	if m == n {
+		if b {
+			return [][]byte{}
+		}
+		return [][]byte{l.mth(hs)}
+	}
+	k := split(n)
+	if m <= k {
+		return append(l.subproof(m, hs[:k], b), l.mth(hs[k:]))
+	}
+	return append(l.subproof(m-k, hs[k:], false), l.mth(hs[:k]))
+}
+
+// split returns the largest power of two which is less than n, for n > 1.
+func split(n uint64) uint64 {
+	k := uint64(1)
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
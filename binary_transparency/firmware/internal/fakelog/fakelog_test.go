@@ -0,0 +1,118 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fakelog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/google/trillian-examples/binary_transparency/firmware/internal/verify"
+	"github.com/google/trillian/merkle/compact"
+	"github.com/google/trillian/merkle/rfc6962/hasher"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLogProofs(t *testing.T) {
+	ctx := context.Background()
+	const maxSize = 20
+	h := hasher.DefaultHasher
+	l := New()
+
+	// Build the expected roots independently using a compact range.
+	rf := compact.RangeFactory{Hash: h.HashChildren}
+	cr := rf.NewEmptyRange(0)
+	roots := [][]byte{h.EmptyRoot()}
+	var leaves [][]byte
+	for i := 0; i < maxSize; i++ {
+		leaf := []byte(fmt.Sprintf("leaf %d", i))
+		leaves = append(leaves, leaf)
+		if err := l.AddSignedStatement(ctx, leaf); err != nil {
+			t.Fatalf("AddSignedStatement() = %v", err)
+		}
+		if err := l.UpdateRoot(ctx); err != nil {
+			t.Fatalf("UpdateRoot() = %v", err)
+		}
+		if err := cr.Append(h.HashLeaf(leaf), nil); err != nil {
+			t.Fatalf("Append() = %v", err)
+		}
+		want, err := cr.GetRootHash(nil)
+		if err != nil {
+			t.Fatalf("GetRootHash() = %v", err)
+		}
+		roots = append(roots, want)
+		if got := l.Root(); got.TreeSize != uint64(i+1) || !bytes.Equal(got.RootHash, want) {
+			t.Fatalf("Root() = %d %x, want %d %x", got.TreeSize, got.RootHash, i+1, want)
+		}
+	}
+
+	lv := verify.NewLogVerifier()
+	for size := uint64(1); size <= maxSize; size++ {
+		for i := uint64(0); i < size; i++ {
+			data, proof, err := l.FirmwareManifestAtIndex(ctx, i, size)
+			if err != nil {
+				t.Fatalf("FirmwareManifestAtIndex(%d, %d) = %v", i, size, err)
+			}
+			if !bytes.Equal(data, leaves[i]) {
+				t.Errorf("FirmwareManifestAtIndex(%d, %d) = %q, want %q", i, size, data, leaves[i])
+			}
+			lh := h.HashLeaf(data)
+			if err := lv.VerifyInclusionProof(int64(i), int64(size), proof, roots[size], lh); err != nil {
+				t.Errorf("inclusion proof for %d in %d failed to verify: %v", i, size, err)
+			}
+			index, _, err := l.InclusionProofByHash(ctx, lh, size)
+			if err != nil || index != i {
+				t.Errorf("InclusionProofByHash(%d, %d) = %d, %v, want %d, nil", i, size, index, err, i)
+			}
+		}
+		for from := uint64(1); from <= size; from++ {
+			proof, err := l.ConsistencyProof(ctx, from, size)
+			if err != nil {
+				t.Fatalf("ConsistencyProof(%d, %d) = %v", from, size, err)
+			}
+			if err := lv.VerifyConsistencyProof(int64(from), int64(size), roots[from], roots[size], proof); err != nil {
+				t.Errorf("consistency proof from %d to %d failed to verify: %v", from, size, err)
+			}
+		}
+	}
+}
+
+func TestLogQueue(t *testing.T) {
+	ctx := context.Background()
+	l := New()
+	for _, leaf := range []string{"a", "b", "a"} {
+		if err := l.AddSignedStatement(ctx, []byte(leaf)); err != nil {
+			t.Fatalf("AddSignedStatement(%q) = %v", leaf, err)
+		}
+	}
+	lh := hasher.DefaultHasher.HashLeaf([]byte("a"))
+	if _, _, err := l.InclusionProofByHash(ctx, lh, 0); status.Code(err) != codes.NotFound {
+		t.Errorf("InclusionProofByHash() before UpdateRoot = %v, want code NotFound", err)
+	}
+	if got := l.Root().TreeSize; got != 0 {
+		t.Errorf("Root().TreeSize before UpdateRoot = %d, want 0", got)
+	}
+	if err := l.UpdateRoot(ctx); err != nil {
+		t.Fatalf("UpdateRoot() = %v", err)
+	}
+	if got := l.Root().TreeSize; got != 2 {
+		t.Errorf("Root().TreeSize = %d, want 2 as duplicates are ignored", got)
+	}
+	if _, _, err := l.FirmwareManifestAtIndex(ctx, 2, 3); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("FirmwareManifestAtIndex() beyond log = %v, want code InvalidArgument", err)
+	}
+}
@@ -15,6 +15,7 @@
 package ftmap
 
 import (
+	"bytes"
 	"crypto/sha512"
 	"encoding/json"
 	"fmt"
@@ -39,16 +40,22 @@ func init() {
 // rules are:
 // * AnnotationMalware: `Good` is true providing there are no malware annotations that claim the
 //                      firmware is bad.
-func Aggregate(s beam.Scope, treeID int64, fws, annotationMalwares beam.PCollection) (beam.PCollection, beam.PCollection) {
+// * Revocation: `Revoked` is true if there are any revocations for the firmware.
+// Annotations are matched to firmware by log index, and are ignored if the image
+// hash they give is not that of the firmware at the index.
+func Aggregate(s beam.Scope, treeID int64, fws, annotationMalwares, revocations beam.PCollection) (beam.PCollection, beam.PCollection) {
 	keyedFws := beam.ParDo(s, func(l *firmwareLogEntry) (uint64, *firmwareLogEntry) { return uint64(l.Index), l }, fws)
 	keyedAnns := beam.ParDo(s, func(a *annotationMalwareLogEntry) (uint64, *annotationMalwareLogEntry) {
 		return a.Annotation.FirmwareID.LogIndex, a
 	}, annotationMalwares)
-	annotations := beam.ParDo(s, aggregationFn, beam.CoGroupByKey(s, keyedFws, keyedAnns))
+	keyedRevs := beam.ParDo(s, func(r *revocationLogEntry) (uint64, *revocationLogEntry) {
+		return r.Revocation.FirmwareID.LogIndex, r
+	}, revocations)
+	annotations := beam.ParDo(s, aggregationFn, beam.CoGroupByKey(s, keyedFws, keyedAnns, keyedRevs))
 	return beam.ParDo(s, &aggregatedFirmwareHashFn{treeID}, annotations), annotations
 }
 
-func aggregationFn(fwIndex uint64, fwit func(**firmwareLogEntry) bool, amit func(**annotationMalwareLogEntry) bool) (*api.AggregatedFirmware, error) {
+func aggregationFn(fwIndex uint64, fwit func(**firmwareLogEntry) bool, amit func(**annotationMalwareLogEntry) bool, rit func(**revocationLogEntry) bool) (*api.AggregatedFirmware, error) {
 	// There will be exactly one firmware entry for the log index.
 	var fwle *firmwareLogEntry
 	if !fwit(&fwle) {
@@ -59,12 +66,26 @@ func aggregationFn(fwIndex uint64, fwit func(**firmwareLogEntry) bool, amit func
 	good := true
 	var amle *annotationMalwareLogEntry
 	for amit(&amle) {
+		if !bytes.Equal(amle.Annotation.FirmwareID.FirmwareImageSHA512, fwle.Firmware.FirmwareImageSHA512) {
+			continue
+		}
 		good = good && amle.Annotation.Good
 	}
 
+	// Any revocation is final; a revoked FW can only be replaced by a new release.
+	revoked := false
+	var rle *revocationLogEntry
+	for rit(&rle) {
+		if !bytes.Equal(rle.Revocation.FirmwareID.FirmwareImageSHA512, fwle.Firmware.FirmwareImageSHA512) {
+			continue
+		}
+		revoked = true
+	}
+
 	return &api.AggregatedFirmware{
-		Index: fwIndex,
-		Good:  good,
+		Index:   fwIndex,
+		Good:    good,
+		Revoked: revoked,
 	}, nil
 }
 
@@ -43,10 +43,29 @@ func TestAggregate(t *testing.T) {
 			},
 		}
 	}
+	createRevocation := func(fwIndex int) *revocationLogEntry {
+		logHead++
+		return &revocationLogEntry{
+			Index: logHead,
+			Revocation: api.RevocationStatement{
+				FirmwareID: api.FirmwareID{
+					LogIndex:            uint64(fwIndex),
+					FirmwareImageSHA512: fwEntries[fwIndex].Firmware.FirmwareImageSHA512,
+				},
+			},
+		}
+	}
+	// Annotations which give the image hash of different firmware.
+	badOtherImage := createAnnotationMalware(0, false)
+	badOtherImage.Annotation.FirmwareID.FirmwareImageSHA512 = fwEntries[1].Firmware.FirmwareImageSHA512
+	revokedOtherImage := createRevocation(1)
+	revokedOtherImage.Revocation.FirmwareID.FirmwareImageSHA512 = fwEntries[0].Firmware.FirmwareImageSHA512
+
 	tests := []struct {
 		name               string
 		treeID             int64
 		annotationMalwares []*annotationMalwareLogEntry
+		revocations        []*revocationLogEntry
 
 		wantGood []string
 	}{
@@ -89,6 +108,43 @@ func TestAggregate(t *testing.T) {
 
 			wantGood: []string{"0: false", "1: true"},
 		},
+		{
+			name:   "One revocation",
+			treeID: 12345,
+
+			revocations: []*revocationLogEntry{
+				createRevocation(1),
+			},
+
+			wantGood: []string{"0: true", "1: true (revoked)"},
+		},
+		{
+			name:   "Revoked and bad",
+			treeID: 12345,
+
+			annotationMalwares: []*annotationMalwareLogEntry{
+				createAnnotationMalware(0, false),
+			},
+			revocations: []*revocationLogEntry{
+				createRevocation(0),
+				createRevocation(0),
+			},
+
+			wantGood: []string{"0: false (revoked)", "1: true"},
+		},
+		{
+			name:   "Annotations for other image",
+			treeID: 12345,
+
+			annotationMalwares: []*annotationMalwareLogEntry{
+				badOtherImage,
+			},
+			revocations: []*revocationLogEntry{
+				revokedOtherImage,
+			},
+
+			wantGood: []string{"0: true", "1: true"},
+		},
 	}
 
 	for _, test := range tests {
@@ -98,13 +154,19 @@ func TestAggregate(t *testing.T) {
 
 			fws := beam.CreateList(s, fwEntries)
 			annotationMalwares := beam.CreateList(s, test.annotationMalwares)
+			revocations := beam.CreateList(s, test.revocations)
 
-			entries, aggs := Aggregate(s, test.treeID, fws, annotationMalwares)
+			entries, aggs := Aggregate(s, test.treeID, fws, annotationMalwares, revocations)
 
 			passert.Count(s, entries, "entries", len(fwEntries))
 			passert.Count(s, aggs, "aggs", len(fwEntries))
 
-			aggregationToString := func(a *api.AggregatedFirmware) string { return fmt.Sprintf("%d: %t", a.Index, a.Good) }
+			aggregationToString := func(a *api.AggregatedFirmware) string {
+				if a.Revoked {
+					return fmt.Sprintf("%d: %t (revoked)", a.Index, a.Good)
+				}
+				return fmt.Sprintf("%d: %t", a.Index, a.Good)
+			}
 			passert.Equals(s, beam.ParDo(s, aggregationToString, aggs), beam.CreateList(s, test.wantGood))
 
 			err := ptest.Run(p)
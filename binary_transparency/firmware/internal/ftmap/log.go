@@ -15,6 +15,7 @@
 package ftmap
 
 import (
+	"context"
 	"crypto"
 	"crypto/sha256"
 	"encoding/binary"
@@ -32,23 +33,39 @@ import (
 )
 
 func init() {
+	beam.RegisterFunction(keyByQualifiedDeviceIDFn)
 	beam.RegisterFunction(makeDeviceReleaseLogFn)
 	beam.RegisterType(reflect.TypeOf((*moduleLogHashFn)(nil)).Elem())
 	beam.RegisterType(reflect.TypeOf((*api.DeviceReleaseLog)(nil)).Elem())
 }
 
 // MakeReleaseLogs takes all firmwareLogEntrys and processes these by
-// DeviceID in order to create logs of release revisions. The versions for
-// each DeviceID are sorted (by ID in the original log), and a log is
-// constructed for each device. This method returns two PCollections:
+// vendor and DeviceID in order to create logs of release revisions. The
+// versions for each device are sorted (by ID in the original log), and a log
+// is constructed for each device. Entries whose IDs don't pass ValidateIDs
+// are skipped, as their QualifiedDeviceID could clash with another device's.
+// This method returns two PCollections:
 // 1. the first is of type Entry; the key/value data to include in the map
 // 2. the second is of type DeviceReleaseLog.
 func MakeReleaseLogs(s beam.Scope, treeID int64, logEntries beam.PCollection) (beam.PCollection, beam.PCollection) {
-	keyed := beam.ParDo(s, func(l *firmwareLogEntry) (string, *firmwareLogEntry) { return l.Firmware.DeviceID, l }, logEntries)
+	keyed := beam.ParDo(s, keyByQualifiedDeviceIDFn, logEntries)
 	logs := beam.ParDo(s, makeDeviceReleaseLogFn, beam.GroupByKey(s, keyed))
 	return beam.ParDo(s, &moduleLogHashFn{TreeID: treeID}, logs), logs
 }
 
+// invalidIDs counts the firmware entries skipped by keyByQualifiedDeviceIDFn.
+var invalidIDs = beam.NewCounter("ftmap", "invalid-device-ids")
+
+// keyByQualifiedDeviceIDFn emits the entry keyed by its QualifiedDeviceID,
+// unless its IDs are invalid.
+func keyByQualifiedDeviceIDFn(ctx context.Context, l *firmwareLogEntry, emit func(string, *firmwareLogEntry)) {
+	if err := l.Firmware.ValidateIDs(); err != nil {
+		invalidIDs.Inc(ctx, 1)
+		return
+	}
+	emit(l.Firmware.QualifiedDeviceID(), l)
+}
+
 type moduleLogHashFn struct {
 	TreeID int64
 
@@ -71,10 +88,12 @@ func (fn *moduleLogHashFn) ProcessElement(log *api.DeviceReleaseLog) (*batchmap.
 	}
 	logRoot, err := logRange.GetRootHash(nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create log for %q: %v", log.DeviceID, err)
+		return nil, fmt.Errorf("failed to create log for %q: %v", log.QualifiedDeviceID(), err)
 	}
+	// The key for devices without a vendor is unchanged from before vendors
+	// were introduced.
 	h := crypto.SHA512_256.New()
-	h.Write([]byte(log.DeviceID))
+	h.Write([]byte(log.QualifiedDeviceID()))
 	logKey := h.Sum(nil)
 
 	leafID := tree.NewNodeID2(string(logKey), uint(len(logKey)*8))
@@ -84,7 +103,7 @@ func (fn *moduleLogHashFn) ProcessElement(log *api.DeviceReleaseLog) (*batchmap.
 	}, nil
 }
 
-func makeDeviceReleaseLogFn(deviceID string, lit func(**firmwareLogEntry) bool) (*api.DeviceReleaseLog, error) {
+func makeDeviceReleaseLogFn(qualifiedID string, lit func(**firmwareLogEntry) bool) (*api.DeviceReleaseLog, error) {
 	// We need to ensure ordering by sequence ID in the original log for stability.
 
 	// First consume the iterator into an in-memory list.
@@ -102,8 +121,10 @@ func makeDeviceReleaseLogFn(deviceID string, lit func(**firmwareLogEntry) bool)
 		revisions[i] = entries[i].Firmware.FirmwareRevision
 	}
 
+	// All entries have the same vendor and device, from which the key was derived.
 	return &api.DeviceReleaseLog{
-		DeviceID:  deviceID,
+		VendorID:  entries[0].Firmware.VendorID,
+		DeviceID:  entries[0].Firmware.DeviceID,
 		Revisions: revisions,
 	}, nil
 }
@@ -23,7 +23,6 @@ import (
 
 	"github.com/google/trillian-examples/binary_transparency/firmware/api"
 	"github.com/google/trillian/experimental/batchmap"
-	"github.com/google/trillian/types"
 )
 
 // NoRevisionsFound is returned when the DB appears valid but has no revisions in it.
@@ -49,9 +48,17 @@ func NewMapDB(location string) (*MapDB, error) {
 
 // Init creates the database tables if needed.
 func (d *MapDB) Init() error {
-	if _, err := d.db.Exec("CREATE TABLE IF NOT EXISTS revisions (revision INTEGER PRIMARY KEY, datetime TIMESTAMP, logroot BLOB, count INTEGER)"); err != nil {
+	if _, err := d.db.Exec("CREATE TABLE IF NOT EXISTS revisions (revision INTEGER PRIMARY KEY, datetime TIMESTAMP, logroot BLOB, count INTEGER, logcheckpoint BLOB)"); err != nil {
 		return err
 	}
+	// Databases created before signed log checkpoints were stored need the
+	// column adding. Their revisions only have a LogRootV1 in logroot, and
+	// are ignored by LatestRevision.
+	if _, err := d.db.Exec("SELECT logcheckpoint FROM revisions LIMIT 0"); err != nil {
+		if _, err := d.db.Exec("ALTER TABLE revisions ADD COLUMN logcheckpoint BLOB"); err != nil {
+			return fmt.Errorf("failed to add logcheckpoint column: %v", err)
+		}
+	}
 	if _, err := d.db.Exec("CREATE TABLE IF NOT EXISTS tiles (revision INTEGER, path BLOB, tile BLOB, PRIMARY KEY (revision, path))"); err != nil {
 		return err
 	}
@@ -59,9 +66,15 @@ func (d *MapDB) Init() error {
 		return err
 	}
 	// We use an INTEGER for a boolean to make life easy across multiple DB implementations.
-	if _, err := d.db.Exec("CREATE TABLE IF NOT EXISTS aggregations (fwLogIndex INTEGER, revision INTEGER, good INTEGER, PRIMARY KEY (fwLogIndex, revision))"); err != nil {
+	if _, err := d.db.Exec("CREATE TABLE IF NOT EXISTS aggregations (fwLogIndex INTEGER, revision INTEGER, good INTEGER, revoked INTEGER NOT NULL DEFAULT 0, PRIMARY KEY (fwLogIndex, revision))"); err != nil {
 		return err
 	}
+	// Databases created before revocations were supported need the column adding.
+	if _, err := d.db.Exec("SELECT revoked FROM aggregations LIMIT 0"); err != nil {
+		if _, err := d.db.Exec("ALTER TABLE aggregations ADD COLUMN revoked INTEGER NOT NULL DEFAULT 0"); err != nil {
+			return fmt.Errorf("failed to add revoked column: %v", err)
+		}
+	}
 	return nil
 }
 
@@ -79,19 +92,17 @@ func (d *MapDB) NextWriteRevision() (int, error) {
 }
 
 // LatestRevision gets the metadata for the last completed write.
-func (d *MapDB) LatestRevision() (rev int, logroot types.LogRootV1, count int64, err error) {
-	var sqlRev sql.NullInt32
-	var lcpRaw []byte
-	if err := d.db.QueryRow("SELECT revision, logroot, count FROM revisions ORDER BY revision DESC LIMIT 1").Scan(&sqlRev, &lcpRaw, &count); err != nil {
-		return 0, types.LogRootV1{}, 0, fmt.Errorf("failed to get latest revision: %v", err)
-	}
-	if sqlRev.Valid {
-		if err := logroot.UnmarshalBinary(lcpRaw); err != nil {
-			return 0, types.LogRootV1{}, 0, fmt.Errorf("failed to get unmarshal log root: %v", err)
-		}
-		return int(sqlRev.Int32), logroot, count, nil
-	}
-	return 0, types.LogRootV1{}, 0, NoRevisionsFound(errors.New("no revisions found"))
+// The log checkpoint is the log's signed checkpoint which the revision was
+// built from. Revisions written without one are skipped.
+func (d *MapDB) LatestRevision() (rev int, logCheckpoint []byte, count int64, err error) {
+	err = d.db.QueryRow("SELECT revision, logcheckpoint, count FROM revisions WHERE logcheckpoint IS NOT NULL ORDER BY revision DESC LIMIT 1").Scan(&rev, &logCheckpoint, &count)
+	switch {
+	case err == sql.ErrNoRows:
+		return 0, nil, 0, NoRevisionsFound(errors.New("no revisions found"))
+	case err != nil:
+		return 0, nil, 0, fmt.Errorf("failed to get latest revision: %v", err)
+	}
+	return rev, logCheckpoint, count, nil
 }
 
 // Tile gets the tile at the given path in the given revision of the map.
@@ -109,13 +120,14 @@ func (d *MapDB) Tile(revision int, path []byte) (*batchmap.Tile, error) {
 
 // Aggregation gets the aggregation for the firmware at the given log index.
 func (d *MapDB) Aggregation(revision int, fwLogIndex uint64) (api.AggregatedFirmware, error) {
-	var good int
-	if err := d.db.QueryRow("SELECT good FROM aggregations WHERE fwLogIndex=? AND revision=?", fwLogIndex, revision).Scan(&good); err != nil {
+	var good, revoked int
+	if err := d.db.QueryRow("SELECT good, revoked FROM aggregations WHERE fwLogIndex=? AND revision=?", fwLogIndex, revision).Scan(&good, &revoked); err != nil {
 		return api.AggregatedFirmware{}, err
 	}
 	return api.AggregatedFirmware{
-		Index: fwLogIndex,
-		Good:  good > 0,
+		Index:   fwLogIndex,
+		Good:    good > 0,
+		Revoked: revoked > 0,
 	}, nil
 }
 
@@ -124,22 +136,24 @@ func (d *MapDB) Aggregation(revision int, fwLogIndex uint64) (api.AggregatedFirm
 // skipped by sensible readers because the provenance information isn't available.
 func (d *MapDB) WriteRevision(rev int, logCheckpoint []byte, count int64) error {
 	now := time.Now()
-	_, err := d.db.Exec("INSERT INTO revisions (revision, datetime, logroot, count) VALUES (?, ?, ?, ?)", rev, now, logCheckpoint, count)
+	_, err := d.db.Exec("INSERT INTO revisions (revision, datetime, logcheckpoint, count) VALUES (?, ?, ?, ?)", rev, now, logCheckpoint, count)
 	if err != nil {
 		return fmt.Errorf("failed to write revision: %w", err)
 	}
 	return nil
 }
 
-// Versions gets the log of versions for the given module in the given map revision.
-func (d *MapDB) Versions(revision int, module string) ([]string, error) {
+// DeviceReleaseLog gets the release log for the given vendor qualified device
+// ID in the given map revision.
+func (d *MapDB) DeviceReleaseLog(revision int, deviceID string) (api.DeviceReleaseLog, error) {
 	var bs []byte
-	if err := d.db.QueryRow("SELECT leaves FROM logs WHERE revision=? AND module=?", revision, module).Scan(&bs); err != nil {
-		return nil, err
+	if err := d.db.QueryRow("SELECT leaves FROM logs WHERE revision=? AND deviceID=?", revision, deviceID).Scan(&bs); err != nil {
+		return api.DeviceReleaseLog{}, err
 	}
-	var versions []string
-	if err := json.Unmarshal(bs, &versions); err != nil {
-		return nil, fmt.Errorf("failed to parse tile at revision=%d, path=%x: %v", revision, module, err)
+	l := api.DeviceReleaseLog{}
+	l.VendorID, l.DeviceID = api.ParseQualifiedDeviceID(deviceID)
+	if err := json.Unmarshal(bs, &l.Revisions); err != nil {
+		return api.DeviceReleaseLog{}, fmt.Errorf("failed to parse release log at revision=%d, device=%q: %v", revision, deviceID, err)
 	}
-	return versions, nil
+	return l, nil
 }
@@ -0,0 +1,61 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ftmap
+
+import (
+	"bytes"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3" // Load drivers for sqlite3
+)
+
+func TestLatestRevisionSkipsLegacyRevisions(t *testing.T) {
+	location := filepath.Join(t.TempDir(), "map.db")
+
+	// Create a database as it was before signed log checkpoints were stored.
+	db, err := sql.Open("sqlite3", location)
+	if err != nil {
+		t.Fatalf("sql.Open() = %v", err)
+	}
+	if _, err := db.Exec("CREATE TABLE revisions (revision INTEGER PRIMARY KEY, datetime TIMESTAMP, logroot BLOB, count INTEGER)"); err != nil {
+		t.Fatalf("failed to create legacy table: %v", err)
+	}
+	if _, err := db.Exec("INSERT INTO revisions (revision, logroot, count) VALUES (0, ?, 10)", []byte("LogRootV1")); err != nil {
+		t.Fatalf("failed to write legacy revision: %v", err)
+	}
+	db.Close()
+
+	mapDB, err := NewMapDB(location)
+	if err != nil {
+		t.Fatalf("NewMapDB() = %v", err)
+	}
+	if _, _, _, err := mapDB.LatestRevision(); err == nil {
+		t.Error("LatestRevision() with only legacy revisions want err, got nil")
+	}
+
+	cp := []byte("signed checkpoint")
+	if err := mapDB.WriteRevision(1, cp, 20); err != nil {
+		t.Fatalf("WriteRevision() = %v", err)
+	}
+	rev, gotCP, count, err := mapDB.LatestRevision()
+	if err != nil {
+		t.Fatalf("LatestRevision() = %v", err)
+	}
+	if rev != 1 || !bytes.Equal(gotCP, cp) || count != 20 {
+		t.Errorf("LatestRevision() = (%d, %q, %d), want (1, %q, 20)", rev, gotCP, count, cp)
+	}
+}
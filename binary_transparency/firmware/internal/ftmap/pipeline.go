@@ -19,6 +19,7 @@ package ftmap
 import (
 	"crypto"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"reflect"
 
@@ -32,6 +33,7 @@ func init() {
 	beam.RegisterFunction(parseStatementFn)
 	beam.RegisterFunction(parseFirmwareFn)
 	beam.RegisterFunction(parseAnnotationMalwareFn)
+	beam.RegisterFunction(parseRevocationFn)
 	beam.RegisterFunction(partitionFn)
 	beam.RegisterType(reflect.TypeOf((*InputLogMetadata)(nil)).Elem())
 	beam.RegisterType(reflect.TypeOf((*InputLogLeaf)(nil)).Elem())
@@ -39,17 +41,47 @@ func init() {
 	beam.RegisterType(reflect.TypeOf((*loggedStatement)(nil)).Elem())
 	beam.RegisterType(reflect.TypeOf((*firmwareLogEntry)(nil)).Elem())
 	beam.RegisterType(reflect.TypeOf((*annotationMalwareLogEntry)(nil)).Elem())
+	beam.RegisterType(reflect.TypeOf((*revocationLogEntry)(nil)).Elem())
 }
 
 // InputLog allows access to entries from the FT Log.
 type InputLog interface {
 	// Head returns the metadata of available entries.
-	// The log checkpoint is a serialized LogRootV1.
+	// The log checkpoint is the FT Log's signed checkpoint, so that clients of
+	// the map can verify the log state which the map was built from.
 	Head() (checkpoint []byte, count int64, err error)
+	EntrySource
+}
+
+// EntrySource allows access to the entries in the FT Log.
+type EntrySource interface {
 	// Entries returns a PCollection of InputLogLeaf, containing entries in range [start, end).
 	Entries(s beam.Scope, start, end int64) beam.PCollection
 }
 
+// NewInputLog returns an InputLog which reads entries from src, up to the size
+// of the FT Log checkpoint returned by checkpoint, which must have been parsed
+// from the log's signed envelope.
+func NewInputLog(checkpoint func() (*api.LogCheckpoint, error), src EntrySource) InputLog {
+	return &signedInputLog{EntrySource: src, checkpoint: checkpoint}
+}
+
+type signedInputLog struct {
+	EntrySource
+	checkpoint func() (*api.LogCheckpoint, error)
+}
+
+func (l *signedInputLog) Head() ([]byte, int64, error) {
+	cp, err := l.checkpoint()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get log checkpoint: %v", err)
+	}
+	if len(cp.Envelope) == 0 {
+		return nil, 0, errors.New("log checkpoint has no signed envelope")
+	}
+	return cp.Envelope, int64(cp.Size), nil
+}
+
 // InputLogMetadata describes the provenance information of the input
 // log to be passed around atomically.
 type InputLogMetadata struct {
@@ -109,17 +141,19 @@ func (b *MapBuilder) Create(s beam.Scope, size int64) (*PipelineResult, error) {
 	// Partition into:
 	// 0: FW Metadata
 	// 1: Annotation malware
-	// 2: Everything else
+	// 2: Revocations
+	// 3: Everything else
 	partitions := beam.Partition(s.Scope("partition"), MaxPartitions, partitionFn, statements)
 
 	fws := beam.ParDo(s, parseFirmwareFn, partitions[FirmwareMetaPartition])
 	ams := beam.ParDo(s, parseAnnotationMalwareFn, partitions[MalwareStatementPartition])
+	rs := beam.ParDo(s, parseRevocationFn, partitions[RevocationStatementPartition])
 
 	// Branch 1: create the logs of firmware releases.
 	logEntries, logs := MakeReleaseLogs(s.Scope("makeLogs"), b.treeID, fws)
 
 	// Branch 2: aggregate firmware releases with their annotations.
-	annotationEntries, aggregated := Aggregate(s, b.treeID, fws, ams)
+	annotationEntries, aggregated := Aggregate(s, b.treeID, fws, ams, rs)
 
 	// Flatten the entries together to create a single unified map.
 	entries := beam.Flatten(s, logEntries, annotationEntries)
@@ -160,6 +194,8 @@ const (
 	FirmwareMetaPartition = iota
 	// Partition index for partition containing MalwareStatement
 	MalwareStatementPartition
+	// Partition index for partition containing RevocationStatement
+	RevocationStatementPartition
 	// Partition index for partition containing anything not classified above
 	UnclassifiedStatementPartition
 	// Add new partitions here
@@ -173,6 +209,8 @@ func partitionFn(s *loggedStatement) int {
 		return FirmwareMetaPartition
 	case api.MalwareStatementType:
 		return MalwareStatementPartition
+	case api.RevocationStatementType:
+		return RevocationStatementPartition
 	default:
 		return UnclassifiedStatementPartition
 	}
@@ -227,3 +265,19 @@ func parseAnnotationMalwareFn(s *loggedStatement) (*annotationMalwareLogEntry, e
 		Annotation: a,
 	}, nil
 }
+
+type revocationLogEntry struct {
+	Index      int64
+	Revocation api.RevocationStatement
+}
+
+func parseRevocationFn(s *loggedStatement) (*revocationLogEntry, error) {
+	var r api.RevocationStatement
+	if err := json.Unmarshal(s.Statement.Statement, &r); err != nil {
+		return nil, err
+	}
+	return &revocationLogEntry{
+		Index:      s.Index,
+		Revocation: r,
+	}, nil
+}
@@ -77,7 +77,7 @@ func TestCreate(t *testing.T) {
 			rootToString := func(t *batchmap.Tile) string { return fmt.Sprintf("%x", t.RootHash) }
 			passert.Equals(s, beam.ParDo(s, rootToString, result.MapTiles), test.wantRoot)
 
-			logToString := func(l *api.DeviceReleaseLog) string { return fmt.Sprintf("%s: %v", l.DeviceID, l.Revisions) }
+			logToString := func(l *api.DeviceReleaseLog) string { return fmt.Sprintf("%s: %v", l.QualifiedDeviceID(), l.Revisions) }
 			passert.Equals(s, beam.ParDo(s, logToString, result.DeviceLogs), beam.CreateList(s, test.wantLogs))
 
 			err = ptest.Run(p)
@@ -88,6 +88,44 @@ func TestCreate(t *testing.T) {
 	}
 }
 
+func TestCreateVendorLogs(t *testing.T) {
+	vendorFW := func(vendor, device string, revision uint64) api.SignedStatement {
+		fw := createFW(device, revision)
+		fw.VendorID = vendor
+		fwbs, _ := json.Marshal(fw)
+		return api.SignedStatement{
+			Type:      api.FirmwareMetadataType,
+			Statement: fwbs,
+		}
+	}
+	inputLog := fakeLog{
+		leaves: []api.SignedStatement{
+			createFWSignedStatement("dummy", 1),
+			vendorFW("acme", "dummy", 2),
+			vendorFW("other", "dummy", 3),
+			vendorFW("acme", "dummy", 4),
+			// Invalid IDs, which would otherwise be added to acme's log.
+			vendorFW("", "acme/dummy", 5),
+			vendorFW("acme/dummy", "", 6),
+		},
+		head: []byte("this is just passed around"),
+	}
+	wantLogs := []string{"dummy: [1]", "acme/dummy: [2 4]", "other/dummy: [3]"}
+
+	mb := NewMapBuilder(inputLog, 12345, 0)
+	p, s := beam.NewPipelineWithRoot()
+	result, err := mb.Create(s, -1)
+	if err != nil {
+		t.Fatalf("failed to Create(): %v", err)
+	}
+	logToString := func(l *api.DeviceReleaseLog) string { return fmt.Sprintf("%s: %v", l.QualifiedDeviceID(), l.Revisions) }
+	passert.Equals(s, beam.ParDo(s, logToString, result.DeviceLogs), beam.CreateList(s, wantLogs))
+
+	if err := ptest.Run(p); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
 func createFW(device string, revision uint64) api.FirmwareMetadata {
 	image := fmt.Sprintf("this image is the firmware at revision %d for device %s.", revision, device)
 	imageHash := sha512.Sum512([]byte(image))
@@ -34,24 +34,29 @@ type ConsistencyProofFunc func(from, to uint64) ([][]byte, error)
 // are all self-consistent, and that the provided firmware image hash matches
 // the one in the bundle. It also checks consistency proof between update log point
 // and device log point (for non zero device tree size). Upon successful verification
-// returns a proof bundle
-func BundleForUpdate(bundleRaw, fwHash []byte, dc api.LogCheckpoint, cpFunc ConsistencyProofFunc, logSigVerifier note.Verifier) (api.ProofBundle, api.FirmwareMetadata, error) {
-	proofBundle, fwMeta, err := verifyBundle(bundleRaw, note.VerifierList(logSigVerifier))
+// returns a proof bundle. The firmware manifest must be signed by a claimant in
+// the given registry, and the firmware revision must not be lower than the
+// installedRevision currently on the device, to prevent rollback attacks.
+// The bundle checkpoint must satisfy the witness policy wp. If the bundle
+// includes the firmware's annotations from the map then these are also checked,
+// using mapSigVerifier.
+func BundleForUpdate(bundleRaw, fwHash []byte, dc api.LogCheckpoint, installedRevision uint64, cpFunc ConsistencyProofFunc, logSigVerifier, mapSigVerifier note.Verifier, claimants *crypto.Registry, wp WitnessPolicy) (api.ProofBundle, api.FirmwareMetadata, error) {
+	proofBundle, fwMeta, err := verifyBundle(bundleRaw, logSigVerifier, mapSigVerifier, claimants, wp)
 	if err != nil {
 		return proofBundle, fwMeta, err
 	}
 
+	if fwMeta.FirmwareRevision < installedRevision {
+		return proofBundle, fwMeta, fmt.Errorf("firmware revision %d is older than installed revision %d", fwMeta.FirmwareRevision, installedRevision)
+	}
+
 	if got, want := fwHash, fwMeta.FirmwareImageSHA512; !bytes.Equal(got, want) {
 		return proofBundle, fwMeta, fmt.Errorf("firmware update image hash does not match metadata (0x%x != 0x%x)", got, want)
 	}
 
-	pcNote, err := note.Open(proofBundle.Checkpoint, note.VerifierList(logSigVerifier))
+	pc, err := api.ParseCheckpoint(proofBundle.Checkpoint, logSigVerifier)
 	if err != nil {
-		return proofBundle, fwMeta, fmt.Errorf("failed to open the device checkpoint: %w", err)
-	}
-	pc := &api.LogCheckpoint{Envelope: proofBundle.Checkpoint}
-	if err := pc.Unmarshal([]byte(pcNote.Text)); err != nil {
-		return proofBundle, fwMeta, fmt.Errorf("failed to unmarshal the device checkpoint: %w", err)
+		return proofBundle, fwMeta, fmt.Errorf("failed to parse the proof bundle checkpoint: %w", err)
 	}
 
 	cProof, err := cpFunc(dc.Size, pc.Size)
@@ -78,15 +83,11 @@ func BundleConsistency(pb api.ProofBundle, rc api.LogCheckpoint, cpFunc Consiste
 		return fmt.Errorf("remote verification failed wcp treesize(%d)<device cp index(%d)", rc.Size, pb.InclusionProof.LeafIndex)
 	}
 
-	bundleCPNote, err := note.Open(pb.Checkpoint, note.VerifierList(logSigVerifier))
+	bundleCP, err := api.ParseCheckpoint(pb.Checkpoint, logSigVerifier)
 	if err != nil {
-		return fmt.Errorf("failed to open the proof bundle checkpoint: %w", err)
+		return fmt.Errorf("failed to parse the proof bundle checkpoint: %w", err)
 	}
-	bundleCP := api.LogCheckpoint{Envelope: pb.Checkpoint}
-	if err := bundleCP.Unmarshal([]byte(bundleCPNote.Text)); err != nil {
-		return fmt.Errorf("failed to unmarshal the proof bundle checkpoint: %w", err)
-	}
-	fromCP, toCP := rc, bundleCP
+	fromCP, toCP := rc, *bundleCP
 	// swap the remote checkpoint(fromCP) with published checkpoint (toCP) if it is ahead of published checkpoint
 	if rc.Size > bundleCP.Size {
 		fromCP, toCP = toCP, fromCP
@@ -103,9 +104,12 @@ func BundleConsistency(pb api.ProofBundle, rc api.LogCheckpoint, cpFunc Consiste
 
 // BundleForBoot checks that the manifest, checkpoint, and proofs in a bundle
 // are all self-consistent, and that the provided firmware measurement matches
-// the one expected by the bundle.
-func BundleForBoot(bundleRaw, measurement []byte, logSigVerifiers note.Verifiers) error {
-	_, fwMeta, err := verifyBundle(bundleRaw, logSigVerifiers)
+// the one expected by the bundle. The firmware manifest must be signed by a
+// claimant in the given registry, and the bundle checkpoint must satisfy the
+// witness policy wp. If the bundle includes the firmware's annotations from
+// the map then these are also checked, using mapSigVerifier.
+func BundleForBoot(bundleRaw, measurement []byte, logSigVerifier, mapSigVerifier note.Verifier, claimants *crypto.Registry, wp WitnessPolicy) error {
+	_, fwMeta, err := verifyBundle(bundleRaw, logSigVerifier, mapSigVerifier, claimants, wp)
 	if err != nil {
 		return err
 	}
@@ -117,32 +121,31 @@ func BundleForBoot(bundleRaw, measurement []byte, logSigVerifiers note.Verifiers
 }
 
 // verifyBundle parses a proof bundle and verifies its self-consistency.
-func verifyBundle(bundleRaw []byte, logSigVerifiers note.Verifiers) (api.ProofBundle, api.FirmwareMetadata, error) {
+func verifyBundle(bundleRaw []byte, logSigVerifier, mapSigVerifier note.Verifier, claimants *crypto.Registry, wp WitnessPolicy) (api.ProofBundle, api.FirmwareMetadata, error) {
 	var pb api.ProofBundle
 	if err := json.Unmarshal(bundleRaw, &pb); err != nil {
 		return api.ProofBundle{}, api.FirmwareMetadata{}, fmt.Errorf("failed to parse proof bundle: %w", err)
 	}
 
-	bundleCPNote, err := note.Open(pb.Checkpoint, logSigVerifiers)
+	bundleCP, err := api.ParseCheckpoint(pb.Checkpoint, logSigVerifier)
 	if err != nil {
-		return api.ProofBundle{}, api.FirmwareMetadata{}, fmt.Errorf("failed to open the proof bundle checkpoint: %w", err)
+		return api.ProofBundle{}, api.FirmwareMetadata{}, fmt.Errorf("failed to parse the proof bundle checkpoint: %w", err)
 	}
-	bundleCP := &api.LogCheckpoint{Envelope: pb.Checkpoint}
-	if err := bundleCP.Unmarshal([]byte(bundleCPNote.Text)); err != nil {
-		return api.ProofBundle{}, api.FirmwareMetadata{}, fmt.Errorf("failed to unmarshal the proof bundle checkpoint: %w", err)
+	if err := wp.Verify(pb.Checkpoint, logSigVerifier); err != nil {
+		return api.ProofBundle{}, api.FirmwareMetadata{}, fmt.Errorf("proof bundle checkpoint does not satisfy witness policy: %w", err)
 	}
 
 	var fwStatement api.SignedStatement
 	if err := json.Unmarshal(pb.ManifestStatement, &fwStatement); err != nil {
 		return api.ProofBundle{}, api.FirmwareMetadata{}, fmt.Errorf("failed to unmarshal SignedStatement: %w", err)
 	}
+	if fwStatement.Type != api.FirmwareMetadataType {
+		return api.ProofBundle{}, api.FirmwareMetadata{}, fmt.Errorf("expected statement type %q, but got %q", api.FirmwareMetadataType, fwStatement.Type)
+	}
 	// Verify the statement signature:
-	if err := crypto.Publisher.VerifySignature(fwStatement.Type, fwStatement.Statement, fwStatement.Signature); err != nil {
+	if err := claimants.VerifyStatement(fwStatement, nil); err != nil {
 		return api.ProofBundle{}, api.FirmwareMetadata{}, fmt.Errorf("failed to verify signature on SignedStatement: %w", err)
 	}
-	if fwStatement.Type != api.FirmwareMetadataType {
-		return api.ProofBundle{}, api.FirmwareMetadata{}, fmt.Errorf("expected statement type %q, but got %q", api.MalwareStatementType, fwStatement.Type)
-	}
 
 	lh := HashLeaf(pb.ManifestStatement)
 	lv := NewLogVerifier()
@@ -155,5 +158,13 @@ func verifyBundle(bundleRaw []byte, logSigVerifiers note.Verifiers) (api.ProofBu
 		return api.ProofBundle{}, api.FirmwareMetadata{}, fmt.Errorf("failed to unmarshal Metadata: %w", err)
 	}
 
+	// Annotations are only required by some callers, but if the bundle carries
+	// them then they must be valid and allow the firmware to be installed.
+	if pb.MapInclusion != nil {
+		if err := BundleAnnotations(pb, logSigVerifier, mapSigVerifier); err != nil {
+			return api.ProofBundle{}, api.FirmwareMetadata{}, fmt.Errorf("invalid map inclusion in bundle: %w", err)
+		}
+	}
+
 	return pb, fwMeta, nil
 }
@@ -48,6 +48,15 @@ func mustGetLogSigVerifier(t *testing.T) note.Verifier {
 }
 
 // This test is useful for creating the Checkpoint field of the goldenProofBundle above.
+func mustLoadRegistry(t *testing.T) *crypto.Registry {
+	t.Helper()
+	r, err := crypto.LoadRegistry("../../testdata/keys/claimants.json")
+	if err != nil {
+		t.Fatalf("failed to load claimant registry: %v", err)
+	}
+	return r
+}
+
 func TestGenerateGoldenCheckpoint(t *testing.T) {
 	cp := "RmlybXdhcmUgVHJhbnNwYXJlbmN5IExvZyB2MAo1Clg2VEY4QWNkSUh2OVp0UWwrU1NhZVZOYy9aNVJjNDJweDFpRlJLVGNDdHc9CjE2MDc0NTA3MzgxMTE1MDYwODgK"
 	nb, _ := base64.StdEncoding.DecodeString(cp)
@@ -69,13 +78,23 @@ func TestBundleForUpdate(t *testing.T) {
 	proof := func(from, to uint64) ([][]byte, error) { return [][]byte{}, nil }
 
 	for _, test := range []struct {
-		desc    string
-		img     []byte
-		wantErr bool
+		desc      string
+		img       []byte
+		installed uint64
+		wantErr   bool
 	}{
 		{
 			desc: "all good",
 			img:  []byte(goldenFirmwareImage),
+		}, {
+			desc:      "reinstall same revision",
+			img:       []byte(goldenFirmwareImage),
+			installed: 1,
+		}, {
+			desc:      "rollback",
+			img:       []byte(goldenFirmwareImage),
+			installed: 2,
+			wantErr:   true,
 		}, {
 			desc:    "bad image hash",
 			img:     []byte("this is wrong"),
@@ -84,7 +103,7 @@ func TestBundleForUpdate(t *testing.T) {
 	} {
 		t.Run(test.desc, func(t *testing.T) {
 			imgHash := sha512.Sum512(test.img)
-			_, _, err := verify.BundleForUpdate([]byte(goldenProofBundle), imgHash[:], dc, proof, mustGetLogSigVerifier(t))
+			_, _, err := verify.BundleForUpdate([]byte(goldenProofBundle), imgHash[:], dc, test.installed, proof, mustGetLogSigVerifier(t), nil, mustLoadRegistry(t), verify.WitnessPolicy{})
 			if (err != nil) != test.wantErr {
 				var lve logverifier.RootMismatchError
 				if errors.As(err, &lve) {
@@ -122,7 +141,7 @@ func TestBundleForBoot(t *testing.T) {
 		},
 	} {
 		t.Run(test.desc, func(t *testing.T) {
-			err := verify.BundleForBoot([]byte(goldenProofBundle), test.measurement, note.VerifierList(mustGetLogSigVerifier(t)))
+			err := verify.BundleForBoot([]byte(goldenProofBundle), test.measurement, mustGetLogSigVerifier(t), nil, mustLoadRegistry(t), verify.WitnessPolicy{})
 			if (err != nil) != test.wantErr {
 				t.Fatalf("want err %v, got %q", test.wantErr, err)
 			}
@@ -143,7 +162,11 @@ func TestGoldenBundleGeneration(t *testing.T) {
 	}
 
 	mbs, _ := json.Marshal(meta)
-	sig, err := crypto.Publisher.SignMessage(api.FirmwareMetadataType, mbs)
+	vendor, err := crypto.LoadSigningClaimant("../../testdata/keys/vendor.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := vendor.SignMessage(api.FirmwareMetadataType, mbs)
 	if err != nil {
 		t.Error(err)
 	}
@@ -0,0 +1,144 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/google/trillian-examples/binary_transparency/firmware/api"
+	"github.com/google/trillian/merkle/coniks"
+	"github.com/google/trillian/storage/tree"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// MapAggregation checks that the map inclusion proof ip shows that the map
+// with checkpoint mcp commits to preimage as the aggregation for the firmware
+// at fwIndex in the log, and returns the aggregation.
+func MapAggregation(mcp api.MapCheckpoint, fwIndex uint64, preimage []byte, ip api.MapInclusionProof) (api.AggregatedFirmware, error) {
+	// 1. Check: the proof is for the correct key.
+	kbs := sha512.Sum512_256([]byte(fmt.Sprintf("summary:%d", fwIndex)))
+	if !bytes.Equal(ip.Key, kbs[:]) {
+		return api.AggregatedFirmware{}, fmt.Errorf("received inclusion proof for key %x but wanted %x", ip.Key, kbs[:])
+	}
+	// 2. Check: the proof is for the correct value.
+	leafID := tree.NewNodeID2(string(kbs[:]), 256)
+	hasher := coniks.Default
+	expectedCommitment := hasher.HashLeaf(api.MapTreeID, leafID, preimage)
+	if !bytes.Equal(ip.Value, expectedCommitment) {
+		// This could happen if the JSON roundtripping was not stable. If we see that happen,
+		// then we'll need to pass out the raw bytes received from the server and parse into
+		// the struct at a higher level.
+		// It could also happen because the value returned is not actually committed to by the map.
+		return api.AggregatedFirmware{}, fmt.Errorf("received inclusion proof for value %x but wanted %x", ip.Value, expectedCommitment)
+	}
+	// 3. Check: the inclusion proof evaluates to the map root that we've obtained.
+	// The calculation starts from the leaf, and uses the siblings from the inclusion proof
+	// to generate the root, which is then compared with the map checkpoint.
+	if got, want := len(ip.Proof), hasher.BitLen(); got != want {
+		return api.AggregatedFirmware{}, fmt.Errorf("inclusion proof has %d siblings but wanted %d", got, want)
+	}
+	calc := expectedCommitment
+	for pd := hasher.BitLen(); pd > 0; pd-- {
+		sib := ip.Proof[pd-1]
+		stem := leafID.Prefix(uint(pd))
+		if sib == nil {
+			sib = hasher.HashEmpty(api.MapTreeID, stem.Sibling())
+		}
+		left, right := calc, sib
+		if !isLeftChild(stem) {
+			left, right = right, left
+		}
+		calc = hasher.HashChildren(left, right)
+	}
+	if !bytes.Equal(calc, mcp.RootHash) {
+		return api.AggregatedFirmware{}, fmt.Errorf("inclusion proof calculated root %x but wanted %x", calc, mcp.RootHash)
+	}
+
+	var agg api.AggregatedFirmware
+	if err := json.Unmarshal(preimage, &agg); err != nil {
+		return api.AggregatedFirmware{}, fmt.Errorf("failed to decode aggregation: %w", err)
+	}
+	if agg.Index != fwIndex {
+		return api.AggregatedFirmware{}, fmt.Errorf("aggregation is for firmware at index %d but wanted %d", agg.Index, fwIndex)
+	}
+	return agg, nil
+}
+
+// MapInclusion checks that the map inclusion in the bundle, which must be
+// present, is for the firmware in the bundle and is consistent with the bundle
+// checkpoint, and returns the aggregation it proves. No network access is needed.
+//
+// The map checkpoint must be signed by the map, and the log checkpoint which
+// the map was built from must be signed by the log.
+func MapInclusion(pb api.ProofBundle, logSigVerifier, mapSigVerifier note.Verifier) (api.AggregatedFirmware, error) {
+	mi := pb.MapInclusion
+	if mi == nil {
+		return api.AggregatedFirmware{}, errors.New("proof bundle has no map inclusion")
+	}
+	if mapSigVerifier == nil {
+		return api.AggregatedFirmware{}, errors.New("no map key to verify the map checkpoint with")
+	}
+	mcp, err := api.ParseMapCheckpoint(mi.Checkpoint, mapSigVerifier)
+	if err != nil {
+		return api.AggregatedFirmware{}, fmt.Errorf("failed to parse map checkpoint: %w", err)
+	}
+	lcp, err := api.ParseCheckpoint(mcp.LogCheckpoint, logSigVerifier)
+	if err != nil {
+		return api.AggregatedFirmware{}, fmt.Errorf("failed to parse map log checkpoint: %w", err)
+	}
+	if mcp.LogSize > lcp.Size {
+		return api.AggregatedFirmware{}, fmt.Errorf("map built from %d log entries but log checkpoint has only %d", mcp.LogSize, lcp.Size)
+	}
+	fwIndex := pb.InclusionProof.LeafIndex
+	if mcp.LogSize <= fwIndex {
+		return api.AggregatedFirmware{}, fmt.Errorf("map built from %d log entries does not include firmware at index %d", mcp.LogSize, fwIndex)
+	}
+	cpFunc := func(from, to uint64) ([][]byte, error) { return mi.LogConsistency, nil }
+	if err := BundleConsistency(pb, *lcp, cpFunc, logSigVerifier); err != nil {
+		return api.AggregatedFirmware{}, fmt.Errorf("map log checkpoint is inconsistent with bundle: %w", err)
+	}
+	return MapAggregation(*mcp, fwIndex, mi.Aggregation, mi.Proof)
+}
+
+// BundleAnnotations checks, without network access, that the map inclusion in
+// the bundle proves that the firmware has been neither revoked nor marked as bad.
+func BundleAnnotations(pb api.ProofBundle, logSigVerifier, mapSigVerifier note.Verifier) error {
+	agg, err := MapInclusion(pb, logSigVerifier, mapSigVerifier)
+	if err != nil {
+		return err
+	}
+	return Aggregation(agg)
+}
+
+// Aggregation checks that the aggregated annotations allow the firmware to be installed.
+func Aggregation(agg api.AggregatedFirmware) error {
+	if agg.Revoked {
+		return errors.New("firmware has been revoked")
+	}
+	if !agg.Good {
+		return errors.New("firmware is marked as bad")
+	}
+	return nil
+}
+
+// isLeftChild returns whether the given node is a left child.
+func isLeftChild(id tree.NodeID2) bool {
+	last, bits := id.LastByte()
+	return last&(1<<(8-bits)) == 0
+}
@@ -0,0 +1,250 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify_test
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/google/trillian-examples/binary_transparency/firmware/api"
+	"github.com/google/trillian-examples/binary_transparency/firmware/internal/crypto"
+	"github.com/google/trillian-examples/binary_transparency/firmware/internal/verify"
+	"github.com/google/trillian/merkle/coniks"
+	"github.com/google/trillian/merkle/smt"
+	"github.com/google/trillian/storage/tree"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// mapNodes records the nodes written when building a map.
+type mapNodes map[tree.NodeID2][]byte
+
+func (m mapNodes) Get(id tree.NodeID2) ([]byte, error) {
+	return coniks.Default.HashEmpty(api.MapTreeID, id), nil
+}
+
+func (m mapNodes) Set(id tree.NodeID2, hash []byte) {
+	m[id] = hash
+}
+
+// buildMap returns the unsigned checkpoint of a map, built from the log at
+// lcp, containing the aggregations, and an inclusion proof for each of them.
+func buildMap(t *testing.T, lcp api.LogCheckpoint, aggs ...api.AggregatedFirmware) (api.MapCheckpoint, map[uint64][]byte, map[uint64]api.MapInclusionProof) {
+	t.Helper()
+	h := coniks.Default
+	values := make(map[uint64][]byte)
+	ids := make(map[uint64]tree.NodeID2)
+	var leaves []smt.Node
+	for _, agg := range aggs {
+		v, err := json.Marshal(agg)
+		if err != nil {
+			t.Fatalf("failed to marshal aggregation: %v", err)
+		}
+		kbs := sha512.Sum512_256([]byte(fmt.Sprintf("summary:%d", agg.Index)))
+		id := tree.NewNodeID2(string(kbs[:]), 256)
+		values[agg.Index], ids[agg.Index] = v, id
+		leaves = append(leaves, smt.Node{ID: id, Hash: h.HashLeaf(api.MapTreeID, id, v)})
+	}
+	if err := smt.Prepare(leaves, 256); err != nil {
+		t.Fatalf("Prepare() = %v", err)
+	}
+	hs, err := smt.NewHStar3(leaves, h.HashChildren, 256, 0)
+	if err != nil {
+		t.Fatalf("NewHStar3() = %v", err)
+	}
+	nodes := make(mapNodes)
+	root, err := hs.Update(nodes)
+	if err != nil {
+		t.Fatalf("Update() = %v", err)
+	}
+
+	proofs := make(map[uint64]api.MapInclusionProof)
+	for i, id := range ids {
+		p := api.MapInclusionProof{Value: h.HashLeaf(api.MapTreeID, id, values[i]), Proof: make([][]byte, 256)}
+		kbs := sha512.Sum512_256([]byte(fmt.Sprintf("summary:%d", i)))
+		p.Key = kbs[:]
+		for d := uint(1); d <= 256; d++ {
+			p.Proof[d-1] = nodes[id.Prefix(d).Sibling()]
+		}
+		proofs[i] = p
+	}
+	mcp := api.MapCheckpoint{
+		LogCheckpoint: lcp.Envelope,
+		LogSize:       lcp.Size,
+		RootHash:      root[0].Hash,
+		Revision:      1,
+	}
+	return mcp, values, proofs
+}
+
+func TestMapInclusion(t *testing.T) {
+	var pb api.ProofBundle
+	if err := json.Unmarshal([]byte(goldenProofBundle), &pb); err != nil {
+		t.Fatalf("failed to unmarshal golden bundle: %v", err)
+	}
+	lcp, err := api.ParseCheckpoint(pb.Checkpoint, mustGetLogSigVerifier(t))
+	if err != nil {
+		t.Fatalf("failed to parse golden checkpoint: %v", err)
+	}
+	mapSigVerifier, err := note.NewVerifier(crypto.TestMapPub)
+	if err != nil {
+		t.Fatalf("failed to create map verifier: %v", err)
+	}
+	fwIndex := pb.InclusionProof.LeafIndex
+	mcp, values, proofs := buildMap(t, *lcp, api.AggregatedFirmware{Index: fwIndex - 1, Good: true}, api.AggregatedFirmware{Index: fwIndex, Good: true})
+	badMCP, badValues, badProofs := buildMap(t, *lcp, api.AggregatedFirmware{Index: fwIndex, Good: false})
+	revokedMCP, revokedValues, revokedProofs := buildMap(t, *lcp, api.AggregatedFirmware{Index: fwIndex, Good: true, Revoked: true})
+
+	forkedLCP := *lcp
+	forkedRoot := sha256.Sum256([]byte("forked"))
+	forkedLCP.Hash = forkedRoot[:]
+	forkedMCP := mcp
+	forkedMCP.LogCheckpoint = mustSignNote(t, mustMarshalCheckpoint(t, forkedLCP), crypto.TestFTPersonalityPriv)
+
+	unsignedLogMCP := mcp
+	unsignedLogMCP.LogCheckpoint = mustMarshalCheckpoint(t, *lcp)
+
+	behindMCP := mcp
+	behindMCP.LogSize = fwIndex
+
+	aheadMCP := mcp
+	aheadMCP.LogSize = lcp.Size + 1
+
+	signed := func(mcp api.MapCheckpoint) []byte {
+		return mustSignNote(t, mcp.Marshal(), crypto.TestMapPriv)
+	}
+
+	for _, test := range []struct {
+		desc         string
+		mi           *api.MapInclusion
+		wantMapErr   bool
+		wantAnnotErr bool
+	}{
+		{
+			desc:         "absent",
+			wantMapErr:   true,
+			wantAnnotErr: true,
+		}, {
+			desc: "good",
+			mi:   &api.MapInclusion{Checkpoint: signed(mcp), Aggregation: values[fwIndex], Proof: proofs[fwIndex]},
+		}, {
+			desc:         "marked bad",
+			mi:           &api.MapInclusion{Checkpoint: signed(badMCP), Aggregation: badValues[fwIndex], Proof: badProofs[fwIndex]},
+			wantAnnotErr: true,
+		}, {
+			desc:         "revoked",
+			mi:           &api.MapInclusion{Checkpoint: signed(revokedMCP), Aggregation: revokedValues[fwIndex], Proof: revokedProofs[fwIndex]},
+			wantAnnotErr: true,
+		}, {
+			desc:         "wrong firmware",
+			mi:           &api.MapInclusion{Checkpoint: signed(mcp), Aggregation: values[fwIndex-1], Proof: proofs[fwIndex-1]},
+			wantMapErr:   true,
+			wantAnnotErr: true,
+		}, {
+			desc:         "tampered aggregation",
+			mi:           &api.MapInclusion{Checkpoint: signed(badMCP), Aggregation: values[fwIndex], Proof: badProofs[fwIndex]},
+			wantMapErr:   true,
+			wantAnnotErr: true,
+		}, {
+			desc:         "proof to wrong root",
+			mi:           &api.MapInclusion{Checkpoint: signed(badMCP), Aggregation: values[fwIndex], Proof: proofs[fwIndex]},
+			wantMapErr:   true,
+			wantAnnotErr: true,
+		}, {
+			desc:         "truncated proof",
+			mi:           &api.MapInclusion{Checkpoint: signed(mcp), Aggregation: values[fwIndex], Proof: api.MapInclusionProof{Key: proofs[fwIndex].Key, Value: proofs[fwIndex].Value}},
+			wantMapErr:   true,
+			wantAnnotErr: true,
+		}, {
+			desc:         "map from forked log",
+			mi:           &api.MapInclusion{Checkpoint: signed(forkedMCP), Aggregation: values[fwIndex], Proof: proofs[fwIndex]},
+			wantMapErr:   true,
+			wantAnnotErr: true,
+		}, {
+			desc:         "map checkpoint not signed by map",
+			mi:           &api.MapInclusion{Checkpoint: mustSignNote(t, mcp.Marshal(), crypto.TestWitnessPriv), Aggregation: values[fwIndex], Proof: proofs[fwIndex]},
+			wantMapErr:   true,
+			wantAnnotErr: true,
+		}, {
+			desc:         "log checkpoint not signed by log",
+			mi:           &api.MapInclusion{Checkpoint: signed(unsignedLogMCP), Aggregation: values[fwIndex], Proof: proofs[fwIndex]},
+			wantMapErr:   true,
+			wantAnnotErr: true,
+		}, {
+			desc:         "map ahead of log checkpoint",
+			mi:           &api.MapInclusion{Checkpoint: signed(aheadMCP), Aggregation: values[fwIndex], Proof: proofs[fwIndex]},
+			wantMapErr:   true,
+			wantAnnotErr: true,
+		}, {
+			desc:         "map behind firmware",
+			mi:           &api.MapInclusion{Checkpoint: signed(behindMCP), Aggregation: values[fwIndex], Proof: proofs[fwIndex]},
+			wantMapErr:   true,
+			wantAnnotErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			pb := pb
+			pb.MapInclusion = test.mi
+			if _, err := verify.MapInclusion(pb, mustGetLogSigVerifier(t), mapSigVerifier); (err != nil) != test.wantMapErr {
+				t.Errorf("MapInclusion() want err %v, got %q", test.wantMapErr, err)
+			}
+			if err := verify.BundleAnnotations(pb, mustGetLogSigVerifier(t), mapSigVerifier); (err != nil) != test.wantAnnotErr {
+				t.Errorf("BundleAnnotations() want err %v, got %q", test.wantAnnotErr, err)
+			}
+			if _, err := verify.MapInclusion(pb, mustGetLogSigVerifier(t), nil); err == nil {
+				t.Error("MapInclusion() without map key want err, got nil")
+			}
+
+			// Devices check any annotations carried by the bundle, but don't
+			// require them.
+			wantBootErr := test.mi != nil && test.wantAnnotErr
+			raw, err := json.Marshal(pb)
+			if err != nil {
+				t.Fatalf("failed to marshal bundle: %v", err)
+			}
+			measurement := b64Decode(t, goldenFirmwareHashB64)
+			if err := verify.BundleForBoot(raw, measurement, mustGetLogSigVerifier(t), mapSigVerifier, mustLoadRegistry(t), verify.WitnessPolicy{}); (err != nil) != wantBootErr {
+				t.Errorf("BundleForBoot() want err %v, got %q", wantBootErr, err)
+			}
+			if err := verify.BundleForBoot(raw, measurement, mustGetLogSigVerifier(t), nil, mustLoadRegistry(t), verify.WitnessPolicy{}); test.mi != nil && err == nil {
+				t.Error("BundleForBoot() without map key want err, got nil")
+			}
+		})
+	}
+}
+
+func mustMarshalCheckpoint(t *testing.T, cp api.LogCheckpoint) []byte {
+	t.Helper()
+	b, err := cp.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal() = %v", err)
+	}
+	return b
+}
+
+func mustSignNote(t *testing.T, text []byte, skey string) []byte {
+	t.Helper()
+	s, err := note.NewSigner(skey)
+	if err != nil {
+		t.Fatalf("NewSigner() = %v", err)
+	}
+	n, err := note.Sign(&note.Note{Text: string(text)}, s)
+	if err != nil {
+		t.Fatalf("Sign() = %v", err)
+	}
+	return n
+}
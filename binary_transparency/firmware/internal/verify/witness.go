@@ -0,0 +1,87 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"fmt"
+
+	"github.com/google/trillian-examples/formats/log"
+	fnote "github.com/google/trillian-examples/formats/note"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// WitnessPolicy describes the witness cosignatures which a checkpoint must
+// carry in order to be trusted. Requiring a checkpoint to be cosigned by
+// witnesses which check that the log is append-only protects devices which
+// can't contact the witnesses themselves from being shown a split view.
+//
+// The zero WitnessPolicy requires no cosignatures.
+type WitnessPolicy struct {
+	// Witnesses holds the verifiers for the trusted witnesses.
+	Witnesses []note.Verifier
+	// Threshold is the number of distinct Witnesses which must have cosigned
+	// a checkpoint.
+	Threshold int
+}
+
+// NewWitnessPolicy returns a WitnessPolicy requiring cosignatures from
+// threshold of the witnesses with the given note verifier keys.
+func NewWitnessPolicy(vkeys []string, threshold int) (WitnessPolicy, error) {
+	if threshold < 0 || threshold > len(vkeys) {
+		return WitnessPolicy{}, fmt.Errorf("threshold %d must be between 0 and the number of witnesses (%d)", threshold, len(vkeys))
+	}
+	wp := WitnessPolicy{Threshold: threshold}
+	seen := make(map[string]bool)
+	for _, k := range vkeys {
+		v, err := fnote.NewVerifier(k)
+		if err != nil {
+			return WitnessPolicy{}, fmt.Errorf("invalid witness key %q: %w", k, err)
+		}
+		id := witnessID(v.Name(), v.KeyHash())
+		if seen[id] {
+			return WitnessPolicy{}, fmt.Errorf("duplicate witness key %q", k)
+		}
+		seen[id] = true
+		wp.Witnesses = append(wp.Witnesses, v)
+	}
+	return wp, nil
+}
+
+// Verify checks that the checkpoint envelope is signed by the log, and has
+// valid cosignatures from at least Threshold of the Witnesses.
+func (wp WitnessPolicy) Verify(envelope []byte, logSigVerifier note.Verifier) error {
+	if wp.Threshold == 0 {
+		return nil
+	}
+	sc, err := log.ParseSignedCheckpoint(envelope, logSigVerifier, wp.Witnesses...)
+	if err != nil {
+		return fmt.Errorf("failed to parse cosigned checkpoint: %w", err)
+	}
+	// A witness may have cosigned more than once, but only counts once.
+	cosigned := make(map[string]bool)
+	for _, c := range sc.Cosignatures {
+		if c.Verified {
+			cosigned[witnessID(c.Name, c.Hash)] = true
+		}
+	}
+	if got := len(cosigned); got < wp.Threshold {
+		return fmt.Errorf("checkpoint is cosigned by %d witnesses, but %d are required", got, wp.Threshold)
+	}
+	return nil
+}
+
+func witnessID(name string, hash uint32) string {
+	return fmt.Sprintf("%s+%08x", name, hash)
+}
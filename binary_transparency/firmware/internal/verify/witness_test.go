@@ -0,0 +1,173 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify_test
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/trillian-examples/binary_transparency/firmware/api"
+	"github.com/google/trillian-examples/binary_transparency/firmware/internal/crypto"
+	"github.com/google/trillian-examples/binary_transparency/firmware/internal/verify"
+	"github.com/google/trillian-examples/formats/log"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// cosign returns the golden proof bundle with its checkpoint cosigned by signers.
+func cosign(t *testing.T, signers ...note.Signer) []byte {
+	t.Helper()
+	var pb api.ProofBundle
+	if err := json.Unmarshal([]byte(goldenProofBundle), &pb); err != nil {
+		t.Fatalf("failed to unmarshal golden bundle: %v", err)
+	}
+	sc, err := log.ParseSignedCheckpoint(pb.Checkpoint, mustGetLogSigVerifier(t))
+	if err != nil {
+		t.Fatalf("failed to parse golden checkpoint: %v", err)
+	}
+	for _, s := range signers {
+		if err := sc.Cosign(s); err != nil {
+			t.Fatalf("Cosign() = %v", err)
+		}
+	}
+	pb.Checkpoint = sc.Marshal()
+	raw, err := json.Marshal(pb)
+	if err != nil {
+		t.Fatalf("failed to marshal bundle: %v", err)
+	}
+	return raw
+}
+
+func TestWitnessPolicy(t *testing.T) {
+	ws, err := note.NewSigner(crypto.TestWitnessPriv)
+	if err != nil {
+		t.Fatalf("failed to create witness signer: %v", err)
+	}
+	otherSKey, otherVKey, err := note.GenerateKey(rand.Reader, "other_witness")
+	if err != nil {
+		t.Fatalf("failed to generate witness key: %v", err)
+	}
+	other, err := note.NewSigner(otherSKey)
+	if err != nil {
+		t.Fatalf("failed to create witness signer: %v", err)
+	}
+	_, unknownVKey, err := note.GenerateKey(rand.Reader, "unknown_witness")
+	if err != nil {
+		t.Fatalf("failed to generate witness key: %v", err)
+	}
+
+	measurement := b64Decode(t, goldenFirmwareHashB64)
+	for _, test := range []struct {
+		desc      string
+		bundle    []byte
+		keys      []string
+		threshold int
+		wantErr   bool
+	}{
+		{
+			desc:   "no policy",
+			bundle: []byte(goldenProofBundle),
+		}, {
+			desc:   "no policy with cosignatures",
+			bundle: cosign(t, ws),
+		}, {
+			desc:      "not cosigned",
+			bundle:    []byte(goldenProofBundle),
+			keys:      []string{crypto.TestWitnessPub},
+			threshold: 1,
+			wantErr:   true,
+		}, {
+			desc:      "cosigned",
+			bundle:    cosign(t, ws),
+			keys:      []string{crypto.TestWitnessPub},
+			threshold: 1,
+		}, {
+			desc:      "one of two",
+			bundle:    cosign(t, other),
+			keys:      []string{crypto.TestWitnessPub, otherVKey},
+			threshold: 1,
+		}, {
+			desc:      "two of two",
+			bundle:    cosign(t, other, ws),
+			keys:      []string{crypto.TestWitnessPub, otherVKey},
+			threshold: 2,
+		}, {
+			desc:      "one of two cosigned twice",
+			bundle:    cosign(t, ws, ws),
+			keys:      []string{crypto.TestWitnessPub, otherVKey},
+			threshold: 2,
+			wantErr:   true,
+		}, {
+			desc:      "cosigned by unknown witness",
+			bundle:    cosign(t, ws),
+			keys:      []string{unknownVKey},
+			threshold: 1,
+			wantErr:   true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			wp, err := verify.NewWitnessPolicy(test.keys, test.threshold)
+			if err != nil {
+				t.Fatalf("NewWitnessPolicy() = %v", err)
+			}
+			err = verify.BundleForBoot(test.bundle, measurement, mustGetLogSigVerifier(t), nil, mustLoadRegistry(t), wp)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("want err %v, got %q", test.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestNewWitnessPolicy(t *testing.T) {
+	for _, test := range []struct {
+		desc      string
+		keys      []string
+		threshold int
+		wantErr   bool
+	}{
+		{
+			desc: "empty",
+		}, {
+			desc:      "valid",
+			keys:      []string{crypto.TestWitnessPub},
+			threshold: 1,
+		}, {
+			desc:      "threshold too high",
+			keys:      []string{crypto.TestWitnessPub},
+			threshold: 2,
+			wantErr:   true,
+		}, {
+			desc:      "negative threshold",
+			threshold: -1,
+			wantErr:   true,
+		}, {
+			desc:    "invalid key",
+			keys:    []string{"not a key"},
+			wantErr: true,
+		}, {
+			desc:      "duplicate key",
+			keys:      []string{crypto.TestWitnessPub, crypto.TestWitnessPub},
+			threshold: 1,
+			wantErr:   true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := verify.NewWitnessPolicy(test.keys, test.threshold)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("want err %v, got %q", test.wantErr, err)
+			}
+		})
+	}
+}
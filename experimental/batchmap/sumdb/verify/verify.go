@@ -28,6 +28,8 @@ import (
 
 	"github.com/google/trillian-examples/experimental/batchmap/sumdb/mapdb"
 	"github.com/google/trillian-examples/experimental/batchmap/sumdb/verification"
+	"github.com/google/trillian-examples/formats/log"
+	"golang.org/x/mod/sumdb/note"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -39,6 +41,7 @@ var (
 	mapDB        = flag.String("map_db", "", "sqlite DB containing the map tiles.")
 	treeID       = flag.Int64("tree_id", 12345, "The ID of the tree. Used as a salt in hashing.")
 	prefixStrata = flag.Int("prefix_strata", 2, "The number of strata of 8-bit strata before the final strata.")
+	logVKey      = flag.String("log_vkey", "sum.golang.org+033de0ae+Ac4zctda0e5eza+HJyk9SxEdh+s3Ux18htTTAD8OuAn8", "Verifier key for the SumDB log checkpoint the map was built from.")
 )
 
 func main() {
@@ -60,6 +63,14 @@ func main() {
 	if rev, logRoot, _, err = tiledb.LatestRevision(); err != nil {
 		glog.Exitf("No revisions found in map DB at %q: %v", *mapDB, err)
 	}
+	v, err := note.NewVerifier(*logVKey)
+	if err != nil {
+		glog.Exitf("Invalid --log_vkey: %v", err)
+	}
+	logCP, _, err := log.ParseSumDBCheckpoint(logRoot, v)
+	if err != nil {
+		glog.Exitf("Failed to verify log checkpoint for map rev %d: %v", rev, err)
+	}
 
 	mv := verification.NewMapVerifier(tiledb.Tile, *prefixStrata, *treeID, hash)
 
@@ -95,5 +106,5 @@ func main() {
 		root = newRoot
 		count++
 	}
-	glog.Infof("Verified %d entries committed to by map rev %d root %x. Log checkpoint:\n%s", count, rev, root, logRoot)
+	glog.Infof("Verified %d entries committed to by map rev %d root %x, built from log checkpoint of size %d with root %x", count, rev, root, logCP.Size, logCP.Hash)
 }
@@ -22,6 +22,9 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 // Checkpoint represents a minimal log checkpoint (STH).
@@ -76,3 +79,40 @@ func (c *Checkpoint) Unmarshal(data []byte) ([]byte, error) {
 	}
 	return rest, nil
 }
+
+// UnmarshalStrict is like Unmarshal, but additionally requires that the data
+// is in its canonical form, i.e. that the Checkpoint would Marshal to exactly
+// the bytes which were parsed, and that any trailing otherdata is valid.
+//
+// This should be used when parsing checkpoints which are bound by signatures,
+// to prevent malleability.
+func (c *Checkpoint) UnmarshalStrict(data []byte) ([]byte, error) {
+	var r Checkpoint
+	rest, err := r.Unmarshal(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateEcosystem(r.Ecosystem); err != nil {
+		return nil, err
+	}
+	if m := r.Marshal(); !bytes.HasPrefix(data, m) || len(m)+len(rest) != len(data) {
+		return nil, errors.New("invalid checkpoint - not in canonical form")
+	}
+	if err := ValidateOtherData(rest); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint - %w", err)
+	}
+	*c = r
+	return rest, nil
+}
+
+// validateEcosystem checks that an ecosystem string is valid UTF-8 and
+// contains no control characters.
+func validateEcosystem(eco string) error {
+	if !utf8.ValidString(eco) {
+		return errors.New("invalid checkpoint - ecosystem is not valid UTF-8")
+	}
+	if strings.IndexFunc(eco, unicode.IsControl) >= 0 {
+		return errors.New("invalid checkpoint - ecosystem contains control characters")
+	}
+	return nil
+}
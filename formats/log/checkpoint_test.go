@@ -153,6 +153,68 @@ func TestUnmarshalLogState(t *testing.T) {
 	}
 }
 
+func TestUnmarshalStrict(t *testing.T) {
+	for _, test := range []struct {
+		desc    string
+		m       string
+		wantErr bool
+	}{
+		{
+			desc: "valid",
+			m:    "Log Checkpoint v0\n123\nYmFuYW5hcw==\n",
+		}, {
+			desc: "valid with otherdata",
+			m:    "Log Checkpoint v0\n123\nYmFuYW5hcw==\nsome\nother data\n",
+		}, {
+			desc:    "leading zeros in size",
+			m:       "Log Checkpoint v0\n0123\nYmFuYW5hcw==\n",
+			wantErr: true,
+		}, {
+			desc:    "non-zero base64 padding bits",
+			m:       "Log Checkpoint v0\n123\nYmFuYW5hcx==\n",
+			wantErr: true,
+		}, {
+			desc:    "carriage return in hash",
+			m:       "Log Checkpoint v0\n123\nYmFuYW5h\rcw==\n",
+			wantErr: true,
+		}, {
+			desc:    "control character in ecosystem",
+			m:       "Log Checkpoint\tv0\n123\nYmFuYW5hcw==\n",
+			wantErr: true,
+		}, {
+			desc:    "invalid UTF-8 in ecosystem",
+			m:       "Log Checkpoint \xff\n123\nYmFuYW5hcw==\n",
+			wantErr: true,
+		}, {
+			desc:    "blank line in otherdata",
+			m:       "Log Checkpoint v0\n123\nYmFuYW5hcw==\n\n\n",
+			wantErr: true,
+		}, {
+			desc:    "unterminated otherdata",
+			m:       "Log Checkpoint v0\n123\nYmFuYW5hcw==\nmore",
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			var lenient log.Checkpoint
+			if _, err := lenient.Unmarshal([]byte(test.m)); err != nil {
+				t.Fatalf("Unmarshal = %v, want lenient parsing to succeed", err)
+			}
+			var got log.Checkpoint
+			rest, err := got.UnmarshalStrict([]byte(test.m))
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("UnmarshalStrict = %v, wantErr %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if m := string(got.Marshal()) + string(rest); m != test.m {
+				t.Errorf("Marshal = %q, want %q", m, test.m)
+			}
+		})
+	}
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // Below is an example of embedding the minimal checkpoint as one way to extend
 // it to include additional ecosystem-specific data.
@@ -0,0 +1,217 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/trillian/merkle/hashers"
+	"github.com/google/trillian/merkle/logverifier"
+	"github.com/google/trillian/merkle/rfc6962/hasher"
+)
+
+// ProofHeaderV0 is the first line of a v0 proof envelope.
+const ProofHeaderV0 = "Log Proof v0"
+
+// ProofType identifies the kind of proof held in a ProofEnvelope.
+type ProofType string
+
+const (
+	// InclusionProof proves that a leaf is included in a tree.
+	InclusionProof ProofType = "inclusion"
+	// ConsistencyProof proves that a larger tree is an append-only extension
+	// of a smaller one.
+	ConsistencyProof ProofType = "consistency"
+)
+
+// HashRFC6962SHA256 identifies RFC 6962 Merkle tree hashing using SHA-256.
+const HashRFC6962SHA256 = "RFC6962-SHA256"
+
+// proofHashers maps the hash algorithms understood by ProofEnvelope to their
+// LogHasher.
+var proofHashers = map[string]hashers.LogHasher{
+	HashRFC6962SHA256: hasher.DefaultHasher,
+}
+
+// ProofEnvelope is a self-describing proof, carrying the metadata needed to
+// interpret and verify it alongside the proof hashes themselves.
+//
+// The serialised form is a header of "<key> <value>" lines, a blank line, and
+// then the proof in the common format:
+//
+//	Log Proof v0
+//	Type <inclusion|consistency>
+//	Hash <hash algorithm>
+//	LeafIndex <decimal>   (inclusion only)
+//	TreeSize <decimal>    (inclusion only)
+//	FromSize <decimal>    (consistency only)
+//	ToSize <decimal>      (consistency only)
+//
+//	<base64 proof hashes, one per line>
+type ProofEnvelope struct {
+	// Type is the kind of proof.
+	Type ProofType
+	// HashAlgorithm identifies how the tree is hashed, e.g. HashRFC6962SHA256.
+	HashAlgorithm string
+	// LeafIndex is the index of the leaf an inclusion proof is for.
+	LeafIndex uint64
+	// TreeSize is the size of the tree an inclusion proof is for.
+	TreeSize uint64
+	// FromSize is the size of the smaller tree in a consistency proof.
+	FromSize uint64
+	// ToSize is the size of the larger tree in a consistency proof.
+	ToSize uint64
+	// Proof holds the proof hashes.
+	Proof Proof
+}
+
+// Marshal returns the serialised form of the envelope.
+func (e ProofEnvelope) Marshal() ([]byte, error) {
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "%s\nType %s\nHash %s\n", ProofHeaderV0, e.Type, e.HashAlgorithm)
+	switch e.Type {
+	case InclusionProof:
+		fmt.Fprintf(b, "LeafIndex %d\nTreeSize %d\n", e.LeafIndex, e.TreeSize)
+	case ConsistencyProof:
+		fmt.Fprintf(b, "FromSize %d\nToSize %d\n", e.FromSize, e.ToSize)
+	default:
+		return nil, fmt.Errorf("unknown proof type %q", e.Type)
+	}
+	b.WriteString("\n")
+	b.WriteString(e.Proof.Marshal())
+	return b.Bytes(), nil
+}
+
+// Unmarshal parses a serialised proof envelope and stores the result in e.
+func (e *ProofEnvelope) Unmarshal(data []byte) error {
+	i := bytes.Index(data, []byte("\n\n"))
+	if i < 0 {
+		return errors.New("invalid proof envelope - no blank line after header")
+	}
+	header, proof := string(data[:i]), data[i+2:]
+	lines := strings.Split(header, "\n")
+	if lines[0] != ProofHeaderV0 {
+		return fmt.Errorf("invalid proof envelope - unknown header %q", lines[0])
+	}
+
+	fields := make(map[string]string)
+	for _, l := range lines[1:] {
+		f := strings.SplitN(l, " ", 2)
+		if len(f) != 2 {
+			return fmt.Errorf("invalid proof envelope line %q", l)
+		}
+		if _, ok := fields[f[0]]; ok {
+			return fmt.Errorf("invalid proof envelope - repeated %q", f[0])
+		}
+		fields[f[0]] = f[1]
+	}
+	// pop removes and returns the named numeric field.
+	pop := func(k string) (uint64, error) {
+		v, ok := fields[k]
+		if !ok {
+			return 0, fmt.Errorf("invalid proof envelope - missing %q", k)
+		}
+		delete(fields, k)
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid proof envelope - invalid %q: %w", k, err)
+		}
+		return n, nil
+	}
+
+	r := ProofEnvelope{
+		Type:          ProofType(fields["Type"]),
+		HashAlgorithm: fields["Hash"],
+	}
+	delete(fields, "Type")
+	delete(fields, "Hash")
+	if len(r.HashAlgorithm) == 0 {
+		return errors.New("invalid proof envelope - missing \"Hash\"")
+	}
+	var err error
+	switch r.Type {
+	case InclusionProof:
+		if r.LeafIndex, err = pop("LeafIndex"); err != nil {
+			return err
+		}
+		if r.TreeSize, err = pop("TreeSize"); err != nil {
+			return err
+		}
+	case ConsistencyProof:
+		if r.FromSize, err = pop("FromSize"); err != nil {
+			return err
+		}
+		if r.ToSize, err = pop("ToSize"); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid proof envelope - unknown type %q", r.Type)
+	}
+	if len(fields) > 0 {
+		extra := make([]string, 0, len(fields))
+		for k := range fields {
+			extra = append(extra, k)
+		}
+		sort.Strings(extra)
+		return fmt.Errorf("invalid proof envelope - unexpected %q for %s proof", extra, r.Type)
+	}
+	if len(proof) > 0 {
+		if err := r.Proof.Unmarshal(proof); err != nil {
+			return err
+		}
+	}
+	*e = r
+	return nil
+}
+
+// VerifyInclusion verifies that the envelope holds a valid inclusion proof
+// for leafHash in the tree with the given root hash.
+func (e ProofEnvelope) VerifyInclusion(leafHash, root []byte) error {
+	if e.Type != InclusionProof {
+		return fmt.Errorf("want %s proof, got %s", InclusionProof, e.Type)
+	}
+	lv, err := e.verifier()
+	if err != nil {
+		return err
+	}
+	return lv.VerifyInclusionProof(int64(e.LeafIndex), int64(e.TreeSize), e.Proof, root, leafHash)
+}
+
+// VerifyConsistency verifies that the envelope holds a valid consistency
+// proof between trees with the given root hashes.
+func (e ProofEnvelope) VerifyConsistency(fromRoot, toRoot []byte) error {
+	if e.Type != ConsistencyProof {
+		return fmt.Errorf("want %s proof, got %s", ConsistencyProof, e.Type)
+	}
+	lv, err := e.verifier()
+	if err != nil {
+		return err
+	}
+	return lv.VerifyConsistencyProof(int64(e.FromSize), int64(e.ToSize), fromRoot, toRoot, e.Proof)
+}
+
+// verifier returns a LogVerifier for the envelope's hash algorithm.
+func (e ProofEnvelope) verifier() (logverifier.LogVerifier, error) {
+	h, ok := proofHashers[e.HashAlgorithm]
+	if !ok {
+		return logverifier.LogVerifier{}, fmt.Errorf("unsupported hash algorithm %q", e.HashAlgorithm)
+	}
+	return logverifier.New(h), nil
+}
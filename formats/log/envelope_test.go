@@ -0,0 +1,145 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/trillian-examples/formats/log"
+	"github.com/google/trillian/merkle/rfc6962/hasher"
+)
+
+func TestProofEnvelopeRoundTrip(t *testing.T) {
+	for _, test := range []struct {
+		desc string
+		e    log.ProofEnvelope
+		want string
+	}{
+		{
+			desc: "inclusion",
+			e: log.ProofEnvelope{
+				Type:          log.InclusionProof,
+				HashAlgorithm: log.HashRFC6962SHA256,
+				LeafIndex:     2,
+				TreeSize:      3,
+				Proof:         log.Proof{[]byte("one"), []byte("two")},
+			},
+			want: "Log Proof v0\nType inclusion\nHash RFC6962-SHA256\nLeafIndex 2\nTreeSize 3\n\nb25l\ndHdv\n",
+		}, {
+			desc: "consistency",
+			e: log.ProofEnvelope{
+				Type:          log.ConsistencyProof,
+				HashAlgorithm: log.HashRFC6962SHA256,
+				FromSize:      2,
+				ToSize:        3,
+				Proof:         log.Proof{[]byte("one")},
+			},
+			want: "Log Proof v0\nType consistency\nHash RFC6962-SHA256\nFromSize 2\nToSize 3\n\nb25l\n",
+		}, {
+			desc: "empty proof",
+			e: log.ProofEnvelope{
+				Type:          log.InclusionProof,
+				HashAlgorithm: log.HashRFC6962SHA256,
+				TreeSize:      1,
+			},
+			want: "Log Proof v0\nType inclusion\nHash RFC6962-SHA256\nLeafIndex 0\nTreeSize 1\n\n",
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			got, err := test.e.Marshal()
+			if err != nil {
+				t.Fatalf("Marshal = %v", err)
+			}
+			if string(got) != test.want {
+				t.Fatalf("Marshal = %q, want %q", got, test.want)
+			}
+			var e log.ProofEnvelope
+			if err := e.Unmarshal(got); err != nil {
+				t.Fatalf("Unmarshal = %v", err)
+			}
+			if diff := cmp.Diff(test.e, e); len(diff) != 0 {
+				t.Errorf("Unmarshal returned diff: %s", diff)
+			}
+		})
+	}
+}
+
+func TestProofEnvelopeUnmarshalErrors(t *testing.T) {
+	for _, test := range []struct {
+		desc string
+		data string
+	}{
+		{desc: "no header", data: "b25l\n"},
+		{desc: "wrong header", data: "Log Proof v9\nType inclusion\nHash RFC6962-SHA256\nLeafIndex 0\nTreeSize 1\n\n"},
+		{desc: "unknown type", data: "Log Proof v0\nType exclusion\nHash RFC6962-SHA256\n\n"},
+		{desc: "missing hash", data: "Log Proof v0\nType inclusion\nLeafIndex 0\nTreeSize 1\n\n"},
+		{desc: "missing size", data: "Log Proof v0\nType inclusion\nHash RFC6962-SHA256\nLeafIndex 0\n\n"},
+		{desc: "invalid size", data: "Log Proof v0\nType inclusion\nHash RFC6962-SHA256\nLeafIndex 0\nTreeSize -1\n\n"},
+		{desc: "repeated field", data: "Log Proof v0\nType inclusion\nHash RFC6962-SHA256\nLeafIndex 0\nLeafIndex 0\nTreeSize 1\n\n"},
+		{desc: "wrong fields for type", data: "Log Proof v0\nType consistency\nHash RFC6962-SHA256\nFromSize 1\nToSize 2\nLeafIndex 0\n\n"},
+		{desc: "bad proof", data: "Log Proof v0\nType consistency\nHash RFC6962-SHA256\nFromSize 1\nToSize 2\n\n!!!\n"},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			var e log.ProofEnvelope
+			if err := e.Unmarshal([]byte(test.data)); err == nil {
+				t.Error("Unmarshal = nil, want error")
+			}
+		})
+	}
+}
+
+func TestProofEnvelopeVerify(t *testing.T) {
+	h := hasher.DefaultHasher
+	a, b, c := h.HashLeaf([]byte("a")), h.HashLeaf([]byte("b")), h.HashLeaf([]byte("c"))
+	ab := h.HashChildren(a, b)
+	abc := h.HashChildren(ab, c)
+
+	incl := log.ProofEnvelope{
+		Type:          log.InclusionProof,
+		HashAlgorithm: log.HashRFC6962SHA256,
+		LeafIndex:     2,
+		TreeSize:      3,
+		Proof:         log.Proof{ab},
+	}
+	if err := incl.VerifyInclusion(c, abc); err != nil {
+		t.Errorf("VerifyInclusion = %v", err)
+	}
+	if err := incl.VerifyInclusion(a, abc); err == nil {
+		t.Error("VerifyInclusion(wrong leaf) = nil, want error")
+	}
+	if err := incl.VerifyConsistency(ab, abc); err == nil {
+		t.Error("VerifyConsistency(inclusion proof) = nil, want error")
+	}
+
+	cons := log.ProofEnvelope{
+		Type:          log.ConsistencyProof,
+		HashAlgorithm: log.HashRFC6962SHA256,
+		FromSize:      2,
+		ToSize:        3,
+		Proof:         log.Proof{c},
+	}
+	if err := cons.VerifyConsistency(ab, abc); err != nil {
+		t.Errorf("VerifyConsistency = %v", err)
+	}
+	if err := cons.VerifyConsistency(abc, abc); err == nil {
+		t.Error("VerifyConsistency(wrong root) = nil, want error")
+	}
+
+	cons.HashAlgorithm = "MD5"
+	if err := cons.VerifyConsistency(ab, abc); err == nil {
+		t.Error("VerifyConsistency(unknown hash) = nil, want error")
+	}
+}
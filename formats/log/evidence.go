@@ -0,0 +1,232 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/trillian/merkle/hashers"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// EvidenceHeaderV0 is the first line of a v0 equivocation evidence bundle.
+const EvidenceHeaderV0 = "Log Equivocation Evidence v0"
+
+// Evidence is a portable, self-contained demonstration that a log has
+// equivocated, i.e. signed two checkpoints which cannot both describe the
+// same append-only log.
+//
+// There are two forms of evidence:
+//   - two checkpoints of the same size with different root hashes, in which
+//     case HashAlgorithm and Proof must be empty.
+//   - two checkpoints of different sizes along with an inconsistency proof.
+//
+// An inconsistency proof is an RFC 6962 consistency proof path between the
+// two checkpoints, except that it always begins with the hash of the subtree
+// of the larger tree which covers the first FromSize leaves, even when
+// FromSize is a power of two and a consistency proof would omit it. Since the
+// proof reconstructs the larger checkpoint's root hash, its nodes are bound
+// to the larger tree, so a proof which then fails to reconstruct the smaller
+// checkpoint's root demonstrates that the log has forked. Note that a
+// consistency proof which simply fails to verify is not evidence on its own,
+// as anyone can construct one.
+//
+// The serialised form is:
+//
+//	Log Equivocation Evidence v0
+//	Checkpoint <base64 signed checkpoint envelope>
+//	Checkpoint <base64 signed checkpoint envelope>
+//	Hash <hash algorithm>   (inconsistency proofs only)
+//
+//	<base64 proof hashes, one per line>
+type Evidence struct {
+	// Checkpoints holds the two conflicting signed checkpoint envelopes, in
+	// either order.
+	Checkpoints [2][]byte
+	// HashAlgorithm identifies how the tree is hashed, e.g. HashRFC6962SHA256.
+	HashAlgorithm string
+	// Proof holds the inconsistency proof, if the checkpoints differ in size.
+	Proof Proof
+}
+
+// Marshal returns the serialised form of the evidence.
+func (e Evidence) Marshal() ([]byte, error) {
+	if (len(e.HashAlgorithm) == 0) != (len(e.Proof) == 0) {
+		return nil, errors.New("hash algorithm must be set if and only if there is a proof")
+	}
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "%s\n", EvidenceHeaderV0)
+	for _, c := range e.Checkpoints {
+		if len(c) == 0 {
+			return nil, errors.New("missing checkpoint")
+		}
+		fmt.Fprintf(b, "Checkpoint %s\n", base64.StdEncoding.EncodeToString(c))
+	}
+	if len(e.HashAlgorithm) > 0 {
+		fmt.Fprintf(b, "Hash %s\n", e.HashAlgorithm)
+	}
+	b.WriteString("\n")
+	b.WriteString(e.Proof.Marshal())
+	return b.Bytes(), nil
+}
+
+// Unmarshal parses serialised evidence and stores the result in e.
+//
+// This only checks the structure of the evidence; use Verify to check that
+// it really does demonstrate misbehaviour.
+func (e *Evidence) Unmarshal(data []byte) error {
+	i := bytes.Index(data, []byte("\n\n"))
+	if i < 0 {
+		return errors.New("invalid evidence - no blank line after header")
+	}
+	header, proof := string(data[:i]), data[i+2:]
+	lines := strings.Split(header, "\n")
+	if lines[0] != EvidenceHeaderV0 {
+		return fmt.Errorf("invalid evidence - unknown header %q", lines[0])
+	}
+
+	var r Evidence
+	var nCP int
+	for _, l := range lines[1:] {
+		f := strings.SplitN(l, " ", 2)
+		if len(f) != 2 {
+			return fmt.Errorf("invalid evidence line %q", l)
+		}
+		switch f[0] {
+		case "Checkpoint":
+			if nCP == len(r.Checkpoints) {
+				return errors.New("invalid evidence - too many checkpoints")
+			}
+			c, err := base64.StdEncoding.DecodeString(f[1])
+			if err != nil || len(c) == 0 {
+				return fmt.Errorf("invalid evidence - bad checkpoint %q", f[1])
+			}
+			r.Checkpoints[nCP] = c
+			nCP++
+		case "Hash":
+			if len(r.HashAlgorithm) > 0 {
+				return errors.New("invalid evidence - repeated \"Hash\"")
+			}
+			r.HashAlgorithm = f[1]
+		default:
+			return fmt.Errorf("invalid evidence - unexpected %q", f[0])
+		}
+	}
+	if nCP != len(r.Checkpoints) {
+		return fmt.Errorf("invalid evidence - got %d checkpoints, want %d", nCP, len(r.Checkpoints))
+	}
+	if len(proof) > 0 {
+		if err := r.Proof.Unmarshal(proof); err != nil {
+			return err
+		}
+	}
+	if (len(r.HashAlgorithm) == 0) != (len(r.Proof) == 0) {
+		return errors.New("invalid evidence - \"Hash\" must be present if and only if there is a proof")
+	}
+	*e = r
+	return nil
+}
+
+// Verify checks that the evidence demonstrates that the log identified by
+// logVerifier has misbehaved, returning nil only if it does.
+func (e Evidence) Verify(logVerifier note.Verifier) error {
+	var cps [2]*SignedCheckpoint
+	for i, raw := range e.Checkpoints {
+		c, err := ParseSignedCheckpoint(raw, logVerifier)
+		if err != nil {
+			return fmt.Errorf("checkpoint %d: %w", i, err)
+		}
+		cps[i] = c
+	}
+	a, b := cps[0], cps[1]
+	if a.Ecosystem != b.Ecosystem {
+		return fmt.Errorf("checkpoints are from different ecosystems %q and %q", a.Ecosystem, b.Ecosystem)
+	}
+
+	if a.Size == b.Size {
+		if len(e.Proof) > 0 {
+			return errors.New("unexpected proof for checkpoints of the same size")
+		}
+		if bytes.Equal(a.Hash, b.Hash) {
+			return fmt.Errorf("checkpoints of size %d have the same root hash", a.Size)
+		}
+		return nil
+	}
+
+	if a.Size > b.Size {
+		a, b = b, a
+	}
+	if a.Size == 0 {
+		return errors.New("an empty tree is consistent with every other tree")
+	}
+	h, ok := proofHashers[e.HashAlgorithm]
+	if !ok {
+		return fmt.Errorf("unsupported hash algorithm %q", e.HashAlgorithm)
+	}
+	fromRoot, toRoot, err := rootsFromInconsistencyProof(h, a.Size, b.Size, e.Proof)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(toRoot, b.Hash) {
+		return fmt.Errorf("proof does not match the root hash of the size %d checkpoint", b.Size)
+	}
+	if bytes.Equal(fromRoot, a.Hash) {
+		return fmt.Errorf("proof shows that the checkpoints of size %d and %d are consistent", a.Size, b.Size)
+	}
+	return nil
+}
+
+// rootsFromInconsistencyProof computes the root hashes of the trees of size
+// m and n which are implied by an inconsistency proof between them, following
+// the consistency proof verification algorithm of RFC 9162 section 2.1.4.2.
+func rootsFromInconsistencyProof(h hashers.LogHasher, m, n uint64, proof Proof) ([]byte, []byte, error) {
+	if m == 0 || m >= n {
+		return nil, nil, fmt.Errorf("invalid sizes %d and %d", m, n)
+	}
+	if len(proof) == 0 {
+		return nil, nil, errors.New("empty proof")
+	}
+	fn, sn := m-1, n-1
+	for fn&1 == 1 {
+		fn >>= 1
+		sn >>= 1
+	}
+	fr, sr := proof[0], proof[0]
+	for _, c := range proof[1:] {
+		if sn == 0 {
+			return nil, nil, errors.New("proof too long")
+		}
+		if fn&1 == 1 || fn == sn {
+			fr = h.HashChildren(c, fr)
+			sr = h.HashChildren(c, sr)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			sr = h.HashChildren(sr, c)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 {
+		return nil, nil, errors.New("proof too short")
+	}
+	return fr, sr, nil
+}
@@ -0,0 +1,276 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/trillian-examples/formats/log"
+	"github.com/google/trillian/merkle/rfc6962/hasher"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// mth returns the RFC 6962 Merkle tree hash of leaves.
+func mth(leaves [][]byte) []byte {
+	h := hasher.DefaultHasher
+	if len(leaves) == 0 {
+		return h.EmptyRoot()
+	}
+	if len(leaves) == 1 {
+		return h.HashLeaf(leaves[0])
+	}
+	k := split(len(leaves))
+	return h.HashChildren(mth(leaves[:k]), mth(leaves[k:]))
+}
+
+// split returns the largest power of two smaller than n.
+func split(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+// inconsistencyProof returns the RFC 6962 consistency proof from the first m
+// leaves to all of leaves, including the hash of the first m leaves even when
+// m is a power of two.
+func inconsistencyProof(m int, leaves [][]byte) log.Proof {
+	var sub func(m int, leaves [][]byte, b bool) log.Proof
+	sub = func(m int, leaves [][]byte, b bool) log.Proof {
+		n := len(leaves)
+		if m == n {
+			if b {
+				return nil
+			}
+			return log.Proof{mth(leaves)}
+		}
+		k := split(n)
+		if m <= k {
+			return append(sub(m, leaves[:k], b), mth(leaves[k:]))
+		}
+		return append(sub(m-k, leaves[k:], false), mth(leaves[:k]))
+	}
+	return sub(m, leaves, false)
+}
+
+func leaves(prefix string, n int) [][]byte {
+	r := make([][]byte, n)
+	for i := range r {
+		r[i] = []byte(fmt.Sprintf("%s %d", prefix, i))
+	}
+	return r
+}
+
+func signedCheckpoint(t *testing.T, s note.Signer, size int, root []byte) []byte {
+	t.Helper()
+	sc, err := log.SignCheckpoint(log.Checkpoint{Ecosystem: "Log Checkpoint v0", Size: uint64(size), Hash: root}, nil, s)
+	if err != nil {
+		t.Fatalf("SignCheckpoint = %v", err)
+	}
+	return sc.Marshal()
+}
+
+func TestEvidenceRoundTrip(t *testing.T) {
+	for _, e := range []log.Evidence{
+		{Checkpoints: [2][]byte{[]byte("one\n"), []byte("two\n")}},
+		{Checkpoints: [2][]byte{[]byte("one\n"), []byte("two\n")}, HashAlgorithm: log.HashRFC6962SHA256, Proof: log.Proof{[]byte("a"), []byte("b")}},
+	} {
+		raw, err := e.Marshal()
+		if err != nil {
+			t.Fatalf("Marshal = %v", err)
+		}
+		var got log.Evidence
+		if err := got.Unmarshal(raw); err != nil {
+			t.Fatalf("Unmarshal(%q) = %v", raw, err)
+		}
+		if diff := cmp.Diff(e, got); len(diff) != 0 {
+			t.Errorf("Unmarshal(%q) returned diff: %s", raw, diff)
+		}
+	}
+}
+
+func TestEvidenceUnmarshalErrors(t *testing.T) {
+	for _, test := range []struct {
+		desc string
+		data string
+	}{
+		{desc: "no header", data: "Checkpoint b25l\nCheckpoint dHdv\n\n"},
+		{desc: "no blank line", data: "Log Equivocation Evidence v0\nCheckpoint b25l\nCheckpoint dHdv\n"},
+		{desc: "one checkpoint", data: "Log Equivocation Evidence v0\nCheckpoint b25l\n\n"},
+		{desc: "three checkpoints", data: "Log Equivocation Evidence v0\nCheckpoint b25l\nCheckpoint dHdv\nCheckpoint dHdv\n\n"},
+		{desc: "bad checkpoint", data: "Log Equivocation Evidence v0\nCheckpoint !!!\nCheckpoint dHdv\n\n"},
+		{desc: "unknown field", data: "Log Equivocation Evidence v0\nCheckpoint b25l\nCheckpoint dHdv\nTreeSize 1\n\n"},
+		{desc: "proof without hash", data: "Log Equivocation Evidence v0\nCheckpoint b25l\nCheckpoint dHdv\n\nb25l\n"},
+		{desc: "hash without proof", data: "Log Equivocation Evidence v0\nCheckpoint b25l\nCheckpoint dHdv\nHash RFC6962-SHA256\n\n"},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			var e log.Evidence
+			if err := e.Unmarshal([]byte(test.data)); err == nil {
+				t.Error("Unmarshal = nil, want error")
+			}
+		})
+	}
+}
+
+func TestEvidenceVerify(t *testing.T) {
+	logS, logV := newKeys(t, "log")
+	otherS, _ := newKeys(t, "other")
+	honest := leaves("honest", 20)
+	forked := append(append([][]byte{}, honest[:5]...), leaves("forked", 15)...)
+
+	for _, test := range []struct {
+		desc    string
+		e       log.Evidence
+		wantErr bool
+	}{
+		{
+			desc: "same size fork",
+			e: log.Evidence{Checkpoints: [2][]byte{
+				signedCheckpoint(t, logS, 10, mth(honest[:10])),
+				signedCheckpoint(t, logS, 10, mth(forked[:10])),
+			}},
+		}, {
+			desc: "same size same root",
+			e: log.Evidence{Checkpoints: [2][]byte{
+				signedCheckpoint(t, logS, 10, mth(honest[:10])),
+				signedCheckpoint(t, logS, 10, mth(honest[:10])),
+			}},
+			wantErr: true,
+		}, {
+			desc: "wrong signer",
+			e: log.Evidence{Checkpoints: [2][]byte{
+				signedCheckpoint(t, logS, 10, mth(honest[:10])),
+				signedCheckpoint(t, otherS, 10, mth(forked[:10])),
+			}},
+			wantErr: true,
+		}, {
+			desc: "fork",
+			e: log.Evidence{
+				Checkpoints: [2][]byte{
+					signedCheckpoint(t, logS, 7, mth(honest[:7])),
+					signedCheckpoint(t, logS, 20, mth(forked)),
+				},
+				HashAlgorithm: log.HashRFC6962SHA256,
+				Proof:         inconsistencyProof(7, forked),
+			},
+		}, {
+			desc: "fork from power of two size, reversed",
+			e: log.Evidence{
+				Checkpoints: [2][]byte{
+					signedCheckpoint(t, logS, 20, mth(forked)),
+					signedCheckpoint(t, logS, 8, mth(honest[:8])),
+				},
+				HashAlgorithm: log.HashRFC6962SHA256,
+				Proof:         inconsistencyProof(8, forked),
+			},
+		}, {
+			desc: "consistent",
+			e: log.Evidence{
+				Checkpoints: [2][]byte{
+					signedCheckpoint(t, logS, 7, mth(honest[:7])),
+					signedCheckpoint(t, logS, 20, mth(honest)),
+				},
+				HashAlgorithm: log.HashRFC6962SHA256,
+				Proof:         inconsistencyProof(7, honest),
+			},
+			wantErr: true,
+		}, {
+			desc: "proof not from larger tree",
+			e: log.Evidence{
+				Checkpoints: [2][]byte{
+					signedCheckpoint(t, logS, 7, mth(honest[:7])),
+					signedCheckpoint(t, logS, 20, mth(honest)),
+				},
+				HashAlgorithm: log.HashRFC6962SHA256,
+				Proof:         inconsistencyProof(7, forked),
+			},
+			wantErr: true,
+		}, {
+			desc: "truncated proof",
+			e: log.Evidence{
+				Checkpoints: [2][]byte{
+					signedCheckpoint(t, logS, 7, mth(honest[:7])),
+					signedCheckpoint(t, logS, 20, mth(forked)),
+				},
+				HashAlgorithm: log.HashRFC6962SHA256,
+				Proof:         inconsistencyProof(7, forked)[1:],
+			},
+			wantErr: true,
+		}, {
+			desc: "missing proof",
+			e: log.Evidence{Checkpoints: [2][]byte{
+				signedCheckpoint(t, logS, 7, mth(honest[:7])),
+				signedCheckpoint(t, logS, 20, mth(forked)),
+			}},
+			wantErr: true,
+		}, {
+			desc: "empty tree",
+			e: log.Evidence{
+				Checkpoints: [2][]byte{
+					signedCheckpoint(t, logS, 0, []byte("not the empty root")),
+					signedCheckpoint(t, logS, 20, mth(forked)),
+				},
+				HashAlgorithm: log.HashRFC6962SHA256,
+				Proof:         log.Proof{mth(forked)},
+			},
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			// Verification should survive a round trip.
+			raw, err := test.e.Marshal()
+			if err != nil {
+				t.Fatalf("Marshal = %v", err)
+			}
+			var e log.Evidence
+			if err := e.Unmarshal(raw); err != nil {
+				t.Fatalf("Unmarshal = %v", err)
+			}
+			if err := e.Verify(logV); (err != nil) != test.wantErr {
+				t.Errorf("Verify = %v, want error %t", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestInconsistencyProofOfHonestLog(t *testing.T) {
+	// Proofs between states of an honest log must never be accepted as
+	// evidence, and must be rejected because the roots match.
+	logS, logV := newKeys(t, "log")
+	all := leaves("leaf", 33)
+	for n := 2; n <= len(all); n++ {
+		for m := 1; m < n; m++ {
+			e := log.Evidence{
+				Checkpoints: [2][]byte{
+					signedCheckpoint(t, logS, m, mth(all[:m])),
+					signedCheckpoint(t, logS, n, mth(all[:n])),
+				},
+				HashAlgorithm: log.HashRFC6962SHA256,
+				Proof:         inconsistencyProof(m, all[:n]),
+			}
+			if err := e.Verify(logV); err == nil {
+				t.Fatalf("Verify(%d, %d) = nil, want error", m, n)
+			}
+			// Corrupting the smaller checkpoint's root must give evidence.
+			e.Checkpoints[0] = signedCheckpoint(t, logS, m, mth(all[1:m+1]))
+			if err := e.Verify(logV); err != nil {
+				t.Fatalf("Verify(%d, %d) with forked smaller tree = %v", m, n, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Native fuzzing needs testing.F, which was added in Go 1.18. The module still
+// supports older toolchains, so these tests are only built with Go 1.18+.
+
+//go:build go1.18
+// +build go1.18
+
+package log_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/trillian-examples/formats/log"
+)
+
+// The seed corpora for these fuzz tests live in testdata/fuzz, and are run as
+// regular tests by `go test`. To fuzz, run e.g.:
+//   go test ./formats/log -fuzz FuzzCheckpoint
+
+// FuzzCheckpoint checks that strictly parsed checkpoints round-trip exactly,
+// and that anything accepted by the lenient parser can be re-marshalled into
+// a form accepted by the strict parser.
+func FuzzCheckpoint(f *testing.F) {
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var strict log.Checkpoint
+		if rest, err := strict.UnmarshalStrict(data); err == nil {
+			if m := append(strict.Marshal(), rest...); !bytes.Equal(m, data) {
+				t.Fatalf("Strict round trip of %q gave %q", data, m)
+			}
+		}
+
+		var lenient log.Checkpoint
+		if _, err := lenient.Unmarshal(data); err != nil {
+			return
+		}
+		if err := validEcosystem(lenient.Ecosystem); err != nil {
+			// The lenient parser allows ecosystems which can never be canonical.
+			return
+		}
+		var again log.Checkpoint
+		if _, err := again.UnmarshalStrict(lenient.Marshal()); err != nil {
+			t.Fatalf("UnmarshalStrict(Marshal(%q)) = %v", data, err)
+		}
+		if diff := cmp.Diff(lenient, again); len(diff) != 0 {
+			t.Fatalf("Re-parsed checkpoint differs: %s", diff)
+		}
+	})
+}
+
+// validEcosystem checks an ecosystem string by attempting to strictly parse a
+// checkpoint which uses it.
+func validEcosystem(eco string) error {
+	var c log.Checkpoint
+	_, err := c.UnmarshalStrict(log.Checkpoint{Ecosystem: eco}.Marshal())
+	return err
+}
+
+// FuzzProof checks that strictly parsed proofs round-trip exactly, and that
+// anything accepted by the lenient parser survives re-marshalling.
+func FuzzProof(f *testing.F) {
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var strict log.Proof
+		if err := strict.UnmarshalStrict(data); err == nil {
+			if m := strict.Marshal(); m != string(data) {
+				t.Fatalf("Strict round trip of %q gave %q", data, m)
+			}
+		}
+
+		var lenient log.Proof
+		if err := lenient.Unmarshal(data); err != nil {
+			return
+		}
+		var again log.Proof
+		if err := again.Unmarshal([]byte(lenient.Marshal())); err != nil {
+			t.Fatalf("Unmarshal(Marshal(%q)) = %v", data, err)
+		}
+		if diff := cmp.Diff(lenient, again); len(diff) != 0 {
+			t.Fatalf("Re-parsed proof differs: %s", diff)
+		}
+	})
+}
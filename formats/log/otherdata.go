@@ -0,0 +1,326 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Extension is a single typed line of checkpoint otherdata, of the form:
+//
+//	<keyword> <value>
+//
+// or just <keyword> if the value is empty.
+type Extension interface {
+	// Keyword returns the first word of the extension's line, which
+	// identifies its type.
+	Keyword() string
+	// MarshalValue returns the remainder of the extension's line.
+	MarshalValue() string
+}
+
+// ExtensionType describes how to parse one type of Extension.
+type ExtensionType struct {
+	// Keyword is the first word of lines of this type.
+	Keyword string
+	// Repeatable is true if more than one line of this type may be present.
+	Repeatable bool
+	// Parse parses the value of a line of this type.
+	Parse func(value string) (Extension, error)
+}
+
+// Registry holds the set of ExtensionTypes understood by an ecosystem.
+type Registry struct {
+	types map[string]ExtensionType
+}
+
+// NewRegistry creates a Registry which understands the given types.
+func NewRegistry(types ...ExtensionType) (*Registry, error) {
+	r := &Registry{types: make(map[string]ExtensionType)}
+	for _, t := range types {
+		if err := validateKeyword(t.Keyword); err != nil {
+			return nil, err
+		}
+		if _, ok := r.types[t.Keyword]; ok {
+			return nil, fmt.Errorf("duplicate extension type %q", t.Keyword)
+		}
+		r.types[t.Keyword] = t
+	}
+	return r, nil
+}
+
+// Parse parses checkpoint otherdata, as returned by Checkpoint.Unmarshal, into
+// a list of Extensions.
+//
+// Lines whose keyword isn't known to the registry are returned as Unknown
+// extensions so that they can be preserved.
+func (r *Registry) Parse(otherData []byte) (Extensions, error) {
+	if err := ValidateOtherData(otherData); err != nil {
+		return nil, err
+	}
+	if len(otherData) == 0 {
+		return nil, nil
+	}
+	var ret Extensions
+	seen := make(map[string]bool)
+	for _, l := range strings.Split(strings.TrimSuffix(string(otherData), "\n"), "\n") {
+		kw, v := splitLine(l)
+		t, ok := r.types[kw]
+		if !ok {
+			ret = append(ret, Unknown{Line: l})
+			continue
+		}
+		if seen[kw] && !t.Repeatable {
+			return nil, fmt.Errorf("multiple %q lines", kw)
+		}
+		seen[kw] = true
+		e, err := t.Parse(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %q line: %w", kw, err)
+		}
+		ret = append(ret, e)
+	}
+	return ret, nil
+}
+
+// Extensions is an ordered list of checkpoint otherdata lines.
+type Extensions []Extension
+
+// Find returns the first extension with the given keyword, or nil if there
+// is none.
+func (e Extensions) Find(keyword string) Extension {
+	for _, x := range e {
+		if x.Keyword() == keyword {
+			return x
+		}
+	}
+	return nil
+}
+
+// Marshal returns the checkpoint otherdata representation of the extensions.
+func (e Extensions) Marshal() ([]byte, error) {
+	b := &bytes.Buffer{}
+	for _, x := range e {
+		l := x.Keyword()
+		if u, ok := x.(Unknown); ok {
+			l = u.Line
+		} else {
+			if err := validateKeyword(l); err != nil {
+				return nil, err
+			}
+			if v := x.MarshalValue(); len(v) > 0 {
+				l += " " + v
+			}
+		}
+		if strings.Contains(l, "\n") {
+			return nil, fmt.Errorf("%q extension contains a newline", x.Keyword())
+		}
+		b.WriteString(l)
+		b.WriteString("\n")
+	}
+	if err := ValidateOtherData(b.Bytes()); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// ValidateOtherData checks that checkpoint otherdata conforms to the signed
+// note format: it must be valid UTF-8 containing no control characters other
+// than newlines, and consist of non-empty lines each terminated by a newline.
+func ValidateOtherData(otherData []byte) error {
+	if len(otherData) == 0 {
+		return nil
+	}
+	if !bytes.HasSuffix(otherData, []byte("\n")) {
+		return errors.New("otherdata must end with a newline")
+	}
+	for i := 0; i < len(otherData); {
+		r, size := utf8.DecodeRune(otherData[i:])
+		if r == utf8.RuneError && size == 1 {
+			return errors.New("otherdata is not valid UTF-8")
+		}
+		if r < 0x20 && r != '\n' {
+			return fmt.Errorf("otherdata contains control character %U", r)
+		}
+		i += size
+	}
+	if otherData[0] == '\n' || bytes.Contains(otherData, []byte("\n\n")) {
+		return errors.New("otherdata must not contain blank lines")
+	}
+	return nil
+}
+
+func validateKeyword(kw string) error {
+	if len(kw) == 0 || strings.ContainsAny(kw, " \n") {
+		return fmt.Errorf("invalid extension keyword %q", kw)
+	}
+	return nil
+}
+
+// splitLine splits an otherdata line into its keyword and value.
+func splitLine(l string) (string, string) {
+	i := strings.Index(l, " ")
+	if i < 0 {
+		return l, ""
+	}
+	return l[:i], l[i+1:]
+}
+
+// parseCanonicalUint parses a decimal number which must be in its canonical
+// form, i.e. without a sign or leading zeros.
+func parseCanonicalUint(v string, bitSize int) (uint64, error) {
+	n, err := strconv.ParseUint(v, 10, bitSize)
+	if err != nil {
+		return 0, err
+	}
+	if strconv.FormatUint(n, 10) != v {
+		return 0, fmt.Errorf("%q is not in canonical form", v)
+	}
+	return n, nil
+}
+
+// Unknown is an otherdata line which isn't understood by the Registry which
+// parsed it.
+type Unknown struct {
+	Line string
+}
+
+// Keyword returns the first word of the line.
+func (u Unknown) Keyword() string {
+	kw, _ := splitLine(u.Line)
+	return kw
+}
+
+// MarshalValue returns the remainder of the line.
+func (u Unknown) MarshalValue() string {
+	_, v := splitLine(u.Line)
+	return v
+}
+
+// Timestamp records the time at which a checkpoint was created, as decimal
+// nanoseconds since the Unix epoch.
+type Timestamp struct {
+	Time time.Time
+}
+
+// Keyword implements Extension.
+func (Timestamp) Keyword() string { return TimestampExtension.Keyword }
+
+// MarshalValue implements Extension.
+func (t Timestamp) MarshalValue() string { return strconv.FormatInt(t.Time.UnixNano(), 10) }
+
+// TimestampExtension is the ExtensionType for Timestamp.
+var TimestampExtension = ExtensionType{
+	Keyword: "Timestamp",
+	Parse: func(v string) (Extension, error) {
+		// Timestamps before the epoch can't be represented, so the value
+		// must fit in the non-negative range of an int64.
+		ns, err := parseCanonicalUint(v, 63)
+		if err != nil {
+			return nil, err
+		}
+		return Timestamp{Time: time.Unix(0, int64(ns))}, nil
+	},
+}
+
+// Origin identifies the log which issued a checkpoint.
+type Origin struct {
+	Name string
+}
+
+// Keyword implements Extension.
+func (Origin) Keyword() string { return OriginExtension.Keyword }
+
+// MarshalValue implements Extension.
+func (o Origin) MarshalValue() string { return o.Name }
+
+// OriginExtension is the ExtensionType for Origin.
+var OriginExtension = ExtensionType{
+	Keyword: "Origin",
+	Parse: func(v string) (Extension, error) {
+		if len(v) == 0 {
+			return nil, errors.New("empty origin")
+		}
+		return Origin{Name: v}, nil
+	},
+}
+
+// PreviousRoot identifies an earlier checkpoint issued by the same log, of
+// the form "<decimal size> <base64 root hash>".
+type PreviousRoot struct {
+	Size uint64
+	Hash []byte
+}
+
+// Keyword implements Extension.
+func (PreviousRoot) Keyword() string { return PreviousRootExtension.Keyword }
+
+// MarshalValue implements Extension.
+func (p PreviousRoot) MarshalValue() string {
+	return fmt.Sprintf("%d %s", p.Size, base64.StdEncoding.EncodeToString(p.Hash))
+}
+
+// PreviousRootExtension is the ExtensionType for PreviousRoot.
+var PreviousRootExtension = ExtensionType{
+	Keyword: "PreviousRoot",
+	Parse: func(v string) (Extension, error) {
+		f := strings.Split(v, " ")
+		if len(f) != 2 {
+			return nil, fmt.Errorf("want 2 fields, got %d", len(f))
+		}
+		size, err := parseCanonicalUint(f[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid size: %w", err)
+		}
+		hash, err := base64.StdEncoding.DecodeString(f[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid hash: %w", err)
+		}
+		return PreviousRoot{Size: size, Hash: hash}, nil
+	},
+}
+
+// KeyValue is a free-form "<key> <value>" pair, for ecosystem-specific data
+// which doesn't warrant its own type.
+type KeyValue struct {
+	Key   string
+	Value string
+}
+
+// Keyword implements Extension.
+func (KeyValue) Keyword() string { return KeyValueExtension.Keyword }
+
+// MarshalValue implements Extension.
+func (kv KeyValue) MarshalValue() string { return kv.Key + " " + kv.Value }
+
+// KeyValueExtension is the ExtensionType for KeyValue.
+var KeyValueExtension = ExtensionType{
+	Keyword:    "KV",
+	Repeatable: true,
+	Parse: func(v string) (Extension, error) {
+		k, val := splitLine(v)
+		if len(k) == 0 {
+			return nil, errors.New("empty key")
+		}
+		return KeyValue{Key: k, Value: val}, nil
+	},
+}
@@ -0,0 +1,133 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/trillian-examples/formats/log"
+)
+
+func mustRegistry(t *testing.T) *log.Registry {
+	t.Helper()
+	r, err := log.NewRegistry(log.TimestampExtension, log.OriginExtension, log.PreviousRootExtension, log.KeyValueExtension)
+	if err != nil {
+		t.Fatalf("NewRegistry = %v", err)
+	}
+	return r
+}
+
+func TestRegistryParse(t *testing.T) {
+	for _, test := range []struct {
+		desc    string
+		data    string
+		want    log.Extensions
+		wantErr bool
+	}{
+		{
+			desc: "empty",
+		}, {
+			desc: "all types",
+			data: "Origin example.com/log\nTimestamp 1000000000\nPreviousRoot 10 YmFuYW5hcw==\nKV moon full\nKV tide high\nmystery line\n",
+			want: log.Extensions{
+				log.Origin{Name: "example.com/log"},
+				log.Timestamp{Time: time.Unix(1, 0)},
+				log.PreviousRoot{Size: 10, Hash: []byte("bananas")},
+				log.KeyValue{Key: "moon", Value: "full"},
+				log.KeyValue{Key: "tide", Value: "high"},
+				log.Unknown{Line: "mystery line"},
+			},
+		}, {
+			desc:    "repeated timestamp",
+			data:    "Timestamp 1\nTimestamp 2\n",
+			wantErr: true,
+		}, {
+			desc:    "invalid timestamp",
+			data:    "Timestamp yesterday\n",
+			wantErr: true,
+		}, {
+			desc:    "timestamp with sign",
+			data:    "Timestamp +5\n",
+			wantErr: true,
+		}, {
+			desc:    "timestamp with leading zeros",
+			data:    "Timestamp 007\n",
+			wantErr: true,
+		}, {
+			desc:    "negative timestamp",
+			data:    "Timestamp -5\n",
+			wantErr: true,
+		}, {
+			desc:    "previous root size with leading zeros",
+			data:    "PreviousRoot 010 YmFuYW5hcw==\n",
+			wantErr: true,
+		}, {
+			desc:    "invalid previous root",
+			data:    "PreviousRoot 10\n",
+			wantErr: true,
+		}, {
+			desc:    "blank line",
+			data:    "Origin example.com/log\n\nKV a b\n",
+			wantErr: true,
+		}, {
+			desc:    "leading blank line",
+			data:    "\nOrigin example.com/log\n",
+			wantErr: true,
+		}, {
+			desc:    "missing trailing newline",
+			data:    "Origin example.com/log",
+			wantErr: true,
+		}, {
+			desc:    "control character",
+			data:    "Origin example\t.com/log\n",
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			got, err := mustRegistry(t).Parse([]byte(test.data))
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("Parse = %v, wantErr %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(test.want, got); len(diff) != 0 {
+				t.Fatalf("Parse returned diff: %s", diff)
+			}
+			m, err := got.Marshal()
+			if err != nil {
+				t.Fatalf("Marshal = %v", err)
+			}
+			if string(m) != test.data {
+				t.Errorf("Marshal = %q, want %q", m, test.data)
+			}
+		})
+	}
+}
+
+func TestNewRegistryDuplicate(t *testing.T) {
+	if _, err := log.NewRegistry(log.OriginExtension, log.OriginExtension); err == nil {
+		t.Error("NewRegistry with duplicate types = nil, want error")
+	}
+}
+
+func TestExtensionsMarshalInvalid(t *testing.T) {
+	e := log.Extensions{log.Origin{Name: "two\nlines"}}
+	if _, err := e.Marshal(); err == nil {
+		t.Error("Marshal with newline in value = nil, want error")
+	}
+}
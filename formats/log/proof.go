@@ -59,3 +59,30 @@ func (p *Proof) Unmarshal(data []byte) error {
 	(*p) = r
 	return nil
 }
+
+// UnmarshalStrict is like Unmarshal, but additionally requires that the data
+// is in its canonical form, i.e. that the Proof would Marshal to exactly the
+// bytes which were parsed, and that it contains no empty hashes.
+//
+// Unlike Unmarshal, empty data is accepted as an empty proof, since that is
+// what an empty Proof marshals to.
+func (p *Proof) UnmarshalStrict(data []byte) error {
+	r := Proof{}
+	if len(data) == 0 {
+		*p = r
+		return nil
+	}
+	if err := r.Unmarshal(data); err != nil {
+		return err
+	}
+	for i, h := range r {
+		if len(h) == 0 {
+			return fmt.Errorf("empty proof hash on line %d", i)
+		}
+	}
+	if r.Marshal() != string(data) {
+		return errors.New("proof is not in canonical form")
+	}
+	(*p) = r
+	return nil
+}
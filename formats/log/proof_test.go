@@ -90,3 +90,38 @@ func TestUnmarshalProof(t *testing.T) {
 		})
 	}
 }
+
+func TestUnmarshalProofStrict(t *testing.T) {
+	for _, test := range []struct {
+		desc    string
+		m       string
+		wantErr bool
+	}{
+		{
+			desc: "valid",
+			m:    "b25l\ndHdv\ndGhyZWU=\n",
+		}, {
+			desc: "valid empty",
+			m:    "",
+		}, {
+			desc:    "empty hash",
+			m:       "b25l\n\ndGhyZWU=\n",
+			wantErr: true,
+		}, {
+			desc:    "non-zero base64 padding bits",
+			m:       "b25=\n",
+			wantErr: true,
+		}, {
+			desc:    "carriage return",
+			m:       "b2\r5l\n",
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			var got log.Proof
+			if err := got.UnmarshalStrict([]byte(test.m)); (err != nil) != test.wantErr {
+				t.Fatalf("UnmarshalStrict = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
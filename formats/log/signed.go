@@ -0,0 +1,164 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/mod/sumdb/note"
+)
+
+// sigPrefix starts each signature line in a signed note.
+const sigPrefix = "— "
+
+// Cosignature is a signature on a checkpoint other than the log's own.
+type Cosignature struct {
+	note.Signature
+	// Verified is true if the signature was verified by one of the
+	// cosignature verifiers passed to ParseSignedCheckpoint.
+	Verified bool
+}
+
+// SignedCheckpoint is a checkpoint along with the signed note envelope which
+// carries it.
+//
+// The first signature on the envelope is always from the log which issued the
+// checkpoint, and is followed by zero or more cosignatures, e.g. from
+// witnesses.
+type SignedCheckpoint struct {
+	Checkpoint
+	// OtherData holds any data in the checkpoint body following the hash.
+	OtherData []byte
+	// LogSignature is the log's signature over the checkpoint body.
+	LogSignature note.Signature
+	// Cosignatures holds all signatures after the log's, in the order they
+	// appear in the envelope.
+	Cosignatures []Cosignature
+}
+
+// ParseSignedCheckpoint parses and verifies a signed checkpoint envelope.
+//
+// The first signature must be a valid signature from logVerifier. Any other
+// signatures made by one of cosigVerifiers must be valid, and will be marked
+// as Verified; signatures from unknown keys are retained but unverified.
+//
+// The checkpoint body must be in its canonical form, so that Marshal
+// returns exactly the bytes which were parsed.
+func ParseSignedCheckpoint(raw []byte, logVerifier note.Verifier, cosigVerifiers ...note.Verifier) (*SignedCheckpoint, error) {
+	n, err := note.Open(raw, note.VerifierList(append([]note.Verifier{logVerifier}, cosigVerifiers...)...))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open checkpoint envelope: %w", err)
+	}
+	// note.Open drops duplicate signatures, so parse the signature lines
+	// directly in order to preserve them all.
+	sigs, err := parseSignatureLines(raw[len(n.Text)+1:])
+	if err != nil {
+		return nil, err
+	}
+	if sigs[0].Name != logVerifier.Name() || sigs[0].Hash != logVerifier.KeyHash() {
+		return nil, fmt.Errorf("first signature is from %q, not the log %q", sigs[0].Name, logVerifier.Name())
+	}
+	verified := make(map[note.Signature]bool)
+	for _, s := range n.Sigs {
+		verified[s] = true
+	}
+	// The log's verifier was given to note.Open, so its signature will have
+	// been verified if it was valid.
+	if !verified[sigs[0]] {
+		return nil, errors.New("log signature not verified")
+	}
+
+	sc := &SignedCheckpoint{LogSignature: sigs[0]}
+	for _, s := range sigs[1:] {
+		sc.Cosignatures = append(sc.Cosignatures, Cosignature{Signature: s, Verified: verified[s]})
+	}
+	rest, err := sc.Checkpoint.UnmarshalStrict([]byte(n.Text))
+	if err != nil {
+		return nil, err
+	}
+	sc.OtherData = rest
+	return sc, nil
+}
+
+// parseSignatureLines parses the signature block of a signed note, which
+// note.Open has already checked is well-formed.
+func parseSignatureLines(b []byte) ([]note.Signature, error) {
+	var ret []note.Signature
+	for _, l := range strings.Split(strings.TrimSuffix(string(b), "\n"), "\n") {
+		f := strings.SplitN(strings.TrimPrefix(l, sigPrefix), " ", 2)
+		if len(f) != 2 {
+			return nil, fmt.Errorf("invalid signature line %q", l)
+		}
+		sig, err := base64.StdEncoding.DecodeString(f[1])
+		if err != nil || len(sig) < 5 {
+			return nil, fmt.Errorf("invalid signature line %q", l)
+		}
+		ret = append(ret, note.Signature{Name: f[0], Hash: binary.BigEndian.Uint32(sig), Base64: f[1]})
+	}
+	return ret, nil
+}
+
+// Body returns the signed checkpoint body, i.e. the marshalled Checkpoint
+// followed by OtherData.
+func (s SignedCheckpoint) Body() []byte {
+	return append(s.Checkpoint.Marshal(), s.OtherData...)
+}
+
+// Marshal returns the signed note envelope representation of this
+// SignedCheckpoint.
+func (s SignedCheckpoint) Marshal() []byte {
+	b := bytes.NewBuffer(s.Body())
+	b.WriteString("\n")
+	fmt.Fprintf(b, "%s%s %s\n", sigPrefix, s.LogSignature.Name, s.LogSignature.Base64)
+	for _, c := range s.Cosignatures {
+		fmt.Fprintf(b, "%s%s %s\n", sigPrefix, c.Name, c.Base64)
+	}
+	return b.Bytes()
+}
+
+// SignCheckpoint creates a new SignedCheckpoint for cp and otherData, signed
+// by the log's signer.
+func SignCheckpoint(cp Checkpoint, otherData []byte, signer note.Signer) (*SignedCheckpoint, error) {
+	sc := &SignedCheckpoint{Checkpoint: cp, OtherData: otherData}
+	raw, err := note.Sign(&note.Note{Text: string(sc.Body())}, signer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign checkpoint: %w", err)
+	}
+	sigs, err := parseSignatureLines(raw[len(sc.Body())+1:])
+	if err != nil {
+		return nil, err
+	}
+	sc.LogSignature = sigs[0]
+	return sc, nil
+}
+
+// Cosign adds a new verified cosignature from signer to the checkpoint.
+func (s *SignedCheckpoint) Cosign(signer note.Signer) error {
+	raw, err := note.Sign(&note.Note{Text: string(s.Body())}, signer)
+	if err != nil {
+		return fmt.Errorf("failed to cosign checkpoint: %w", err)
+	}
+	sigs, err := parseSignatureLines(raw[len(s.Body())+1:])
+	if err != nil {
+		return err
+	}
+	s.Cosignatures = append(s.Cosignatures, Cosignature{Signature: sigs[0], Verified: true})
+	return nil
+}
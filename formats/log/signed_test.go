@@ -0,0 +1,127 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+
+	"github.com/google/trillian-examples/formats/log"
+	"golang.org/x/mod/sumdb/note"
+)
+
+func newKeys(t *testing.T, name string) (note.Signer, note.Verifier) {
+	t.Helper()
+	skey, vkey, err := note.GenerateKey(rand.Reader, name)
+	if err != nil {
+		t.Fatalf("GenerateKey = %v", err)
+	}
+	s, err := note.NewSigner(skey)
+	if err != nil {
+		t.Fatalf("NewSigner = %v", err)
+	}
+	v, err := note.NewVerifier(vkey)
+	if err != nil {
+		t.Fatalf("NewVerifier = %v", err)
+	}
+	return s, v
+}
+
+func TestSignedCheckpointRoundTrip(t *testing.T) {
+	logS, logV := newKeys(t, "log")
+	witS, witV := newKeys(t, "witness")
+	otherS, _ := newKeys(t, "other")
+
+	cp := log.Checkpoint{Ecosystem: "Log Checkpoint v0", Size: 42, Hash: []byte("bananas")}
+	sc, err := log.SignCheckpoint(cp, []byte("some\nother data\n"), logS)
+	if err != nil {
+		t.Fatalf("SignCheckpoint = %v", err)
+	}
+	if err := sc.Cosign(witS); err != nil {
+		t.Fatalf("Cosign = %v", err)
+	}
+	if err := sc.Cosign(otherS); err != nil {
+		t.Fatalf("Cosign = %v", err)
+	}
+	raw := sc.Marshal()
+
+	got, err := log.ParseSignedCheckpoint(raw, logV, witV)
+	if err != nil {
+		t.Fatalf("ParseSignedCheckpoint = %v", err)
+	}
+	if got.Size != cp.Size || !bytes.Equal(got.Hash, cp.Hash) || string(got.OtherData) != "some\nother data\n" {
+		t.Errorf("ParseSignedCheckpoint = %+v, want checkpoint %+v", got, cp)
+	}
+	if l := len(got.Cosignatures); l != 2 {
+		t.Fatalf("Got %d cosignatures, want 2", l)
+	}
+	if c := got.Cosignatures[0]; c.Name != "witness" || !c.Verified {
+		t.Errorf("Got first cosignature %+v, want verified from witness", c)
+	}
+	if c := got.Cosignatures[1]; c.Name != "other" || c.Verified {
+		t.Errorf("Got second cosignature %+v, want unverified from other", c)
+	}
+	if m := got.Marshal(); !bytes.Equal(m, raw) {
+		t.Errorf("Marshal = %q, want %q", m, raw)
+	}
+}
+
+func TestParseSignedCheckpointErrors(t *testing.T) {
+	logS, logV := newKeys(t, "log")
+	witS, witV := newKeys(t, "witness")
+	cp := log.Checkpoint{Ecosystem: "Log Checkpoint v0", Size: 42, Hash: []byte("bananas")}
+
+	mustSign := func(body string, signers ...note.Signer) []byte {
+		t.Helper()
+		b, err := note.Sign(&note.Note{Text: body}, signers...)
+		if err != nil {
+			t.Fatalf("Sign = %v", err)
+		}
+		return b
+	}
+	body := string(cp.Marshal())
+
+	for _, test := range []struct {
+		desc string
+		raw  []byte
+	}{
+		{
+			desc: "unsigned",
+			raw:  []byte(body),
+		}, {
+			desc: "witness signature first",
+			raw:  mustSign(body, witS, logS),
+		}, {
+			desc: "only witness signature",
+			raw:  mustSign(body, witS),
+		}, {
+			desc: "invalid body",
+			raw:  mustSign("Log Checkpoint v0\nbananas\n", logS),
+		}, {
+			desc: "non-canonical size",
+			raw:  mustSign("Log Checkpoint v0\n042\nYmFuYW5hcw==\n", logS),
+		}, {
+			desc: "bad log signature",
+			raw:  bytes.Replace(mustSign(body, logS), []byte("42"), []byte("43"), 1),
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			if _, err := log.ParseSignedCheckpoint(test.raw, logV, witV); err == nil {
+				t.Fatal("ParseSignedCheckpoint = nil, want error")
+			}
+		})
+	}
+}
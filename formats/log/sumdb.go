@@ -0,0 +1,69 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"math"
+
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// SumDBEcosystem is the ecosystem string used by the Go checksum database's
+// tree notes, which are otherwise compatible with this checkpoint format.
+const SumDBEcosystem = "go.sum database tree"
+
+// CheckpointFromTree returns the Checkpoint corresponding to a sumdb tree.
+func CheckpointFromTree(t tlog.Tree) Checkpoint {
+	h := t.Hash
+	return Checkpoint{
+		Ecosystem: SumDBEcosystem,
+		Size:      uint64(t.N),
+		Hash:      h[:],
+	}
+}
+
+// ToTree returns the sumdb tree corresponding to this Checkpoint, which must
+// be from the sumdb ecosystem.
+func (c Checkpoint) ToTree() (tlog.Tree, error) {
+	if c.Ecosystem != SumDBEcosystem {
+		return tlog.Tree{}, fmt.Errorf("checkpoint ecosystem is %q, want %q", c.Ecosystem, SumDBEcosystem)
+	}
+	if c.Size > math.MaxInt64 {
+		return tlog.Tree{}, fmt.Errorf("checkpoint size %d too large for sumdb", c.Size)
+	}
+	if len(c.Hash) != tlog.HashSize {
+		return tlog.Tree{}, fmt.Errorf("checkpoint hash has length %d, want %d", len(c.Hash), tlog.HashSize)
+	}
+	t := tlog.Tree{N: int64(c.Size)}
+	copy(t.Hash[:], c.Hash)
+	return t, nil
+}
+
+// ParseSumDBCheckpoint verifies and parses a sumdb signed tree note, e.g. as
+// served by https://sum.golang.org/latest, returning both the common
+// SignedCheckpoint and the corresponding sumdb tree.
+func ParseSumDBCheckpoint(raw []byte, v note.Verifier) (*SignedCheckpoint, tlog.Tree, error) {
+	sc, err := ParseSignedCheckpoint(raw, v)
+	if err != nil {
+		return nil, tlog.Tree{}, err
+	}
+	t, err := sc.ToTree()
+	if err != nil {
+		return nil, tlog.Tree{}, err
+	}
+	return sc, t, nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/trillian-examples/formats/log"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+const (
+	sumDBVKey = "sum.golang.org+033de0ae+Ac4zctda0e5eza+HJyk9SxEdh+s3Ux18htTTAD8OuAn8"
+	sumDBNote = `go.sum database tree
+1514086
+kn9DgqDhXzoZMM8828SQsbuovr/WRn7QfFd5Qe1rpwA=
+
+— sum.golang.org Az3grunuggF5mKymPJeK/l9Pq71lOg/rAVkQVCzGkWRJcnS3ZFunzveHr9PAH8LFsuhpcCWzGDNrn9FFDyXm/66tBg8=
+`
+)
+
+func TestParseSumDBCheckpoint(t *testing.T) {
+	v, err := note.NewVerifier(sumDBVKey)
+	if err != nil {
+		t.Fatalf("NewVerifier = %v", err)
+	}
+	sc, tree, err := log.ParseSumDBCheckpoint([]byte(sumDBNote), v)
+	if err != nil {
+		t.Fatalf("ParseSumDBCheckpoint = %v", err)
+	}
+
+	// The result should agree with sumdb's own parser.
+	n, err := note.Open([]byte(sumDBNote), note.VerifierList(v))
+	if err != nil {
+		t.Fatalf("Open = %v", err)
+	}
+	want, err := tlog.ParseTree([]byte(n.Text))
+	if err != nil {
+		t.Fatalf("ParseTree = %v", err)
+	}
+	if tree != want {
+		t.Errorf("ParseSumDBCheckpoint returned tree %v, want %v", tree, want)
+	}
+	if sc.Size != uint64(want.N) || !bytes.Equal(sc.Hash, want.Hash[:]) {
+		t.Errorf("ParseSumDBCheckpoint returned checkpoint %+v, want %v", sc.Checkpoint, want)
+	}
+	if got := sc.Marshal(); string(got) != sumDBNote {
+		t.Errorf("Marshal = %q, want %q", got, sumDBNote)
+	}
+	if got := sc.Body(); !bytes.Equal(got, tlog.FormatTree(tree)) {
+		t.Errorf("Body = %q, want %q", got, tlog.FormatTree(tree))
+	}
+}
+
+func TestTreeConversion(t *testing.T) {
+	tree := tlog.Tree{N: 42}
+	copy(tree.Hash[:], "0123456789abcdef0123456789abcdef")
+
+	cp := log.CheckpointFromTree(tree)
+	if !bytes.Equal(cp.Marshal(), tlog.FormatTree(tree)) {
+		t.Errorf("Marshal = %q, want %q", cp.Marshal(), tlog.FormatTree(tree))
+	}
+	got, err := cp.ToTree()
+	if err != nil {
+		t.Fatalf("ToTree = %v", err)
+	}
+	if got != tree {
+		t.Errorf("ToTree = %v, want %v", got, tree)
+	}
+
+	for _, bad := range []log.Checkpoint{
+		{Ecosystem: "Log Checkpoint v0", Size: 42, Hash: tree.Hash[:]},
+		{Ecosystem: log.SumDBEcosystem, Size: 42, Hash: []byte("short")},
+		{Ecosystem: log.SumDBEcosystem, Size: 1 << 63, Hash: tree.Hash[:]},
+	} {
+		if _, err := bad.ToTree(); err == nil {
+			t.Errorf("ToTree(%+v) = nil, want error", bad)
+		}
+	}
+}
@@ -0,0 +1,326 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package note provides signed note Signers and Verifiers for signature
+// schemes other than the Ed25519 scheme supported by
+// golang.org/x/mod/sumdb/note, so that keys which can't do Ed25519 (e.g.
+// those held in hardware) can be used to sign checkpoints.
+//
+// Keys are represented as strings in the same way as sumdb note keys:
+//
+//	<name>+<hex key hash>+<base64 key>
+//	PRIVATE+KEY+<name>+<hex key hash>+<base64 key>
+//
+// where the key is an algorithm identifier byte followed by the key material,
+// and the key hash is the first 4 bytes of the SHA-256 hash of the name, a
+// newline, and the key. For the algorithms supported by this package the key
+// material is a DER encoded PKIX public key, or PKCS #8 private key.
+package note
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	crand "crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	gonote "golang.org/x/mod/sumdb/note"
+)
+
+// Algorithm identifies a signature scheme, and is the first byte of an
+// encoded key.
+type Algorithm byte
+
+const (
+	// Ed25519 is the scheme supported by golang.org/x/mod/sumdb/note.
+	Ed25519 Algorithm = 1
+	// ECDSAP256SHA256 is ECDSA using curve P-256 and SHA-256, with ASN.1
+	// encoded signatures.
+	ECDSAP256SHA256 Algorithm = 2
+	// RSAPSSSHA256 is RSASSA-PSS using SHA-256, with the salt length equal to
+	// the hash length.
+	RSAPSSSHA256 Algorithm = 3
+)
+
+// minRSABits is the smallest RSA modulus accepted.
+const minRSABits = 2048
+
+var (
+	errVerifierID = errors.New("malformed verifier id")
+	errSignerID   = errors.New("malformed signer id")
+	errAlg        = errors.New("unknown or unsupported algorithm")
+)
+
+// NewVerifier constructs a new Verifier from an encoded verifier key, which
+// may use any of the supported algorithms.
+func NewVerifier(vkey string) (gonote.Verifier, error) {
+	name, hash, alg, key, err := parseKey(vkey, errVerifierID)
+	if err != nil {
+		return nil, err
+	}
+	if alg == Ed25519 {
+		return gonote.NewVerifier(vkey)
+	}
+	if keyHash(name, append([]byte{byte(alg)}, key...)) != hash {
+		return nil, errVerifierID
+	}
+	k, err := x509.ParsePKIXPublicKey(key)
+	if err != nil {
+		return nil, errVerifierID
+	}
+	var verify func(msg, sig []byte) bool
+	switch alg {
+	case ECDSAP256SHA256:
+		pk, ok := k.(*ecdsa.PublicKey)
+		if !ok || pk.Curve != elliptic.P256() {
+			return nil, errVerifierID
+		}
+		verify = func(msg, sig []byte) bool {
+			d := sha256.Sum256(msg)
+			return ecdsa.VerifyASN1(pk, d[:], sig)
+		}
+	case RSAPSSSHA256:
+		pk, ok := k.(*rsa.PublicKey)
+		if !ok || pk.N.BitLen() < minRSABits {
+			return nil, errVerifierID
+		}
+		verify = func(msg, sig []byte) bool {
+			d := sha256.Sum256(msg)
+			return rsa.VerifyPSS(pk, crypto.SHA256, d[:], sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil
+		}
+	default:
+		return nil, errAlg
+	}
+	return &verifier{name: name, hash: hash, verify: verify}, nil
+}
+
+// NewSigner constructs a new Signer from an encoded signer key, which may use
+// any of the supported algorithms.
+func NewSigner(skey string) (gonote.Signer, error) {
+	if !strings.HasPrefix(skey, "PRIVATE+KEY+") {
+		return nil, errSignerID
+	}
+	name, hash, alg, key, err := parseKey(strings.TrimPrefix(skey, "PRIVATE+KEY+"), errSignerID)
+	if err != nil {
+		return nil, err
+	}
+	if alg == Ed25519 {
+		return gonote.NewSigner(skey)
+	}
+	k, err := x509.ParsePKCS8PrivateKey(key)
+	if err != nil {
+		return nil, errSignerID
+	}
+	cs, ok := k.(crypto.Signer)
+	if !ok {
+		return nil, errSignerID
+	}
+	s, err := NewCryptoSigner(name, cs)
+	if err != nil {
+		return nil, err
+	}
+	if a, _ := algorithmFor(cs.Public()); a != alg || s.KeyHash() != hash {
+		return nil, errSignerID
+	}
+	return s, nil
+}
+
+// NewCryptoSigner returns a Signer which uses the crypto.Signer s, which must
+// hold an ECDSA P-256 or RSA key, e.g. one backed by an HSM.
+func NewCryptoSigner(name string, s crypto.Signer) (gonote.Signer, error) {
+	if !isValidName(name) {
+		return nil, errSignerID
+	}
+	alg, err := algorithmFor(s.Public())
+	if err != nil {
+		return nil, err
+	}
+	pub, err := x509.MarshalPKIXPublicKey(s.Public())
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal public key: %w", err)
+	}
+	var opts crypto.SignerOpts = crypto.SHA256
+	if alg == RSAPSSSHA256 {
+		opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256}
+	}
+	return &signer{
+		name: name,
+		hash: keyHash(name, append([]byte{byte(alg)}, pub...)),
+		sign: func(msg []byte) ([]byte, error) {
+			d := sha256.Sum256(msg)
+			return s.Sign(crand.Reader, d[:], opts)
+		},
+	}, nil
+}
+
+// VerifierKey returns the encoded verifier key for the given public key, which
+// must be an ECDSA P-256 or RSA key.
+func VerifierKey(name string, pub crypto.PublicKey) (string, error) {
+	if !isValidName(name) {
+		return "", errVerifierID
+	}
+	alg, err := algorithmFor(pub)
+	if err != nil {
+		return "", err
+	}
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal public key: %w", err)
+	}
+	key := append([]byte{byte(alg)}, der...)
+	return fmt.Sprintf("%s+%08x+%s", name, keyHash(name, key), base64.StdEncoding.EncodeToString(key)), nil
+}
+
+// GenerateKey generates a signer and verifier key pair for a named server
+// using the given algorithm.
+// The signer key skey is private and must be kept secret.
+func GenerateKey(rand io.Reader, name string, alg Algorithm) (skey, vkey string, err error) {
+	var priv crypto.Signer
+	switch alg {
+	case Ed25519:
+		return gonote.GenerateKey(rand, name)
+	case ECDSAP256SHA256:
+		priv, err = ecdsa.GenerateKey(elliptic.P256(), rand)
+	case RSAPSSSHA256:
+		priv, err = rsa.GenerateKey(rand, 3072)
+	default:
+		return "", "", errAlg
+	}
+	if err != nil {
+		return "", "", err
+	}
+	s, err := NewCryptoSigner(name, priv)
+	if err != nil {
+		return "", "", err
+	}
+	vkey, err = VerifierKey(name, priv.Public())
+	if err != nil {
+		return "", "", err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to marshal private key: %w", err)
+	}
+	skey = fmt.Sprintf("PRIVATE+KEY+%s+%08x+%s", name, s.KeyHash(), base64.StdEncoding.EncodeToString(append([]byte{byte(alg)}, der...)))
+	return skey, vkey, nil
+}
+
+// algorithmNames holds the names of the supported algorithms, as used by
+// command line flags.
+var algorithmNames = map[Algorithm]string{
+	Ed25519:         "ed25519",
+	ECDSAP256SHA256: "ecdsa",
+	RSAPSSSHA256:    "rsa",
+}
+
+// String returns the name of the algorithm.
+func (a Algorithm) String() string {
+	if n, ok := algorithmNames[a]; ok {
+		return n
+	}
+	return fmt.Sprintf("Algorithm(%d)", byte(a))
+}
+
+// ParseAlgorithm returns the Algorithm with the given name: one of "ed25519",
+// "ecdsa" or "rsa".
+func ParseAlgorithm(s string) (Algorithm, error) {
+	for a, n := range algorithmNames {
+		if n == s {
+			return a, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown algorithm %q", s)
+}
+
+func algorithmFor(pub crypto.PublicKey) (Algorithm, error) {
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return 0, errors.New("only P-256 ECDSA keys are supported")
+		}
+		return ECDSAP256SHA256, nil
+	case *rsa.PublicKey:
+		if k.N.BitLen() < minRSABits {
+			return 0, fmt.Errorf("RSA keys must be at least %d bits", minRSABits)
+		}
+		return RSAPSSSHA256, nil
+	}
+	return 0, errAlg
+}
+
+// parseKey parses the <name>+<hash>+<key> form common to signer and verifier
+// keys.
+func parseKey(s string, errID error) (string, uint32, Algorithm, []byte, error) {
+	f := strings.SplitN(s, "+", 3)
+	if len(f) != 3 || !isValidName(f[0]) || len(f[1]) != 8 {
+		return "", 0, 0, nil, errID
+	}
+	hash, err := strconv.ParseUint(f[1], 16, 32)
+	if err != nil {
+		return "", 0, 0, nil, errID
+	}
+	key, err := base64.StdEncoding.DecodeString(f[2])
+	if err != nil || len(key) < 2 {
+		return "", 0, 0, nil, errID
+	}
+	return f[0], uint32(hash), Algorithm(key[0]), key[1:], nil
+}
+
+// keyHash computes the key hint for a named key, as defined by sumdb note.
+func keyHash(name string, key []byte) uint32 {
+	h := sha256.New()
+	h.Write([]byte(name))
+	h.Write([]byte("\n"))
+	h.Write(key)
+	return binary.BigEndian.Uint32(h.Sum(nil))
+}
+
+// isValidName reports whether name is valid, as defined by sumdb note.
+func isValidName(name string) bool {
+	return name != "" && utf8.ValidString(name) && strings.IndexFunc(name, unicode.IsSpace) < 0 && !strings.Contains(name, "+")
+}
+
+// verifier is a gonote.Verifier for the algorithms supported by this
+// package.
+type verifier struct {
+	name   string
+	hash   uint32
+	verify func(msg, sig []byte) bool
+}
+
+func (v *verifier) Name() string                { return v.name }
+func (v *verifier) KeyHash() uint32             { return v.hash }
+func (v *verifier) Verify(msg, sig []byte) bool { return v.verify(msg, sig) }
+
+// signer is a gonote.Signer for the algorithms supported by this package.
+type signer struct {
+	name string
+	hash uint32
+	sign func(msg []byte) ([]byte, error)
+}
+
+func (s *signer) Name() string                    { return s.name }
+func (s *signer) KeyHash() uint32                 { return s.hash }
+func (s *signer) Sign(msg []byte) ([]byte, error) { return s.sign(msg) }
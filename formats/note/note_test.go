@@ -0,0 +1,120 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package note_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"strings"
+	"testing"
+
+	"github.com/google/trillian-examples/formats/log"
+	"github.com/google/trillian-examples/formats/note"
+	gonote "golang.org/x/mod/sumdb/note"
+)
+
+func TestSignVerify(t *testing.T) {
+	for _, alg := range []note.Algorithm{note.Ed25519, note.ECDSAP256SHA256, note.RSAPSSSHA256} {
+		t.Run(alg.String(), func(t *testing.T) {
+			skey, vkey, err := note.GenerateKey(rand.Reader, "example.com/log", alg)
+			if err != nil {
+				t.Fatalf("GenerateKey = %v", err)
+			}
+			s, err := note.NewSigner(skey)
+			if err != nil {
+				t.Fatalf("NewSigner = %v", err)
+			}
+			v, err := note.NewVerifier(vkey)
+			if err != nil {
+				t.Fatalf("NewVerifier = %v", err)
+			}
+			if s.Name() != v.Name() || s.KeyHash() != v.KeyHash() {
+				t.Fatalf("Signer %s/%x doesn't match verifier %s/%x", s.Name(), s.KeyHash(), v.Name(), v.KeyHash())
+			}
+
+			cp := log.Checkpoint{Ecosystem: "Log Checkpoint v0", Size: 1, Hash: []byte("bananas")}
+			sc, err := log.SignCheckpoint(cp, nil, s)
+			if err != nil {
+				t.Fatalf("SignCheckpoint = %v", err)
+			}
+			raw := sc.Marshal()
+			if _, err := log.ParseSignedCheckpoint(raw, v); err != nil {
+				t.Errorf("ParseSignedCheckpoint = %v", err)
+			}
+			tampered := []byte(strings.Replace(string(raw), "\n1\n", "\n2\n", 1))
+			if _, err := gonote.Open(tampered, gonote.VerifierList(v)); err == nil {
+				t.Error("Open(tampered) = nil, want error")
+			}
+		})
+	}
+}
+
+func TestNewCryptoSigner(t *testing.T) {
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey = %v", err)
+	}
+	s, err := note.NewCryptoSigner("hsm", k)
+	if err != nil {
+		t.Fatalf("NewCryptoSigner = %v", err)
+	}
+	vkey, err := note.VerifierKey("hsm", k.Public())
+	if err != nil {
+		t.Fatalf("VerifierKey = %v", err)
+	}
+	v, err := note.NewVerifier(vkey)
+	if err != nil {
+		t.Fatalf("NewVerifier = %v", err)
+	}
+	msg, err := gonote.Sign(&gonote.Note{Text: "hello\n"}, s)
+	if err != nil {
+		t.Fatalf("Sign = %v", err)
+	}
+	if _, err := gonote.Open(msg, gonote.VerifierList(v)); err != nil {
+		t.Errorf("Open = %v", err)
+	}
+
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey = %v", err)
+	}
+	if _, err := note.NewCryptoSigner("hsm", p384); err == nil {
+		t.Error("NewCryptoSigner(P-384) = nil, want error")
+	}
+}
+
+func TestNewVerifierErrors(t *testing.T) {
+	_, vkey, err := note.GenerateKey(rand.Reader, "log", note.ECDSAP256SHA256)
+	if err != nil {
+		t.Fatalf("GenerateKey = %v", err)
+	}
+	f := strings.SplitN(vkey, "+", 3)
+	for _, test := range []struct {
+		desc string
+		vkey string
+	}{
+		{desc: "wrong hash", vkey: f[0] + "+00000000+" + f[2]},
+		{desc: "wrong name", vkey: "other" + strings.TrimPrefix(vkey, "log")},
+		{desc: "truncated", vkey: vkey[:len(vkey)-8]},
+		{desc: "unknown algorithm", vkey: "log+00000000+/w=="},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			if _, err := note.NewVerifier(test.vkey); err == nil {
+				t.Error("NewVerifier = nil, want error")
+			}
+		})
+	}
+}
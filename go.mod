@@ -18,6 +18,7 @@ require (
 	github.com/mattn/go-sqlite3 v1.14.7
 	github.com/niemeyer/pretty v0.0.0-20200227124842-a10e7caefd8e // indirect
 	github.com/perlin-network/life v0.0.0-20191203030451-05c0e0f7eaea
+	github.com/prometheus/client_golang v1.10.0
 	github.com/stretchr/testify v1.7.0 // indirect
 	github.com/u-root/u-root v7.0.0+incompatible
 	golang.org/x/crypto v0.0.0-20201002170205-7f63de1d35b0
@@ -0,0 +1,145 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"fmt"
+
+	"github.com/google/trillian-examples/formats/log"
+)
+
+// Predecessor identifies the final state of a closed log.
+type Predecessor struct {
+	// Size is the size of the predecessor's final checkpoint.
+	Size uint64
+	// Hash is the root hash of the predecessor's final checkpoint.
+	Hash []byte
+}
+
+// Keyword implements log.Extension.
+func (Predecessor) Keyword() string { return PredecessorExtension.Keyword }
+
+// MarshalValue implements log.Extension.
+func (p Predecessor) MarshalValue() string {
+	return log.PreviousRoot(p).MarshalValue()
+}
+
+// PredecessorExtension is the checkpoint otherdata extension type which
+// identifies the final checkpoint of the log which preceded this one.
+// Its value has the same form as log.PreviousRoot, but refers to another log.
+var PredecessorExtension = log.ExtensionType{
+	Keyword: "Predecessor",
+	Parse: func(v string) (log.Extension, error) {
+		e, err := log.PreviousRootExtension.Parse(v)
+		if err != nil {
+			return nil, err
+		}
+		return Predecessor(e.(log.PreviousRoot)), nil
+	},
+}
+
+// Closed marks a checkpoint as the final one which will be issued by a log.
+type Closed struct{}
+
+// Keyword implements log.Extension.
+func (Closed) Keyword() string { return ClosedExtension.Keyword }
+
+// MarshalValue implements log.Extension.
+func (Closed) MarshalValue() string { return "" }
+
+// ClosedExtension is the checkpoint otherdata extension type which marks a
+// checkpoint as the final one which will be issued by a log.
+var ClosedExtension = log.ExtensionType{
+	Keyword: "Closed",
+	Parse: func(v string) (log.Extension, error) {
+		if len(v) > 0 {
+			return nil, fmt.Errorf("unexpected value %q", v)
+		}
+		return Closed{}, nil
+	},
+}
+
+// shardRegistry understands the otherdata extensions related to sharding.
+var shardRegistry = mustRegistry(PredecessorExtension, ClosedExtension)
+
+func mustRegistry(types ...log.ExtensionType) *log.Registry {
+	r, err := log.NewRegistry(types...)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// ShardInfo describes where a log sits in a chain of logs, where each log
+// (or shard) has been frozen and replaced by a successor when it grew too
+// large.
+//
+// This information is carried in the otherdata section of the log's
+// checkpoints, with each piece of information on its own line:
+//
+//	Closed
+//	Predecessor <decimal size> <base64 root hash>
+//
+// Other lines are preserved, but otherwise ignored.
+type ShardInfo struct {
+	// Closed is true if the log has been frozen, and will accept no further
+	// entries.
+	Closed bool
+	// Predecessor, if set, identifies the final checkpoint of the log which
+	// this one succeeds.
+	Predecessor *Predecessor
+	// Other holds any otherdata lines not related to sharding.
+	Other []string
+}
+
+// ParseShardInfo parses checkpoint otherdata, as returned by
+// log.Checkpoint.Unmarshal.
+func ParseShardInfo(otherData []byte) (ShardInfo, error) {
+	var ret ShardInfo
+	exts, err := shardRegistry.Parse(otherData)
+	if err != nil {
+		return ret, err
+	}
+	for _, e := range exts {
+		switch e := e.(type) {
+		case Closed:
+			ret.Closed = true
+		case Predecessor:
+			ret.Predecessor = &e
+		default:
+			ret.Other = append(ret.Other, e.(log.Unknown).Line)
+		}
+	}
+	return ret, nil
+}
+
+// Marshal returns the checkpoint otherdata representation of this ShardInfo.
+func (s ShardInfo) Marshal() ([]byte, error) {
+	var exts log.Extensions
+	if s.Predecessor != nil {
+		exts = append(exts, *s.Predecessor)
+	}
+	for _, l := range s.Other {
+		exts = append(exts, log.Unknown{Line: l})
+	}
+	if s.Closed {
+		exts = append(exts, Closed{})
+	}
+	b, err := exts.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("invalid shard info: %w", err)
+	}
+	return b, nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/trillian-examples/serverless/api"
+)
+
+func TestShardInfoRoundtrip(t *testing.T) {
+	for _, test := range []struct {
+		desc string
+		si   api.ShardInfo
+	}{
+		{
+			desc: "empty",
+		}, {
+			desc: "closed",
+			si:   api.ShardInfo{Closed: true},
+		}, {
+			desc: "successor",
+			si: api.ShardInfo{
+				Predecessor: &api.Predecessor{Size: 123, Hash: []byte("root hash")},
+			},
+		}, {
+			desc: "closed successor with other data",
+			si: api.ShardInfo{
+				Closed:      true,
+				Predecessor: &api.Predecessor{Size: 123, Hash: []byte("root hash")},
+				Other:       []string{"phase of the moon: waxing"},
+			},
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			b, err := test.si.Marshal()
+			if err != nil {
+				t.Fatalf("Marshal = %v", err)
+			}
+			got, err := api.ParseShardInfo(b)
+			if err != nil {
+				t.Fatalf("ParseShardInfo = %v", err)
+			}
+			if diff := cmp.Diff(test.si, got); len(diff) != 0 {
+				t.Errorf("Roundtrip had diff %s", diff)
+			}
+		})
+	}
+}
+
+func TestShardInfoMarshalErrors(t *testing.T) {
+	for _, si := range []api.ShardInfo{
+		{Other: []string{"two\nlines"}},
+		{Other: []string{""}},
+	} {
+		if b, err := si.Marshal(); err == nil {
+			t.Errorf("Marshal(%+v) = %q, want error", si, b)
+		}
+	}
+}
+
+func TestParseShardInfoErrors(t *testing.T) {
+	for _, test := range []struct {
+		desc string
+		data string
+	}{
+		{
+			desc: "no trailing newline",
+			data: "Closed",
+		}, {
+			desc: "bad predecessor size",
+			data: "Predecessor x aGFzaA==\n",
+		}, {
+			desc: "bad predecessor hash",
+			data: "Predecessor 1 not-base64\n",
+		}, {
+			desc: "missing predecessor hash",
+			data: "Predecessor 1\n",
+		}, {
+			desc: "multiple predecessors",
+			data: "Predecessor 1 aGFzaA==\nPredecessor 2 aGFzaA==\n",
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			if _, err := api.ParseShardInfo([]byte(test.data)); err == nil {
+				t.Error("ParseShardInfo = nil, want error")
+			}
+		})
+	}
+}
@@ -25,7 +25,7 @@ import (
 
 	"github.com/google/trillian-examples/formats/log"
 	"github.com/google/trillian-examples/serverless/api"
-	"github.com/google/trillian-examples/serverless/internal/layout"
+	"github.com/google/trillian-examples/serverless/layout"
 	"github.com/google/trillian/merkle"
 	"github.com/google/trillian/merkle/compact"
 	"github.com/google/trillian/merkle/hashers"
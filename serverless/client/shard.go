@@ -0,0 +1,100 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/google/trillian-examples/formats/log"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/layout"
+)
+
+// Shard is one of a chain of logs, each of which succeeds the previous one
+// once it has been closed.
+type Shard struct {
+	// URL is the root location of the log.
+	URL *url.URL
+	// CheckpointRaw is the latest checkpoint of the log, as returned by it.
+	CheckpointRaw []byte
+	// Checkpoint is the parsed form of CheckpointRaw.
+	Checkpoint log.Checkpoint
+	// Info is the sharding information carried by Checkpoint.
+	Info api.ShardInfo
+}
+
+// ErrBrokenShardChain is returned by FollowShards when a successor log does
+// not start from the final checkpoint of the log which it claims to succeed.
+var ErrBrokenShardChain = errors.New("successor log does not follow from closed log")
+
+// FollowShards walks the chain of logs starting with the log at root,
+// following each closed log to its successor and verifying that the
+// successor started from the closed log's final checkpoint.
+//
+// newFetcher is used to create a FetcherFunc for each log in the chain, and
+// at most maxShards logs will be visited.
+// Returns the logs in the chain, ending with the first which is not closed.
+func FollowShards(root *url.URL, newFetcher func(*url.URL) FetcherFunc, maxShards int) ([]Shard, error) {
+	ret := make([]Shard, 0, 1)
+	for u := root; len(ret) < maxShards; {
+		f := newFetcher(u)
+		cpRaw, err := f(layout.CheckpointPath)
+		if err != nil {
+			return ret, fmt.Errorf("failed to fetch checkpoint for %s: %w", u, err)
+		}
+		var cp log.Checkpoint
+		otherData, err := cp.Unmarshal(cpRaw)
+		if err != nil {
+			return ret, fmt.Errorf("failed to unmarshal checkpoint for %s: %w", u, err)
+		}
+		si, err := api.ParseShardInfo(otherData)
+		if err != nil {
+			return ret, fmt.Errorf("failed to parse checkpoint otherdata for %s: %w", u, err)
+		}
+		s := Shard{URL: u, CheckpointRaw: cpRaw, Checkpoint: cp, Info: si}
+
+		if n := len(ret); n > 0 {
+			prev := ret[n-1].Checkpoint
+			if p := si.Predecessor; p == nil || p.Size != prev.Size || !bytes.Equal(p.Hash, prev.Hash) {
+				return ret, fmt.Errorf("%s: %w", u, ErrBrokenShardChain)
+			}
+		}
+		ret = append(ret, s)
+		if !si.Closed {
+			return ret, nil
+		}
+
+		succ, err := f(layout.SuccessorPath)
+		if err != nil {
+			return ret, fmt.Errorf("failed to fetch successor location for %s: %w", u, err)
+		}
+		// Ensure the successor URL is treated as a directory so that paths
+		// within it are resolved correctly.
+		su := strings.TrimSpace(string(succ))
+		if !strings.HasSuffix(su, "/") {
+			su += "/"
+		}
+		next, err := u.Parse(su)
+		if err != nil {
+			return ret, fmt.Errorf("invalid successor location %q for %s: %w", su, u, err)
+		}
+		u = next
+	}
+	return ret, fmt.Errorf("shard chain is longer than %d logs", maxShards)
+}
@@ -27,7 +27,7 @@ import (
 	"strconv"
 
 	"github.com/golang/glog"
-	"github.com/google/trillian-examples/serverless/internal/client"
+	"github.com/google/trillian-examples/serverless/client"
 	"github.com/google/trillian/merkle/logverifier"
 	"github.com/google/trillian/merkle/rfc6962/hasher"
 )
@@ -49,6 +49,7 @@ var (
 func usage() {
 	fmt.Fprintf(os.Stderr, "Please specify one of the commands and its arguments:\n")
 	fmt.Fprintf(os.Stderr, "  inclusion <file> [index-in-log]\n")
+	fmt.Fprintf(os.Stderr, "  shards\n")
 	os.Exit(-1)
 }
 
@@ -80,6 +81,8 @@ func main() {
 	switch args[0] {
 	case "inclusion":
 		err = lc.inclusionProof(args[1:])
+	case "shards":
+		err = listShards(rootURL)
 	default:
 		usage()
 	}
@@ -179,6 +182,27 @@ func (l *logClientTool) inclusionProof(args []string) error {
 	return nil
 }
 
+// maxShards is the maximum length of a chain of logs which will be followed.
+const maxShards = 1000
+
+// listShards follows the chain of logs starting at root, verifying that each
+// successor follows on from its predecessor, and prints details of each log
+// in the chain.
+func listShards(root *url.URL) error {
+	shards, err := client.FollowShards(root, newFetcher, maxShards)
+	for _, s := range shards {
+		state := "open"
+		if s.Info.Closed {
+			state = "closed"
+		}
+		fmt.Printf("%s: %s, size %d, root 0x%0x\n", s.URL, state, s.Checkpoint.Size, s.Checkpoint.Hash)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to follow shards: %w", err)
+	}
+	return nil
+}
+
 // newFetcher creates a FetcherFunc for the log at the given root location.
 func newFetcher(root *url.URL) client.FetcherFunc {
 	get := getByScheme[root.Scheme]
@@ -22,11 +22,12 @@ import (
 	"os"
 
 	"github.com/golang/glog"
-	"golang.org/x/mod/sumdb/note"
+	"github.com/google/trillian-examples/formats/note"
 )
 
 var (
 	keyName = flag.String("key_name", "", "Name for the key identity.")
+	keyType = flag.String("key_type", "ed25519", "Type of key to create, one of ed25519, ecdsa (P-256), or rsa (RSA-PSS).")
 	outPriv = flag.String("out_priv", "", "Output file for private key.")
 	outPub  = flag.String("out_pub", "", "Output file for public key.")
 	print   = flag.Bool("print", false, "Print private key, then public key, over 2 lines, to stdout.")
@@ -45,7 +46,12 @@ func main() {
 		}
 	}
 
-	skey, vkey, err := note.GenerateKey(rand.Reader, *keyName)
+	alg, err := note.ParseAlgorithm(*keyType)
+	if err != nil {
+		glog.Exitf("Invalid --key_type: %q", err)
+	}
+
+	skey, vkey, err := note.GenerateKey(rand.Reader, *keyName, alg)
 	if err != nil {
 		glog.Exitf("Unable to create key: %q", err)
 	}
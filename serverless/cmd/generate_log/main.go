@@ -0,0 +1,84 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package main provides a command line tool for quickly generating large
+// serverless logs filled with deterministic entries, for testing and
+// benchmarking.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/log"
+	"github.com/google/trillian-examples/serverless/storage"
+	"github.com/google/trillian-examples/serverless/storage/fs"
+	"github.com/google/trillian/merkle/rfc6962/hasher"
+)
+
+var (
+	storageDir    = flag.String("storage_dir", "", "Root directory in which to create the log, must not already exist.")
+	numLeaves     = flag.Uint64("num_leaves", 1<<20, "Number of entries to integrate into the generated log.")
+	pendingLeaves = flag.Uint64("pending_leaves", 0, "Number of additional entries to sequence, but not integrate, e.g. for benchmarking integrate.")
+)
+
+// leaf returns the deterministic contents of the entry at index i.
+func leaf(i uint64) []byte {
+	return []byte(fmt.Sprintf("Generated leaf %d", i))
+}
+
+func main() {
+	flag.Parse()
+	h := hasher.DefaultHasher
+
+	if len(*storageDir) == 0 {
+		glog.Exit("--storage_dir required")
+	}
+
+	st, err := fs.Create(*storageDir, h.EmptyRoot())
+	if err != nil {
+		glog.Exitf("Failed to create log: %q", err)
+	}
+
+	start := time.Now()
+	cp, err := log.Populate(st, h, *numLeaves, leaf)
+	if err != nil {
+		glog.Exitf("Failed to populate log: %q", err)
+	}
+	cp.Ecosystem = api.CheckpointHeaderV0
+	if err := st.WriteCheckpoint(cp.Marshal()); err != nil {
+		glog.Exitf("Failed to write checkpoint: %q", err)
+	}
+	glog.Infof("Generated log with %d entries in %s, root hash %x", cp.Size, time.Since(start), cp.Hash)
+
+	if *pendingLeaves == 0 {
+		return
+	}
+	// Reload the storage so that sequencing continues from the end of the
+	// generated entries.
+	st, err = fs.Load(*storageDir, cp)
+	if err != nil {
+		glog.Exitf("Failed to load log: %q", err)
+	}
+	for i := cp.Size; i < cp.Size+*pendingLeaves; i++ {
+		if _, err := log.Sequence(st, h, leaf(i)); err != nil && !errors.Is(err, storage.ErrDupeLeaf) {
+			glog.Exitf("Failed to sequence entry %d: %q", i, err)
+		}
+	}
+	glog.Infof("Sequenced %d pending entries", *pendingLeaves)
+}
@@ -18,10 +18,18 @@ package main
 
 import (
 	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/golang/glog"
-	"github.com/google/trillian-examples/serverless/internal/log"
-	"github.com/google/trillian-examples/serverless/internal/storage/fs"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/internal/metrics"
+	"github.com/google/trillian-examples/serverless/layout"
+	"github.com/google/trillian-examples/serverless/log"
+	"github.com/google/trillian-examples/serverless/storage/buffered"
+	"github.com/google/trillian-examples/serverless/storage/fs"
 	"github.com/google/trillian/merkle/rfc6962/hasher"
 
 	fmtlog "github.com/google/trillian-examples/formats/log"
@@ -29,37 +37,106 @@ import (
 
 var (
 	storageDir = flag.String("storage_dir", "", "Root directory to store log data.")
+	dryRun     = flag.Bool("dry_run", false, "Set to calculate the new checkpoint and list the files which would be written, without modifying the log.")
+
+	metricsListen   = flag.String("metrics_listen", "", "If set, the address on which to serve Prometheus metrics, e.g. localhost:8081.")
+	metricsTextfile = flag.String("metrics_textfile", "", "If set, the file to write Prometheus metrics to once integration completes, e.g. for use with the node_exporter textfile collector.")
 )
 
 func main() {
 	flag.Parse()
+	metrics.Init(*metricsListen)
 	h := hasher.DefaultHasher
 
+	if fi, err := os.Stat(filepath.Join(*storageDir, layout.CheckpointPath)); err == nil {
+		log.RecordCheckpointAge(time.Since(fi.ModTime()))
+	}
+
 	// init storage
 	cpRaw, err := fs.ReadCheckpoint(*storageDir)
 	if err != nil {
 		glog.Exitf("Failed to read log checkpoint: %q", err)
 	}
 	var cp fmtlog.Checkpoint
-	if _, err := cp.Unmarshal(cpRaw); err != nil {
+	otherData, err := cp.Unmarshal(cpRaw)
+	if err != nil {
 		glog.Exitf("Failed to unmarshal checkpoint: %q", err)
 	}
+	si, err := api.ParseShardInfo(otherData)
+	if err != nil {
+		glog.Exitf("Failed to parse checkpoint otherdata: %q", err)
+	}
+	if si.Closed {
+		glog.Exit("Log is closed")
+	}
 	st, err := fs.Load(*storageDir, &cp)
 	if err != nil {
 		glog.Exitf("Failed to load storage: %q", err)
 	}
 
+	// In dry-run mode, all writes are held in memory so they can be
+	// reported on instead.
+	var ls log.Storage = st
+	var buf *buffered.Storage
+	if *dryRun {
+		buf = buffered.New(st)
+		ls = buf
+	}
+
 	// Integrate new entries
-	newCp, err := log.Integrate(st, h)
+	newCp, err := log.Integrate(ls, h)
 	if err != nil {
 		glog.Exitf("Failed to integrate: %q", err)
 	}
 	if newCp == nil {
+		writeMetrics()
 		glog.Exit("Nothing to integrate")
 	}
 
-	// Persist new log checkpoint.
-	if err := st.WriteCheckpoint(newCp.Marshal()); err != nil {
+	// Persist new log checkpoint, preserving the ecosystem and any otherdata
+	// (e.g. a reference to a predecessor log) from the previous one.
+	newCp.Ecosystem = cp.Ecosystem
+	if err := ls.WriteCheckpoint(append(newCp.Marshal(), otherData...)); err != nil {
 		glog.Exitf("Failed to store new log checkpoint: %q", err)
 	}
+	if *dryRun {
+		printPlan(buf, newCp)
+		return
+	}
+	log.RecordCheckpointAge(0)
+	writeMetrics()
+}
+
+// printPlan describes the changes to the log which have been buffered in b.
+func printPlan(b *buffered.Storage, newCp *fmtlog.Checkpoint) {
+	fmt.Printf("Dry run, the log has not been modified.\n")
+	fmt.Printf("New checkpoint: size %d, root hash %x\n", newCp.Size, newCp.Hash)
+
+	tiles := b.Tiles()
+	var total int
+	lines := make([]string, 0, len(tiles))
+	for _, t := range tiles {
+		raw, err := t.Tile.MarshalText()
+		if err != nil {
+			glog.Exitf("Failed to marshal tile: %q", err)
+		}
+		total += len(raw)
+		p := filepath.Join(layout.TilePath("", t.Level, t.Index, uint64(t.Tile.NumLeaves)%256))
+		lines = append(lines, fmt.Sprintf("  %s (%d leaves, %d bytes)", p, t.Tile.NumLeaves, len(raw)))
+	}
+	fmt.Printf("Would write %d tiles (%d bytes):\n", len(tiles), total)
+	for _, l := range lines {
+		fmt.Println(l)
+	}
+	fmt.Printf("Would write %s (%d bytes)\n", layout.CheckpointPath, len(b.PendingCheckpoint()))
+}
+
+// writeMetrics writes out the metrics textfile, if one was requested.
+func writeMetrics() {
+	if len(*metricsTextfile) == 0 {
+		return
+	}
+	if err := metrics.WriteTextfile(*metricsTextfile); err != nil {
+		glog.Exitf("Failed to write metrics: %q", err)
+	}
 }
@@ -0,0 +1,181 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package main provides a command line tool for closing a serverless log
+// and creating a successor log to continue from where it left off.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/layout"
+	"github.com/google/trillian-examples/serverless/log"
+	"github.com/google/trillian-examples/serverless/storage/fs"
+	"github.com/google/trillian/merkle/rfc6962/hasher"
+
+	fmtlog "github.com/google/trillian-examples/formats/log"
+)
+
+var (
+	storageDir   = flag.String("storage_dir", "", "Root directory of the log to close.")
+	successorDir = flag.String("successor_dir", "", "Root directory in which to create the successor log.")
+	successorURL = flag.String("successor_url", "", "URL at which the successor log will be published, may be relative to the URL of the log being closed.")
+)
+
+func main() {
+	flag.Parse()
+	h := hasher.DefaultHasher
+
+	if len(*storageDir) == 0 || len(*successorDir) == 0 || len(*successorURL) == 0 {
+		glog.Exit("--storage_dir, --successor_dir, and --successor_url are required")
+	}
+
+	// Each step can be repeated, so if a rollover is interrupted it can be
+	// completed by running this again with the same flags.
+	cpRaw, err := fs.ReadCheckpoint(*storageDir)
+	if err != nil {
+		glog.Exitf("Failed to read log checkpoint: %q", err)
+	}
+	var cp fmtlog.Checkpoint
+	otherData, err := cp.Unmarshal(cpRaw)
+	if err != nil {
+		glog.Exitf("Failed to unmarshal checkpoint: %q", err)
+	}
+	si, err := api.ParseShardInfo(otherData)
+	if err != nil {
+		glog.Exitf("Failed to parse checkpoint otherdata: %q", err)
+	}
+	st, err := fs.Load(*storageDir, &cp)
+	if err != nil {
+		glog.Exitf("Failed to load storage: %q", err)
+	}
+
+	final := &cp
+	if si.Closed {
+		// The final checkpoint is only written once the successor is in
+		// place, but check it's still there.
+		glog.Infof("Log is already closed at size %d", final.Size)
+	} else {
+		// Stop new entries being sequenced, then integrate any outstanding
+		// entries so that the final checkpoint covers everything which has
+		// been sequenced.
+		if err := st.MarkClosed(); err != nil {
+			glog.Exitf("Failed to close log to new entries: %q", err)
+		}
+		newCP, err := log.Integrate(st, h)
+		if err != nil {
+			glog.Exitf("Failed to integrate: %q", err)
+		}
+		if newCP != nil {
+			newCP.Ecosystem = cp.Ecosystem
+			final = newCP
+		}
+		// A sequencer which checked the log wasn't closed just before it was
+		// marked may have added an entry since, in which case it's safe to try again.
+		if n, err := st.ScanSequenced(final.Size, func(uint64, []byte) error { return nil }); err != nil {
+			glog.Exitf("Failed to check for sequenced entries: %q", err)
+		} else if n > 0 {
+			glog.Exitf("%d entries were sequenced while closing the log, re-run to integrate them", n)
+		}
+	}
+
+	// Create the successor first, so that the log is never closed without
+	// somewhere to go next.
+	if err := ensureSuccessor(*successorDir, final, h.EmptyRoot()); err != nil {
+		glog.Exitf("Failed to create successor log: %q", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(*storageDir, layout.SuccessorPath), []byte(*successorURL), 0644); err != nil {
+		glog.Exitf("Failed to write successor location: %q", err)
+	}
+	if si.Closed {
+		return
+	}
+
+	// Finally, close the log.
+	si.Closed = true
+	od, err := si.Marshal()
+	if err != nil {
+		glog.Exitf("Failed to marshal shard info: %q", err)
+	}
+	if err := st.WriteCheckpoint(append(final.Marshal(), od...)); err != nil {
+		glog.Exitf("Failed to store final log checkpoint: %q", err)
+	}
+	glog.Infof("Closed log at size %d with root hash %x", final.Size, final.Hash)
+}
+
+// ensureSuccessor creates an empty log in dir whose checkpoint names final as
+// its predecessor. If there is already a log there, its predecessor must be
+// final. A log which was created without a checkpoint, by a run which was
+// interrupted, is given one.
+func ensureSuccessor(dir string, final *fmtlog.Checkpoint, emptyRoot []byte) error {
+	succCP := fmtlog.Checkpoint{
+		Ecosystem: final.Ecosystem,
+		Size:      0,
+		Hash:      emptyRoot,
+	}
+	succ, err := fs.Create(dir, emptyRoot)
+	if errors.Is(err, os.ErrExist) {
+		cpRaw, err := fs.ReadCheckpoint(dir)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			if succ, err = fs.Load(dir, &succCP); err != nil {
+				return err
+			}
+		case err != nil:
+			return fmt.Errorf("failed to read existing successor checkpoint: %w", err)
+		default:
+			return checkPredecessor(cpRaw, final)
+		}
+	} else if err != nil {
+		return err
+	}
+
+	succSI := api.ShardInfo{
+		Predecessor: &api.Predecessor{Size: final.Size, Hash: final.Hash},
+	}
+	succOD, err := succSI.Marshal()
+	if err != nil {
+		return fmt.Errorf("failed to marshal successor shard info: %w", err)
+	}
+	if err := succ.WriteCheckpoint(append(succCP.Marshal(), succOD...)); err != nil {
+		return fmt.Errorf("failed to write successor checkpoint: %w", err)
+	}
+	return nil
+}
+
+// checkPredecessor checks that the checkpoint of an existing successor log
+// names final as its predecessor.
+func checkPredecessor(cpRaw []byte, final *fmtlog.Checkpoint) error {
+	var cp fmtlog.Checkpoint
+	otherData, err := cp.Unmarshal(cpRaw)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal existing successor checkpoint: %w", err)
+	}
+	si, err := api.ParseShardInfo(otherData)
+	if err != nil {
+		return fmt.Errorf("failed to parse existing successor checkpoint otherdata: %w", err)
+	}
+	if p := si.Predecessor; p == nil || p.Size != final.Size || !bytes.Equal(p.Hash, final.Hash) {
+		return fmt.Errorf("existing successor has predecessor %v, want size %d with root hash %x", p, final.Size, final.Hash)
+	}
+	return nil
+}
@@ -24,8 +24,11 @@ import (
 	"path/filepath"
 
 	"github.com/google/trillian-examples/formats/log"
-	"github.com/google/trillian-examples/serverless/internal/storage"
-	"github.com/google/trillian-examples/serverless/internal/storage/fs"
+	"github.com/google/trillian-examples/serverless/internal/metrics"
+	"github.com/google/trillian-examples/serverless/storage"
+	"github.com/google/trillian-examples/serverless/storage/fs"
+
+	serverlesslog "github.com/google/trillian-examples/serverless/log"
 
 	"github.com/golang/glog"
 	"github.com/google/trillian/merkle/rfc6962/hasher"
@@ -35,10 +38,14 @@ var (
 	storageDir = flag.String("storage_dir", "", "Root directory to store log data.")
 	entries    = flag.String("entries", "", "File path glob of entries to add to the log.")
 	create     = flag.Bool("create", false, "Set when creating a new log to initialise the structure.")
+
+	metricsListen   = flag.String("metrics_listen", "", "If set, the address on which to serve Prometheus metrics, e.g. localhost:8081.")
+	metricsTextfile = flag.String("metrics_textfile", "", "If set, the file to write Prometheus metrics to once sequencing completes, e.g. for use with the node_exporter textfile collector.")
 )
 
 func main() {
 	flag.Parse()
+	metrics.Init(*metricsListen)
 
 	toAdd, err := filepath.Glob(*entries)
 	if err != nil {
@@ -59,11 +66,11 @@ func main() {
 		if err != nil {
 			glog.Exitf("Failed to read log checkpoint: %q", err)
 		}
-		var cp *log.Checkpoint
+		var cp log.Checkpoint
 		if _, err := cp.Unmarshal(cpRaw); err != nil {
 			glog.Exitf("Failed to unmarshal checkpoint: %q", err)
 		}
-		st, err = fs.Load(*storageDir, cp)
+		st, err = fs.Load(*storageDir, &cp)
 	}
 	if err != nil {
 		glog.Exitf("Failed to initialise storage: %q", err)
@@ -93,9 +100,8 @@ func main() {
 
 	for entry := range entries {
 		// ask storage to sequence
-		lh := h.HashLeaf(entry.b)
 		dupe := false
-		seq, err := st.Sequence(lh, entry.b)
+		seq, err := serverlesslog.Sequence(st, h, entry.b)
 		if err != nil {
 			if errors.Is(err, storage.ErrDupeLeaf) {
 				dupe = true
@@ -109,4 +115,10 @@ func main() {
 		}
 		glog.Info(l)
 	}
+
+	if len(*metricsTextfile) > 0 {
+		if err := metrics.WriteTextfile(*metricsTextfile); err != nil {
+			glog.Exitf("Failed to write metrics: %q", err)
+		}
+	}
 }
@@ -16,6 +16,8 @@
 package integration
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"net"
@@ -26,9 +28,11 @@ import (
 
 	"github.com/golang/glog"
 	"github.com/google/trillian-examples/serverless/api"
-	"github.com/google/trillian-examples/serverless/internal/client"
-	"github.com/google/trillian-examples/serverless/internal/log"
-	"github.com/google/trillian-examples/serverless/internal/storage/fs"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/google/trillian-examples/serverless/layout"
+	"github.com/google/trillian-examples/serverless/log"
+	"github.com/google/trillian-examples/serverless/storage"
+	"github.com/google/trillian-examples/serverless/storage/fs"
 	"github.com/google/trillian/merkle/hashers"
 	"github.com/google/trillian/merkle/logverifier"
 	"github.com/google/trillian/merkle/rfc6962/hasher"
@@ -36,6 +40,8 @@ import (
 	fmtlog "github.com/google/trillian-examples/formats/log"
 )
 
+var benchLogSize = flag.Uint64("bench_log_size", 1<<20, "Size of the log to generate for benchmarks.")
+
 func RunIntegration(t *testing.T, s log.Storage, f client.FetcherFunc) {
 	lh := hasher.DefaultHasher
 	lv := logverifier.New(lh)
@@ -201,3 +207,153 @@ func httpFetcher(t *testing.T, u string) client.FetcherFunc {
 		return ioutil.ReadAll(resp.Body)
 	}
 }
+
+func TestShardRollover(t *testing.T) {
+	lh := hasher.DefaultHasher
+	dir := t.TempDir()
+
+	// Create a log with some entries in it.
+	first, err := fs.Create(filepath.Join(dir, "first"), lh.EmptyRoot())
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	sequenceNLeaves(t, first, lh, 0, 10)
+	final, err := log.Integrate(first, lh)
+	if err != nil {
+		t.Fatalf("Integrate = %v", err)
+	}
+	final.Ecosystem = api.CheckpointHeaderV0
+
+	// Create its successor, then close it.
+	second, err := fs.Create(filepath.Join(dir, "second"), lh.EmptyRoot())
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	succSI := api.ShardInfo{Predecessor: &api.Predecessor{Size: final.Size, Hash: final.Hash}}
+	succCP := fmtlog.Checkpoint{Ecosystem: api.CheckpointHeaderV0, Hash: lh.EmptyRoot()}
+	if err := second.WriteCheckpoint(append(succCP.Marshal(), mustMarshalShardInfo(t, succSI)...)); err != nil {
+		t.Fatalf("Failed to write successor checkpoint: %q", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "first", layout.SuccessorPath), []byte("../second"), 0644); err != nil {
+		t.Fatalf("Failed to write successor location: %q", err)
+	}
+	if err := first.MarkClosed(); err != nil {
+		t.Fatalf("MarkClosed = %v", err)
+	}
+	closedSI := api.ShardInfo{Closed: true}
+	if err := first.WriteCheckpoint(append(final.Marshal(), mustMarshalShardInfo(t, closedSI)...)); err != nil {
+		t.Fatalf("Failed to write final checkpoint: %q", err)
+	}
+
+	// The closed log must not accept further entries.
+	c := []byte("too late")
+	if _, err := first.Sequence(lh.HashLeaf(c), c); !errors.Is(err, storage.ErrLogClosed) {
+		t.Errorf("Sequence on closed log = %v, want ErrLogClosed", err)
+	}
+
+	root, err := url.Parse(fmt.Sprintf("file://%s/", filepath.Join(dir, "first")))
+	if err != nil {
+		t.Fatalf("Failed to create root URL: %q", err)
+	}
+	shards, err := client.FollowShards(root, fileFetcher, 10)
+	if err != nil {
+		t.Fatalf("FollowShards = %v", err)
+	}
+	if got, want := len(shards), 2; got != want {
+		t.Fatalf("Got %d shards, want %d", got, want)
+	}
+	if !shards[0].Info.Closed || shards[1].Info.Closed {
+		t.Errorf("Got closed states %t, %t, want true, false", shards[0].Info.Closed, shards[1].Info.Closed)
+	}
+
+	// A successor which doesn't follow on from the closed log must be spotted.
+	succSI.Predecessor.Size++
+	if err := second.WriteCheckpoint(append(succCP.Marshal(), mustMarshalShardInfo(t, succSI)...)); err != nil {
+		t.Fatalf("Failed to write successor checkpoint: %q", err)
+	}
+	if _, err := client.FollowShards(root, fileFetcher, 10); !errors.Is(err, client.ErrBrokenShardChain) {
+		t.Errorf("FollowShards = %v, want ErrBrokenShardChain", err)
+	}
+}
+
+func mustMarshalShardInfo(t *testing.T, si api.ShardInfo) []byte {
+	t.Helper()
+	b, err := si.Marshal()
+	if err != nil {
+		t.Fatalf("Failed to marshal shard info: %q", err)
+	}
+	return b
+}
+
+// fileFetcher returns a FetcherFunc which reads files relative to the
+// file:// URL root.
+func fileFetcher(root *url.URL) client.FetcherFunc {
+	return func(p string) ([]byte, error) {
+		u, err := root.Parse(p)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.ReadFile(u.Path)
+	}
+}
+
+// benchmarkLog generates a log of size n, and returns its checkpoint along
+// with a FetcherFunc for reading it.
+func benchmarkLog(b *testing.B, n uint64) (*fmtlog.Checkpoint, client.FetcherFunc) {
+	b.Helper()
+	h := hasher.DefaultHasher
+	root := filepath.Join(b.TempDir(), "log")
+	st, err := fs.Create(root, h.EmptyRoot())
+	if err != nil {
+		b.Fatalf("Create = %v", err)
+	}
+	cp, err := log.Populate(st, h, n, func(i uint64) []byte {
+		return []byte(fmt.Sprintf("Benchmark leaf %d", i))
+	})
+	if err != nil {
+		b.Fatalf("Populate = %v", err)
+	}
+	return cp, fileFetcher(&url.URL{Scheme: "file", Path: root + "/"})
+}
+
+// BenchmarkProofBuilder measures building proofs with a fresh ProofBuilder,
+// and so a cold tile cache, each time.
+func BenchmarkProofBuilder(b *testing.B) {
+	cp, f := benchmarkLog(b, *benchLogSize)
+	h := hasher.DefaultHasher
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pb, err := client.NewProofBuilder(*cp, h.HashChildren, f)
+		if err != nil {
+			b.Fatalf("NewProofBuilder = %v", err)
+		}
+		idx := uint64(i) * 7919 % cp.Size
+		if _, err := pb.InclusionProof(idx); err != nil {
+			b.Fatalf("InclusionProof(%d) = %v", idx, err)
+		}
+		if _, err := pb.ConsistencyProof(idx+1, cp.Size); err != nil {
+			b.Fatalf("ConsistencyProof(%d, %d) = %v", idx+1, cp.Size, err)
+		}
+	}
+}
+
+// BenchmarkProofBuilderCached measures building proofs with a single
+// ProofBuilder, so tiles are served from its cache once they've been fetched.
+func BenchmarkProofBuilderCached(b *testing.B) {
+	cp, f := benchmarkLog(b, *benchLogSize)
+	h := hasher.DefaultHasher
+	pb, err := client.NewProofBuilder(*cp, h.HashChildren, f)
+	if err != nil {
+		b.Fatalf("NewProofBuilder = %v", err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		idx := uint64(i) * 7919 % cp.Size
+		if _, err := pb.InclusionProof(idx); err != nil {
+			b.Fatalf("InclusionProof(%d) = %v", idx, err)
+		}
+		if _, err := pb.ConsistencyProof(idx+1, cp.Size); err != nil {
+			b.Fatalf("ConsistencyProof(%d, %d) = %v", idx+1, cp.Size, err)
+		}
+	}
+}
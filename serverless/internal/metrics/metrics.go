@@ -0,0 +1,55 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics provides support for exporting the metrics recorded by the
+// serverless log tooling to Prometheus.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian-examples/serverless/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	prom "github.com/google/trillian/monitoring/prometheus"
+)
+
+// Init configures the log tooling to record its metrics with Prometheus.
+//
+// If listenAddr is non-empty, the metrics will also be served over HTTP on
+// the /metrics path at that address for as long as the process is running.
+func Init(listenAddr string) {
+	log.InitMetrics(prom.MetricFactory{})
+	if len(listenAddr) == 0 {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	go func() {
+		glog.Infof("Serving metrics on %s", listenAddr)
+		if err := http.ListenAndServe(listenAddr, mux); err != nil {
+			glog.Errorf("Metrics server on %s stopped: %q", listenAddr, err)
+		}
+	}()
+}
+
+// WriteTextfile writes the current values of all metrics to the named file
+// using the Prometheus text exposition format, so that they can be picked up
+// by e.g. the node_exporter textfile collector once a job has completed.
+// The file is replaced atomically.
+func WriteTextfile(path string) error {
+	return prometheus.WriteToTextfile(path, prometheus.DefaultGatherer)
+}
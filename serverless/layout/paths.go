@@ -29,6 +29,15 @@ import (
 const (
 	// CheckpointPath is the location of the file containing the log checkpoint.
 	CheckpointPath = "checkpoint"
+
+	// SuccessorPath is the location of the file containing the URL of the log
+	// which succeeds this one, once this log has been closed.
+	SuccessorPath = "successor"
+
+	// ClosedPath is the location of the file which marks the log as closed to
+	// new entries. It's written before the log's final checkpoint, so that no
+	// entries can be sequenced after the final integration.
+	ClosedPath = "closed"
 )
 
 // SeqPath builds the directory path and relative filename for the entry at the given
@@ -17,14 +17,16 @@
 package log
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/google/trillian-examples/formats/log"
 	"github.com/google/trillian-examples/serverless/api"
-	"github.com/google/trillian-examples/serverless/internal/client"
-	"github.com/google/trillian-examples/serverless/internal/layout"
+	"github.com/google/trillian-examples/serverless/client"
+	"github.com/google/trillian-examples/serverless/layout"
 	"github.com/google/trillian/merkle/compact"
 	"github.com/google/trillian/merkle/hashers"
 )
@@ -34,6 +36,10 @@ type Storage interface {
 	// GetTile returns the tile at the given level & index.
 	GetTile(level, index, logSize uint64) (*api.Tile, error)
 
+	// PartialTileSizes returns the sizes of all partial tiles stored at the
+	// given level & index, in ascending order.
+	PartialTileSizes(level, index uint64) ([]uint64, error)
+
 	// StoreTile stores the tile at the given level & index.
 	StoreTile(level, index uint64, tile *api.Tile) error
 
@@ -53,17 +59,26 @@ type Storage interface {
 	// If a duplicate leaf is sequenced the storage implementation may return
 	// the sequence number associated with an earlier instance, along with a
 	// os.ErrDupeLeaf error.
+	// If the log has been closed, storage.ErrLogClosed should be returned.
 	Sequence(leafhash []byte, leaf []byte) (uint64, error)
 }
 
 // Integrate adds sequenced but not-yet-included entries into the tree.
 // Returns an updated Checkpoint, or an error.
 func Integrate(st Storage, h hashers.LogHasher) (*log.Checkpoint, error) {
+	InitMetrics(nil)
+	defer func(start time.Time) {
+		integrateDuration.Observe(time.Since(start).Seconds())
+	}(time.Now())
+
 	rf := compact.RangeFactory{Hash: h.HashChildren}
 
 	// Fetch previously stored state
 	checkpoint := st.Checkpoint()
-	nc := client.NewNodeCache(st.GetTile)
+	getTile := func(l, i, s uint64) (*api.Tile, error) {
+		return GetTile(st, l, i, s)
+	}
+	nc := client.NewNodeCache(getTile)
 	hashes, err := client.FetchRangeNodes(checkpoint.Size, &nc)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch compact range nodes: %w", err)
@@ -80,11 +95,12 @@ func Integrate(st Storage, h hashers.LogHasher) (*log.Checkpoint, error) {
 	}
 
 	glog.Infof("Loaded state with roothash %x", r)
+	treeSize.Set(float64(checkpoint.Size))
 
 	// Create a new compact range which represents the update to the tree
 	newRange := rf.NewEmptyRange(checkpoint.Size)
-	tc := tileCache{m: make(map[tileKey]*api.Tile), getTile: func(l, i uint64) (*api.Tile, error) {
-		return st.GetTile(l, i, checkpoint.Size)
+	tc := &tileCache{m: make(map[tileKey]*api.Tile), getTile: func(l, i uint64) (*api.Tile, error) {
+		return getTile(l, i, checkpoint.Size)
 	}}
 	n, err := st.ScanSequenced(checkpoint.Size,
 		func(seq uint64, entry []byte) error {
@@ -93,7 +109,7 @@ func Integrate(st Storage, h hashers.LogHasher) (*log.Checkpoint, error) {
 			tc.Visit(compact.NodeID{Level: 0, Index: seq}, lh)
 			// Update range and set internal nodes
 			newRange.Append(lh, tc.Visit)
-			return nil
+			return tc.err
 		})
 	if err != nil {
 		return nil, fmt.Errorf("error while integrating: %w", err)
@@ -108,6 +124,9 @@ func Integrate(st Storage, h hashers.LogHasher) (*log.Checkpoint, error) {
 	if err := baseRange.AppendRange(newRange, tc.Visit); err != nil {
 		return nil, fmt.Errorf("failed to merge new range onto existing log: %w", err)
 	}
+	if tc.err != nil {
+		return nil, fmt.Errorf("failed to merge new range onto existing log: %w", tc.err)
+	}
 
 	// Calculate the new root hash - don't pass in the tileCache visitor here since
 	// this will construct any emphemeral nodes and we do not want to store those.
@@ -124,7 +143,9 @@ func Integrate(st Storage, h hashers.LogHasher) (*log.Checkpoint, error) {
 		if err := st.StoreTile(k.level, k.index, t); err != nil {
 			return nil, fmt.Errorf("failed to store tile at level %d index %d: %w", k.level, k.index, err)
 		}
+		tilesWritten.Inc()
 	}
+	treeSize.Set(float64(baseRange.End()))
 
 	// Finally, return a new checkpoint struct to the caller, so they can sign &
 	// persist it.
@@ -141,6 +162,64 @@ func Integrate(st Storage, h hashers.LogHasher) (*log.Checkpoint, error) {
 	return &newCP, nil
 }
 
+// GetTile returns the tile at the given level & index for a tree of logSize
+// entries.
+//
+// If the expected partial tile is not present in storage, which can happen if
+// a previous integration was interrupted and the stored tiles and checkpoint
+// are out of step, the smallest larger version of the tile which is present
+// will be returned instead. This is safe since nodes are never changed once
+// they have been written, so larger versions of a tile contain all of the
+// nodes in the smaller ones.
+func GetTile(st Storage, level, index, logSize uint64) (*api.Tile, error) {
+	t, err := st.GetTile(level, index, logSize)
+	if !errors.Is(err, os.ErrNotExist) {
+		return t, err
+	}
+	want := layout.PartialTileSize(level, index, logSize)
+	if want == 0 {
+		// There's no larger version of a full tile.
+		return nil, err
+	}
+	sizes, lErr := st.PartialTileSizes(level, index)
+	if lErr != nil {
+		return nil, ErrTile{Level: level, Index: index, Wrapped: lErr}
+	}
+	// Finally try the full tile, represented here as size 256.
+	for _, s := range append(sizes, 256) {
+		if s <= want {
+			continue
+		}
+		// Request the tile as though the tree was just large enough to
+		// contain a tile of size s.
+		t, sErr := st.GetTile(level, index, ((index<<8)+s)<<(level*8))
+		if errors.Is(sErr, os.ErrNotExist) {
+			continue
+		}
+		if sErr == nil {
+			glog.Warningf("Tile at level %d index %d with size %d not found, using size %d", level, index, want, s)
+		}
+		return t, sErr
+	}
+	return nil, err
+}
+
+// ErrTile is returned when a tile needed to update the tree could not be
+// retrieved from storage.
+type ErrTile struct {
+	Level   uint64
+	Index   uint64
+	Wrapped error
+}
+
+func (e ErrTile) Unwrap() error {
+	return e.Wrapped
+}
+
+func (e ErrTile) Error() string {
+	return fmt.Sprintf("failed to get tile at level %d index %d: %s", e.Level, e.Index, e.Wrapped)
+}
+
 // tileKey is a level/index key for the tile cache below.
 type tileKey struct {
 	level uint64
@@ -159,6 +238,10 @@ type tileCache struct {
 	m map[tileKey]*api.Tile
 
 	getTile func(level, index uint64) (*api.Tile, error)
+
+	// err holds the first error encountered by Visit, since the visitor
+	// function signature provides no way to return it directly.
+	err error
 }
 
 // Visit should be called once for each newly set non-ephemeral node in the
@@ -167,7 +250,13 @@ type tileCache struct {
 // If the tile containing id has not been seen before, this method will fetch
 // it from disk (or create a new empty in-memory tile if it doesn't exist), and
 // update it by setting the node corresponding to id to the value hash.
-func (tc tileCache) Visit(id compact.NodeID, hash []byte) {
+//
+// If the tile can't be fetched, the error is stored in tc.err and this and
+// all subsequent calls to Visit will have no effect.
+func (tc *tileCache) Visit(id compact.NodeID, hash []byte) {
+	if tc.err != nil {
+		return
+	}
 	tileLevel, tileIndex, nodeLevel, nodeIndex := layout.NodeCoordsToTileAddress(uint64(id.Level), uint64(id.Index))
 	tileKey := tileKey{level: tileLevel, index: tileIndex}
 	tile := tc.m[tileKey]
@@ -177,8 +266,9 @@ func (tc tileCache) Visit(id compact.NodeID, hash []byte) {
 		created := false
 		tile, err = tc.getTile(tileLevel, tileIndex)
 		if err != nil {
-			if !os.IsNotExist(err) {
-				panic(err)
+			if !errors.Is(err, os.ErrNotExist) {
+				tc.err = ErrTile{Level: tileLevel, Index: tileIndex, Wrapped: err}
+				return
 			}
 			// This is a brand new tile.
 			created = true
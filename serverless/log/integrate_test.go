@@ -0,0 +1,92 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/storage/fs"
+	"github.com/google/trillian/merkle/rfc6962/hasher"
+)
+
+// brokenStorage is a Storage implementation whose GetTile always fails.
+type brokenStorage struct {
+	*fs.Storage
+}
+
+func (brokenStorage) GetTile(level, index, logSize uint64) (*api.Tile, error) {
+	return nil, errors.New("bang")
+}
+
+func sequenceN(t *testing.T, st Storage, start, n int) {
+	t.Helper()
+	for i := start; i < start+n; i++ {
+		if _, err := Sequence(st, hasher.DefaultHasher, []byte(fmt.Sprintf("leaf %d", i))); err != nil {
+			t.Fatalf("Sequence = %v", err)
+		}
+	}
+}
+
+func TestIntegrateTileError(t *testing.T) {
+	st, err := fs.Create(filepath.Join(t.TempDir(), "log"), hasher.DefaultHasher.EmptyRoot())
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	sequenceN(t, st, 0, 10)
+
+	_, err = Integrate(brokenStorage{st}, hasher.DefaultHasher)
+	var tErr ErrTile
+	if !errors.As(err, &tErr) {
+		t.Fatalf("Integrate = %v, want ErrTile", err)
+	}
+}
+
+func TestGetTileFallsBackToLargerTile(t *testing.T) {
+	st, err := fs.Create(filepath.Join(t.TempDir(), "log"), hasher.DefaultHasher.EmptyRoot())
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	sequenceN(t, st, 0, 10)
+	if _, err := Integrate(st, hasher.DefaultHasher); err != nil {
+		t.Fatalf("Integrate = %v", err)
+	}
+
+	// There is no tile for a tree of size 5, but the one for size 10 should
+	// be returned in its place.
+	if _, err := st.GetTile(0, 0, 5); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("fs.GetTile = %v, want not exist", err)
+	}
+	tile, err := GetTile(st, 0, 0, 5)
+	if err != nil {
+		t.Fatalf("GetTile = %v", err)
+	}
+	if got, want := tile.NumLeaves, uint(10); got != want {
+		t.Errorf("GetTile returned tile with %d leaves, want %d", got, want)
+	}
+
+	// There's nothing larger than a full tile to fall back to.
+	if _, err := GetTile(st, 0, 0, 256); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("GetTile = %v, want not exist", err)
+	}
+	// Nor anything to use for a tile larger than any stored.
+	if _, err := GetTile(st, 0, 0, 11); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("GetTile = %v, want not exist", err)
+	}
+}
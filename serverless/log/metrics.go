@@ -0,0 +1,59 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/trillian/monitoring"
+)
+
+var (
+	metricsOnce sync.Once
+
+	entriesSequenced  monitoring.Counter
+	entriesDuplicate  monitoring.Counter
+	integrateDuration monitoring.Histogram
+	tilesWritten      monitoring.Counter
+	treeSize          monitoring.Gauge
+	checkpointAge     monitoring.Gauge
+)
+
+// InitMetrics sets up the metrics reported by the log tooling using the
+// provided MetricFactory.
+// Only the first call has any effect, so callers wishing to export metrics
+// must call this before using any other functions in this package. If it's
+// never called, metrics are recorded to an inert factory and discarded.
+func InitMetrics(mf monitoring.MetricFactory) {
+	metricsOnce.Do(func() {
+		if mf == nil {
+			mf = monitoring.InertMetricFactory{}
+		}
+		entriesSequenced = mf.NewCounter("serverless_entries_sequenced", "Number of new entries assigned a sequence number")
+		entriesDuplicate = mf.NewCounter("serverless_entries_duplicate", "Number of entries found to have been sequenced previously")
+		integrateDuration = mf.NewHistogramWithBuckets("serverless_integrate_duration", "Time taken to integrate sequenced entries, in seconds", monitoring.ExpBuckets(0.01, 2, 16))
+		tilesWritten = mf.NewCounter("serverless_tiles_written", "Number of tiles written to storage")
+		treeSize = mf.NewGauge("serverless_tree_size", "Size of the most recently integrated tree")
+		checkpointAge = mf.NewGauge("serverless_checkpoint_age", "Age of the stored checkpoint when last inspected, in seconds")
+	})
+}
+
+// RecordCheckpointAge reports how long ago the stored checkpoint was last
+// updated.
+func RecordCheckpointAge(age time.Duration) {
+	InitMetrics(nil)
+	checkpointAge.Set(age.Seconds())
+}
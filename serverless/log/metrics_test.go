@@ -0,0 +1,117 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/storage"
+	"github.com/google/trillian-examples/serverless/storage/fs"
+	"github.com/google/trillian/merkle/rfc6962/hasher"
+	"github.com/google/trillian/monitoring"
+	"github.com/google/trillian/monitoring/testonly"
+)
+
+func TestMain(m *testing.M) {
+	// Metrics can only be initialised once, so this must happen before any
+	// test uses the package. The inert factory keeps values in memory.
+	InitMetrics(monitoring.InertMetricFactory{})
+	os.Exit(m.Run())
+}
+
+func TestMetrics(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "log")
+	st, err := fs.Create(root, hasher.DefaultHasher.EmptyRoot())
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+
+	for _, step := range []struct {
+		desc         string
+		start, n     int
+		wantNew      float64
+		wantDupes    float64
+		wantTiles    float64
+		wantTreeSize float64
+	}{
+		{
+			desc:         "first entries",
+			start:        0,
+			n:            10,
+			wantNew:      10,
+			wantTiles:    1,
+			wantTreeSize: 10,
+		}, {
+			desc:         "some duplicates",
+			start:        5,
+			n:            300,
+			wantNew:      295,
+			wantDupes:    5,
+			wantTiles:    3,
+			wantTreeSize: 305,
+		}, {
+			desc:         "all duplicates",
+			start:        0,
+			n:            20,
+			wantDupes:    20,
+			wantTreeSize: 305,
+		},
+	} {
+		sequenced := testonly.NewCounterSnapshot(entriesSequenced)
+		dupes := testonly.NewCounterSnapshot(entriesDuplicate)
+		tiles := testonly.NewCounterSnapshot(tilesWritten)
+		integrations, _ := integrateDuration.Info()
+
+		for i := step.start; i < step.start+step.n; i++ {
+			if _, err := Sequence(st, hasher.DefaultHasher, []byte(fmt.Sprintf("leaf %d", i))); err != nil && !errors.Is(err, storage.ErrDupeLeaf) {
+				t.Fatalf("%s: Sequence = %v", step.desc, err)
+			}
+		}
+		cp, err := Integrate(st, hasher.DefaultHasher)
+		if err != nil {
+			t.Fatalf("%s: Integrate = %v", step.desc, err)
+		}
+		if cp != nil {
+			cp.Ecosystem = api.CheckpointHeaderV0
+			if err := st.WriteCheckpoint(cp.Marshal()); err != nil {
+				t.Fatalf("%s: WriteCheckpoint = %v", step.desc, err)
+			}
+			if st, err = fs.Load(root, cp); err != nil {
+				t.Fatalf("%s: Load = %v", step.desc, err)
+			}
+		}
+
+		if got, want := sequenced.Delta(), step.wantNew; got != want {
+			t.Errorf("%s: sequenced %v entries, want %v", step.desc, got, want)
+		}
+		if got, want := dupes.Delta(), step.wantDupes; got != want {
+			t.Errorf("%s: got %v duplicates, want %v", step.desc, got, want)
+		}
+		if got, want := tiles.Delta(), step.wantTiles; got != want {
+			t.Errorf("%s: wrote %v tiles, want %v", step.desc, got, want)
+		}
+		if got, want := treeSize.Value(), step.wantTreeSize; got != want {
+			t.Errorf("%s: got tree size %v, want %v", step.desc, got, want)
+		}
+		if got, _ := integrateDuration.Info(); got != integrations+1 {
+			t.Errorf("%s: got %d integrations, want %d", step.desc, got, integrations+1)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/google/trillian-examples/formats/log"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/layout"
+	"github.com/google/trillian/merkle/compact"
+	"github.com/google/trillian/merkle/hashers"
+)
+
+// Populate builds the tree structure for a log containing n entries, whose
+// contents are returned by calling leaf with each index in turn, and stores
+// the resulting tiles in the empty log st.
+//
+// This is intended for quickly creating large logs for testing and
+// benchmarking: the entries are neither sequenced nor stored, so only the
+// tiles are written, and the entries' leafhash->index mappings are not
+// available.
+// Returns the Checkpoint for the populated log, which the caller should
+// persist.
+func Populate(st Storage, h hashers.LogHasher, n uint64, leaf func(index uint64) []byte) (*log.Checkpoint, error) {
+	if s := st.Checkpoint().Size; s != 0 {
+		return nil, fmt.Errorf("log must be empty, but has size %d", s)
+	}
+	InitMetrics(nil)
+
+	// All of the tiles are being created from scratch, so there's no need to
+	// consult storage for existing ones.
+	tc := &tileCache{m: make(map[tileKey]*api.Tile), getTile: func(_, _ uint64) (*api.Tile, error) {
+		return nil, os.ErrNotExist
+	}}
+	var storeErr error
+	visit := func(id compact.NodeID, hash []byte) {
+		tc.Visit(id, hash)
+		if tc.err != nil || storeErr != nil {
+			return
+		}
+		// Setting the right-hand node in the top-most level of a tile means
+		// that tile is complete and will never change again, so it can be
+		// stored and evicted from the cache to keep memory usage bounded.
+		if id.Level%8 == 7 && id.Index%2 == 1 {
+			tileLevel, tileIndex, _, _ := layout.NodeCoordsToTileAddress(uint64(id.Level), id.Index)
+			k := tileKey{level: tileLevel, index: tileIndex}
+			if storeErr = st.StoreTile(tileLevel, tileIndex, tc.m[k]); storeErr != nil {
+				storeErr = fmt.Errorf("failed to store tile at level %d index %d: %w", tileLevel, tileIndex, storeErr)
+				return
+			}
+			tilesWritten.Inc()
+			delete(tc.m, k)
+		}
+	}
+
+	r := (&compact.RangeFactory{Hash: h.HashChildren}).NewEmptyRange(0)
+	for i := uint64(0); i < n; i++ {
+		lh := h.HashLeaf(leaf(i))
+		visit(compact.NodeID{Level: 0, Index: i}, lh)
+		if err := r.Append(lh, visit); err != nil {
+			return nil, fmt.Errorf("failed to append leaf %d: %w", i, err)
+		}
+		if tc.err != nil {
+			return nil, tc.err
+		}
+		if storeErr != nil {
+			return nil, storeErr
+		}
+	}
+
+	// Store the remaining partial tiles on the right-hand edge of the tree.
+	for k, t := range tc.m {
+		if err := st.StoreTile(k.level, k.index, t); err != nil {
+			return nil, fmt.Errorf("failed to store tile at level %d index %d: %w", k.level, k.index, err)
+		}
+		tilesWritten.Inc()
+	}
+
+	root := h.EmptyRoot()
+	if n > 0 {
+		var err error
+		if root, err = r.GetRootHash(nil); err != nil {
+			return nil, fmt.Errorf("failed to calculate root hash: %w", err)
+		}
+	}
+	treeSize.Set(float64(n))
+	return &log.Checkpoint{Size: n, Hash: root}, nil
+}
@@ -0,0 +1,151 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/trillian-examples/serverless/storage/fs"
+	"github.com/google/trillian/merkle/rfc6962/hasher"
+)
+
+var benchLogSize = flag.Uint64("bench_log_size", 1<<16, "Size of the log to generate for benchmarks.")
+
+func testLeaf(i uint64) []byte {
+	return []byte(fmt.Sprintf("leaf %d", i))
+}
+
+func TestPopulateMatchesIntegrate(t *testing.T) {
+	h := hasher.DefaultHasher
+	for _, n := range []uint64{0, 1, 255, 256, 257, 3*256 + 5} {
+		t.Run(fmt.Sprintf("size %d", n), func(t *testing.T) {
+			populated, err := fs.Create(filepath.Join(t.TempDir(), "populated"), h.EmptyRoot())
+			if err != nil {
+				t.Fatalf("Create = %v", err)
+			}
+			pCP, err := Populate(populated, h, n, testLeaf)
+			if err != nil {
+				t.Fatalf("Populate = %v", err)
+			}
+
+			integrated, err := fs.Create(filepath.Join(t.TempDir(), "integrated"), h.EmptyRoot())
+			if err != nil {
+				t.Fatalf("Create = %v", err)
+			}
+			sequenceN(t, integrated, 0, int(n))
+			iCP, err := Integrate(integrated, h)
+			if err != nil {
+				t.Fatalf("Integrate = %v", err)
+			}
+			if n == 0 {
+				// Integrate has nothing to do for an empty log.
+				if !bytes.Equal(pCP.Hash, h.EmptyRoot()) {
+					t.Errorf("Populate root %x, want empty root %x", pCP.Hash, h.EmptyRoot())
+				}
+				return
+			}
+			if diff := cmp.Diff(iCP, pCP); len(diff) != 0 {
+				t.Fatalf("Populate checkpoint differs from Integrate: %s", diff)
+			}
+
+			// The tiles on the right-hand edge of the tree are the most
+			// interesting, so compare those.
+			for level := uint64(0); n>>(level*8) > 0; level++ {
+				index := (n - 1) >> (level * 8) / 256
+				pt, err := populated.GetTile(level, index, n)
+				if err != nil {
+					t.Fatalf("GetTile(%d, %d) = %v", level, index, err)
+				}
+				it, err := integrated.GetTile(level, index, n)
+				if err != nil {
+					t.Fatalf("GetTile(%d, %d) = %v", level, index, err)
+				}
+				if diff := cmp.Diff(it, pt); len(diff) != 0 {
+					t.Errorf("Tile at level %d index %d differs: %s", level, index, diff)
+				}
+			}
+		})
+	}
+}
+
+func TestPopulateNonEmptyLog(t *testing.T) {
+	h := hasher.DefaultHasher
+	_, st := populatedLog(t, 10)
+	if _, err := Populate(st, h, 10, testLeaf); err == nil {
+		t.Error("Populate on non-empty log = nil, want error")
+	}
+}
+
+// populatedLog returns the root directory of, and a Storage for, a newly
+// generated log of size n.
+func populatedLog(t testing.TB, n uint64) (string, *fs.Storage) {
+	t.Helper()
+	h := hasher.DefaultHasher
+	root := filepath.Join(t.TempDir(), "log")
+	st, err := fs.Create(root, h.EmptyRoot())
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	cp, err := Populate(st, h, n, testLeaf)
+	if err != nil {
+		t.Fatalf("Populate = %v", err)
+	}
+	st, err = fs.Load(root, cp)
+	if err != nil {
+		t.Fatalf("Load = %v", err)
+	}
+	return root, st
+}
+
+func BenchmarkPopulate(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		populatedLog(b, *benchLogSize)
+	}
+}
+
+func BenchmarkIntegrate(b *testing.B) {
+	const batch = 1000
+	h := hasher.DefaultHasher
+	root, st := populatedLog(b, *benchLogSize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		start := st.Checkpoint().Size
+		for j := start; j < start+batch; j++ {
+			if _, err := Sequence(st, h, testLeaf(j)); err != nil {
+				b.Fatalf("Sequence = %v", err)
+			}
+		}
+		b.StartTimer()
+
+		cp, err := Integrate(st, h)
+		if err != nil {
+			b.Fatalf("Integrate = %v", err)
+		}
+
+		b.StopTimer()
+		// Storage doesn't track the checkpoint itself, so reload it with the
+		// new one.
+		if st, err = fs.Load(root, cp); err != nil {
+			b.Fatalf("Load = %v", err)
+		}
+		b.StartTimer()
+	}
+}
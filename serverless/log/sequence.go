@@ -0,0 +1,38 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"errors"
+
+	"github.com/google/trillian-examples/serverless/storage"
+	"github.com/google/trillian/merkle/hashers"
+)
+
+// Sequence asks the storage to assign a sequence number to the passed in
+// leaf.
+// Returns the assigned sequence number, along with storage.ErrDupeLeaf if the
+// leaf had already been sequenced.
+func Sequence(st Storage, h hashers.LogHasher, leaf []byte) (uint64, error) {
+	InitMetrics(nil)
+	seq, err := st.Sequence(h.HashLeaf(leaf), leaf)
+	switch {
+	case errors.Is(err, storage.ErrDupeLeaf):
+		entriesDuplicate.Inc()
+	case err == nil:
+		entriesSequenced.Inc()
+	}
+	return seq, err
+}
@@ -0,0 +1,148 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package buffered provides a log storage wrapper which holds all writes in
+// memory rather than passing them on to the underlying storage.
+package buffered
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/layout"
+	"github.com/google/trillian-examples/serverless/log"
+)
+
+// ErrReadOnly is returned by Sequence, since sequencing entries can't be
+// buffered.
+var ErrReadOnly = errors.New("sequencing not supported by buffered storage")
+
+// Storage wraps another log Storage implementation, serving reads from it but
+// holding any tiles and checkpoints written in memory.
+// This allows e.g. log.Integrate to be run against a log in order to see
+// what it would do, without modifying the log itself.
+//
+// The functions on this struct are not thread-safe.
+type Storage struct {
+	log.Storage
+
+	// tiles holds the tiles written via StoreTile.
+	tiles map[tileKey]*api.Tile
+	// checkpoint holds the last checkpoint written via WriteCheckpoint.
+	checkpoint []byte
+}
+
+// tileKey identifies a particular version of a tile.
+type tileKey struct {
+	level uint64
+	index uint64
+	size  uint64
+}
+
+// Tile is a tile which has been written to the buffer.
+type Tile struct {
+	Level uint64
+	Index uint64
+	Tile  *api.Tile
+}
+
+// New returns a Storage which reads from s, but buffers any writes.
+func New(s log.Storage) *Storage {
+	return &Storage{
+		Storage: s,
+		tiles:   make(map[tileKey]*api.Tile),
+	}
+}
+
+// GetTile returns the tile at the given level & index for a tree of logSize
+// entries, preferring any buffered tile over the underlying storage.
+func (s *Storage) GetTile(level, index, logSize uint64) (*api.Tile, error) {
+	if t, ok := s.tiles[tileKey{level: level, index: index, size: layout.PartialTileSize(level, index, logSize)}]; ok {
+		return t, nil
+	}
+	return s.Storage.GetTile(level, index, logSize)
+}
+
+// PartialTileSizes returns the sizes of all partial tiles at the given level &
+// index in either the underlying storage or the buffer, in ascending order.
+func (s *Storage) PartialTileSizes(level, index uint64) ([]uint64, error) {
+	sizes, err := s.Storage.PartialTileSizes(level, index)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[uint64]bool)
+	for _, sz := range sizes {
+		seen[sz] = true
+	}
+	for k := range s.tiles {
+		if k.level == level && k.index == index && k.size > 0 && !seen[k.size] {
+			sizes = append(sizes, k.size)
+		}
+	}
+	sort.Slice(sizes, func(i, j int) bool { return sizes[i] < sizes[j] })
+	return sizes, nil
+}
+
+// StoreTile buffers the tile in memory.
+func (s *Storage) StoreTile(level, index uint64, tile *api.Tile) error {
+	tileSize := uint64(tile.NumLeaves)
+	if tileSize == 0 || tileSize > 256 {
+		return fmt.Errorf("tileSize %d must be > 0 and <= 256", tileSize)
+	}
+	s.tiles[tileKey{level: level, index: index, size: tileSize % 256}] = tile
+	return nil
+}
+
+// WriteCheckpoint buffers the raw checkpoint in memory.
+func (s *Storage) WriteCheckpoint(newCPRaw []byte) error {
+	s.checkpoint = newCPRaw
+	return nil
+}
+
+// Sequence always returns ErrReadOnly.
+func (s *Storage) Sequence(leafhash []byte, leaf []byte) (uint64, error) {
+	return 0, ErrReadOnly
+}
+
+// Tiles returns the tiles which have been written to the buffer, ordered by
+// level, index, and size.
+func (s *Storage) Tiles() []Tile {
+	keys := make([]tileKey, 0, len(s.tiles))
+	for k := range s.tiles {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.level != b.level {
+			return a.level < b.level
+		}
+		if a.index != b.index {
+			return a.index < b.index
+		}
+		return s.tiles[a].NumLeaves < s.tiles[b].NumLeaves
+	})
+	ret := make([]Tile, 0, len(keys))
+	for _, k := range keys {
+		ret = append(ret, Tile{Level: k.level, Index: k.index, Tile: s.tiles[k]})
+	}
+	return ret
+}
+
+// PendingCheckpoint returns the last checkpoint written to the buffer, or nil
+// if none has been written.
+func (s *Storage) PendingCheckpoint() []byte {
+	return s.checkpoint
+}
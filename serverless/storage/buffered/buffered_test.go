@@ -0,0 +1,71 @@
+// Copyright 2021 Google LLC. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package buffered
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/trillian-examples/serverless/log"
+	"github.com/google/trillian-examples/serverless/storage/fs"
+	"github.com/google/trillian/merkle/rfc6962/hasher"
+)
+
+func TestIntegrateDoesNotModifyUnderlyingStorage(t *testing.T) {
+	h := hasher.DefaultHasher
+	root := filepath.Join(t.TempDir(), "log")
+	st, err := fs.Create(root, h.EmptyRoot())
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	for i := 0; i < 300; i++ {
+		if _, err := log.Sequence(st, h, []byte(fmt.Sprintf("leaf %d", i))); err != nil {
+			t.Fatalf("Sequence = %v", err)
+		}
+	}
+
+	b := New(st)
+	cp, err := log.Integrate(b, h)
+	if err != nil {
+		t.Fatalf("Integrate = %v", err)
+	}
+	if err := b.WriteCheckpoint(cp.Marshal()); err != nil {
+		t.Fatalf("WriteCheckpoint = %v", err)
+	}
+
+	if got, want := len(b.Tiles()), 3; got != want {
+		t.Errorf("Got %d buffered tiles, want %d", got, want)
+	}
+	if len(b.PendingCheckpoint()) == 0 {
+		t.Error("No checkpoint was buffered")
+	}
+	if _, err := b.GetTile(0, 1, cp.Size); err != nil {
+		t.Errorf("GetTile for buffered tile = %v", err)
+	}
+
+	// Nothing should have made it to disk.
+	if _, err := st.GetTile(0, 1, cp.Size); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("fs.GetTile = %v, want not exist", err)
+	}
+	if _, err := fs.ReadCheckpoint(root); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("ReadCheckpoint = %v, want not exist", err)
+	}
+	if _, err := b.Sequence([]byte("hash"), []byte("leaf")); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Sequence = %v, want ErrReadOnly", err)
+	}
+}
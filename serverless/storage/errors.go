@@ -21,3 +21,7 @@ import (
 // ErrDupeLeaf is returned by the Sequence method of storage implementations to
 // indicate that a leaf has already been sequenced.
 var ErrDupeLeaf = errors.New("duplicate leaf")
+
+// ErrLogClosed is returned by the Sequence method of storage implementations to
+// indicate that the log has been closed and will accept no further entries.
+var ErrLogClosed = errors.New("log closed")
@@ -21,13 +21,15 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/golang/glog"
 	"github.com/google/trillian-examples/formats/log"
 	"github.com/google/trillian-examples/serverless/api"
-	"github.com/google/trillian-examples/serverless/internal/layout"
-	"github.com/google/trillian-examples/serverless/internal/storage"
+	"github.com/google/trillian-examples/serverless/layout"
+	"github.com/google/trillian-examples/serverless/storage"
 )
 
 const (
@@ -43,6 +45,7 @@ const (
 //  <rootDir>/seq/aa/bb/cc/ddeeff...
 //  <rootDir>/tile/<level>/aa/bb/ccddee...
 //  <rootDir>/checkpoint
+//  <rootDir>/closed
 //
 // The functions on this struct are not thread-safe.
 type Storage struct {
@@ -55,6 +58,8 @@ type Storage struct {
 	nextSeq uint64
 	// checkpoint is the latest known checkpoint of the log.
 	checkpoint log.Checkpoint
+	// closed is set once the log is known to be closed, which is permanent.
+	closed bool
 }
 
 const leavesPendingPathFmt = "leaves/pending/%0x"
@@ -118,12 +123,19 @@ func (fs *Storage) Checkpoint() log.Checkpoint {
 // Returns the sequence number assigned to this leaf (if the leaf has already
 // been sequenced it will return the original sequence number and
 // storage.ErrDupeLeaf).
+// If the log has been marked as closed, storage.ErrLogClosed is returned.
 func (fs *Storage) Sequence(leafhash []byte, leaf []byte) (uint64, error) {
 	// 1. Check for dupe leafhash
 	// 2. Write temp file
 	// 3. Hard link temp -> seq file
 	// 4. Create leafhash file containing assigned sequence number
 
+	if closed, err := fs.isClosed(); err != nil {
+		return 0, err
+	} else if closed {
+		return 0, storage.ErrLogClosed
+	}
+
 	// Ensure the leafhash directory structure is present
 	leafDir, leafFile := layout.LeafPath(fs.rootDir, leafhash)
 	if err := os.MkdirAll(leafDir, dirPerm); err != nil {
@@ -194,6 +206,36 @@ func (fs *Storage) Sequence(leafhash []byte, leaf []byte) (uint64, error) {
 	}
 }
 
+// MarkClosed marks the log as closed, after which Sequence will not accept
+// any more entries. Entries which have already been sequenced can still be
+// integrated, and the final checkpoint should then be written with the Closed
+// shard info.
+func (fs *Storage) MarkClosed() error {
+	err := createExclusive(filepath.Join(fs.rootDir, layout.ClosedPath), nil)
+	if err != nil && !errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("failed to mark log closed: %w", err)
+	}
+	fs.closed = true
+	return nil
+}
+
+// isClosed returns true if the log has been marked as closed.
+// The marker file is consulted until the log is found to be closed, since the
+// log may have been closed by another process.
+func (fs *Storage) isClosed() (bool, error) {
+	if fs.closed {
+		return true, nil
+	}
+	_, err := os.Stat(filepath.Join(fs.rootDir, layout.ClosedPath))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to stat closed marker: %w", err)
+	}
+	fs.closed = true
+	return true, nil
+}
+
 // createExclusive creates the named file before writing the data in d to it.
 // It will error if the file already exists, or it's unable to fully write the
 // data & close the file.
@@ -258,6 +300,29 @@ func (fs *Storage) GetTile(level, index, logSize uint64) (*api.Tile, error) {
 	return &tile, nil
 }
 
+// PartialTileSizes returns the sizes, in "tile leaves", of all partial tiles
+// stored at the given tile-level and tile-index, in ascending order.
+// Fully populated tiles are not included.
+func (fs *Storage) PartialTileSizes(level, index uint64) ([]uint64, error) {
+	tDir, tFile := layout.TilePath(fs.rootDir, level, index, 0)
+	partials, err := filepath.Glob(filepath.Join(tDir, fmt.Sprintf("%s.*", tFile)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list partial tiles: %w", err)
+	}
+	ret := make([]uint64, 0, len(partials))
+	for _, p := range partials {
+		sfx := strings.TrimPrefix(filepath.Base(p), tFile+".")
+		// Ignore any temporary files left behind by StoreTile.
+		ts, err := strconv.ParseUint(sfx, 16, 8)
+		if err != nil || ts == 0 {
+			continue
+		}
+		ret = append(ret, ts)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i] < ret[j] })
+	return ret, nil
+}
+
 // StoreTile writes a tile out to disk.
 // Fully populated tiles are stored at the path corresponding to the level &
 // index parameters, partially populated (i.e. right-hand edge) tiles are
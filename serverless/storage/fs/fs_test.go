@@ -24,7 +24,8 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/trillian-examples/formats/log"
-	"github.com/google/trillian-examples/serverless/internal/storage"
+	"github.com/google/trillian-examples/serverless/api"
+	"github.com/google/trillian-examples/serverless/storage"
 )
 
 func TestCreate(t *testing.T) {
@@ -148,3 +149,70 @@ func TestSequence(t *testing.T) {
 	}
 
 }
+
+func TestMarkClosed(t *testing.T) {
+	d := filepath.Join(t.TempDir(), "storage")
+	s, err := Create(d, []byte("empty"))
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	// Another process sequencing entries into the same log.
+	other, err := Load(d, &log.Checkpoint{})
+	if err != nil {
+		t.Fatalf("Load = %v", err)
+	}
+	sequence := func(st *Storage, leaf []byte) error {
+		h := sha256.Sum256(leaf)
+		_, err := st.Sequence(h[:], leaf)
+		return err
+	}
+	if err := sequence(other, []byte{0x00}); err != nil {
+		t.Fatalf("Sequence before closing = %v", err)
+	}
+
+	if err := s.MarkClosed(); err != nil {
+		t.Fatalf("MarkClosed = %v", err)
+	}
+	// Marking an already closed log is fine, e.g. when retrying a rollover.
+	if err := s.MarkClosed(); err != nil {
+		t.Fatalf("MarkClosed again = %v", err)
+	}
+	for _, st := range []*Storage{s, other} {
+		if err := sequence(st, []byte{0x01}); !errors.Is(err, storage.ErrLogClosed) {
+			t.Errorf("Sequence after closing = %v, want ErrLogClosed", err)
+		}
+	}
+}
+
+func TestPartialTileSizes(t *testing.T) {
+	d := filepath.Join(t.TempDir(), "storage")
+	s, err := Create(d, []byte("empty"))
+	if err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+	for _, n := range []uint{0x03, 0x10, 0x01} {
+		if err := s.StoreTile(1, 2, &api.Tile{NumLeaves: n}); err != nil {
+			t.Fatalf("StoreTile(%d) = %v", n, err)
+		}
+	}
+	// Tiles at other locations must not be reported.
+	if err := s.StoreTile(1, 3, &api.Tile{NumLeaves: 0x20}); err != nil {
+		t.Fatalf("StoreTile = %v", err)
+	}
+
+	got, err := s.PartialTileSizes(1, 2)
+	if err != nil {
+		t.Fatalf("PartialTileSizes = %v", err)
+	}
+	if diff := cmp.Diff(got, []uint64{0x01, 0x03, 0x10}); len(diff) != 0 {
+		t.Errorf("PartialTileSizes had diff %s", diff)
+	}
+
+	got, err = s.PartialTileSizes(0, 0)
+	if err != nil {
+		t.Fatalf("PartialTileSizes = %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("PartialTileSizes for missing tile = %v, want none", got)
+	}
+}
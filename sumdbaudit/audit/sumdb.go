@@ -21,6 +21,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/google/trillian-examples/formats/log"
 	"golang.org/x/mod/sumdb/note"
 	"golang.org/x/mod/sumdb/tlog"
 )
@@ -84,15 +85,9 @@ func (c *SumDBClient) ParseCheckpointNote(checkpoint []byte) (*Checkpoint, error
 	if err != nil {
 		return nil, fmt.Errorf("failed to create verifier: %w", err)
 	}
-	verifiers := note.VerifierList(verifier)
-
-	note, err := note.Open(checkpoint, verifiers)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open note: %w", err)
-	}
-	tree, err := tlog.ParseTree([]byte(note.Text))
+	_, tree, err := log.ParseSumDBCheckpoint(checkpoint, verifier)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse tree: %w", err)
+		return nil, fmt.Errorf("failed to parse checkpoint: %w", err)
 	}
 
 	return &Checkpoint{Tree: &tree, Raw: checkpoint}, nil